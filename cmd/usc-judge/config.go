@@ -0,0 +1,82 @@
+package main
+
+import (
+	"encoding/json"
+	"io/ioutil"
+	"os"
+	"time"
+)
+
+// Config is read from a JSON file. Anything left out of the file keeps its
+// value from defaultConfig.
+type Config struct {
+	// The bolt database file
+	DB string `json:"db"`
+	// Where the caller API and the peer API listen
+	CallerAddress string `json:"callerAddress"`
+	PeerAddress   string `json:"peerAddress"`
+	// "http" or "grpc", for the peer API. Peers must use the same transport to
+	// talk to the judge.
+	Transport string `json:"transport"`
+	// If SignerSocket is set, the Judges are signed for by the usc-signer
+	// listening on it, instead of the keystore in the database.
+	SignerSocket  string   `json:"signerSocket"`
+	SignerTimeout Duration `json:"signerTimeout"`
+
+	// How often logic.Scheduler looks for channels to finalize
+	SchedulerInterval Duration `json:"schedulerInterval"`
+	// How often logic.Webhooks looks for webhooks to deliver
+	WebhookInterval Duration `json:"webhookInterval"`
+}
+
+var defaultConfig = Config{
+	DB:                "usc-judge.db",
+	CallerAddress:     "localhost:4457",
+	PeerAddress:       ":4459",
+	Transport:         "http",
+	SignerTimeout:     Duration(10 * time.Second),
+	SchedulerInterval: Duration(10 * time.Second),
+	WebhookInterval:   Duration(5 * time.Second),
+}
+
+// Duration is a time.Duration written as a string, like "1m30s".
+type Duration time.Duration
+
+func (d Duration) MarshalJSON() ([]byte, error) {
+	return json.Marshal(time.Duration(d).String())
+}
+
+func (d *Duration) UnmarshalJSON(b []byte) error {
+	var s string
+	err := json.Unmarshal(b, &s)
+	if err != nil {
+		return err
+	}
+
+	parsed, err := time.ParseDuration(s)
+	if err != nil {
+		return err
+	}
+	*d = Duration(parsed)
+	return nil
+}
+
+// readConfig reads the config file at path. If there is no file, the
+// defaults are used.
+func readConfig(path string) (*Config, error) {
+	cfg := defaultConfig
+
+	b, err := ioutil.ReadFile(path)
+	if os.IsNotExist(err) {
+		return &cfg, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	err = json.Unmarshal(b, &cfg)
+	if err != nil {
+		return nil, err
+	}
+	return &cfg, nil
+}
@@ -0,0 +1,181 @@
+// Command usc-judge runs a judge. It serves the caller API over HTTP to the
+// judge's operators, and the peer API to the peers of its channels, and
+// finalizes channels whose hold period is over, and delivers its webhooks.
+//
+//	usc-judge -config usc-judge.json
+//
+// See Config for the config file. The keystore in the database starts out
+// locked, and must be unlocked through the caller API's /unlock before
+// anything can be signed, unless signerSocket is set.
+package main
+
+import (
+	"context"
+	"flag"
+	"log"
+	"net"
+	"net/http"
+	"os"
+	"os/signal"
+	"sync"
+	"syscall"
+	"time"
+
+	"github.com/boltdb/bolt"
+	"github.com/jtremback/usc/core/keystore"
+	"github.com/jtremback/usc/core/signer"
+	"github.com/jtremback/usc/judge/access"
+	"github.com/jtremback/usc/judge/logic"
+	"github.com/jtremback/usc/judge/servers"
+	"google.golang.org/grpc"
+)
+
+func main() {
+	path := flag.String("config", "usc-judge.json", "config file")
+	flag.Parse()
+
+	cfg, err := readConfig(*path)
+	if err != nil {
+		log.Fatal("could not read config: ", err)
+	}
+	if cfg.Transport != "http" && cfg.Transport != "grpc" {
+		log.Fatal("unknown transport ", cfg.Transport)
+	}
+
+	db, err := bolt.Open(cfg.DB, 0600, &bolt.Options{Timeout: time.Second})
+	if err != nil {
+		log.Fatal(err)
+	}
+	defer db.Close()
+
+	err = access.MakeBuckets(db)
+	if err != nil {
+		log.Fatal(err)
+	}
+
+	ks, err := readKeystore(db)
+	if err != nil {
+		log.Fatal(err)
+	}
+
+	caller := &logic.CallerAPI{
+		DB:       db,
+		Keystore: ks,
+	}
+	var judgeSigner signer.Signer = ks
+	if cfg.SignerSocket != "" {
+		caller.Signer = &signer.Remote{
+			Path:    cfg.SignerSocket,
+			Timeout: time.Duration(cfg.SignerTimeout),
+		}
+		judgeSigner = caller.Signer
+	}
+
+	peer := &logic.PeerAPI{
+		DB:     db,
+		Signer: judgeSigner,
+	}
+
+	callerMux := http.NewServeMux()
+	(&servers.CallerHTTP{Logic: caller}).MountRoutes(callerMux)
+	callerSrv := serveHTTP(cfg.CallerAddress, callerMux)
+	log.Println("caller API listening on", cfg.CallerAddress)
+
+	var stopPeer func()
+	if cfg.Transport == "grpc" {
+		s := grpc.NewServer()
+		(&servers.PeerGRPC{Logic: peer}).Register(s)
+		serveGRPC(cfg.PeerAddress, s)
+		stopPeer = s.GracefulStop
+	} else {
+		mux := http.NewServeMux()
+		(&servers.PeerHTTP{Logic: peer}).MountRoutes(mux)
+		srv := serveHTTP(cfg.PeerAddress, mux)
+		stopPeer = func() { shutdown(srv) }
+	}
+	log.Println("peer API listening on", cfg.PeerAddress, "over", cfg.Transport)
+
+	scheduler := &logic.Scheduler{
+		DB:       db,
+		Signer:   judgeSigner,
+		Interval: time.Duration(cfg.SchedulerInterval),
+	}
+	webhooks := &logic.Webhooks{
+		DB:       db,
+		Signer:   judgeSigner,
+		Interval: time.Duration(cfg.WebhookInterval),
+	}
+	stop := make(chan struct{})
+	var wg sync.WaitGroup
+	wg.Add(2)
+	go func() {
+		scheduler.Run(stop)
+		wg.Done()
+	}()
+	go func() {
+		webhooks.Run(stop)
+		wg.Done()
+	}()
+
+	sigs := make(chan os.Signal, 1)
+	signal.Notify(sigs, syscall.SIGINT, syscall.SIGTERM)
+	<-sigs
+	log.Println("shutting down")
+
+	// Stop taking requests first, so that nothing is half done when the
+	// database is closed.
+	shutdown(callerSrv)
+	stopPeer()
+	close(stop)
+	wg.Wait()
+	caller.Lock()
+}
+
+// readKeystore gets the keystore from the database, or makes a new one.
+func readKeystore(db *bolt.DB) (*keystore.Keystore, error) {
+	ks := keystore.New()
+	err := db.View(func(tx *bolt.Tx) error {
+		saved, err := access.GetKeystore(tx)
+		if _, ok := err.(*access.NilError); ok {
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+		ks = saved
+		return nil
+	})
+	return ks, err
+}
+
+// serveHTTP serves h on address until the returned server is shut down.
+func serveHTTP(address string, h http.Handler) *http.Server {
+	srv := &http.Server{Addr: address, Handler: h}
+	go func() {
+		err := srv.ListenAndServe()
+		if err != nil && err != http.ErrServerClosed {
+			log.Fatal(err)
+		}
+	}()
+	return srv
+}
+
+// serveGRPC serves s on address until it is stopped.
+func serveGRPC(address string, s *grpc.Server) {
+	l, err := net.Listen("tcp", address)
+	if err != nil {
+		log.Fatal(err)
+	}
+	go s.Serve(l)
+}
+
+// shutdown waits a while for the requests that srv is handling to finish.
+func shutdown(srv *http.Server) {
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	err := srv.Shutdown(ctx)
+	if err != nil {
+		log.Println("error shutting down:", err)
+	}
+}
@@ -0,0 +1,97 @@
+package main
+
+import (
+	"encoding/json"
+	"io/ioutil"
+	"os"
+	"time"
+)
+
+// Config is read from a JSON file. Anything left out of the file keeps its
+// value from defaultConfig.
+type Config struct {
+	// The bolt database file
+	DB string `json:"db"`
+	// Where the caller API and the counterparty API listen
+	CallerAddress       string `json:"callerAddress"`
+	CounterpartyAddress string `json:"counterpartyAddress"`
+	// "http" or "grpc". It is used for the counterparty API, and for talking
+	// to counterparties and judges, so their addresses must suit it.
+	Transport string `json:"transport"`
+	// If SignerSocket is set, the Accounts are signed for by the usc-signer
+	// listening on it, instead of the keystore in the database.
+	SignerSocket  string   `json:"signerSocket"`
+	SignerTimeout Duration `json:"signerTimeout"`
+
+	Watcher WatcherConfig `json:"watcher"`
+	// How often logic.Webhooks looks for webhooks to deliver
+	WebhookInterval Duration `json:"webhookInterval"`
+	// How often logic.Outbox looks for messages to send again
+	OutboxInterval Duration `json:"outboxInterval"`
+}
+
+// WatcherConfig is passed on to logic.Watcher.
+type WatcherConfig struct {
+	ChecksPerHoldPeriod int64    `json:"checksPerHoldPeriod"`
+	MinInterval         Duration `json:"minInterval"`
+	MaxInterval         Duration `json:"maxInterval"`
+	Tick                Duration `json:"tick"`
+}
+
+var defaultConfig = Config{
+	DB:                  "usc-peer.db",
+	CallerAddress:       "localhost:4456",
+	CounterpartyAddress: ":4458",
+	Transport:           "http",
+	SignerTimeout:       Duration(10 * time.Second),
+	Watcher: WatcherConfig{
+		ChecksPerHoldPeriod: 4,
+		MinInterval:         Duration(time.Minute),
+		MaxInterval:         Duration(time.Hour),
+		Tick:                Duration(10 * time.Second),
+	},
+	WebhookInterval: Duration(5 * time.Second),
+	OutboxInterval:  Duration(time.Second),
+}
+
+// Duration is a time.Duration written as a string, like "1m30s".
+type Duration time.Duration
+
+func (d Duration) MarshalJSON() ([]byte, error) {
+	return json.Marshal(time.Duration(d).String())
+}
+
+func (d *Duration) UnmarshalJSON(b []byte) error {
+	var s string
+	err := json.Unmarshal(b, &s)
+	if err != nil {
+		return err
+	}
+
+	parsed, err := time.ParseDuration(s)
+	if err != nil {
+		return err
+	}
+	*d = Duration(parsed)
+	return nil
+}
+
+// readConfig reads the config file at path. If there is no file, the
+// defaults are used.
+func readConfig(path string) (*Config, error) {
+	cfg := defaultConfig
+
+	b, err := ioutil.ReadFile(path)
+	if os.IsNotExist(err) {
+		return &cfg, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	err = json.Unmarshal(b, &cfg)
+	if err != nil {
+		return nil, err
+	}
+	return &cfg, nil
+}
@@ -0,0 +1,197 @@
+// Command usc-peer runs a peer. It serves the caller API over HTTP to the
+// peer's own software, and the counterparty API to other peers, and watches
+// its channels with their judges, and sends the messages and webhooks in its
+// outboxes.
+//
+//	usc-peer -config usc-peer.json
+//
+// See Config for the config file. The keystore in the database starts out
+// locked, and must be unlocked through the caller API's /unlock before
+// anything can be signed, unless signerSocket is set.
+package main
+
+import (
+	"context"
+	"flag"
+	"log"
+	"net"
+	"net/http"
+	"os"
+	"os/signal"
+	"sync"
+	"syscall"
+	"time"
+
+	"github.com/boltdb/bolt"
+	"github.com/jtremback/usc/core/keystore"
+	"github.com/jtremback/usc/core/signer"
+	"github.com/jtremback/usc/peer/access"
+	"github.com/jtremback/usc/peer/clients"
+	"github.com/jtremback/usc/peer/logic"
+	"github.com/jtremback/usc/peer/servers"
+	"google.golang.org/grpc"
+)
+
+func main() {
+	path := flag.String("config", "usc-peer.json", "config file")
+	flag.Parse()
+
+	cfg, err := readConfig(*path)
+	if err != nil {
+		log.Fatal("could not read config: ", err)
+	}
+
+	db, err := bolt.Open(cfg.DB, 0600, &bolt.Options{Timeout: time.Second})
+	if err != nil {
+		log.Fatal(err)
+	}
+	defer db.Close()
+
+	err = access.MakeBuckets(db)
+	if err != nil {
+		log.Fatal(err)
+	}
+
+	ks, err := readKeystore(db)
+	if err != nil {
+		log.Fatal(err)
+	}
+
+	cptClient, judgeClient, err := clients.New(cfg.Transport)
+	if err != nil {
+		log.Fatal(err)
+	}
+
+	events := &logic.Events{}
+
+	caller := &logic.CallerAPI{
+		DB:                 db,
+		CounterpartyClient: cptClient,
+		JudgeClient:        judgeClient,
+		Keystore:           ks,
+		Events:             events,
+	}
+	if cfg.SignerSocket != "" {
+		caller.Signer = &signer.Remote{
+			Path:    cfg.SignerSocket,
+			Timeout: time.Duration(cfg.SignerTimeout),
+		}
+	}
+
+	counterparty := &logic.CounterpartyAPI{
+		DB:     db,
+		Events: events,
+	}
+
+	callerMux := http.NewServeMux()
+	(&servers.CallerHTTP{Logic: caller}).MountRoutes(callerMux)
+	callerSrv := serveHTTP(cfg.CallerAddress, callerMux)
+	log.Println("caller API listening on", cfg.CallerAddress)
+
+	var stopCounterparty func()
+	if cfg.Transport == clients.GRPC {
+		s := grpc.NewServer()
+		(&servers.CounterpartyGRPC{Logic: counterparty}).Register(s)
+		serveGRPC(cfg.CounterpartyAddress, s)
+		stopCounterparty = s.GracefulStop
+	} else {
+		mux := http.NewServeMux()
+		(&servers.CounterpartyHTTP{Logic: counterparty}).MountRoutes(mux)
+		srv := serveHTTP(cfg.CounterpartyAddress, mux)
+		stopCounterparty = func() { shutdown(srv) }
+	}
+	log.Println("counterparty API listening on", cfg.CounterpartyAddress, "over", cfg.Transport)
+
+	watcher := &logic.Watcher{
+		Caller:              caller,
+		ChecksPerHoldPeriod: cfg.Watcher.ChecksPerHoldPeriod,
+		MinInterval:         time.Duration(cfg.Watcher.MinInterval),
+		MaxInterval:         time.Duration(cfg.Watcher.MaxInterval),
+		Tick:                time.Duration(cfg.Watcher.Tick),
+	}
+	webhooks := &logic.Webhooks{
+		Caller:   caller,
+		Interval: time.Duration(cfg.WebhookInterval),
+	}
+	outbox := &logic.Outbox{
+		Caller:   caller,
+		Interval: time.Duration(cfg.OutboxInterval),
+	}
+	stop := make(chan struct{})
+	var wg sync.WaitGroup
+	wg.Add(3)
+	go func() {
+		watcher.Run(stop)
+		wg.Done()
+	}()
+	go func() {
+		webhooks.Run(stop)
+		wg.Done()
+	}()
+	go func() {
+		outbox.Run(stop)
+		wg.Done()
+	}()
+
+	sigs := make(chan os.Signal, 1)
+	signal.Notify(sigs, syscall.SIGINT, syscall.SIGTERM)
+	<-sigs
+	log.Println("shutting down")
+
+	// Stop taking requests first, so that nothing is half done when the
+	// database is closed.
+	shutdown(callerSrv)
+	stopCounterparty()
+	close(stop)
+	wg.Wait()
+	caller.Lock()
+}
+
+// readKeystore gets the keystore from the database, or makes a new one.
+func readKeystore(db *bolt.DB) (*keystore.Keystore, error) {
+	ks := keystore.New()
+	err := db.View(func(tx *bolt.Tx) error {
+		saved, err := access.GetKeystore(tx)
+		if _, ok := err.(*access.NilError); ok {
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+		ks = saved
+		return nil
+	})
+	return ks, err
+}
+
+// serveHTTP serves h on address until the returned server is shut down.
+func serveHTTP(address string, h http.Handler) *http.Server {
+	srv := &http.Server{Addr: address, Handler: h}
+	go func() {
+		err := srv.ListenAndServe()
+		if err != nil && err != http.ErrServerClosed {
+			log.Fatal(err)
+		}
+	}()
+	return srv
+}
+
+// serveGRPC serves s on address until it is stopped.
+func serveGRPC(address string, s *grpc.Server) {
+	l, err := net.Listen("tcp", address)
+	if err != nil {
+		log.Fatal(err)
+	}
+	go s.Serve(l)
+}
+
+// shutdown waits a while for the requests that srv is handling to finish.
+func shutdown(srv *http.Server) {
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	err := srv.Shutdown(ctx)
+	if err != nil {
+		log.Println("error shutting down:", err)
+	}
+}
@@ -0,0 +1,127 @@
+// Command usc-signer holds private keys for a peer or judge in a separate
+// process. It serves the keys in a keystore file over a Unix socket, to be
+// used with signer.Remote.
+//
+//	usc-signer -keystore keys.json -generate
+//	usc-signer -keystore keys.json -socket /var/run/usc-signer.sock
+//
+// The passphrase of the keystore is read from the first line of stdin.
+package main
+
+import (
+	"bufio"
+	"crypto/rand"
+	"encoding/base64"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"io/ioutil"
+	"log"
+	"net"
+	"os"
+	"os/signal"
+	"strings"
+	"syscall"
+
+	"github.com/agl/ed25519"
+	"github.com/jtremback/usc/core/keystore"
+	"github.com/jtremback/usc/core/signer"
+)
+
+func main() {
+	path := flag.String("keystore", "keystore.json", "keystore file")
+	socket := flag.String("socket", "usc-signer.sock", "unix socket to listen on")
+	generate := flag.Bool("generate", false, "add a new key to the keystore and print its public key")
+	flag.Parse()
+
+	passphrase, err := bufio.NewReader(os.Stdin).ReadString('\n')
+	if err != nil && passphrase == "" {
+		log.Fatal("could not read passphrase: ", err)
+	}
+	passphrase = strings.TrimRight(passphrase, "\r\n")
+
+	ks, err := readKeystore(*path)
+	if err != nil {
+		log.Fatal(err)
+	}
+
+	err = ks.Unlock(passphrase)
+	if err != nil {
+		log.Fatal(err)
+	}
+
+	if *generate {
+		pub, priv, err := ed25519.GenerateKey(rand.Reader)
+		if err != nil {
+			log.Fatal(err)
+		}
+
+		err = ks.Add(pub[:], priv[:])
+		if err != nil {
+			log.Fatal(err)
+		}
+
+		err = writeKeystore(*path, ks)
+		if err != nil {
+			log.Fatal(err)
+		}
+
+		fmt.Println(base64.URLEncoding.EncodeToString(pub[:]))
+		return
+	}
+
+	// The keystore file gets a salt the first time it is unlocked
+	err = writeKeystore(*path, ks)
+	if err != nil {
+		log.Fatal(err)
+	}
+
+	os.Remove(*socket)
+	l, err := net.Listen("unix", *socket)
+	if err != nil {
+		log.Fatal(err)
+	}
+	err = os.Chmod(*socket, 0600)
+	if err != nil {
+		log.Fatal(err)
+	}
+
+	sigs := make(chan os.Signal, 1)
+	signal.Notify(sigs, syscall.SIGINT, syscall.SIGTERM)
+	go func() {
+		<-sigs
+		ks.Lock()
+		l.Close()
+	}()
+
+	log.Println("signing with", len(ks.Keys), "keys on", *socket)
+	err = signer.Serve(l, ks)
+	if err != nil && !strings.Contains(err.Error(), "use of closed network connection") {
+		log.Fatal(err)
+	}
+}
+
+func readKeystore(path string) (*keystore.Keystore, error) {
+	b, err := ioutil.ReadFile(path)
+	if os.IsNotExist(err) {
+		return keystore.New(), nil
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	ks := &keystore.Keystore{}
+	err = json.Unmarshal(b, ks)
+	if err != nil {
+		return nil, err
+	}
+	return ks, nil
+}
+
+func writeKeystore(path string, ks *keystore.Keystore) error {
+	b, err := json.Marshal(ks)
+	if err != nil {
+		return err
+	}
+	return ioutil.WriteFile(path, b, 0600)
+}
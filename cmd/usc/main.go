@@ -0,0 +1,550 @@
+// Command usc drives a peer through its caller API.
+//
+//	usc [-peer http://localhost:4456] [-format table|json] <command> [flags] [args]
+//
+// Run usc with no command for the list of commands. The passphrase for unlock
+// and change-passphrase is read from stdin, one per line.
+package main
+
+import (
+	"bufio"
+	"crypto/rand"
+	"encoding/base64"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"sort"
+	"strings"
+	"text/tabwriter"
+	"time"
+
+	"github.com/agl/ed25519"
+	"github.com/jtremback/usc/peer/clients"
+	"github.com/jtremback/usc/peer/servers"
+)
+
+type command struct {
+	usage string
+	run   func(c *clients.CallerHTTP, args []string) (interface{}, error)
+}
+
+var commands = map[string]command{
+	"keygen": {"make a new ed25519 key pair, without talking to the peer", keygen},
+
+	"judges":    {"list judges", judges},
+	"add-judge": {"-name <name> -pubkey <pubkey> -address <url>", addJudge},
+
+	"accounts":    {"list accounts", accounts},
+	"account":     {"<pubkey>", account},
+	"new-account": {"-name <name> -judge <judge pubkey>", newAccount},
+
+	"counterparties":   {"list counterparties", counterparties},
+	"counterparty":     {"<pubkey>", counterparty},
+	"add-counterparty": {"-name <name> -judge <judge pubkey> -pubkey <pubkey> -address <url>", addCounterparty},
+
+	"channels":      {"list channels", channels},
+	"channel":       {"<channel id>", channel},
+	"messages":      {"<channel id>: list the messages about a channel that have not been delivered yet", messages},
+	"equivocations": {"<channel id>: list the conflicting update txs signed by the counterparties of a channel", equivocations},
+	"propose":       {"-id <channel id> -account <pubkey> -counterparty <pubkey>[,<pubkey>...] -state <state> -hold-period <duration>", propose},
+	"accept":        {"<channel id>: accept a proposed channel", channelCommand((*clients.CallerHTTP).AcceptChannel)},
+	"reject":        {"<channel id>: reject a proposed channel", reject},
+	"cancel":        {"<channel id>: cancel a channel that has not been accepted", channelCommand((*clients.CallerHTTP).CancelChannel)},
+	"update":        {"-id <channel id> -state <state> [-fast]: propose an update tx", update},
+	"cosign":        {"<channel id>: accept the proposed update tx", channelCommand((*clients.CallerHTTP).AcceptUpdateTx)},
+	"reject-update": {"<channel id>: reject the proposed update tx", channelCommand((*clients.CallerHTTP).RejectUpdateTx)},
+	"close":         {"<channel id>", channelCommand((*clients.CallerHTTP).CloseChannel)},
+	"check":         {"<channel id>: check the channel with its judge", channelCommand((*clients.CallerHTTP).CheckChannel)},
+
+	"events":       {"[-cursor <cursor>] [-follow]: print the events after cursor", events},
+	"webhooks":     {"<account pubkey>", webhooks},
+	"set-webhooks": {"-account <pubkey> [<url>...]: set the webhook URLs of an account, or remove them with none", setWebhooks},
+	"deliveries":   {"list webhooks that have not been delivered yet", deliveries},
+
+	"unlock":            {"unlock the keystore", unlock},
+	"lock":              {"lock the keystore", lock},
+	"change-passphrase": {"change the passphrase of the keystore", changePassphrase},
+}
+
+func usage() {
+	fmt.Fprintln(os.Stderr, "usage: usc [-peer <url>] [-format table|json] <command> [flags] [args]")
+	fmt.Fprintln(os.Stderr)
+	flag.PrintDefaults()
+	fmt.Fprintln(os.Stderr)
+
+	names := []string{}
+	for name := range commands {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	w := tabwriter.NewWriter(os.Stderr, 0, 4, 2, ' ', 0)
+	for _, name := range names {
+		fmt.Fprintf(w, "  %s\t%s\n", name, commands[name].usage)
+	}
+	w.Flush()
+}
+
+func main() {
+	address := flag.String("peer", "http://localhost:4456", "address of the peer's caller API")
+	format := flag.String("format", "table", "output format, table or json")
+	flag.Usage = usage
+	flag.Parse()
+
+	if flag.NArg() == 0 {
+		usage()
+		os.Exit(2)
+	}
+	cmd, ok := commands[flag.Arg(0)]
+	if !ok {
+		fmt.Fprintln(os.Stderr, "unknown command", flag.Arg(0))
+		usage()
+		os.Exit(2)
+	}
+
+	resp, err := cmd.run(&clients.CallerHTTP{Address: strings.TrimRight(*address, "/")}, flag.Args()[1:])
+	if err != nil {
+		fmt.Fprintln(os.Stderr, "error:", err)
+		os.Exit(1)
+	}
+	if resp == nil {
+		return
+	}
+
+	switch *format {
+	case "json":
+		err = printJSON(os.Stdout, resp)
+	case "table":
+		err = printTable(os.Stdout, resp)
+	default:
+		err = fmt.Errorf("unknown format %s", *format)
+	}
+	if err != nil {
+		fmt.Fprintln(os.Stderr, "error:", err)
+		os.Exit(1)
+	}
+}
+
+// oneArg checks that there is exactly one argument, and returns it.
+func oneArg(args []string, name string) (string, error) {
+	if len(args) != 1 {
+		return "", fmt.Errorf("expected a %s", name)
+	}
+	return args[0], nil
+}
+
+// parse parses flags, and checks that each of required was given.
+func parse(fs *flag.FlagSet, args []string, required ...string) error {
+	err := fs.Parse(args)
+	if err != nil {
+		return err
+	}
+
+	set := map[string]bool{}
+	fs.Visit(func(f *flag.Flag) {
+		set[f.Name] = true
+	})
+	for _, name := range required {
+		if !set[name] {
+			return fmt.Errorf("-%s is required", name)
+		}
+	}
+	return nil
+}
+
+// readLine reads one line from stdin, such as a passphrase.
+func readLine(r *bufio.Reader) (string, error) {
+	line, err := r.ReadString('\n')
+	if err != nil && line == "" {
+		return "", err
+	}
+	return strings.TrimRight(line, "\r\n"), nil
+}
+
+type keyPair struct {
+	Pubkey  string `json:"pubkey"`
+	Privkey string `json:"privkey"`
+}
+
+func keygen(c *clients.CallerHTTP, args []string) (interface{}, error) {
+	pub, priv, err := ed25519.GenerateKey(rand.Reader)
+	if err != nil {
+		return nil, err
+	}
+	return &keyPair{
+		Pubkey:  base64.URLEncoding.EncodeToString(pub[:]),
+		Privkey: base64.URLEncoding.EncodeToString(priv[:]),
+	}, nil
+}
+
+func judges(c *clients.CallerHTTP, args []string) (interface{}, error) {
+	return c.Judges()
+}
+
+func addJudge(c *clients.CallerHTTP, args []string) (interface{}, error) {
+	req := &servers.AddJudgeRequest{}
+	fs := flag.NewFlagSet("add-judge", flag.ExitOnError)
+	fs.StringVar(&req.Name, "name", "", "name of the judge")
+	fs.StringVar(&req.Pubkey, "pubkey", "", "pubkey of the judge")
+	fs.StringVar(&req.Address, "address", "", "address of the judge")
+	err := parse(fs, args, "pubkey", "address")
+	if err != nil {
+		return nil, err
+	}
+	return c.AddJudge(req)
+}
+
+func accounts(c *clients.CallerHTTP, args []string) (interface{}, error) {
+	return c.Accounts()
+}
+
+func account(c *clients.CallerHTTP, args []string) (interface{}, error) {
+	pubkey, err := oneArg(args, "pubkey")
+	if err != nil {
+		return nil, err
+	}
+	return c.Account(pubkey)
+}
+
+func newAccount(c *clients.CallerHTTP, args []string) (interface{}, error) {
+	req := &servers.NewAccountRequest{}
+	fs := flag.NewFlagSet("new-account", flag.ExitOnError)
+	fs.StringVar(&req.Name, "name", "", "name of the account")
+	fs.StringVar(&req.JudgePubkey, "judge", "", "pubkey of the account's judge")
+	err := parse(fs, args, "judge")
+	if err != nil {
+		return nil, err
+	}
+	return c.NewAccount(req)
+}
+
+func counterparties(c *clients.CallerHTTP, args []string) (interface{}, error) {
+	return c.Counterparties()
+}
+
+func counterparty(c *clients.CallerHTTP, args []string) (interface{}, error) {
+	pubkey, err := oneArg(args, "pubkey")
+	if err != nil {
+		return nil, err
+	}
+	return c.Counterparty(pubkey)
+}
+
+func addCounterparty(c *clients.CallerHTTP, args []string) (interface{}, error) {
+	req := &servers.AddCounterpartyRequest{}
+	fs := flag.NewFlagSet("add-counterparty", flag.ExitOnError)
+	fs.StringVar(&req.Name, "name", "", "name of the counterparty")
+	fs.StringVar(&req.JudgePubkey, "judge", "", "pubkey of the counterparty's judge")
+	fs.StringVar(&req.Pubkey, "pubkey", "", "pubkey of the counterparty")
+	fs.StringVar(&req.Address, "address", "", "address of the counterparty")
+	err := parse(fs, args, "judge", "pubkey", "address")
+	if err != nil {
+		return nil, err
+	}
+	return c.AddCounterparty(req)
+}
+
+func channels(c *clients.CallerHTTP, args []string) (interface{}, error) {
+	return c.Channels()
+}
+
+func channel(c *clients.CallerHTTP, args []string) (interface{}, error) {
+	chID, err := oneArg(args, "channel id")
+	if err != nil {
+		return nil, err
+	}
+	return c.Channel(chID)
+}
+
+func messages(c *clients.CallerHTTP, args []string) (interface{}, error) {
+	chID, err := oneArg(args, "channel id")
+	if err != nil {
+		return nil, err
+	}
+	return c.ChannelMessages(chID)
+}
+
+func equivocations(c *clients.CallerHTTP, args []string) (interface{}, error) {
+	chID, err := oneArg(args, "channel id")
+	if err != nil {
+		return nil, err
+	}
+	return c.ChannelEquivocations(chID)
+}
+
+func propose(c *clients.CallerHTTP, args []string) (interface{}, error) {
+	req := &servers.ProposeChannelRequest{}
+	var cpts string
+	var holdPeriod time.Duration
+	fs := flag.NewFlagSet("propose", flag.ExitOnError)
+	fs.StringVar(&req.ChannelId, "id", "", "id of the new channel")
+	fs.StringVar(&req.AccountPubkey, "account", "", "pubkey of our account")
+	fs.StringVar(&cpts, "counterparty", "", "pubkeys of the counterparties, separated by commas")
+	fs.StringVar(&req.State, "state", "", "opening state of the channel")
+	fs.DurationVar(&holdPeriod, "hold-period", 24*time.Hour, "hold period of the channel")
+	err := parse(fs, args, "id", "account", "counterparty")
+	if err != nil {
+		return nil, err
+	}
+	req.CounterpartyPubkeys = strings.Split(cpts, ",")
+	req.HoldPeriod = uint64(holdPeriod)
+	return c.ProposeChannel(req)
+}
+
+// channelCommand makes a command that takes a channel id and returns the
+// channel.
+func channelCommand(fn func(*clients.CallerHTTP, string) (*servers.Channel, error)) func(*clients.CallerHTTP, []string) (interface{}, error) {
+	return func(c *clients.CallerHTTP, args []string) (interface{}, error) {
+		chID, err := oneArg(args, "channel id")
+		if err != nil {
+			return nil, err
+		}
+		return fn(c, chID)
+	}
+}
+
+func reject(c *clients.CallerHTTP, args []string) (interface{}, error) {
+	chID, err := oneArg(args, "channel id")
+	if err != nil {
+		return nil, err
+	}
+	return nil, c.RejectChannel(chID)
+}
+
+func update(c *clients.CallerHTTP, args []string) (interface{}, error) {
+	req := &servers.ProposeUpdateTxRequest{}
+	fs := flag.NewFlagSet("update", flag.ExitOnError)
+	fs.StringVar(&req.ChannelId, "id", "", "id of the channel")
+	fs.StringVar(&req.State, "state", "", "new state of the channel")
+	fs.BoolVar(&req.Fast, "fast", false, "let the channel be closed without waiting for the hold period")
+	err := parse(fs, args, "id", "state")
+	if err != nil {
+		return nil, err
+	}
+	return c.ProposeUpdateTx(req)
+}
+
+// events prints events as they come, one per line, until the stream ends.
+// Without -follow, it stops once there is nothing more to print.
+func events(c *clients.CallerHTTP, args []string) (interface{}, error) {
+	var cursor uint64
+	var follow bool
+	fs := flag.NewFlagSet("events", flag.ExitOnError)
+	fs.Uint64Var(&cursor, "cursor", 0, "print the events after this cursor")
+	fs.BoolVar(&follow, "follow", false, "keep printing new events")
+	err := parse(fs, args)
+	if err != nil {
+		return nil, err
+	}
+
+	evs := make(chan *servers.Event)
+	done := make(chan error, 1)
+	go func() {
+		done <- c.Events(cursor, func(ev *servers.Event) error {
+			evs <- ev
+			return nil
+		})
+	}()
+
+	for {
+		var idle <-chan time.Time
+		if !follow {
+			idle = time.After(time.Second)
+		}
+
+		select {
+		case ev := <-evs:
+			fmt.Printf("%d\t%s\t%s\t%s\n", ev.Cursor, ev.Time.Format(time.RFC3339), ev.Type, eventTarget(ev))
+		case err := <-done:
+			return nil, err
+		case <-idle:
+			return nil, nil
+		}
+	}
+}
+
+func eventTarget(ev *servers.Event) string {
+	if ev.SequenceNumber == 0 {
+		return ev.ChannelId
+	}
+	return fmt.Sprintf("%s (seq %d)", ev.ChannelId, ev.SequenceNumber)
+}
+
+func webhooks(c *clients.CallerHTTP, args []string) (interface{}, error) {
+	pubkey, err := oneArg(args, "pubkey")
+	if err != nil {
+		return nil, err
+	}
+	return c.Webhooks(pubkey)
+}
+
+func setWebhooks(c *clients.CallerHTTP, args []string) (interface{}, error) {
+	req := &servers.Webhooks{}
+	fs := flag.NewFlagSet("set-webhooks", flag.ExitOnError)
+	fs.StringVar(&req.Pubkey, "account", "", "pubkey of the account")
+	err := parse(fs, args, "account")
+	if err != nil {
+		return nil, err
+	}
+	req.URLs = fs.Args()
+	return c.SetWebhooks(req)
+}
+
+func deliveries(c *clients.CallerHTTP, args []string) (interface{}, error) {
+	return c.WebhookDeliveries()
+}
+
+func unlock(c *clients.CallerHTTP, args []string) (interface{}, error) {
+	passphrase, err := readLine(bufio.NewReader(os.Stdin))
+	if err != nil {
+		return nil, err
+	}
+	return nil, c.Unlock(passphrase)
+}
+
+func lock(c *clients.CallerHTTP, args []string) (interface{}, error) {
+	return nil, c.Lock()
+}
+
+func changePassphrase(c *clients.CallerHTTP, args []string) (interface{}, error) {
+	r := bufio.NewReader(os.Stdin)
+	old, err := readLine(r)
+	if err != nil {
+		return nil, err
+	}
+	new, err := readLine(r)
+	if err != nil {
+		return nil, err
+	}
+	return nil, c.ChangePassphrase(old, new)
+}
+
+func printJSON(w io.Writer, resp interface{}) error {
+	b, err := json.MarshalIndent(resp, "", "  ")
+	if err != nil {
+		return err
+	}
+	_, err = fmt.Fprintln(w, string(b))
+	return err
+}
+
+// printTable prints resp with a row for each judge, account, counterparty,
+// channel, message, webhook URL or delivery. Anything else is printed as JSON.
+func printTable(out io.Writer, resp interface{}) error {
+	w := tabwriter.NewWriter(out, 0, 4, 2, ' ', 0)
+
+	switch resp := resp.(type) {
+	case *servers.Judge:
+		return printTable(out, []*servers.Judge{resp})
+	case []*servers.Judge:
+		fmt.Fprintln(w, "NAME\tPUBKEY\tADDRESS")
+		for _, jd := range resp {
+			fmt.Fprintf(w, "%s\t%s\t%s\n", jd.Name, jd.Pubkey, jd.Address)
+		}
+	case *servers.Account:
+		return printTable(out, []*servers.Account{resp})
+	case []*servers.Account:
+		fmt.Fprintln(w, "NAME\tPUBKEY\tJUDGE")
+		for _, acct := range resp {
+			fmt.Fprintf(w, "%s\t%s\t%s\n", acct.Name, acct.Pubkey, judgeName(acct.Judge))
+		}
+	case *servers.Counterparty:
+		return printTable(out, []*servers.Counterparty{resp})
+	case []*servers.Counterparty:
+		fmt.Fprintln(w, "NAME\tPUBKEY\tADDRESS\tJUDGE")
+		for _, cpt := range resp {
+			fmt.Fprintf(w, "%s\t%s\t%s\t%s\n", cpt.Name, cpt.Pubkey, cpt.Address, judgeName(cpt.Judge))
+		}
+	case *servers.Channel:
+		return printTable(out, []*servers.Channel{resp})
+	case []*servers.Channel:
+		fmt.Fprintln(w, "ID\tPHASE\tACCOUNT\tCOUNTERPARTIES\tSEQ\tSTATE\tPROPOSED")
+		for _, ch := range resp {
+			seq, state := "-", ""
+			if ch.LastFullUpdateTx != nil {
+				seq = fmt.Sprint(ch.LastFullUpdateTx.SequenceNumber)
+				state = ch.LastFullUpdateTx.State
+			} else if ch.OpeningTx != nil {
+				state = ch.OpeningTx.State
+			}
+			fmt.Fprintf(w, "%s\t%s\t%s\t%s\t%s\t%s\t%s\n",
+				ch.ChannelId, ch.Phase, accountName(ch.Account), counterpartyNames(ch.Counterparties),
+				seq, state, proposed(ch))
+		}
+	case []*servers.Message:
+		fmt.Fprintln(w, "ID\tKIND\tADDRESS\tATTEMPTS\tNEXT ATTEMPT\tLAST ERROR")
+		for _, m := range resp {
+			next := m.NextAttempt.Format(time.RFC3339)
+			if m.Dead {
+				next = "dead"
+			}
+			fmt.Fprintf(w, "%d\t%s\t%s\t%d\t%s\t%s\n",
+				m.Id, m.Kind, m.Address, m.Attempts, next, m.LastError)
+		}
+	case []*servers.Equivocation:
+		fmt.Fprintln(w, "ID\tSEQ\tHELD STATE\tCONFLICTING STATE\tTIME")
+		for _, eq := range resp {
+			fmt.Fprintf(w, "%d\t%d\t%s\t%s\t%s\n",
+				eq.Id, eq.SequenceNumber, updateTxState(eq.Held), updateTxState(eq.Conflicting),
+				eq.Time.Format(time.RFC3339))
+		}
+	case *servers.Webhooks:
+		fmt.Fprintln(w, "URL")
+		for _, u := range resp.URLs {
+			fmt.Fprintln(w, u)
+		}
+	case []*servers.Delivery:
+		fmt.Fprintln(w, "ID\tTYPE\tCHANNEL\tURL\tATTEMPTS\tNEXT ATTEMPT\tLAST ERROR")
+		for _, d := range resp {
+			fmt.Fprintf(w, "%d\t%s\t%s\t%s\t%d\t%s\t%s\n",
+				d.Id, d.Payload.Type, d.Payload.ChannelId, d.URL, d.Attempts,
+				d.NextAttempt.Format(time.RFC3339), d.LastError)
+		}
+	default:
+		return printJSON(out, resp)
+	}
+
+	return w.Flush()
+}
+
+func judgeName(jd *servers.Judge) string {
+	if jd == nil {
+		return ""
+	}
+	return jd.Name
+}
+
+func accountName(acct *servers.Account) string {
+	if acct == nil {
+		return ""
+	}
+	return acct.Name
+}
+
+func counterpartyNames(cpts []*servers.Counterparty) string {
+	names := []string{}
+	for _, cpt := range cpts {
+		names = append(names, cpt.Name)
+	}
+	return strings.Join(names, ",")
+}
+
+// proposed describes the update tx that is waiting to be cosigned, if any.
+func proposed(ch *servers.Channel) string {
+	if ch.TheirProposedUpdateTx != nil {
+		return fmt.Sprintf("theirs (seq %d)", ch.TheirProposedUpdateTx.SequenceNumber)
+	}
+	if ch.MyProposedUpdateTx != nil {
+		return fmt.Sprintf("mine (seq %d)", ch.MyProposedUpdateTx.SequenceNumber)
+	}
+	return ""
+}
+
+func updateTxState(utx *servers.UpdateTx) string {
+	if utx == nil {
+		return ""
+	}
+	return utx.State
+}
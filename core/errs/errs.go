@@ -0,0 +1,157 @@
+// Package errs gives the errors that USC returns to its callers a stable,
+// machine readable Code, and maps each Code to an HTTP status.
+package errs
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+)
+
+// Code is the machine readable kind of an error. Codes are part of the HTTP
+// APIs, so they must never change.
+type Code string
+
+const (
+	// The error has no Code
+	Internal Code = "internal"
+	// The request could not be parsed, or a tx is not valid
+	Invalid Code = "invalid"
+	// The channel, account, judge etc. does not exist
+	NotFound Code = "not_found"
+	// The channel is not in a phase where this can be done
+	WrongPhase Code = "wrong_phase"
+	// A signature is missing or not valid
+	BadSignature Code = "bad_signature"
+	// An UpdateTx's sequence number is not higher than the last one
+	SeqTooLow Code = "seq_too_low"
+	// An UpdateTx has expired
+	Expired Code = "expired"
+	// The hold period of the channel is not over yet
+	HoldPeriodNotOver Code = "hold_period_not_over"
+	// The thing already exists, or has already been done
+	Conflict Code = "conflict"
+	// The keystore must be unlocked first
+	Locked Code = "locked"
+	// The passphrase of the keystore is wrong
+	BadPassphrase Code = "bad_passphrase"
+	// A counterparty or judge could not be reached, or refused the request
+	Upstream Code = "upstream"
+)
+
+var statuses = map[Code]int{
+	Internal:          http.StatusInternalServerError,
+	Invalid:           http.StatusBadRequest,
+	NotFound:          http.StatusNotFound,
+	WrongPhase:        http.StatusConflict,
+	BadSignature:      http.StatusBadRequest,
+	SeqTooLow:         http.StatusConflict,
+	Expired:           http.StatusConflict,
+	HoldPeriodNotOver: http.StatusConflict,
+	Conflict:          http.StatusConflict,
+	Locked:            http.StatusServiceUnavailable,
+	BadPassphrase:     http.StatusUnauthorized,
+	Upstream:          http.StatusBadGateway,
+}
+
+// Status is the HTTP status for errors with the Code.
+func (c Code) Status() int {
+	status, ok := statuses[c]
+	if !ok {
+		return http.StatusInternalServerError
+	}
+	return status
+}
+
+// Error is an error with a Code.
+type Error struct {
+	code Code
+	msg  string
+	// For Upstream errors, whether the other side refused the request
+	// outright, rather than failing or not being reached
+	rejected bool
+}
+
+// New makes an Error. msg is for people, and can be more specific than the
+// Code, such as "channel not OPEN" for WrongPhase.
+func New(code Code, msg string) error {
+	return &Error{code: code, msg: msg}
+}
+
+func (e *Error) Error() string {
+	return e.msg
+}
+
+func (e *Error) Code() Code {
+	return e.code
+}
+
+// Is reports whether target has the same Code as e, so that errors.Is can be
+// used with the Err values of core/peer and core/judge.
+func (e *Error) Is(target error) bool {
+	return CodeOf(target) == e.code
+}
+
+// CodeOf is the Code of err, or of the first error it wraps which has a Code
+// method. Errors which don't have one are Internal.
+func CodeOf(err error) Code {
+	var c interface {
+		Code() Code
+	}
+	if !errors.As(err, &c) {
+		return Internal
+	}
+	return c.Code()
+}
+
+// Rejected returns true if err means that the request was refused outright,
+// so that making it again will fail in the same way. These are Upstream errors
+// for which the other side responded with a 4xx status, and errors with a Code
+// whose status is 4xx. Network errors, Internal errors and Locked are not
+// rejections.
+func Rejected(err error) bool {
+	if CodeOf(err) == Upstream {
+		var e *Error
+		return errors.As(err, &e) && e.rejected
+	}
+	return rejection(CodeOf(err).Status())
+}
+
+func rejection(status int) bool {
+	return status >= 400 && status < 500
+}
+
+// Response is the body of a failed request to one of USC's HTTP APIs.
+type Response struct {
+	Error string
+	Code  Code
+}
+
+// Fail writes msg as a Response with code, and the status for code.
+func Fail(w http.ResponseWriter, msg string, code Code) {
+	w.Header().Set("Content-Type", "application/json")
+
+	resp, _ := json.Marshal(&Response{Error: msg, Code: code})
+	w.WriteHeader(code.Status())
+	w.Write(resp)
+}
+
+// FailErr writes err as a Response, with its Code.
+func FailErr(w http.ResponseWriter, err error) {
+	Fail(w, err.Error(), CodeOf(err))
+}
+
+// FromResponse makes an Upstream error from the status and body of a failed
+// request to one of USC's HTTP APIs, prefixing its message with prefix. The
+// Code of the Response is not kept, since it describes the other side's state,
+// not ours, but a 4xx status makes the error Rejected.
+func FromResponse(status int, body []byte, prefix string) error {
+	e := &Error{code: Upstream, msg: prefix, rejected: rejection(status)}
+
+	resp := &Response{}
+	err := json.Unmarshal(body, resp)
+	if err == nil && resp.Error != "" {
+		e.msg = prefix + ": " + resp.Error
+	}
+	return e
+}
@@ -0,0 +1,96 @@
+package errs
+
+import (
+	"errors"
+	"fmt"
+	"net/http/httptest"
+	"testing"
+
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+type notFound struct{}
+
+func (e *notFound) Error() string { return "not found" }
+func (e *notFound) Code() Code    { return NotFound }
+
+func TestCodes(t *testing.T) {
+	err := New(WrongPhase, "channel not OPEN")
+	if CodeOf(err) != WrongPhase || err.Error() != "channel not OPEN" {
+		t.Fatal("code or message incorrect", CodeOf(err), err)
+	}
+
+	if !errors.Is(err, New(WrongPhase, "channel in wrong phase")) {
+		t.Fatal("errors with the same code should be equal under errors.Is")
+	}
+	if errors.Is(err, New(SeqTooLow, "channel not OPEN")) {
+		t.Fatal("errors with different codes should not be equal under errors.Is")
+	}
+
+	if CodeOf(errors.New("oops")) != Internal {
+		t.Fatal("errors without a code should be Internal")
+	}
+	if CodeOf(&notFound{}) != NotFound {
+		t.Fatal("errors with a Code method should have that code")
+	}
+	if CodeOf(fmt.Errorf("getting channel: %w", err)) != WrongPhase {
+		t.Fatal("wrapped errors should have the code of the error they wrap")
+	}
+
+	if !Rejected(err) || Rejected(New(Locked, "keystore locked")) || Rejected(errors.New("oops")) {
+		t.Fatal("only errors with 4xx codes should be rejected")
+	}
+
+	if NotFound.Status() != 404 || WrongPhase.Status() != 409 || Code("nonsense").Status() != 500 {
+		t.Fatal("statuses incorrect")
+	}
+}
+
+func TestResponses(t *testing.T) {
+	w := httptest.NewRecorder()
+	FailErr(w, New(SeqTooLow, "sequence number too low"))
+	if w.Code != 409 {
+		t.Fatal("status incorrect", w.Code)
+	}
+
+	err := FromResponse(w.Code, w.Body.Bytes(), "judge error")
+	if CodeOf(err) != Upstream || err.Error() != "judge error: sequence number too low" {
+		t.Fatal("error from response incorrect", CodeOf(err), err)
+	}
+	if !Rejected(err) {
+		t.Fatal("error from a 4xx response should be rejected")
+	}
+
+	err = FromResponse(502, []byte("<html>"), "judge error")
+	if CodeOf(err) != Upstream || err.Error() != "judge error" {
+		t.Fatal("error from bad response incorrect", CodeOf(err), err)
+	}
+	if Rejected(err) {
+		t.Fatal("error from a 5xx response should not be rejected")
+	}
+}
+
+func TestGRPCErrors(t *testing.T) {
+	err := ToGRPC(New(SeqTooLow, "sequence number too low"))
+	if status.Code(err) != codes.FailedPrecondition {
+		t.Fatal("grpc code incorrect", status.Code(err))
+	}
+
+	err = FromGRPC(err, "judge error")
+	if CodeOf(err) != Upstream || err.Error() != "judge error: sequence number too low" {
+		t.Fatal("error from grpc incorrect", CodeOf(err), err)
+	}
+	if !Rejected(err) {
+		t.Fatal("error from a failed precondition should be rejected")
+	}
+
+	err = FromGRPC(status.Error(codes.Unavailable, "connection refused"), "judge error")
+	if CodeOf(err) != Upstream || err.Error() != "network error" || Rejected(err) {
+		t.Fatal("error from unavailable grpc incorrect", CodeOf(err), err)
+	}
+
+	if ToGRPC(nil) != nil {
+		t.Fatal("nil error should stay nil")
+	}
+}
@@ -0,0 +1,60 @@
+package errs
+
+import (
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+var grpcCodes = map[Code]codes.Code{
+	Internal:          codes.Internal,
+	Invalid:           codes.InvalidArgument,
+	NotFound:          codes.NotFound,
+	WrongPhase:        codes.FailedPrecondition,
+	BadSignature:      codes.InvalidArgument,
+	SeqTooLow:         codes.FailedPrecondition,
+	Expired:           codes.FailedPrecondition,
+	HoldPeriodNotOver: codes.FailedPrecondition,
+	Conflict:          codes.AlreadyExists,
+	Locked:            codes.Unavailable,
+	BadPassphrase:     codes.Unauthenticated,
+	Upstream:          codes.Unavailable,
+}
+
+// GRPC is the gRPC status code for errors with the Code.
+func (c Code) GRPC() codes.Code {
+	code, ok := grpcCodes[c]
+	if !ok {
+		return codes.Internal
+	}
+	return code
+}
+
+// ToGRPC makes a gRPC status error from err, with the status code for its
+// Code.
+func ToGRPC(err error) error {
+	if err == nil {
+		return nil
+	}
+	return status.Error(CodeOf(err).GRPC(), err.Error())
+}
+
+// grpcRejections are the gRPC status codes for which a request is Rejected.
+var grpcRejections = map[codes.Code]bool{
+	codes.InvalidArgument:    true,
+	codes.NotFound:           true,
+	codes.FailedPrecondition: true,
+	codes.AlreadyExists:      true,
+	codes.Unauthenticated:    true,
+}
+
+// FromGRPC makes an Upstream error from an error returned by a gRPC call,
+// prefixing its message with prefix. Like FromResponse, the Code of the other
+// side is not kept, but the status codes of the 4xx Codes make the error
+// Rejected.
+func FromGRPC(err error, prefix string) error {
+	st, ok := status.FromError(err)
+	if !ok || st.Code() == codes.Unavailable {
+		return New(Upstream, "network error")
+	}
+	return &Error{code: Upstream, msg: prefix + ": " + st.Message(), rejected: grpcRejections[st.Code()]}
+}
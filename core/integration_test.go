@@ -69,7 +69,7 @@ var c2_Counterparty = &c.Counterparty{
 }
 
 func Test(t *testing.T) {
-	otx, err := c1_Account.NewOpeningTx("shibby", c1_Counterparty, []byte{166, 179}, 86400)
+	otx, err := c1_Account.NewOpeningTx("shibby", []*c.Counterparty{c1_Counterparty}, []byte{166, 179}, 86400)
 	if err != nil {
 		t.Fatal(err)
 	}
@@ -78,29 +78,36 @@ func Test(t *testing.T) {
 		t.Fatal(err)
 	}
 
-	c1_Account.AppendSignature(ev)
+	ch1, err := c.NewChannel(ev, otx, c1_Account, []*c.Counterparty{c1_Counterparty})
+	if err != nil {
+		t.Fatal(err)
+	}
 
-	ch1, err := c.NewChannel(ev, otx, c1_Account, c1_Counterparty)
+	err = ch1.SignOpeningTx()
 	if err != nil {
 		t.Fatal(err)
 	}
 
 	// --- Send to second party ---
 
-	err = c2_Account.CheckOpeningTx(ev, c2_Counterparty)
+	err = c2_Account.CheckOpeningTx(ev, otx, []*c.Counterparty{c2_Counterparty})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	ch2, err := c.NewChannel(ev, otx, c2_Account, []*c.Counterparty{c2_Counterparty})
 	if err != nil {
 		t.Fatal(err)
 	}
 
-	ch2, err := c.NewChannel(ev, otx, c2_Account, c2_Counterparty)
+	err = ch2.SignOpeningTx()
 	if err != nil {
 		t.Fatal(err)
 	}
-	c2_Account.AppendSignature(ev)
 
 	// --- Send to judge ---
 
-	jch, err := j_judge.AddChannel(ev, otx, j_c1, j_c2)
+	jch, err := j_judge.AddChannel(ev, otx, []*j.Account{j_c1, j_c2})
 	if err != nil {
 		t.Fatal(err)
 	}
@@ -0,0 +1,58 @@
+package judge
+
+import (
+	"bytes"
+	"time"
+
+	"github.com/jtremback/usc/core/errs"
+	"github.com/jtremback/usc/core/wire"
+)
+
+// ErrEquivocation is returned for an UpdateTx which has the same
+// SequenceNumber as one the judge already holds, but a different payload.
+var ErrEquivocation = errs.New(errs.Conflict, "conflicting update tx with the same sequence number")
+
+// Equivocation is evidence that the participants of a Channel have all signed
+// two different UpdateTxs with the same SequenceNumber. Held is the one the
+// judge had, and Conflicting is the one it was sent after it. Id is its
+// position in the judge's list of Equivocations.
+type Equivocation struct {
+	Id             uint64
+	ChannelId      string
+	SequenceNumber uint32
+	Held           *wire.Envelope
+	Conflicting    *wire.Envelope
+	Time           time.Time
+}
+
+// sameEnvelope returns true if a and b have the same payload.
+func sameEnvelope(a *wire.Envelope, b *wire.Envelope) bool {
+	return a != nil && b != nil && bytes.Compare(a.Payload, b.Payload) == 0
+}
+
+// HasFullUpdateTx returns true if the judge already holds an UpdateTx with the
+// payload of ev.
+func (ch *Channel) HasFullUpdateTx(ev *wire.Envelope) bool {
+	for _, held := range ch.FullUpdateTxEnvelopes {
+		if sameEnvelope(held, ev) {
+			return true
+		}
+	}
+	return false
+}
+
+// ConflictingUpdateTx returns the Envelope of the UpdateTx the judge holds with
+// the same SequenceNumber as utx but a different payload, if ev has been
+// signed by every participant. It returns nil if there is no conflict.
+func (ch *Channel) ConflictingUpdateTx(ev *wire.Envelope, utx *wire.UpdateTx) *wire.Envelope {
+	if utx.ChannelId != ch.ChannelId || checkSignatures(ev, ch.OpeningTx.Pubkeys) != nil {
+		return nil
+	}
+
+	for i, held := range ch.FullUpdateTxs {
+		if held.SequenceNumber == utx.SequenceNumber && !sameEnvelope(ch.FullUpdateTxEnvelopes[i], ev) {
+			return ch.FullUpdateTxEnvelopes[i]
+		}
+	}
+	return nil
+}
@@ -0,0 +1,16 @@
+package judge
+
+type EventType string
+
+// The events that a Judge reports to the webhooks of its operators.
+const (
+	// A Peer has sent an OpeningTx, which the operators must confirm
+	ChannelProposed EventType = "ChannelProposed"
+	// A ClosingTx or CancelTx has started the Channel's hold period
+	HoldPeriodStarted EventType = "HoldPeriodStarted"
+	// The Channel is CLOSED
+	ChannelClosed EventType = "ChannelClosed"
+	// The participants have signed two different UpdateTxs with the same
+	// SequenceNumber, and the Equivocation has been recorded
+	EquivocationDetected EventType = "EquivocationDetected"
+)
@@ -3,11 +3,16 @@ package judge
 import (
 	"bytes"
 	"crypto/rand"
+	"crypto/sha256"
 	"errors"
+	"fmt"
 	"io"
 	"time"
 
 	"github.com/agl/ed25519"
+	"github.com/golang/protobuf/proto"
+	"github.com/jtremback/usc/core/errs"
+	"github.com/jtremback/usc/core/signer"
 	"github.com/jtremback/usc/core/wire"
 )
 
@@ -43,6 +48,18 @@ func randomBytes(c uint) ([]byte, error) {
 	return b, nil
 }
 
+// Errors returned by Channels. Errors from this package have an errs.Code, and
+// are equal to the one of these with the same Code under errors.Is.
+var (
+	ErrInvalid      = errs.New(errs.Invalid, "tx not valid")
+	ErrNotFound     = errs.New(errs.NotFound, "not found")
+	ErrWrongPhase   = errs.New(errs.WrongPhase, "channel in wrong phase")
+	ErrBadSignature = errs.New(errs.BadSignature, "signature not valid")
+	ErrSeqTooLow    = errs.New(errs.SeqTooLow, "sequence number too low")
+	ErrExpired      = errs.New(errs.Expired, "update tx expired")
+	ErrConflict     = errs.New(errs.Conflict, "already done")
+)
+
 type Phase int
 
 const (
@@ -64,14 +81,26 @@ type Channel struct {
 
 	CloseTime         time.Time
 	ClosingTxEnvelope *wire.Envelope
+	CancelTxEnvelope  *wire.Envelope
 
 	FinalUpdateTx         *wire.UpdateTx
 	FinalUpdateTxEnvelope *wire.Envelope
+	// The HashLocks of FinalUpdateTx whose preimages were revealed in time
+	FinalHashLocks []*wire.HashLock
 
 	Judge    *Judge
 	Accounts []*Account
 
 	FollowOnTxs []*wire.Envelope
+	Preimages   []*Preimage
+}
+
+// Preimage is the preimage of a HashLock's hash, and the time at which it was
+// revealed to the judge.
+type Preimage struct {
+	Preimage   []byte
+	RevealTime time.Time
+	Envelope   *wire.Envelope
 }
 
 type Account struct {
@@ -85,6 +114,9 @@ type Judge struct {
 	Name    string
 	Pubkey  []byte
 	Privkey []byte
+	// If Signer is set, the Judge signs with it instead of Privkey, which can
+	// then be left empty.
+	Signer signer.Signer `json:"-"`
 }
 
 // NewJudge makes a new judge
@@ -101,28 +133,33 @@ func NewJudge(name string) (*Judge, error) {
 	}, nil
 }
 
-func (jd *Judge) AddChannel(ev *wire.Envelope, otx *wire.OpeningTx, acct0 *Account, acct1 *Account) (*Channel, error) {
-	if len(ev.Signatures) != 2 {
-		return nil, errors.New("wrong number of signatures")
+// AddChannel makes a Channel from an OpeningTx signed by every one of its
+// pubkeys. accts are the Accounts of the pubkeys, in the same order.
+func (jd *Judge) AddChannel(ev *wire.Envelope, otx *wire.OpeningTx, accts []*Account) (*Channel, error) {
+	if len(otx.Pubkeys) < 2 {
+		return nil, errs.New(errs.Invalid, "not enough public keys")
 	}
-	if len(otx.Pubkeys) != 2 {
-		return nil, errors.New("wrong number of public keys")
+	if len(accts) != len(otx.Pubkeys) {
+		return nil, errs.New(errs.Invalid, "wrong number of accounts")
 	}
-	if bytes.Compare(acct0.Judge.Pubkey, acct1.Judge.Pubkey) != 0 {
-		return nil, errors.New("accounts do not have matching judges")
+	for i, acct := range accts {
+		if bytes.Compare(acct.Pubkey, otx.Pubkeys[i]) != 0 {
+			return nil, errs.New(errs.Invalid, "accounts do not match public keys")
+		}
+		if bytes.Compare(acct.Judge.Pubkey, accts[0].Judge.Pubkey) != 0 {
+			return nil, errs.New(errs.Invalid, "accounts do not have matching judges")
+		}
 	}
-	if !ed25519.Verify(sliceTo32Byte(otx.Pubkeys[0]), ev.Payload, sliceTo64Byte(ev.Signatures[0])) {
-		return nil, errors.New("signature 0 not valid")
-	}
-	if !ed25519.Verify(sliceTo32Byte(otx.Pubkeys[1]), ev.Payload, sliceTo64Byte(ev.Signatures[1])) {
-		return nil, errors.New("signature 1 not valid")
+	err := checkSignatures(ev, otx.Pubkeys)
+	if err != nil {
+		return nil, err
 	}
 
 	ch := &Channel{
 		ChannelId:         otx.ChannelId,
 		OpeningTx:         otx,
 		OpeningTxEnvelope: ev,
-		Accounts:          []*Account{acct0, acct1},
+		Accounts:          accts,
 		Judge:             jd,
 		Phase:             PENDING_OPEN,
 	}
@@ -130,13 +167,62 @@ func (jd *Judge) AddChannel(ev *wire.Envelope, otx *wire.OpeningTx, acct0 *Accou
 	return ch, nil
 }
 
-func (jd *Judge) AppendSignature(ev *wire.Envelope) {
-	ev.Signatures = append(ev.Signatures, [][]byte{ed25519.Sign(sliceTo64Byte(jd.Privkey), ev.Payload)[:]}...)
+// checkSignatures checks that ev has a valid signature from each of pubkeys, in
+// order.
+func checkSignatures(ev *wire.Envelope, pubkeys [][]byte) error {
+	if len(ev.Signatures) != len(pubkeys) {
+		return errs.New(errs.BadSignature, "wrong number of signatures")
+	}
+	for i, pubkey := range pubkeys {
+		if !ed25519.Verify(sliceTo32Byte(pubkey), ev.Payload, sliceTo64Byte(ev.Signatures[i])) {
+			return errs.New(errs.BadSignature, fmt.Sprintf("signature %d not valid", i))
+		}
+	}
+	return nil
+}
+
+// signedByParticipant returns true if ev has a single signature, made by one of
+// the pubkeys in the channel's OpeningTx.
+func (ch *Channel) signedByParticipant(ev *wire.Envelope) bool {
+	if len(ev.Signatures) != 1 {
+		return false
+	}
+	for _, pubkey := range ch.OpeningTx.Pubkeys {
+		if ed25519.Verify(sliceTo32Byte(pubkey), ev.Payload, sliceTo64Byte(ev.Signatures[0])) {
+			return true
+		}
+	}
+	return false
 }
 
-func (ch *Channel) Confirm() {
-	ch.Judge.AppendSignature(ch.OpeningTxEnvelope)
+// Sign signs payload with the Judge's Signer, or its Privkey if it has no
+// Signer.
+func (jd *Judge) Sign(payload []byte) ([]byte, error) {
+	if jd.Signer != nil {
+		return jd.Signer.Sign(jd.Pubkey, payload)
+	}
+	if len(jd.Privkey) != ed25519.PrivateKeySize {
+		return nil, errors.New("judge has no private key")
+	}
+	return signer.NewMemory(jd.Privkey).Sign(jd.Pubkey, payload)
+}
+
+func (jd *Judge) AppendSignature(ev *wire.Envelope) error {
+	sig, err := jd.Sign(ev.Payload)
+	if err != nil {
+		return err
+	}
+	ev.Signatures = append(ev.Signatures, sig)
+	return nil
+}
+
+func (ch *Channel) Confirm() error {
+	err := ch.Judge.AppendSignature(ch.OpeningTxEnvelope)
+	if err != nil {
+		return err
+	}
 	ch.Phase = OPEN
+	return nil
 }
 
 func (ch *Channel) Sanitize() {
@@ -144,21 +230,29 @@ func (ch *Channel) Sanitize() {
 	ch.Judge = nil
 }
 
+// AddFullUpdateTx adds an UpdateTx signed by every participant. Sending an
+// UpdateTx the judge already holds again does nothing.
 func (ch *Channel) AddFullUpdateTx(ev *wire.Envelope, utx *wire.UpdateTx) error {
+	if ch.HasFullUpdateTx(ev) {
+		return nil
+	}
 	if ch.Phase != OPEN {
-		return errors.New("channel not OPEN")
+		return errs.New(errs.WrongPhase, "channel not OPEN")
 	}
 	if len(ch.FullUpdateTxs) > 0 && ch.FullUpdateTxs[len(ch.FullUpdateTxs)-1].SequenceNumber >= utx.SequenceNumber {
-		return errors.New("sequence number not high enough")
+		return errs.New(errs.SeqTooLow, "sequence number not high enough")
 	}
-	if len(ev.Signatures) != 2 {
-		return errors.New("wrong number of signatures")
+	err := checkSignatures(ev, ch.OpeningTx.Pubkeys)
+	if err != nil {
+		return err
 	}
-	if !ed25519.Verify(sliceTo32Byte(ch.OpeningTx.Pubkeys[0]), ev.Payload, sliceTo64Byte(ev.Signatures[0])) {
-		return errors.New("signature 0 not valid")
+	for _, lock := range utx.HashLocks {
+		if len(lock.Hash) != sha256.Size {
+			return errs.New(errs.Invalid, "hash lock hash is not a sha256 hash")
+		}
 	}
-	if !ed25519.Verify(sliceTo32Byte(ch.OpeningTx.Pubkeys[1]), ev.Payload, sliceTo64Byte(ev.Signatures[1])) {
-		return errors.New("signature 1 not valid")
+	if utx.Expiry != 0 && time.Now().After(time.Unix(0, utx.Expiry)) {
+		return ErrExpired
 	}
 
 	ch.FullUpdateTxs = append(ch.FullUpdateTxs, utx)
@@ -167,70 +261,311 @@ func (ch *Channel) AddFullUpdateTx(ev *wire.Envelope, utx *wire.UpdateTx) error
 	return nil
 }
 
+// LastFullUpdateTxEnvelope returns a copy of the Envelope of the UpdateTx with
+// the highest SequenceNumber, signed by the judge. This lets the peers check
+// which UpdateTx the judge is holding.
+func (ch *Channel) LastFullUpdateTxEnvelope() (*wire.Envelope, error) {
+	if len(ch.FullUpdateTxEnvelopes) == 0 {
+		return nil, errs.New(errs.NotFound, "no full update txs")
+	}
+
+	last := ch.FullUpdateTxEnvelopes[len(ch.FullUpdateTxEnvelopes)-1]
+	ev := &wire.Envelope{
+		Payload:    last.Payload,
+		Signatures: append([][]byte{}, last.Signatures...),
+	}
+	err := ch.Judge.AppendSignature(ev)
+	if err != nil {
+		return nil, err
+	}
+
+	return ev, nil
+}
+
+// AddClosingTx starts the hold period on a channel. Sending the same ClosingTx
+// again does nothing.
 func (ch *Channel) AddClosingTx(ev *wire.Envelope) error {
-	if ch.Phase != OPEN {
-		return errors.New("channel not OPEN")
+	if sameEnvelope(ch.ClosingTxEnvelope, ev) {
+		return nil
 	}
-	if len(ev.Signatures) != 1 {
-		return errors.New("wrong number of signatures")
+	if ch.Phase != OPEN {
+		return errs.New(errs.WrongPhase, "channel not OPEN")
 	}
-	if !ed25519.Verify(sliceTo32Byte(ch.Accounts[0].Pubkey), ev.Payload, sliceTo64Byte(ev.Signatures[0])) &&
-		!ed25519.Verify(sliceTo32Byte(ch.Accounts[1].Pubkey), ev.Payload, sliceTo64Byte(ev.Signatures[0])) {
-		return errors.New("signature not valid")
+	if !ch.signedByParticipant(ev) {
+		return ErrBadSignature
 	}
 
 	ch.ClosingTxEnvelope = ev
+	if ch.CloseTime.IsZero() {
+		ch.CloseTime = time.Now()
+	}
+
+	return nil
+}
+
+// AddCancelTx starts the hold period on a channel which has not had any UpdateTx
+// posted. If no UpdateTx is posted before the hold period is over, the channel
+// can be cancelled, closing it with the state in the OpeningTx. Sending the same
+// CancelTx again does nothing.
+func (ch *Channel) AddCancelTx(ev *wire.Envelope) error {
+	if sameEnvelope(ch.CancelTxEnvelope, ev) {
+		return nil
+	}
+	if ch.Phase != OPEN {
+		return errs.New(errs.WrongPhase, "channel not OPEN")
+	}
+	if !ch.CloseTime.IsZero() {
+		return errs.New(errs.WrongPhase, "channel already closing")
+	}
+	if len(ch.FullUpdateTxs) > 0 {
+		return errs.New(errs.Conflict, "channel has full update txs")
+	}
+	if !ch.signedByParticipant(ev) {
+		return ErrBadSignature
+	}
+
+	ch.CancelTxEnvelope = ev
 	ch.CloseTime = time.Now()
 
 	return nil
 }
 
 func (ch *Channel) AddFollowOnTx(ev *wire.Envelope) error {
-	if ch.Phase != OPEN {
-		return errors.New("channel not OPEN")
+	for _, held := range ch.FollowOnTxs {
+		if sameEnvelope(held, ev) {
+			return nil
+		}
 	}
-	if len(ev.Signatures) != 1 {
-		return errors.New("wrong number of signatures")
+	if ch.Phase != OPEN {
+		return errs.New(errs.WrongPhase, "channel not OPEN")
 	}
-	if !ed25519.Verify(sliceTo32Byte(ch.Accounts[0].Pubkey), ev.Payload, sliceTo64Byte(ev.Signatures[0])) ||
-		!ed25519.Verify(sliceTo32Byte(ch.Accounts[1].Pubkey), ev.Payload, sliceTo64Byte(ev.Signatures[0])) {
-		return errors.New("signature not valid")
+	if !ch.signedByParticipant(ev) {
+		return ErrBadSignature
 	}
 
 	ch.FollowOnTxs = append(ch.FollowOnTxs, ev)
 	return nil
 }
 
+// AddPreimageTx records the time at which the preimage of a HashLock's hash was
+// revealed. It must be signed by one of the channel's accounts, and unlock a
+// HashLock of one of the full UpdateTxs which has not expired yet. Revealing
+// the same preimage again does nothing, and keeps the time it was first
+// revealed.
+func (ch *Channel) AddPreimageTx(ev *wire.Envelope, ptx *wire.PreimageTx) error {
+	for _, pre := range ch.Preimages {
+		if bytes.Equal(pre.Preimage, ptx.Preimage) {
+			return nil
+		}
+	}
+	if ch.Phase != OPEN {
+		return errs.New(errs.WrongPhase, "channel not OPEN")
+	}
+	if !ch.signedByParticipant(ev) {
+		return ErrBadSignature
+	}
+	if ptx.ChannelId != ch.ChannelId {
+		return errs.New(errs.Invalid, "channel id incorrect")
+	}
+
+	now := time.Now()
+	if !ch.pendingHashLock(ptx.Preimage, now) {
+		return errs.New(errs.Invalid, "preimage does not unlock a pending hash lock")
+	}
+
+	ch.Preimages = append(ch.Preimages, &Preimage{
+		Preimage:   ptx.Preimage,
+		RevealTime: now,
+		Envelope:   ev,
+	})
+
+	return nil
+}
+
+// pendingHashLock returns true if preimage unlocks a HashLock of one of the
+// full UpdateTxs which had not expired at time now.
+func (ch *Channel) pendingHashLock(preimage []byte, now time.Time) bool {
+	hash := sha256.Sum256(preimage)
+	for _, utx := range ch.FullUpdateTxs {
+		for _, lock := range utx.HashLocks {
+			if bytes.Equal(hash[:], lock.Hash) && now.Before(time.Unix(0, lock.Expiry)) {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// UnlockedHashLocks returns the HashLocks of an UpdateTx whose preimage was
+// revealed to the judge before the HashLock expired. The state of the other
+// HashLocks is not valid.
+func (ch *Channel) UnlockedHashLocks(utx *wire.UpdateTx) []*wire.HashLock {
+	unlocked := []*wire.HashLock{}
+	for _, lock := range utx.HashLocks {
+		for _, pre := range ch.Preimages {
+			hash := sha256.Sum256(pre.Preimage)
+			if bytes.Equal(hash[:], lock.Hash) && pre.RevealTime.Before(time.Unix(0, lock.Expiry)) {
+				unlocked = append(unlocked, lock)
+				break
+			}
+		}
+	}
+	return unlocked
+}
+
+// resolved returns a copy of utx with only the HashLocks whose preimages were
+// revealed in time, which is the state that the channel would close with.
+func (ch *Channel) resolved(utx *wire.UpdateTx) *wire.UpdateTx {
+	r := *utx
+	r.HashLocks = ch.UnlockedHashLocks(utx)
+	return &r
+}
+
 func (ch *Channel) Close(i int) error {
+	if ch.Phase != OPEN {
+		return errs.New(errs.WrongPhase, "channel not OPEN")
+	}
+	if ch.CloseTime.IsZero() {
+		return errs.New(errs.WrongPhase, "channel not closing")
+	}
 	if len(ch.FullUpdateTxEnvelopes) == 0 {
-		return errors.New("no full update txs")
+		return errs.New(errs.NotFound, "no full update txs")
 	}
 	if i > (len(ch.FullUpdateTxEnvelopes) - 1) {
-		return errors.New("i out of range")
+		return errs.New(errs.Invalid, "i out of range")
 	}
+	// Only the newest UpdateTx can skip the hold period by being Fast, since
+	// an older one could still be superseded.
 	hold := time.Duration(int64(ch.OpeningTx.HoldPeriod))
 	since := time.Since(ch.CloseTime)
-	if hold > since {
-		return errors.New("hold period not over")
+	newest := i == len(ch.FullUpdateTxs)-1
+	if hold > since && !(newest && ch.FullUpdateTxs[i].Fast) {
+		return errs.New(errs.HoldPeriodNotOver, "hold period not over")
 	}
 
 	ev := ch.FullUpdateTxEnvelopes[i]
-	ch.Judge.AppendSignature(ev)
+	err := ch.Judge.AppendSignature(ev)
+	if err != nil {
+		return err
+	}
 
 	ch.FinalUpdateTx = ch.FullUpdateTxs[i]
 	ch.FinalUpdateTxEnvelope = ev
+	ch.FinalHashLocks = ch.UnlockedHashLocks(ch.FinalUpdateTx)
 	ch.Phase = CLOSED
 
 	return nil
 }
 
+// Cancel closes the channel with the state in the OpeningTx, once the hold
+// period is over.
 func (ch *Channel) Cancel() error {
+	if ch.Phase != OPEN {
+		return errs.New(errs.WrongPhase, "channel not OPEN")
+	}
+	if ch.CloseTime.IsZero() {
+		return errs.New(errs.WrongPhase, "channel not closing")
+	}
 	hold := time.Duration(int64(ch.OpeningTx.HoldPeriod))
 	since := time.Since(ch.CloseTime)
 	if hold > since {
-		return errors.New("hold period not over")
+		return errs.New(errs.HoldPeriodNotOver, "hold period not over")
 	}
 
 	ch.Phase = CLOSED
 	return nil
 }
+
+// HoldPeriodOver returns true if the channel is closing and its hold period was
+// over at time now.
+func (ch *Channel) HoldPeriodOver(now time.Time) bool {
+	if ch.CloseTime.IsZero() {
+		return false
+	}
+	hold := time.Duration(int64(ch.OpeningTx.HoldPeriod))
+	return !now.Before(ch.CloseTime.Add(hold))
+}
+
+func (ch *Channel) followOnTxs() ([]*wire.FollowOnTx, error) {
+	ftxs := []*wire.FollowOnTx{}
+	for _, ev := range ch.FollowOnTxs {
+		ftx := &wire.FollowOnTx{}
+		err := proto.Unmarshal(ev.Payload, ftx)
+		if err != nil {
+			return nil, err
+		}
+		ftxs = append(ftxs, ftx)
+	}
+	return ftxs, nil
+}
+
+func valid(v StateValidator, otx *wire.OpeningTx, utx *wire.UpdateTx, ftxs []*wire.FollowOnTx) bool {
+	if v == nil {
+		return true
+	}
+	if v.ValidateUpdateTx(otx, utx) != nil {
+		return false
+	}
+	if v.ValidateFollowOnTxs(otx, utx, ftxs) != nil {
+		return false
+	}
+	return true
+}
+
+// Finalize closes the channel once the hold period is over. The UpdateTxs are
+// checked with the StateValidator from the highest SequenceNumber to the lowest,
+// and the channel is closed with the first one that is valid along with the
+// channel's FollowOnTxs. Each is checked with only the HashLocks that were
+// unlocked in time. If none are valid, the channel is cancelled. If v is nil,
+// every UpdateTx is considered valid.
+func (ch *Channel) Finalize(v StateValidator) error {
+	if ch.Phase != OPEN {
+		return errs.New(errs.WrongPhase, "channel not OPEN")
+	}
+	if !ch.HoldPeriodOver(time.Now()) {
+		return errs.New(errs.HoldPeriodNotOver, "hold period not over")
+	}
+
+	ftxs, err := ch.followOnTxs()
+	if err != nil {
+		return err
+	}
+
+	for i := len(ch.FullUpdateTxs) - 1; i >= 0; i-- {
+		if valid(v, ch.OpeningTx, ch.resolved(ch.FullUpdateTxs[i]), ftxs) {
+			return ch.Close(i)
+		}
+	}
+
+	return ch.Cancel()
+}
+
+// CloseFast closes the channel without waiting for the hold period, if a
+// ClosingTx has been received and the UpdateTx with the highest SequenceNumber
+// has Fast set and is valid. It returns true if the channel was closed.
+func (ch *Channel) CloseFast(v StateValidator) (bool, error) {
+	if ch.Phase != OPEN || ch.ClosingTxEnvelope == nil || len(ch.FullUpdateTxs) == 0 {
+		return false, nil
+	}
+
+	i := len(ch.FullUpdateTxs) - 1
+	if !ch.FullUpdateTxs[i].Fast {
+		return false, nil
+	}
+
+	ftxs, err := ch.followOnTxs()
+	if err != nil {
+		return false, err
+	}
+
+	if !valid(v, ch.OpeningTx, ch.resolved(ch.FullUpdateTxs[i]), ftxs) {
+		return false, nil
+	}
+
+	err = ch.Close(i)
+	if err != nil {
+		return false, err
+	}
+
+	return true, nil
+}
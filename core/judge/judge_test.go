@@ -0,0 +1,121 @@
+package judge
+
+import (
+	"crypto/rand"
+	"testing"
+	"time"
+
+	"github.com/agl/ed25519"
+	"github.com/golang/protobuf/proto"
+	"github.com/jtremback/usc/core/errs"
+	"github.com/jtremback/usc/core/wire"
+)
+
+// testChannel returns an OPEN Channel between two new accounts, and their
+// private keys.
+func testChannel(t *testing.T) (*Channel, []*[64]byte) {
+	otx := &wire.OpeningTx{ChannelId: "shibby"}
+	privs := []*[64]byte{}
+	for i := 0; i < 2; i++ {
+		pub, priv, err := ed25519.GenerateKey(rand.Reader)
+		if err != nil {
+			t.Fatal(err)
+		}
+		otx.Pubkeys = append(otx.Pubkeys, pub[:])
+		privs = append(privs, priv)
+	}
+
+	return &Channel{
+		ChannelId: otx.ChannelId,
+		Phase:     OPEN,
+		OpeningTx: otx,
+	}, privs
+}
+
+// signUpdateTx returns utx in an Envelope signed with each of privs.
+func signUpdateTx(t *testing.T, utx *wire.UpdateTx, privs []*[64]byte) *wire.Envelope {
+	b, err := proto.Marshal(utx)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	ev := &wire.Envelope{Payload: b}
+	for _, priv := range privs {
+		ev.Signatures = append(ev.Signatures, ed25519.Sign(priv, b)[:])
+	}
+	return ev
+}
+
+func TestBadSignature(t *testing.T) {
+	ch, privs := testChannel(t)
+
+	utx := &wire.UpdateTx{ChannelId: ch.ChannelId, SequenceNumber: 1}
+	ev := signUpdateTx(t, utx, []*[64]byte{privs[0], privs[0]})
+
+	err := ch.AddFullUpdateTx(ev, utx)
+	if errs.CodeOf(err) != errs.BadSignature {
+		t.Fatal("update tx with a bad signature should be bad_signature", err)
+	}
+}
+
+func TestCloseOldFastUpdateTx(t *testing.T) {
+	ch, privs := testChannel(t)
+	ch.OpeningTx.HoldPeriod = uint64(time.Hour)
+
+	for _, utx := range []*wire.UpdateTx{
+		{ChannelId: ch.ChannelId, SequenceNumber: 1, Fast: true},
+		{ChannelId: ch.ChannelId, SequenceNumber: 2},
+	} {
+		err := ch.AddFullUpdateTx(signUpdateTx(t, utx, privs), utx)
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+	ch.CloseTime = time.Now()
+
+	err := ch.Close(0)
+	if errs.CodeOf(err) != errs.HoldPeriodNotOver {
+		t.Fatal("an old fast update tx should not skip the hold period", err)
+	}
+
+	closed, err := ch.CloseFast(nil)
+	if err != nil || closed {
+		t.Fatal("channel should not close fast when the newest update tx is not fast", err)
+	}
+	if ch.Phase != OPEN {
+		t.Fatal("channel should still be open")
+	}
+}
+
+func TestConflictingUpdateTx(t *testing.T) {
+	ch, privs := testChannel(t)
+
+	utx := &wire.UpdateTx{ChannelId: ch.ChannelId, SequenceNumber: 1, State: []byte{30}}
+	held := signUpdateTx(t, utx, privs)
+	err := ch.AddFullUpdateTx(held, utx)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// Sending the same UpdateTx again does nothing.
+	err = ch.AddFullUpdateTx(signUpdateTx(t, utx, privs), utx)
+	if err != nil || len(ch.FullUpdateTxs) != 1 {
+		t.Fatal("resending an update tx should do nothing", err)
+	}
+	if ch.ConflictingUpdateTx(held, utx) != nil {
+		t.Fatal("the same update tx sent again is not a conflict")
+	}
+
+	conflict := &wire.UpdateTx{ChannelId: ch.ChannelId, SequenceNumber: 1, State: []byte{9}}
+	if ch.ConflictingUpdateTx(signUpdateTx(t, conflict, privs), conflict) != held {
+		t.Fatal("a different update tx with the same sequence number is a conflict")
+	}
+	if ch.ConflictingUpdateTx(signUpdateTx(t, conflict, privs[:1]), conflict) != nil {
+		t.Fatal("an update tx not signed by every participant is not evidence of a conflict")
+	}
+
+	other := &wire.UpdateTx{ChannelId: ch.ChannelId, SequenceNumber: 2, State: []byte{9}}
+	if ch.ConflictingUpdateTx(signUpdateTx(t, other, privs), other) != nil {
+		t.Fatal("an update tx with another sequence number is not a conflict")
+	}
+}
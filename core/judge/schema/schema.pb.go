@@ -0,0 +1,192 @@
+// Code generated by protoc-gen-go.
+// source: judge/schema/schema.proto
+// DO NOT EDIT!
+
+/*
+Package schema is a generated protocol buffer package.
+
+It is generated from these files:
+	judge/schema/schema.proto
+
+It has these top-level messages:
+	Channel
+	Preimage
+*/
+package schema
+
+import proto "github.com/golang/protobuf/proto"
+import fmt "fmt"
+import math "math"
+import wire "github.com/jtremback/usc/core/wire"
+
+// Reference imports to suppress errors if they are not otherwise used.
+var _ = proto.Marshal
+var _ = fmt.Errorf
+var _ = math.Inf
+
+// This is a compile-time assertion to ensure that this generated file
+// is compatible with the proto package it is being compiled against.
+const _ = proto.ProtoPackageIsVersion1
+
+// Channel is a core/judge Channel as it is stored by judge/access. The Judge
+// and Accounts are stored in their own buckets, and are referred to by pubkey.
+type Channel struct {
+	ChannelId             string           `protobuf:"bytes,1,opt,name=channel_id" json:"channel_id,omitempty"`
+	Phase                 uint32           `protobuf:"varint,2,opt,name=phase" json:"phase,omitempty"`
+	OpeningTx             *wire.OpeningTx  `protobuf:"bytes,3,opt,name=opening_tx" json:"opening_tx,omitempty"`
+	OpeningTxEnvelope     *wire.Envelope   `protobuf:"bytes,4,opt,name=opening_tx_envelope" json:"opening_tx_envelope,omitempty"`
+	FullUpdateTxs         []*wire.UpdateTx `protobuf:"bytes,5,rep,name=full_update_txs" json:"full_update_txs,omitempty"`
+	FullUpdateTxEnvelopes []*wire.Envelope `protobuf:"bytes,6,rep,name=full_update_tx_envelopes" json:"full_update_tx_envelopes,omitempty"`
+	// Unix time in nanoseconds, or zero if the channel is not closing.
+	CloseTime             int64            `protobuf:"varint,7,opt,name=close_time" json:"close_time,omitempty"`
+	ClosingTxEnvelope     *wire.Envelope   `protobuf:"bytes,8,opt,name=closing_tx_envelope" json:"closing_tx_envelope,omitempty"`
+	CancelTxEnvelope      *wire.Envelope   `protobuf:"bytes,9,opt,name=cancel_tx_envelope" json:"cancel_tx_envelope,omitempty"`
+	FinalUpdateTx         *wire.UpdateTx   `protobuf:"bytes,10,opt,name=final_update_tx" json:"final_update_tx,omitempty"`
+	FinalUpdateTxEnvelope *wire.Envelope   `protobuf:"bytes,11,opt,name=final_update_tx_envelope" json:"final_update_tx_envelope,omitempty"`
+	FinalHashLocks        []*wire.HashLock `protobuf:"bytes,12,rep,name=final_hash_locks" json:"final_hash_locks,omitempty"`
+	JudgePubkey           []byte           `protobuf:"bytes,13,opt,name=judge_pubkey,proto3" json:"judge_pubkey,omitempty"`
+	AccountPubkeys        [][]byte         `protobuf:"bytes,14,rep,name=account_pubkeys,proto3" json:"account_pubkeys,omitempty"`
+	FollowOnTxs           []*wire.Envelope `protobuf:"bytes,15,rep,name=follow_on_txs" json:"follow_on_txs,omitempty"`
+	Preimages             []*Preimage      `protobuf:"bytes,16,rep,name=preimages" json:"preimages,omitempty"`
+}
+
+func (m *Channel) Reset()                    { *m = Channel{} }
+func (m *Channel) String() string            { return proto.CompactTextString(m) }
+func (*Channel) ProtoMessage()               {}
+func (*Channel) Descriptor() ([]byte, []int) { return fileDescriptor0, []int{0} }
+
+func (m *Channel) GetOpeningTx() *wire.OpeningTx {
+	if m != nil {
+		return m.OpeningTx
+	}
+	return nil
+}
+
+func (m *Channel) GetOpeningTxEnvelope() *wire.Envelope {
+	if m != nil {
+		return m.OpeningTxEnvelope
+	}
+	return nil
+}
+
+func (m *Channel) GetFullUpdateTxs() []*wire.UpdateTx {
+	if m != nil {
+		return m.FullUpdateTxs
+	}
+	return nil
+}
+
+func (m *Channel) GetFullUpdateTxEnvelopes() []*wire.Envelope {
+	if m != nil {
+		return m.FullUpdateTxEnvelopes
+	}
+	return nil
+}
+
+func (m *Channel) GetClosingTxEnvelope() *wire.Envelope {
+	if m != nil {
+		return m.ClosingTxEnvelope
+	}
+	return nil
+}
+
+func (m *Channel) GetCancelTxEnvelope() *wire.Envelope {
+	if m != nil {
+		return m.CancelTxEnvelope
+	}
+	return nil
+}
+
+func (m *Channel) GetFinalUpdateTx() *wire.UpdateTx {
+	if m != nil {
+		return m.FinalUpdateTx
+	}
+	return nil
+}
+
+func (m *Channel) GetFinalUpdateTxEnvelope() *wire.Envelope {
+	if m != nil {
+		return m.FinalUpdateTxEnvelope
+	}
+	return nil
+}
+
+func (m *Channel) GetFinalHashLocks() []*wire.HashLock {
+	if m != nil {
+		return m.FinalHashLocks
+	}
+	return nil
+}
+
+func (m *Channel) GetFollowOnTxs() []*wire.Envelope {
+	if m != nil {
+		return m.FollowOnTxs
+	}
+	return nil
+}
+
+func (m *Channel) GetPreimages() []*Preimage {
+	if m != nil {
+		return m.Preimages
+	}
+	return nil
+}
+
+type Preimage struct {
+	Preimage []byte `protobuf:"bytes,1,opt,name=preimage,proto3" json:"preimage,omitempty"`
+	// Unix time in nanoseconds.
+	RevealTime int64          `protobuf:"varint,2,opt,name=reveal_time" json:"reveal_time,omitempty"`
+	Envelope   *wire.Envelope `protobuf:"bytes,3,opt,name=envelope" json:"envelope,omitempty"`
+}
+
+func (m *Preimage) Reset()                    { *m = Preimage{} }
+func (m *Preimage) String() string            { return proto.CompactTextString(m) }
+func (*Preimage) ProtoMessage()               {}
+func (*Preimage) Descriptor() ([]byte, []int) { return fileDescriptor0, []int{1} }
+
+func (m *Preimage) GetEnvelope() *wire.Envelope {
+	if m != nil {
+		return m.Envelope
+	}
+	return nil
+}
+
+func init() {
+	proto.RegisterType((*Channel)(nil), "judge.schema.Channel")
+	proto.RegisterType((*Preimage)(nil), "judge.schema.Preimage")
+}
+
+var fileDescriptor0 = []byte{
+	// 486 bytes of a gzipped FileDescriptorProto
+	0x1f, 0x8b, 0x08, 0x00, 0x00, 0x00, 0x00, 0x00, 0x02, 0xff, 0x6c, 0x53, 0x51, 0x6f, 0xd3, 0x30,
+	0x10, 0x56, 0x56, 0xd6, 0x35, 0x97, 0xb4, 0x29, 0x86, 0x21, 0x33, 0x09, 0x11, 0xf6, 0x42, 0xc4,
+	0x43, 0x26, 0x0d, 0x84, 0x78, 0x40, 0x3c, 0x80, 0x10, 0x20, 0x21, 0x6d, 0xb2, 0xca, 0x0b, 0x2f,
+	0x91, 0x97, 0xde, 0x9a, 0x50, 0xd7, 0x8e, 0xea, 0x64, 0x2b, 0x3f, 0x8e, 0xff, 0x86, 0x62, 0x27,
+	0x69, 0x3a, 0xe5, 0xa5, 0xf5, 0x7d, 0xf7, 0x7d, 0x77, 0xbe, 0x2f, 0x67, 0x78, 0xfe, 0xa7, 0x5a,
+	0xae, 0xf0, 0x42, 0xa7, 0x19, 0x6e, 0x78, 0xf3, 0x17, 0x17, 0x5b, 0x55, 0x2a, 0xe2, 0x9b, 0x54,
+	0x6c, 0xb1, 0xb3, 0xe0, 0x3e, 0xdf, 0xe2, 0x45, 0xfd, 0x63, 0xd3, 0xe7, 0xff, 0xc6, 0x70, 0xf2,
+	0x25, 0xe3, 0x52, 0xa2, 0x20, 0x2f, 0x00, 0x52, 0x7b, 0x4c, 0xf2, 0x25, 0x75, 0x42, 0x27, 0x72,
+	0x99, 0xdb, 0x20, 0x3f, 0x96, 0xe4, 0x29, 0x1c, 0x17, 0x19, 0xd7, 0x48, 0x8f, 0x42, 0x27, 0x9a,
+	0x32, 0x1b, 0x90, 0x18, 0x40, 0x15, 0x28, 0x73, 0xb9, 0x4a, 0xca, 0x1d, 0x1d, 0x85, 0x4e, 0xe4,
+	0x5d, 0x06, 0xb1, 0xe9, 0x70, 0x65, 0xf1, 0xc5, 0x8e, 0xb9, 0xaa, 0x3d, 0x92, 0x4f, 0xf0, 0x64,
+	0xcf, 0x4f, 0x50, 0xde, 0xa1, 0x50, 0x05, 0xd2, 0x47, 0x46, 0x38, 0xb3, 0xc2, 0xaf, 0x0d, 0xca,
+	0x1e, 0x77, 0xba, 0x16, 0x22, 0xef, 0x21, 0xb8, 0xad, 0x84, 0x48, 0xaa, 0x62, 0xc9, 0x4b, 0x4c,
+	0xca, 0x9d, 0xa6, 0xc7, 0xe1, 0x68, 0xaf, 0xfd, 0x65, 0xf0, 0xc5, 0x8e, 0x4d, 0x6b, 0x5a, 0x1b,
+	0x69, 0xf2, 0x0d, 0xe8, 0xa1, 0xae, 0xeb, 0xad, 0xe9, 0xb8, 0x5f, 0xa0, 0x6b, 0x7e, 0xda, 0x2f,
+	0xd0, 0xa2, 0xda, 0xb8, 0x24, 0x94, 0xc6, 0xa4, 0xcc, 0x37, 0x48, 0x4f, 0x42, 0x27, 0x1a, 0x31,
+	0xd7, 0x20, 0x8b, 0x7c, 0x83, 0xf5, 0x7c, 0x75, 0xf0, 0x70, 0xbe, 0xc9, 0xf0, 0x7c, 0x0d, 0xb5,
+	0x37, 0xdf, 0x47, 0x20, 0x29, 0x97, 0x29, 0x8a, 0x03, 0xb9, 0x3b, 0x28, 0x9f, 0x5b, 0xe6, 0x03,
+	0x77, 0x72, 0xc9, 0x7b, 0x63, 0x52, 0xe8, 0x4b, 0x7b, 0xee, 0xd4, 0xb4, 0x36, 0x34, 0xee, 0x1c,
+	0xea, 0xf6, 0xbd, 0xbd, 0xc1, 0xde, 0xa7, 0x07, 0x05, 0xba, 0x0b, 0x7c, 0x80, 0xb9, 0x2d, 0x94,
+	0x71, 0x9d, 0x25, 0x42, 0xa5, 0x6b, 0x4d, 0xfd, 0xbe, 0xbd, 0xdf, 0xb9, 0xce, 0x7e, 0xaa, 0x74,
+	0xcd, 0x66, 0x86, 0xd7, 0x86, 0x9a, 0xbc, 0x02, 0xbb, 0xaa, 0x49, 0x51, 0xdd, 0xac, 0xf1, 0x2f,
+	0x9d, 0x86, 0x4e, 0xe4, 0x33, 0xcf, 0x60, 0xd7, 0x06, 0x22, 0xaf, 0x21, 0xe0, 0x69, 0xaa, 0x2a,
+	0x59, 0x36, 0x24, 0x4d, 0x67, 0xe1, 0x28, 0xf2, 0xd9, 0xac, 0x81, 0x2d, 0x4f, 0x93, 0x4b, 0x98,
+	0xde, 0x2a, 0x21, 0xd4, 0x7d, 0xa2, 0xa4, 0x59, 0x91, 0x60, 0xf0, 0x0b, 0x7b, 0x96, 0x74, 0x25,
+	0xeb, 0x05, 0x79, 0x07, 0x6e, 0xb1, 0xc5, 0x7c, 0xc3, 0x57, 0xa8, 0xe9, 0xdc, 0xf0, 0x9f, 0xc5,
+	0xfd, 0xc7, 0x13, 0x5f, 0x37, 0x69, 0xb6, 0x27, 0x9e, 0x6b, 0x98, 0xb4, 0x30, 0x39, 0x83, 0x49,
+	0x9b, 0x30, 0xaf, 0xc7, 0x67, 0x5d, 0x4c, 0x5e, 0x82, 0xb7, 0xc5, 0x3b, 0xe4, 0xc2, 0xae, 0xcd,
+	0x91, 0x59, 0x1b, 0xb0, 0x90, 0xd9, 0x9b, 0x37, 0x30, 0xe9, 0x1c, 0x1f, 0x0d, 0x3a, 0xde, 0xe5,
+	0x3f, 0x4f, 0x7e, 0x8f, 0xed, 0x95, 0x6e, 0xc6, 0xe6, 0x15, 0xbf, 0xfd, 0x3f, 0x00, 0x60, 0x5b,
+	0xc5, 0x4c, 0x01, 0x04, 0x00, 0x00,
+}
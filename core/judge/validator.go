@@ -0,0 +1,92 @@
+package judge
+
+import (
+	"encoding/base64"
+	"encoding/json"
+	"math"
+
+	"github.com/jtremback/usc/core/errs"
+	"github.com/jtremback/usc/core/wire"
+)
+
+// StateValidator checks the application-specific validity of a channel's state,
+// which the judge otherwise treats as opaque bytes.
+type StateValidator interface {
+	// ValidateOpeningTx is called before a channel is added.
+	ValidateOpeningTx(otx *wire.OpeningTx) error
+	// ValidateUpdateTx is called before an UpdateTx is added, and again when
+	// the channel is finalized, with only the HashLocks whose preimages were
+	// revealed before they expired.
+	ValidateUpdateTx(otx *wire.OpeningTx, utx *wire.UpdateTx) error
+	// ValidateFollowOnTxs is called when the channel is finalized, with the
+	// UpdateTx that the channel would be closed with.
+	ValidateFollowOnTxs(otx *wire.OpeningTx, utx *wire.UpdateTx, ftxs []*wire.FollowOnTx) error
+}
+
+// BalanceValidator validates channels whose state is a JSON object mapping the
+// base64url encoded pubkey of each participant to their balance, as in the
+// simple payment channel example:
+//
+//	{"R5lVVs82M80i5OpR369StJqaHS61Ld-PzTCfS-0zyAA=":100,"prNVb9C260wELZ3RYmrJ9TsZ_2NCGYcUBVZSSGHUsYQ=":100}
+//
+// Every participant must have a balance, no balance can be negative, the total
+// must fit in an int64, and it cannot change from the total in the OpeningTx.
+type BalanceValidator struct{}
+
+func (v *BalanceValidator) total(otx *wire.OpeningTx, state []byte) (int64, error) {
+	bals := map[string]int64{}
+	err := json.Unmarshal(state, &bals)
+	if err != nil {
+		return 0, errs.New(errs.Invalid, "state is not a balance map")
+	}
+
+	if len(bals) != len(otx.Pubkeys) {
+		return 0, errs.New(errs.Invalid, "wrong number of balances")
+	}
+
+	var total int64
+	for _, pubkey := range otx.Pubkeys {
+		bal, ok := bals[base64.URLEncoding.EncodeToString(pubkey)]
+		if !ok {
+			return 0, errs.New(errs.Invalid, "participant has no balance")
+		}
+		if bal < 0 {
+			return 0, errs.New(errs.Invalid, "balance is negative")
+		}
+		if total > math.MaxInt64-bal {
+			return 0, errs.New(errs.Invalid, "total balance is too large")
+		}
+		total += bal
+	}
+
+	return total, nil
+}
+
+func (v *BalanceValidator) ValidateOpeningTx(otx *wire.OpeningTx) error {
+	_, err := v.total(otx, otx.State)
+	return err
+}
+
+func (v *BalanceValidator) ValidateUpdateTx(otx *wire.OpeningTx, utx *wire.UpdateTx) error {
+	openingTotal, err := v.total(otx, otx.State)
+	if err != nil {
+		return err
+	}
+
+	total, err := v.total(otx, utx.State)
+	if err != nil {
+		return err
+	}
+
+	if total != openingTotal {
+		return errs.New(errs.Invalid, "total balance has changed")
+	}
+
+	return nil
+}
+
+// ValidateFollowOnTxs accepts any FollowOnTxs, as the balance map has no use
+// for them.
+func (v *BalanceValidator) ValidateFollowOnTxs(otx *wire.OpeningTx, utx *wire.UpdateTx, ftxs []*wire.FollowOnTx) error {
+	return nil
+}
@@ -0,0 +1,87 @@
+package judge
+
+import (
+	"encoding/base64"
+	"fmt"
+	"math"
+	"testing"
+
+	"github.com/jtremback/usc/core/wire"
+)
+
+var pubkey0 = []byte{71, 153, 85, 86, 207, 54, 51, 205, 34, 228, 234, 81, 223, 175, 82, 180, 154, 154, 29, 46, 181, 45, 223, 143, 205, 48, 159, 75, 237, 51, 200, 0}
+var pubkey1 = []byte{166, 179, 85, 111, 208, 182, 235, 76, 4, 45, 157, 209, 98, 106, 201, 245, 59, 25, 255, 99, 66, 25, 135, 20, 5, 86, 82, 72, 97, 212, 177, 132}
+
+func balanceState(bal0 int64, bal1 int64) []byte {
+	return []byte(fmt.Sprintf(`{"%s":%d,"%s":%d}`,
+		base64.URLEncoding.EncodeToString(pubkey0), bal0,
+		base64.URLEncoding.EncodeToString(pubkey1), bal1,
+	))
+}
+
+func TestBalanceValidator(t *testing.T) {
+	v := &BalanceValidator{}
+
+	otx := &wire.OpeningTx{
+		ChannelId: "shibby",
+		Pubkeys:   [][]byte{pubkey0, pubkey1},
+		State:     balanceState(100, 100),
+	}
+
+	err := v.ValidateOpeningTx(otx)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	err = v.ValidateOpeningTx(&wire.OpeningTx{
+		Pubkeys: otx.Pubkeys,
+		State:   []byte("blue"),
+	})
+	if err == nil {
+		t.Fatal("state that is not a balance map should not be valid")
+	}
+
+	err = v.ValidateOpeningTx(&wire.OpeningTx{
+		Pubkeys: otx.Pubkeys,
+		State:   []byte(`{"foo":100,"bar":100}`),
+	})
+	if err == nil {
+		t.Fatal("balance map without participants should not be valid")
+	}
+
+	err = v.ValidateUpdateTx(otx, &wire.UpdateTx{State: balanceState(150, 50)})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	err = v.ValidateUpdateTx(otx, &wire.UpdateTx{State: balanceState(250, -50)})
+	if err == nil {
+		t.Fatal("negative balance should not be valid")
+	}
+
+	err = v.ValidateUpdateTx(otx, &wire.UpdateTx{State: balanceState(150, 100)})
+	if err == nil {
+		t.Fatal("changed total should not be valid")
+	}
+
+	// Balances that add up to the opening total only once the sum has
+	// overflowed.
+	pubkey2 := make([]byte, 32)
+	otx3 := &wire.OpeningTx{
+		ChannelId: "shibby",
+		Pubkeys:   [][]byte{pubkey0, pubkey1, pubkey2},
+		State: []byte(fmt.Sprintf(`{"%s":100,"%s":100,"%s":0}`,
+			base64.URLEncoding.EncodeToString(pubkey0),
+			base64.URLEncoding.EncodeToString(pubkey1),
+			base64.URLEncoding.EncodeToString(pubkey2),
+		)),
+	}
+	err = v.ValidateUpdateTx(otx3, &wire.UpdateTx{State: []byte(fmt.Sprintf(`{"%s":%d,"%s":%d,"%s":202}`,
+		base64.URLEncoding.EncodeToString(pubkey0), int64(math.MaxInt64),
+		base64.URLEncoding.EncodeToString(pubkey1), int64(math.MaxInt64),
+		base64.URLEncoding.EncodeToString(pubkey2),
+	))})
+	if err == nil {
+		t.Fatal("balances whose total overflows should not be valid")
+	}
+}
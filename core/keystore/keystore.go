@@ -0,0 +1,332 @@
+// Package keystore keeps private keys encrypted with a key derived from a
+// passphrase. The keys can only be used to sign while the keystore is
+// unlocked.
+package keystore
+
+import (
+	"bytes"
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/rand"
+	"encoding/hex"
+	"errors"
+	"sync"
+
+	"github.com/agl/ed25519"
+	"github.com/jtremback/usc/core/errs"
+	"golang.org/x/crypto/scrypt"
+)
+
+var (
+	ErrLocked        = errs.New(errs.Locked, "keystore is locked")
+	ErrBadPassphrase = errs.New(errs.BadPassphrase, "wrong passphrase")
+	ErrNoKey         = errs.New(errs.NotFound, "key not in keystore")
+	// The keystore gets its passphrase when it is first unlocked
+	ErrNoPassphrase = errs.New(errs.Locked, "keystore has no passphrase")
+)
+
+// scrypt parameters for deriving the encryption key from the passphrase
+const (
+	scryptN = 1 << 15
+	scryptR = 8
+	scryptP = 1
+	keyLen  = 32
+	saltLen = 32
+)
+
+// check is encrypted with the derived key, so that a wrong passphrase can be
+// told apart from corrupted keys.
+var check = []byte("usc keystore")
+
+// Keystore holds ed25519 private keys encrypted with AES-GCM. The exported
+// fields are what gets stored, the decrypted keys are only kept in memory
+// between Unlock and Lock.
+type Keystore struct {
+	// Salt that the encryption key is derived from the passphrase with. It is
+	// empty until the keystore is first unlocked.
+	Salt []byte
+	// Check encrypted with the encryption key
+	Check []byte
+	// Encrypted private keys, keyed by hex encoded public key
+	Keys map[string][]byte
+
+	mu       sync.RWMutex
+	key      []byte
+	privkeys map[string][]byte
+}
+
+func New() *Keystore {
+	return &Keystore{
+		Keys: map[string][]byte{},
+	}
+}
+
+func deriveKey(passphrase string, salt []byte) ([]byte, error) {
+	return scrypt.Key([]byte(passphrase), salt, scryptN, scryptR, scryptP, keyLen)
+}
+
+func seal(key []byte, plaintext []byte, data []byte) ([]byte, error) {
+	block, err := aes.NewCipher(key)
+	if err != nil {
+		return nil, err
+	}
+	gcm, err := cipher.NewGCM(block)
+	if err != nil {
+		return nil, err
+	}
+
+	nonce := make([]byte, gcm.NonceSize())
+	_, err = rand.Read(nonce)
+	if err != nil {
+		return nil, err
+	}
+
+	return gcm.Seal(nonce, nonce, plaintext, data), nil
+}
+
+func open(key []byte, ciphertext []byte, data []byte) ([]byte, error) {
+	block, err := aes.NewCipher(key)
+	if err != nil {
+		return nil, err
+	}
+	gcm, err := cipher.NewGCM(block)
+	if err != nil {
+		return nil, err
+	}
+
+	if len(ciphertext) < gcm.NonceSize() {
+		return nil, errors.New("ciphertext too short")
+	}
+
+	return gcm.Open(nil, ciphertext[:gcm.NonceSize()], ciphertext[gcm.NonceSize():], data)
+}
+
+// newKey makes a new salt and check for the passphrase, and returns the
+// encryption key.
+func (ks *Keystore) newKey(passphrase string) ([]byte, error) {
+	salt := make([]byte, saltLen)
+	_, err := rand.Read(salt)
+	if err != nil {
+		return nil, err
+	}
+
+	key, err := deriveKey(passphrase, salt)
+	if err != nil {
+		return nil, err
+	}
+
+	chk, err := seal(key, check, nil)
+	if err != nil {
+		return nil, err
+	}
+
+	ks.Salt = salt
+	ks.Check = chk
+	return key, nil
+}
+
+// checkPassphrase returns the encryption key if the passphrase is correct.
+func (ks *Keystore) checkPassphrase(passphrase string) ([]byte, error) {
+	key, err := deriveKey(passphrase, ks.Salt)
+	if err != nil {
+		return nil, err
+	}
+
+	_, err = open(key, ks.Check, nil)
+	if err != nil {
+		return nil, ErrBadPassphrase
+	}
+
+	return key, nil
+}
+
+// decryptKeys decrypts every key in the keystore.
+func (ks *Keystore) decryptKeys(key []byte) (map[string][]byte, error) {
+	privkeys := map[string][]byte{}
+	for pubkey, ciphertext := range ks.Keys {
+		privkey, err := open(key, ciphertext, []byte(pubkey))
+		if err != nil {
+			zeroKeys(privkeys)
+			return nil, errors.New("could not decrypt key " + pubkey)
+		}
+		privkeys[pubkey] = privkey
+	}
+	return privkeys, nil
+}
+
+// Unlock decrypts the keys with the passphrase so that they can be used to
+// sign. The first time a keystore is unlocked sets its passphrase.
+func (ks *Keystore) Unlock(passphrase string) error {
+	ks.mu.Lock()
+	defer ks.mu.Unlock()
+
+	var key []byte
+	var err error
+	if len(ks.Salt) == 0 {
+		key, err = ks.newKey(passphrase)
+	} else {
+		key, err = ks.checkPassphrase(passphrase)
+	}
+	if err != nil {
+		return err
+	}
+
+	privkeys, err := ks.decryptKeys(key)
+	if err != nil {
+		zero(key)
+		return err
+	}
+
+	zero(ks.key)
+	zeroKeys(ks.privkeys)
+	ks.key = key
+	ks.privkeys = privkeys
+	return nil
+}
+
+// Lock forgets the decrypted keys.
+func (ks *Keystore) Lock() {
+	ks.mu.Lock()
+	defer ks.mu.Unlock()
+
+	zeroKeys(ks.privkeys)
+	zero(ks.key)
+	ks.key = nil
+	ks.privkeys = nil
+}
+
+func (ks *Keystore) Locked() bool {
+	ks.mu.RLock()
+	defer ks.mu.RUnlock()
+
+	return ks.key == nil
+}
+
+// ChangePassphrase encrypts the keys again with a new passphrase. It works
+// whether or not the keystore is unlocked. The decrypted keys are only kept if
+// it is.
+func (ks *Keystore) ChangePassphrase(old string, new string) error {
+	ks.mu.Lock()
+	defer ks.mu.Unlock()
+
+	if len(ks.Salt) == 0 {
+		return ErrNoPassphrase
+	}
+
+	oldKey, err := ks.checkPassphrase(old)
+	if err != nil {
+		return err
+	}
+	defer zero(oldKey)
+
+	privkeys, err := ks.decryptKeys(oldKey)
+	if err != nil {
+		return err
+	}
+
+	salt, chk := ks.Salt, ks.Check
+	key, err := ks.newKey(new)
+	if err != nil {
+		zeroKeys(privkeys)
+		return err
+	}
+
+	keys := map[string][]byte{}
+	for pubkey, privkey := range privkeys {
+		keys[pubkey], err = seal(key, privkey, []byte(pubkey))
+		if err != nil {
+			ks.Salt, ks.Check = salt, chk
+			zero(key)
+			zeroKeys(privkeys)
+			return err
+		}
+	}
+
+	ks.Keys = keys
+	if ks.key == nil {
+		zero(key)
+		zeroKeys(privkeys)
+		return nil
+	}
+
+	zero(ks.key)
+	zeroKeys(ks.privkeys)
+	ks.key = key
+	ks.privkeys = privkeys
+	return nil
+}
+
+// Add encrypts a private key and adds it to the keystore, which must be
+// unlocked. pubkey must be the public half of privkey.
+func (ks *Keystore) Add(pubkey []byte, privkey []byte) error {
+	ks.mu.Lock()
+	defer ks.mu.Unlock()
+
+	if ks.key == nil {
+		return ErrLocked
+	}
+
+	if len(privkey) != ed25519.PrivateKeySize {
+		return errs.New(errs.Invalid, "private key is the wrong length")
+	}
+
+	if !bytes.Equal(pubkey, privkey[32:]) {
+		return errs.New(errs.Invalid, "public key does not match private key")
+	}
+
+	k := hex.EncodeToString(pubkey)
+	ciphertext, err := seal(ks.key, privkey, []byte(k))
+	if err != nil {
+		return err
+	}
+
+	if ks.Keys == nil {
+		ks.Keys = map[string][]byte{}
+	}
+	ks.Keys[k] = ciphertext
+	zero(ks.privkeys[k])
+	ks.privkeys[k] = append([]byte{}, privkey...)
+	return nil
+}
+
+// Has returns true if the keystore has the private key of pubkey.
+func (ks *Keystore) Has(pubkey []byte) bool {
+	ks.mu.RLock()
+	defer ks.mu.RUnlock()
+
+	_, ok := ks.Keys[hex.EncodeToString(pubkey)]
+	return ok
+}
+
+// Sign signs the payload with the private key of pubkey.
+func (ks *Keystore) Sign(pubkey []byte, payload []byte) ([]byte, error) {
+	ks.mu.RLock()
+	defer ks.mu.RUnlock()
+
+	if ks.key == nil {
+		return nil, ErrLocked
+	}
+
+	privkey, ok := ks.privkeys[hex.EncodeToString(pubkey)]
+	if !ok {
+		return nil, ErrNoKey
+	}
+
+	priv := [ed25519.PrivateKeySize]byte{}
+	copy(priv[:], privkey)
+	defer zero(priv[:])
+
+	return ed25519.Sign(&priv, payload)[:], nil
+}
+
+func zero(b []byte) {
+	for i := range b {
+		b[i] = 0
+	}
+}
+
+func zeroKeys(privkeys map[string][]byte) {
+	for _, privkey := range privkeys {
+		zero(privkey)
+	}
+}
@@ -0,0 +1,164 @@
+package keystore
+
+import (
+	"bytes"
+	"crypto/rand"
+	"encoding/hex"
+	"encoding/json"
+	"testing"
+
+	"github.com/agl/ed25519"
+	"github.com/jtremback/usc/core/errs"
+)
+
+func TestKeystore(t *testing.T) {
+	pub, priv, err := ed25519.GenerateKey(rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	ks := New()
+
+	err = ks.Add(pub[:], priv[:])
+	if err != ErrLocked {
+		t.Fatal("locked keystore should not add keys")
+	}
+
+	err = ks.ChangePassphrase("", "hunter2")
+	if err != ErrNoPassphrase || errs.CodeOf(err) != errs.Locked {
+		t.Fatal("new keystore should return ErrNoPassphrase", err)
+	}
+
+	err = ks.Unlock("hunter2")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	err = ks.Add(pub[:], priv[:])
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	sig, err := ks.Sign(pub[:], []byte{1, 2, 3})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	s := [ed25519.SignatureSize]byte{}
+	copy(s[:], sig)
+	if !ed25519.Verify(pub, []byte{1, 2, 3}, &s) {
+		t.Fatal("signature not valid")
+	}
+
+	_, err = ks.Sign([]byte{4, 5, 6}, []byte{1, 2, 3})
+	if err != ErrNoKey || errs.CodeOf(err) != errs.NotFound {
+		t.Fatal("unknown key should return ErrNoKey")
+	}
+
+	ks.Lock()
+
+	_, err = ks.Sign(pub[:], []byte{1, 2, 3})
+	if err != ErrLocked {
+		t.Fatal("locked keystore should not sign")
+	}
+
+	// Stored and loaded again
+
+	b, err := json.Marshal(ks)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	ks2 := &Keystore{}
+	err = json.Unmarshal(b, ks2)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	err = ks2.Unlock("hunter3")
+	if err != ErrBadPassphrase {
+		t.Fatal("wrong passphrase should return ErrBadPassphrase")
+	}
+
+	err = ks2.ChangePassphrase("hunter2", "correct horse")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	err = ks2.Unlock("hunter2")
+	if err != ErrBadPassphrase {
+		t.Fatal("old passphrase should return ErrBadPassphrase")
+	}
+
+	err = ks2.Unlock("correct horse")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	_, err = ks2.Sign(pub[:], []byte{1, 2, 3})
+	if err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestChangePassphraseUnlocked(t *testing.T) {
+	pub, priv, err := ed25519.GenerateKey(rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	ks := New()
+	err = ks.Unlock("hunter2")
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = ks.Add(pub[:], priv[:])
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	oldKey := ks.key
+	oldPrivkey := ks.privkeys[hex.EncodeToString(pub[:])]
+
+	err = ks.ChangePassphrase("hunter2", "correct horse")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if !bytes.Equal(oldKey, make([]byte, len(oldKey))) {
+		t.Fatal("old encryption key should be zeroed")
+	}
+	if !bytes.Equal(oldPrivkey, make([]byte, len(oldPrivkey))) {
+		t.Fatal("old decrypted private key should be zeroed")
+	}
+
+	_, err = ks.Sign(pub[:], []byte{1, 2, 3})
+	if err != nil {
+		t.Fatal("keystore should still sign after changing the passphrase", err)
+	}
+}
+
+func TestAddWrongPubkey(t *testing.T) {
+	_, priv, err := ed25519.GenerateKey(rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	other, _, err := ed25519.GenerateKey(rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	ks := New()
+	err = ks.Unlock("hunter2")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	err = ks.Add(other[:], priv[:])
+	if errs.CodeOf(err) != errs.Invalid {
+		t.Fatal("private key should not be added under another public key", err)
+	}
+	if ks.Has(other[:]) {
+		t.Fatal("keystore should not have the key")
+	}
+}
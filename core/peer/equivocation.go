@@ -0,0 +1,61 @@
+package peer
+
+import (
+	"bytes"
+	"time"
+
+	"github.com/jtremback/usc/core/errs"
+	"github.com/jtremback/usc/core/wire"
+)
+
+// ErrEquivocation is returned for an UpdateTx which has the same
+// SequenceNumber as one that its signer has already signed, but a different
+// payload.
+var ErrEquivocation = errs.New(errs.Conflict, "conflicting update tx with the same sequence number")
+
+// Equivocation is evidence that a Counterparty has signed two different
+// UpdateTxs with the same SequenceNumber. Held is the one we had, and
+// Conflicting is the one we were sent after it. Id is its position in the
+// Peer's list of Equivocations.
+type Equivocation struct {
+	Id             uint64
+	ChannelId      string
+	SequenceNumber uint32
+	Held           *wire.Envelope
+	Conflicting    *wire.Envelope
+	Time           time.Time
+}
+
+// ConflictingUpdateTx returns the Envelope we hold with the same SequenceNumber
+// as utx but a different payload, if some Counterparty has signed both. Two
+// UpdateTxs signed by different Counterparties are not a conflict, since two
+// peers may propose at the same time. It returns nil if there is no conflict.
+func (ch *Channel) ConflictingUpdateTx(ev *wire.Envelope, utx *wire.UpdateTx) *wire.Envelope {
+	if checkSignatures(ev, ch.OpeningTx.Pubkeys) != nil || utx.ChannelId != ch.ChannelId {
+		return nil
+	}
+
+	for _, held := range []struct {
+		utx *wire.UpdateTx
+		ev  *wire.Envelope
+	}{
+		{ch.LastFullUpdateTx, ch.LastFullUpdateTxEnvelope},
+		{ch.TheirProposedUpdateTx, ch.TheirProposedUpdateTxEnvelope},
+	} {
+		if held.utx != nil && held.utx.SequenceNumber == utx.SequenceNumber &&
+			bytes.Compare(held.ev.Payload, ev.Payload) != 0 && ch.signedBoth(held.ev, ev) {
+			return held.ev
+		}
+	}
+	return nil
+}
+
+// signedBoth returns true if a Counterparty has signed both a and b.
+func (ch *Channel) signedBoth(a *wire.Envelope, b *wire.Envelope) bool {
+	for i := range b.Signatures {
+		if uint32(i) != ch.Me && i < len(a.Signatures) && len(a.Signatures[i]) != 0 && len(b.Signatures[i]) != 0 {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,41 @@
+package peer
+
+import "time"
+
+type EventType string
+
+// The events that a Peer reports about its Channels.
+const (
+	// A Counterparty has proposed a new Channel
+	ChannelProposed EventType = "ChannelProposed"
+	// A Counterparty has proposed an UpdateTx, which is now
+	// TheirProposedUpdateTx
+	UpdateProposed EventType = "UpdateProposed"
+	// An UpdateTx has been signed by everyone, and is now the
+	// LastFullUpdateTx
+	UpdateCosigned EventType = "UpdateCosigned"
+	// The Judge has signed the OpeningTx
+	ChannelOpened EventType = "ChannelOpened"
+	// The Channel is PENDING_CLOSED, waiting for the hold period
+	ClosingStarted EventType = "ClosingStarted"
+	// Someone has given the Judge an older UpdateTx than our
+	// LastFullUpdateTx, and we have sent it ours
+	CheatDetected EventType = "CheatDetected"
+	// The Judge has closed the Channel
+	ChannelClosed EventType = "ChannelClosed"
+	// A Counterparty has signed two different UpdateTxs with the same
+	// SequenceNumber, and the Equivocation has been recorded
+	EquivocationDetected EventType = "EquivocationDetected"
+)
+
+// Event is something that happened to a Channel. Cursor is the position of the
+// Event in the Peer's list of Events, which starts at 1.
+type Event struct {
+	Cursor    uint64
+	Type      EventType
+	ChannelId string
+	// The SequenceNumber of the UpdateTx, for UpdateProposed,
+	// UpdateCosigned and EquivocationDetected
+	SequenceNumber uint32
+	Time           time.Time
+}
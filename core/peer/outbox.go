@@ -0,0 +1,81 @@
+package peer
+
+import (
+	"time"
+
+	"github.com/jtremback/usc/core/errs"
+	"github.com/jtremback/usc/core/wire"
+)
+
+// MessageKind is which call a Message is sent with.
+type MessageKind string
+
+const (
+	// To a Counterparty, with the CounterpartyClient method of the same name
+	AddChannel            MessageKind = "AddChannel"
+	AddProposedUpdateTx   MessageKind = "AddProposedUpdateTx"
+	AddFullUpdateTx       MessageKind = "AddFullUpdateTx"
+	AddChannelRejectionTx MessageKind = "AddChannelRejectionTx"
+	AddUpdateRejectionTx  MessageKind = "AddUpdateRejectionTx"
+	// To the Judge, with the JudgeClient method of the same name without the
+	// Judge prefix
+	JudgeAddChannel      MessageKind = "JudgeAddChannel"
+	JudgeAddCancelTx     MessageKind = "JudgeAddCancelTx"
+	JudgeAddFullUpdateTx MessageKind = "JudgeAddFullUpdateTx"
+	JudgeAddClosingTx    MessageKind = "JudgeAddClosingTx"
+	JudgeAddPreimageTx   MessageKind = "JudgeAddPreimageTx"
+)
+
+const (
+	// The wait after the first failed attempt to send a Message, doubled
+	// after each one after
+	MinMessageBackoff = time.Second
+	// The longest wait between attempts
+	MaxMessageBackoff = 5 * time.Minute
+	// How many times a Message is tried before it is given up on, which is
+	// about a day of attempts
+	MaxMessageAttempts = 300
+	// How long a Dead Message is kept in the outbox, so that it can be seen
+	// why it was given up on
+	DeadMessageRetention = 7 * 24 * time.Hour
+)
+
+// Message is an Envelope waiting in the outbox to be sent to Address. A
+// Message is tried until it is sent, and is sent exactly as it was signed, so
+// that sending it more than once does no harm. Id is its position in the
+// outbox, and the Messages to one Address about one Channel are sent in
+// order. A Message that is Dead has been given up on, and is kept until
+// NextAttempt so that it can be seen why, and then deleted.
+type Message struct {
+	Id          uint64
+	ChannelId   string
+	Kind        MessageKind
+	Envelope    *wire.Envelope
+	Address     string
+	Attempts    int
+	NextAttempt time.Time
+	LastError   string
+	Dead        bool
+}
+
+// Failed records a failed attempt to send m, and schedules the next one. If
+// the other side rejected m, or it has been tried MaxMessageAttempts times, m
+// is marked Dead instead, since sending it again would not help.
+func (m *Message) Failed(err error, now time.Time) {
+	m.Attempts++
+	m.LastError = err.Error()
+	if errs.Rejected(err) || m.Attempts >= MaxMessageAttempts {
+		m.Dead = true
+		m.NextAttempt = now.Add(DeadMessageRetention)
+		return
+	}
+
+	backoff := MinMessageBackoff
+	for i := 1; i < m.Attempts && backoff < MaxMessageBackoff; i++ {
+		backoff *= 2
+	}
+	if backoff > MaxMessageBackoff {
+		backoff = MaxMessageBackoff
+	}
+	m.NextAttempt = now.Add(backoff)
+}
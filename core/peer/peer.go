@@ -3,11 +3,15 @@ package peer
 import (
 	"bytes"
 	"crypto/rand"
+	"crypto/sha256"
 	"errors"
 	"io"
+	"time"
 
 	"github.com/agl/ed25519"
 	"github.com/golang/protobuf/proto"
+	"github.com/jtremback/usc/core/errs"
+	"github.com/jtremback/usc/core/signer"
 	"github.com/jtremback/usc/core/wire"
 )
 
@@ -43,6 +47,18 @@ func randomBytes(c uint) ([]byte, error) {
 	return b, nil
 }
 
+// Errors returned by Channels. Errors from this package have an errs.Code, and
+// are equal to the one of these with the same Code under errors.Is.
+var (
+	ErrInvalid      = errs.New(errs.Invalid, "tx not valid")
+	ErrNotFound     = errs.New(errs.NotFound, "not found")
+	ErrWrongPhase   = errs.New(errs.WrongPhase, "channel in wrong phase")
+	ErrBadSignature = errs.New(errs.BadSignature, "signature not valid")
+	ErrSeqTooLow    = errs.New(errs.SeqTooLow, "sequence number too low")
+	ErrExpired      = errs.New(errs.Expired, "update tx expired")
+	ErrConflict     = errs.New(errs.Conflict, "already done")
+)
+
 type Phase int
 
 const (
@@ -52,8 +68,6 @@ const (
 	CLOSED         Phase = 4
 )
 
-var swap = []int{1, 0}
-
 type Channel struct {
 	ChannelId string
 	Phase     Phase
@@ -70,12 +84,17 @@ type Channel struct {
 	TheirProposedUpdateTx         *wire.UpdateTx
 	TheirProposedUpdateTxEnvelope *wire.Envelope
 
+	FinalUpdateTx         *wire.UpdateTx
+	FinalUpdateTxEnvelope *wire.Envelope
+
+	// Me is the index of Account's pubkey in OpeningTx.Pubkeys, and of its
+	// signature in the Envelopes of the OpeningTx and UpdateTxs.
 	Me          uint32
 	FollowOnTxs []*wire.Envelope
 
-	Judge        *Judge
-	Account      *Account
-	Counterparty *Counterparty
+	Judge          *Judge
+	Account        *Account
+	Counterparties []*Counterparty
 }
 
 type Account struct {
@@ -83,6 +102,9 @@ type Account struct {
 	Pubkey  []byte
 	Privkey []byte
 	Judge   *Judge
+	// If Signer is set, the Account signs with it instead of Privkey, which can
+	// then be left empty.
+	Signer signer.Signer `json:"-"`
 }
 
 type Counterparty struct {
@@ -112,8 +134,15 @@ func NewAccount(name string, jd *Judge) (*Account, error) {
 	}, nil
 }
 
-func (acct *Account) NewOpeningTx(channelId string, cpt *Counterparty, state []byte, holdPeriod uint64) (*wire.OpeningTx, error) {
-	pubkeys := [][]byte{acct.Pubkey, cpt.Pubkey}
+func (acct *Account) NewOpeningTx(channelId string, cpts []*Counterparty, state []byte, holdPeriod uint64) (*wire.OpeningTx, error) {
+	if len(cpts) == 0 {
+		return nil, errs.New(errs.Invalid, "no counterparties")
+	}
+
+	pubkeys := [][]byte{acct.Pubkey}
+	for _, cpt := range cpts {
+		pubkeys = append(pubkeys, cpt.Pubkey)
+	}
 
 	return &wire.OpeningTx{
 		ChannelId:  channelId,
@@ -123,80 +152,223 @@ func (acct *Account) NewOpeningTx(channelId string, cpt *Counterparty, state []b
 	}, nil
 }
 
+// SerializeOpeningTx makes an Envelope for an OpeningTx, with an empty signature
+// for each of the OpeningTx's pubkeys.
 func SerializeOpeningTx(otx *wire.OpeningTx) (*wire.Envelope, error) {
 	data, err := proto.Marshal(otx)
 	if err != nil {
 		return nil, err
 	}
 	return &wire.Envelope{
-		Payload: data,
+		Payload:    data,
+		Signatures: emptySignatures(len(otx.Pubkeys)),
 	}, nil
 }
 
-func (acct *Account) CheckOpeningTx(ev *wire.Envelope, cpt *Counterparty) error {
-	if len(ev.Signatures) != 1 {
-		return errors.New("wrong number of signatures")
+func emptySignatures(n int) [][]byte {
+	sigs := make([][]byte, n)
+	for i := range sigs {
+		sigs[i] = []byte{}
+	}
+	return sigs
+}
+
+// CheckOpeningTx checks an OpeningTx proposed by the first of its pubkeys. The
+// proposer and any other participants who have already signed it must be among
+// cpts.
+func (acct *Account) CheckOpeningTx(ev *wire.Envelope, otx *wire.OpeningTx, cpts []*Counterparty) error {
+	if len(ev.Signatures) != len(otx.Pubkeys) {
+		return errs.New(errs.BadSignature, "wrong number of signatures")
 	}
-	if bytes.Compare(acct.Judge.Pubkey, cpt.Judge.Pubkey) != 0 {
-		return errors.New("accounts do not have the same judge")
+	for _, cpt := range cpts {
+		if bytes.Compare(acct.Judge.Pubkey, cpt.Judge.Pubkey) != 0 {
+			return errs.New(errs.Invalid, "accounts do not have the same judge")
+		}
 	}
-	if !ed25519.Verify(sliceTo32Byte(cpt.Pubkey), ev.Payload, sliceTo64Byte(ev.Signatures[0])) {
-		return errors.New("counterparty signature not valid")
+	if !ed25519.Verify(sliceTo32Byte(otx.Pubkeys[0]), ev.Payload, sliceTo64Byte(ev.Signatures[0])) {
+		return errs.New(errs.BadSignature, "counterparty signature not valid")
 	}
 
-	return nil
+	return checkSignatures(ev, otx.Pubkeys)
+}
+
+// Sign signs payload with the Account's Signer, or its Privkey if it has no
+// Signer.
+func (acct *Account) Sign(payload []byte) ([]byte, error) {
+	if acct.Signer != nil {
+		return acct.Signer.Sign(acct.Pubkey, payload)
+	}
+	if len(acct.Privkey) != ed25519.PrivateKeySize {
+		return nil, errors.New("account has no private key")
+	}
+	return signer.NewMemory(acct.Privkey).Sign(acct.Pubkey, payload)
 }
 
-func (acct *Account) AppendSignature(ev *wire.Envelope) {
-	ev.Signatures = append(ev.Signatures, [][]byte{ed25519.Sign(sliceTo64Byte(acct.Privkey), ev.Payload)[:]}...)
+func (acct *Account) AppendSignature(ev *wire.Envelope) error {
+	sig, err := acct.Sign(ev.Payload)
+	if err != nil {
+		return err
+	}
+	ev.Signatures = append(ev.Signatures, sig)
+	return nil
 }
 
-func NewChannel(ev *wire.Envelope, otx *wire.OpeningTx, acct *Account, cpt *Counterparty) (*Channel, error) {
-	if bytes.Compare(acct.Judge.Pubkey, cpt.Judge.Pubkey) != 0 {
-		return nil, errors.New("accounts do not have the same judge")
+// NewChannel makes a Channel from an OpeningTx. There must be a Counterparty in
+// cpts for each of the OpeningTx's pubkeys other than acct's. They are stored in
+// the order of the pubkeys.
+func NewChannel(ev *wire.Envelope, otx *wire.OpeningTx, acct *Account, cpts []*Counterparty) (*Channel, error) {
+	if len(otx.Pubkeys) < 2 {
+		return nil, errs.New(errs.Invalid, "not enough public keys")
 	}
 
 	// Who is Me?
-	var me uint32
+	me := -1
+	ordered := []*Counterparty{}
 	for i, k := range otx.Pubkeys {
 		if bytes.Compare(acct.Pubkey, k) == 0 {
-			me = uint32(i)
+			me = i
+			continue
+		}
+
+		var found *Counterparty
+		for _, cpt := range cpts {
+			if bytes.Compare(cpt.Pubkey, k) == 0 {
+				found = cpt
+			}
 		}
+		if found == nil {
+			return nil, errs.New(errs.NotFound, "no counterparty for public key")
+		}
+		if bytes.Compare(acct.Judge.Pubkey, found.Judge.Pubkey) != 0 {
+			return nil, errs.New(errs.Invalid, "accounts do not have the same judge")
+		}
+		ordered = append(ordered, found)
+	}
+	if me == -1 {
+		return nil, errs.New(errs.Invalid, "account not in opening tx")
 	}
 
 	ch := &Channel{
 		ChannelId:         otx.ChannelId,
 		OpeningTx:         otx,
 		OpeningTxEnvelope: ev,
-		Me:                me,
+		Me:                uint32(me),
 		Account:           acct,
 		Judge:             acct.Judge,
-		Counterparty:      cpt,
+		Counterparties:    ordered,
 		Phase:             PENDING_OPEN,
 	}
 
 	return ch, nil
 }
 
-func (ch *Channel) Open(ev *wire.Envelope, otx *wire.OpeningTx) error {
+// checkSignatures checks that ev has a signature slot for each of pubkeys, and
+// that each signature which is present is valid.
+func checkSignatures(ev *wire.Envelope, pubkeys [][]byte) error {
+	if len(ev.Signatures) != len(pubkeys) {
+		return errs.New(errs.BadSignature, "wrong number of signatures")
+	}
+	for i, sig := range ev.Signatures {
+		if len(sig) == 0 {
+			continue
+		}
+		if !ed25519.Verify(sliceTo32Byte(pubkeys[i]), ev.Payload, sliceTo64Byte(sig)) {
+			return ErrBadSignature
+		}
+	}
+	return nil
+}
+
+// FullySigned returns true if ev has a valid signature from every pubkey in the
+// Channel's OpeningTx.
+func (ch *Channel) FullySigned(ev *wire.Envelope) bool {
+	if checkSignatures(ev, ch.OpeningTx.Pubkeys) != nil {
+		return false
+	}
+	for _, sig := range ev.Signatures {
+		if len(sig) == 0 {
+			return false
+		}
+	}
+	return true
+}
+
+// signedByCounterparty returns true if ev has a single signature, made by one
+// of the Channel's Counterparties.
+func (ch *Channel) signedByCounterparty(ev *wire.Envelope) bool {
+	if len(ev.Signatures) != 1 {
+		return false
+	}
+	for _, cpt := range ch.Counterparties {
+		if ed25519.Verify(sliceTo32Byte(cpt.Pubkey), ev.Payload, sliceTo64Byte(ev.Signatures[0])) {
+			return true
+		}
+	}
+	return false
+}
+
+// sign puts our signature in our slot of ev's signatures.
+func (ch *Channel) sign(ev *wire.Envelope) error {
+	sig, err := ch.Account.Sign(ev.Payload)
+	if err != nil {
+		return err
+	}
+	if len(ev.Signatures) == 0 {
+		ev.Signatures = emptySignatures(len(ch.OpeningTx.Pubkeys))
+	}
+	ev.Signatures[ch.Me] = sig
+	return nil
+}
+
+// mergeSignatures copies the signatures in src into the empty slots of dst.
+// Both must have been checked with checkSignatures.
+func mergeSignatures(dst *wire.Envelope, src *wire.Envelope) {
+	for i, sig := range src.Signatures {
+		if len(dst.Signatures[i]) == 0 {
+			dst.Signatures[i] = sig
+		}
+	}
+}
+
+// SignOpeningTx signs the Channel's OpeningTx. Once every participant has
+// signed it, it can be sent to the judge.
+func (ch *Channel) SignOpeningTx() error {
 	if ch.Phase != PENDING_OPEN {
-		return errors.New("channel not PENDING_OPEN")
+		return errs.New(errs.WrongPhase, "channel not PENDING_OPEN")
 	}
-	if len(ev.Signatures) != 3 {
-		return errors.New("wrong number of signatures")
+
+	return ch.sign(ch.OpeningTxEnvelope)
+}
+
+// AddOpeningTxSignatures adds the signatures that other participants have made
+// on the Channel's OpeningTx.
+func (ch *Channel) AddOpeningTxSignatures(ev *wire.Envelope) error {
+	if ch.Phase != PENDING_OPEN {
+		return errs.New(errs.WrongPhase, "channel not PENDING_OPEN")
 	}
-	if !ed25519.Verify(sliceTo32Byte(ch.Account.Pubkey), ev.Payload, sliceTo64Byte(ev.Signatures[ch.Me])) {
-		return errors.New("my account signature not valid")
+	if bytes.Compare(ev.Payload, ch.OpeningTxEnvelope.Payload) != 0 {
+		return errs.New(errs.Invalid, "opening tx not valid")
+	}
+	err := checkSignatures(ev, ch.OpeningTx.Pubkeys)
+	if err != nil {
+		return err
 	}
-	if !ed25519.Verify(sliceTo32Byte(ch.Counterparty.Pubkey), ev.Payload, sliceTo64Byte(ev.Signatures[swap[ch.Me]])) {
-		return errors.New("counterparty signature not valid")
+
+	mergeSignatures(ch.OpeningTxEnvelope, ev)
+	return nil
+}
+
+func (ch *Channel) Open(ev *wire.Envelope, otx *wire.OpeningTx) error {
+	if ch.Phase != PENDING_OPEN {
+		return errs.New(errs.WrongPhase, "channel not PENDING_OPEN")
 	}
-	if !ed25519.Verify(sliceTo32Byte(ch.Judge.Pubkey), ev.Payload, sliceTo64Byte(ev.Signatures[2])) {
-		return errors.New("judge signature not valid")
+	err := ch.checkJudgeSignatures(ev)
+	if err != nil {
+		return err
 	}
 
 	if bytes.Compare(ev.Payload, ch.OpeningTxEnvelope.Payload) != 0 {
-		return errors.New("opening tx not valid")
+		return errs.New(errs.Invalid, "opening tx not valid")
 	}
 
 	ch.Phase = OPEN
@@ -206,8 +378,57 @@ func (ch *Channel) Open(ev *wire.Envelope, otx *wire.OpeningTx) error {
 	return nil
 }
 
+// NewChannelRejectionTx makes a ChannelRejectionTx, to tell the Counterparty that
+// we will never sign the Channel's OpeningTx.
+func (ch *Channel) NewChannelRejectionTx() (*wire.ChannelRejectionTx, error) {
+	if ch.Phase != PENDING_OPEN {
+		return nil, errs.New(errs.WrongPhase, "channel not PENDING_OPEN")
+	}
+	if len(ch.OpeningTxEnvelope.Signatures[ch.Me]) != 0 {
+		return nil, errs.New(errs.Conflict, "opening tx already signed")
+	}
+
+	return &wire.ChannelRejectionTx{
+		ChannelId: ch.ChannelId,
+	}, nil
+}
+
+func SerializeChannelRejectionTx(rtx *wire.ChannelRejectionTx) (*wire.Envelope, error) {
+	data, err := proto.Marshal(rtx)
+	if err != nil {
+		return nil, err
+	}
+
+	return &wire.Envelope{
+		Payload: data,
+	}, nil
+}
+
+// CheckChannelRejectionTx checks a ChannelRejectionTx sent by the Counterparty.
+// If it is valid, the Channel can be deleted.
+func (ch *Channel) CheckChannelRejectionTx(ev *wire.Envelope, rtx *wire.ChannelRejectionTx) error {
+	if ch.Phase != PENDING_OPEN {
+		return errs.New(errs.WrongPhase, "channel not PENDING_OPEN")
+	}
+	if !ch.signedByCounterparty(ev) {
+		return errs.New(errs.BadSignature, "counterparty signature not valid")
+	}
+	if rtx.ChannelId != ch.ChannelId {
+		return errs.New(errs.Invalid, "channel id incorrect")
+	}
+
+	return nil
+}
+
+// HighestSeq returns the highest SequenceNumber of LastFullUpdateTx,
+// MyProposedUpdateTx and TheirProposedUpdateTx. Rejected proposals are cleared,
+// so LastFullUpdateTx has to be checked as well.
 func (ch *Channel) HighestSeq() uint32 {
 	var num uint32
+	if ch.LastFullUpdateTx != nil {
+		num = ch.LastFullUpdateTx.SequenceNumber
+	}
+
 	if ch.MyProposedUpdateTx != nil {
 		if ch.MyProposedUpdateTx.SequenceNumber > num {
 			num = ch.MyProposedUpdateTx.SequenceNumber
@@ -232,6 +453,58 @@ func (ch *Channel) NewUpdateTx(state []byte, fast bool) *wire.UpdateTx {
 	}
 }
 
+// NewHashLockedUpdateTx makes an UpdateTx whose hashLocks are only valid if
+// their preimages are revealed to the judge before they expire.
+func (ch *Channel) NewHashLockedUpdateTx(state []byte, hashLocks []*wire.HashLock, fast bool) (*wire.UpdateTx, error) {
+	err := checkHashLocks(hashLocks)
+	if err != nil {
+		return nil, err
+	}
+
+	utx := ch.NewUpdateTx(state, fast)
+	utx.HashLocks = hashLocks
+
+	return utx, nil
+}
+
+// NewRenewalUpdateTx re-issues the state of LastFullUpdateTx at the next
+// sequence number, with a later expiry, so that it does not expire before the
+// channel is closed.
+func (ch *Channel) NewRenewalUpdateTx(expiry time.Time) (*wire.UpdateTx, error) {
+	if ch.Phase != OPEN {
+		return nil, errs.New(errs.WrongPhase, "channel not OPEN")
+	}
+	if ch.LastFullUpdateTx == nil {
+		return nil, errs.New(errs.NotFound, "no full update tx to renew")
+	}
+	if ch.LastFullUpdateTx.Expiry == 0 {
+		return nil, errs.New(errs.Invalid, "full update tx does not expire")
+	}
+	if !expiry.After(time.Unix(0, ch.LastFullUpdateTx.Expiry)) {
+		return nil, errs.New(errs.Invalid, "expiry is not later than the current expiry")
+	}
+
+	utx := ch.NewUpdateTx(ch.LastFullUpdateTx.State, ch.LastFullUpdateTx.Fast)
+	utx.HashLocks = ch.LastFullUpdateTx.HashLocks
+	utx.Expiry = expiry.UnixNano()
+
+	return utx, nil
+}
+
+// expired returns true if utx has an expiry which is before now.
+func expired(utx *wire.UpdateTx, now time.Time) bool {
+	return utx.Expiry != 0 && now.After(time.Unix(0, utx.Expiry))
+}
+
+func checkHashLocks(hashLocks []*wire.HashLock) error {
+	for _, lock := range hashLocks {
+		if len(lock.Hash) != sha256.Size {
+			return errs.New(errs.Invalid, "hash lock hash is not a sha256 hash")
+		}
+	}
+	return nil
+}
+
 func SerializeUpdateTx(utx *wire.UpdateTx) (*wire.Envelope, error) {
 	data, err := proto.Marshal(utx)
 	if err != nil {
@@ -239,44 +512,106 @@ func SerializeUpdateTx(utx *wire.UpdateTx) (*wire.Envelope, error) {
 	}
 
 	ev := wire.Envelope{
-		Payload:    data,
-		Signatures: [][]byte{[]byte{}, []byte{}},
+		Payload: data,
 	}
 
 	return &ev, nil
 }
 
-func (ch *Channel) SignProposedUpdateTx(ev *wire.Envelope, utx *wire.UpdateTx) {
-	ev.Signatures[ch.Me] = ed25519.Sign(sliceTo64Byte(ch.Account.Privkey), ev.Payload)[:]
+func (ch *Channel) SignProposedUpdateTx(ev *wire.Envelope, utx *wire.UpdateTx) error {
+	if !(ch.Phase == OPEN || ch.Phase == PENDING_CLOSED) {
+		return errs.New(errs.WrongPhase, "channel not OPEN or PENDING_CLOSED")
+	}
+	err := ch.sign(ev)
+	if err != nil {
+		return err
+	}
 	ch.MyProposedUpdateTx = utx
 	ch.MyProposedUpdateTxEnvelope = ev
+	return nil
 }
 
-func (ch *Channel) CosignProposedUpdateTx() *wire.Envelope {
+// CosignProposedUpdateTx signs TheirProposedUpdateTx. If every participant has
+// now signed it, it becomes LastFullUpdateTx. Otherwise the returned Envelope
+// must be sent on to the Counterparties to collect the remaining signatures.
+func (ch *Channel) CosignProposedUpdateTx() (*wire.Envelope, error) {
+	if ch.TheirProposedUpdateTx == nil {
+		return nil, errs.New(errs.NotFound, "no proposed update tx")
+	}
+	if expired(ch.TheirProposedUpdateTx, time.Now()) {
+		return nil, errs.New(errs.Expired, "proposed update tx expired")
+	}
+
 	ev := ch.TheirProposedUpdateTxEnvelope
-	ev.Signatures[ch.Me] = ed25519.Sign(sliceTo64Byte(ch.Account.Privkey), ev.Payload)[:]
+	err := ch.sign(ev)
+	if err != nil {
+		return nil, err
+	}
 
-	ch.LastFullUpdateTx = ch.TheirProposedUpdateTx
-	ch.LastFullUpdateTxEnvelope = ch.TheirProposedUpdateTxEnvelope
+	if ch.FullySigned(ev) {
+		ch.LastFullUpdateTx = ch.TheirProposedUpdateTx
+		ch.LastFullUpdateTxEnvelope = ev
+	}
 
-	return ev
+	return ev, nil
 }
 
+// AddProposedUpdateTx adds an UpdateTx proposed by a Counterparty. If it is a
+// proposal we already have, the signatures of the other Counterparties are added
+// to it instead, and once every participant has signed, it becomes
+// LastFullUpdateTx.
 func (ch *Channel) AddProposedUpdateTx(ev *wire.Envelope, utx *wire.UpdateTx) error {
 	if !(ch.Phase == OPEN || ch.Phase == PENDING_CLOSED) {
-		return errors.New("channel not OPEN or PENDING_CLOSED")
+		return errs.New(errs.WrongPhase, "channel not OPEN or PENDING_CLOSED")
 	}
-	if len(ev.Signatures) != 2 {
-		return errors.New("wrong number of signatures")
-	}
-	if !ed25519.Verify(sliceTo32Byte(ch.Counterparty.Pubkey), ev.Payload, sliceTo64Byte(ev.Signatures[swap[ch.Me]])) {
-		return errors.New("counterparty signature not valid")
+	err := checkSignatures(ev, ch.OpeningTx.Pubkeys)
+	if err != nil {
+		return err
 	}
 	if utx.ChannelId != ch.OpeningTx.ChannelId {
-		return errors.New("channel id incorrect")
+		return errs.New(errs.Invalid, "channel id incorrect")
+	}
+
+	if ch.LastFullUpdateTx != nil && bytes.Compare(ev.Payload, ch.LastFullUpdateTxEnvelope.Payload) == 0 {
+		return nil
+	}
+	for _, proposed := range []struct {
+		utx *wire.UpdateTx
+		ev  *wire.Envelope
+	}{
+		{ch.MyProposedUpdateTx, ch.MyProposedUpdateTxEnvelope},
+		{ch.TheirProposedUpdateTx, ch.TheirProposedUpdateTxEnvelope},
+	} {
+		if proposed.utx == nil || bytes.Compare(ev.Payload, proposed.ev.Payload) != 0 {
+			continue
+		}
+
+		mergeSignatures(proposed.ev, ev)
+		if ch.FullySigned(proposed.ev) {
+			ch.LastFullUpdateTx = proposed.utx
+			ch.LastFullUpdateTxEnvelope = proposed.ev
+		}
+		return nil
+	}
+
+	signed := false
+	for i, sig := range ev.Signatures {
+		if uint32(i) != ch.Me && len(sig) != 0 {
+			signed = true
+		}
+	}
+	if !signed {
+		return errs.New(errs.BadSignature, "counterparty signature not valid")
 	}
 	if !(utx.SequenceNumber > ch.HighestSeq()) {
-		return errors.New("sequence number too low")
+		return ErrSeqTooLow
+	}
+	if expired(utx, time.Now()) {
+		return ErrExpired
+	}
+	err = checkHashLocks(utx.HashLocks)
+	if err != nil {
+		return err
 	}
 
 	ch.TheirProposedUpdateTx = utx
@@ -285,25 +620,80 @@ func (ch *Channel) AddProposedUpdateTx(ev *wire.Envelope, utx *wire.UpdateTx) er
 	return nil
 }
 
-func (ch *Channel) AddFullUpdateTx(ev *wire.Envelope, utx *wire.UpdateTx) error {
+// NewUpdateRejectionTx makes an UpdateRejectionTx, to tell the Counterparty that
+// we will never cosign TheirProposedUpdateTx.
+func (ch *Channel) NewUpdateRejectionTx() (*wire.UpdateRejectionTx, error) {
+	if !(ch.Phase == OPEN || ch.Phase == PENDING_CLOSED) {
+		return nil, errs.New(errs.WrongPhase, "channel not OPEN or PENDING_CLOSED")
+	}
+	if ch.TheirProposedUpdateTx == nil {
+		return nil, errs.New(errs.NotFound, "no proposed update tx")
+	}
+	if len(ch.TheirProposedUpdateTxEnvelope.Signatures[ch.Me]) != 0 {
+		return nil, errs.New(errs.Conflict, "proposed update tx already cosigned")
+	}
+
+	return &wire.UpdateRejectionTx{
+		ChannelId:      ch.ChannelId,
+		SequenceNumber: ch.TheirProposedUpdateTx.SequenceNumber,
+	}, nil
+}
+
+func SerializeUpdateRejectionTx(rtx *wire.UpdateRejectionTx) (*wire.Envelope, error) {
+	data, err := proto.Marshal(rtx)
+	if err != nil {
+		return nil, err
+	}
+
+	return &wire.Envelope{
+		Payload: data,
+	}, nil
+}
+
+// RejectProposedUpdateTx clears TheirProposedUpdateTx, after we have rejected it.
+func (ch *Channel) RejectProposedUpdateTx() {
+	ch.TheirProposedUpdateTx = nil
+	ch.TheirProposedUpdateTxEnvelope = nil
+}
+
+// AddUpdateRejectionTx checks an UpdateRejectionTx sent by the Counterparty, and
+// clears MyProposedUpdateTx, which they will never cosign.
+func (ch *Channel) AddUpdateRejectionTx(ev *wire.Envelope, rtx *wire.UpdateRejectionTx) error {
 	if !(ch.Phase == OPEN || ch.Phase == PENDING_CLOSED) {
-		return errors.New("channel not OPEN or PENDING_CLOSED")
+		return errs.New(errs.WrongPhase, "channel not OPEN or PENDING_CLOSED")
+	}
+	if !ch.signedByCounterparty(ev) {
+		return errs.New(errs.BadSignature, "counterparty signature not valid")
+	}
+	if rtx.ChannelId != ch.ChannelId {
+		return errs.New(errs.Invalid, "channel id incorrect")
 	}
-	if len(ev.Signatures) != 2 {
-		return errors.New("wrong number of signatures")
+	if ch.MyProposedUpdateTx == nil || ch.MyProposedUpdateTx.SequenceNumber != rtx.SequenceNumber {
+		return errs.New(errs.NotFound, "no proposed update tx with that sequence number")
 	}
-	if !ed25519.Verify(sliceTo32Byte(ch.Account.Pubkey), ev.Payload, sliceTo64Byte(ev.Signatures[ch.Me])) {
-		return errors.New("my account signature not valid")
+
+	ch.MyProposedUpdateTx = nil
+	ch.MyProposedUpdateTxEnvelope = nil
+
+	return nil
+}
+
+func (ch *Channel) AddFullUpdateTx(ev *wire.Envelope, utx *wire.UpdateTx) error {
+	if !(ch.Phase == OPEN || ch.Phase == PENDING_CLOSED) {
+		return errs.New(errs.WrongPhase, "channel not OPEN or PENDING_CLOSED")
 	}
-	if !ed25519.Verify(sliceTo32Byte(ch.Counterparty.Pubkey), ev.Payload, sliceTo64Byte(ev.Signatures[swap[ch.Me]])) {
-		return errors.New("counterparty signature not valid")
+	if !ch.FullySigned(ev) {
+		return errs.New(errs.BadSignature, "update tx not signed by every participant")
 	}
 	if utx.ChannelId != ch.OpeningTx.ChannelId {
-		return errors.New("channel id incorrect")
+		return errs.New(errs.Invalid, "channel id incorrect")
 	}
 	if ch.LastFullUpdateTx != nil {
-		if utx.SequenceNumber > ch.LastFullUpdateTx.SequenceNumber {
-			return errors.New("sequence number too low")
+		if bytes.Compare(ev.Payload, ch.LastFullUpdateTxEnvelope.Payload) == 0 {
+			return nil
+		}
+		if utx.SequenceNumber <= ch.LastFullUpdateTx.SequenceNumber {
+			return ErrSeqTooLow
 		}
 	}
 
@@ -313,35 +703,89 @@ func (ch *Channel) AddFullUpdateTx(ev *wire.Envelope, utx *wire.UpdateTx) error
 	return nil
 }
 
-// func (ch *Channel) AddFullUpdateTx(ev *wire.Envelope, utx *wire.UpdateTx) (*wire.Envelope, error) {
-// 	if !(ch.Phase == OPEN || ch.Phase == PENDING_CLOSED) {
-// 		return nil, errors.New("channel not OPEN or PENDING_CLOSED")
-// 	}
-// 	if len(ev.Signatures) != 3 {
-// 		return nil, errors.New("wrong number of signatures")
-// 	}
-// 	if !ed25519.Verify(sliceTo32Byte(ch.Account.Pubkey), ev.Payload, sliceTo64Byte(ev.Signatures[ch.Me])) {
-// 		return nil, errors.New("my account signature not valid")
-// 	}
-// 	if !ed25519.Verify(sliceTo32Byte(ch.Counterparty.Pubkey), ev.Payload, sliceTo64Byte(ev.Signatures[swap[ch.Me]])) {
-// 		return nil, errors.New("counterparty signature not valid")
-// 	}
-// 	if !ed25519.Verify(sliceTo32Byte(ch.Judge.Pubkey), ev.Payload, sliceTo64Byte(ev.Signatures[2])) {
-// 		return nil, errors.New("judge signature not valid")
-// 	}
-
-// 	ch.Phase = PENDING_CLOSED
-// 	ch.LastFullUpdateTx = utx
-// 	ch.LastFullUpdateTxEnvelope = ev
-
-// 	if ch.LastFullUpdateTx != nil {
-// 		if ch.LastFullUpdateTx.SequenceNumber > utx.SequenceNumber {
-// 			return ch.LastFullUpdateTxEnvelope, nil
-// 		}
-// 	}
-
-// 	return nil, nil
-// }
+// checkJudgeSignatures checks that ev has been signed by every participant,
+// followed by the judge.
+func (ch *Channel) checkJudgeSignatures(ev *wire.Envelope) error {
+	n := len(ch.OpeningTx.Pubkeys)
+	if len(ev.Signatures) != n+1 {
+		return errs.New(errs.BadSignature, "wrong number of signatures")
+	}
+	if !ch.FullySigned(&wire.Envelope{Payload: ev.Payload, Signatures: ev.Signatures[:n]}) {
+		return errs.New(errs.BadSignature, "participant signature not valid")
+	}
+	if !ed25519.Verify(sliceTo32Byte(ch.Judge.Pubkey), ev.Payload, sliceTo64Byte(ev.Signatures[n])) {
+		return errs.New(errs.BadSignature, "judge signature not valid")
+	}
+	return nil
+}
+
+// checkJudgeSignedUpdateTx checks that an UpdateTx has been signed by every
+// participant and the judge.
+func (ch *Channel) checkJudgeSignedUpdateTx(ev *wire.Envelope, utx *wire.UpdateTx) error {
+	err := ch.checkJudgeSignatures(ev)
+	if err != nil {
+		return err
+	}
+	if utx.ChannelId != ch.OpeningTx.ChannelId {
+		return errs.New(errs.Invalid, "channel id incorrect")
+	}
+
+	return nil
+}
+
+// CheckFinalUpdateTx checks an UpdateTx that the judge has posted. If the judge's
+// UpdateTx is at least as new as our LastFullUpdateTx, the channel is placed in
+// PENDING_CLOSED. Otherwise, our LastFullUpdateTx is returned so that it can be
+// sent to the judge.
+func (ch *Channel) CheckFinalUpdateTx(ev *wire.Envelope, utx *wire.UpdateTx) (*wire.Envelope, error) {
+	if !(ch.Phase == OPEN || ch.Phase == PENDING_CLOSED) {
+		return nil, errs.New(errs.WrongPhase, "channel not OPEN or PENDING_CLOSED")
+	}
+	err := ch.checkJudgeSignedUpdateTx(ev, utx)
+	if err != nil {
+		return nil, err
+	}
+
+	if ch.LastFullUpdateTx != nil {
+		if ch.LastFullUpdateTx.SequenceNumber > utx.SequenceNumber {
+			return ch.LastFullUpdateTxEnvelope, nil
+		}
+	}
+
+	if ch.LastFullUpdateTx == nil || utx.SequenceNumber > ch.LastFullUpdateTx.SequenceNumber {
+		ch.LastFullUpdateTx = utx
+		ch.LastFullUpdateTxEnvelope = &wire.Envelope{
+			Payload:    ev.Payload,
+			Signatures: ev.Signatures[:len(ch.OpeningTx.Pubkeys)],
+		}
+	}
+
+	ch.Phase = PENDING_CLOSED
+
+	return nil, nil
+}
+
+// Close is called when the judge has closed the channel. ev is the UpdateTx the
+// judge closed the channel with, signed by the judge. If the judge cancelled the
+// channel instead, ev and utx are nil.
+func (ch *Channel) Close(ev *wire.Envelope, utx *wire.UpdateTx) error {
+	if !(ch.Phase == OPEN || ch.Phase == PENDING_CLOSED) {
+		return errs.New(errs.WrongPhase, "channel not OPEN or PENDING_CLOSED")
+	}
+
+	if ev != nil {
+		err := ch.checkJudgeSignedUpdateTx(ev, utx)
+		if err != nil {
+			return err
+		}
+	}
+
+	ch.FinalUpdateTx = utx
+	ch.FinalUpdateTxEnvelope = ev
+	ch.Phase = CLOSED
+
+	return nil
+}
 
 func (ch *Channel) NewClosingTx() *wire.ClosingTx {
 	return &wire.ClosingTx{
@@ -360,6 +804,57 @@ func SerializeClosingTx(ctx *wire.ClosingTx) (*wire.Envelope, error) {
 	}, nil
 }
 
+// NewCancelTx makes a CancelTx, which instructs the judge to close the channel
+// with the state in the OpeningTx. It can only be made before any UpdateTx has
+// been cosigned.
+func (ch *Channel) NewCancelTx() (*wire.CancelTx, error) {
+	if ch.Phase != OPEN {
+		return nil, errs.New(errs.WrongPhase, "channel not OPEN")
+	}
+	if ch.LastFullUpdateTx != nil {
+		return nil, errs.New(errs.Conflict, "channel has a full update tx")
+	}
+
+	return &wire.CancelTx{
+		ChannelId: ch.ChannelId,
+	}, nil
+}
+
+func SerializeCancelTx(ctx *wire.CancelTx) (*wire.Envelope, error) {
+	data, err := proto.Marshal(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	return &wire.Envelope{
+		Payload: data,
+	}, nil
+}
+
+// NewPreimageTx makes a PreimageTx revealing the preimage of a HashLock's hash
+// to the judge.
+func (ch *Channel) NewPreimageTx(preimage []byte) (*wire.PreimageTx, error) {
+	if !(ch.Phase == OPEN || ch.Phase == PENDING_CLOSED) {
+		return nil, errs.New(errs.WrongPhase, "channel not OPEN or PENDING_CLOSED")
+	}
+
+	return &wire.PreimageTx{
+		ChannelId: ch.ChannelId,
+		Preimage:  preimage,
+	}, nil
+}
+
+func SerializePreimageTx(ptx *wire.PreimageTx) (*wire.Envelope, error) {
+	data, err := proto.Marshal(ptx)
+	if err != nil {
+		return nil, err
+	}
+
+	return &wire.Envelope{
+		Payload: data,
+	}, nil
+}
+
 func (ch *Channel) NewFollowOnTx(state []byte) *wire.FollowOnTx {
 	return &wire.FollowOnTx{
 		ChannelId: ch.ChannelId,
@@ -380,13 +875,10 @@ func SerializeFollowOnTx(ftx *wire.FollowOnTx) (*wire.Envelope, error) {
 
 func (ch *Channel) AddFollowOnTx(ev *wire.Envelope) error {
 	if !(ch.Phase == OPEN || ch.Phase == PENDING_CLOSED) {
-		return errors.New("channel not OPEN or PENDING_CLOSED")
-	}
-	if len(ev.Signatures) != 1 {
-		return errors.New("wrong number of signatures")
+		return errs.New(errs.WrongPhase, "channel not OPEN or PENDING_CLOSED")
 	}
-	if !ed25519.Verify(sliceTo32Byte(ch.Counterparty.Pubkey), ev.Payload, sliceTo64Byte(ev.Signatures[0])) {
-		return errors.New("signature not valid")
+	if !ch.signedByCounterparty(ev) {
+		return ErrBadSignature
 	}
 
 	ch.FollowOnTxs = append(ch.FollowOnTxs, ev)
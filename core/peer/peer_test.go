@@ -0,0 +1,125 @@
+package peer
+
+import (
+	"crypto/rand"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/agl/ed25519"
+	"github.com/golang/protobuf/proto"
+	"github.com/jtremback/usc/core/errs"
+	"github.com/jtremback/usc/core/wire"
+)
+
+// testChannel returns an OPEN Channel between us and two Counterparties, and
+// the private keys of all three. We are participant 0.
+func testChannel(t *testing.T) (*Channel, []*[64]byte) {
+	otx := &wire.OpeningTx{ChannelId: "shibby"}
+	privs := []*[64]byte{}
+	for i := 0; i < 3; i++ {
+		pub, priv, err := ed25519.GenerateKey(rand.Reader)
+		if err != nil {
+			t.Fatal(err)
+		}
+		otx.Pubkeys = append(otx.Pubkeys, pub[:])
+		privs = append(privs, priv)
+	}
+
+	return &Channel{
+		ChannelId: otx.ChannelId,
+		Phase:     OPEN,
+		OpeningTx: otx,
+	}, privs
+}
+
+// signUpdateTx returns utx in an Envelope signed by the participants at the
+// indexes in signers.
+func signUpdateTx(t *testing.T, utx *wire.UpdateTx, privs []*[64]byte, signers ...int) *wire.Envelope {
+	b, err := proto.Marshal(utx)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	ev := &wire.Envelope{Payload: b, Signatures: make([][]byte, len(privs))}
+	for _, i := range signers {
+		ev.Signatures[i] = ed25519.Sign(privs[i], b)[:]
+	}
+	return ev
+}
+
+func TestConflictingUpdateTx(t *testing.T) {
+	ch, privs := testChannel(t)
+
+	ch.LastFullUpdateTx = &wire.UpdateTx{ChannelId: ch.ChannelId, SequenceNumber: 2, State: []byte{40}}
+	ch.LastFullUpdateTxEnvelope = signUpdateTx(t, ch.LastFullUpdateTx, privs, 0, 1, 2)
+
+	if ch.ConflictingUpdateTx(ch.LastFullUpdateTxEnvelope, ch.LastFullUpdateTx) != nil {
+		t.Fatal("the same update tx sent again is not a conflict")
+	}
+
+	utx := &wire.UpdateTx{ChannelId: ch.ChannelId, SequenceNumber: 2, State: []byte{9}}
+	ev := signUpdateTx(t, utx, privs, 0, 1, 2)
+	if held := ch.ConflictingUpdateTx(ev, utx); held != ch.LastFullUpdateTxEnvelope {
+		t.Fatal("a different full update tx with the same sequence number is a conflict", held)
+	}
+
+	ev.Signatures[1] = ev.Signatures[2]
+	if ch.ConflictingUpdateTx(ev, utx) != nil {
+		t.Fatal("an update tx with a bad signature is not evidence of a conflict")
+	}
+
+	utx = &wire.UpdateTx{ChannelId: ch.ChannelId, SequenceNumber: 1, State: []byte{9}}
+	if ch.ConflictingUpdateTx(signUpdateTx(t, utx, privs, 0, 1, 2), utx) != nil {
+		t.Fatal("an update tx with another sequence number is not a conflict")
+	}
+
+	// Two Counterparties may propose at the same time, but one Counterparty
+	// may not propose twice.
+	ch.TheirProposedUpdateTx = &wire.UpdateTx{ChannelId: ch.ChannelId, SequenceNumber: 3, State: []byte{50}}
+	ch.TheirProposedUpdateTxEnvelope = signUpdateTx(t, ch.TheirProposedUpdateTx, privs, 1)
+
+	utx = &wire.UpdateTx{ChannelId: ch.ChannelId, SequenceNumber: 3, State: []byte{60}}
+	if ch.ConflictingUpdateTx(signUpdateTx(t, utx, privs, 2), utx) != nil {
+		t.Fatal("proposals by different counterparties are not a conflict")
+	}
+	if held := ch.ConflictingUpdateTx(signUpdateTx(t, utx, privs, 1), utx); held != ch.TheirProposedUpdateTxEnvelope {
+		t.Fatal("two proposals by the same counterparty are a conflict", held)
+	}
+}
+
+func TestMessageFailed(t *testing.T) {
+	now := time.Now()
+
+	m := &Message{}
+	m.Failed(errors.New("network down"), now)
+	if m.Dead || m.Attempts != 1 || m.LastError != "network down" || !m.NextAttempt.Equal(now.Add(MinMessageBackoff)) {
+		t.Fatal("failed attempt not recorded", m)
+	}
+	m.Failed(errors.New("network down"), now)
+	if !m.NextAttempt.Equal(now.Add(2 * MinMessageBackoff)) {
+		t.Fatal("backoff should double", m.NextAttempt.Sub(now))
+	}
+
+	m = &Message{}
+	m.Failed(errs.New(errs.Invalid, "not an update tx"), now)
+	if !m.Dead || !m.NextAttempt.Equal(now.Add(DeadMessageRetention)) {
+		t.Fatal("rejected message should be dead", m)
+	}
+
+	// A message that keeps failing is given up on after MaxMessageAttempts.
+	m = &Message{}
+	for i := 1; i < MaxMessageAttempts; i++ {
+		m.Failed(errors.New("network down"), now)
+		if m.Dead {
+			t.Fatal("message given up on after", i, "attempts")
+		}
+		if m.NextAttempt.Sub(now) > MaxMessageBackoff {
+			t.Fatal("backoff should be at most MaxMessageBackoff", m.NextAttempt.Sub(now))
+		}
+	}
+	m.Failed(errors.New("network down"), now)
+	if !m.Dead {
+		t.Fatal("message should be given up on after MaxMessageAttempts")
+	}
+}
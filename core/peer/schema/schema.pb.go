@@ -0,0 +1,169 @@
+// Code generated by protoc-gen-go.
+// source: peer/schema/schema.proto
+// DO NOT EDIT!
+
+/*
+Package schema is a generated protocol buffer package.
+
+It is generated from these files:
+	peer/schema/schema.proto
+
+It has these top-level messages:
+	Channel
+*/
+package schema
+
+import proto "github.com/golang/protobuf/proto"
+import fmt "fmt"
+import math "math"
+import wire "github.com/jtremback/usc/core/wire"
+
+// Reference imports to suppress errors if they are not otherwise used.
+var _ = proto.Marshal
+var _ = fmt.Errorf
+var _ = math.Inf
+
+// This is a compile-time assertion to ensure that this generated file
+// is compatible with the proto package it is being compiled against.
+const _ = proto.ProtoPackageIsVersion1
+
+// Channel is a core/peer Channel as it is stored by peer/access. The Judge,
+// Account and Counterparties are stored in their own buckets, and are referred
+// to by pubkey.
+type Channel struct {
+	ChannelId                     string           `protobuf:"bytes,1,opt,name=channel_id" json:"channel_id,omitempty"`
+	Phase                         uint32           `protobuf:"varint,2,opt,name=phase" json:"phase,omitempty"`
+	OpeningTx                     *wire.OpeningTx  `protobuf:"bytes,3,opt,name=opening_tx" json:"opening_tx,omitempty"`
+	OpeningTxEnvelope             *wire.Envelope   `protobuf:"bytes,4,opt,name=opening_tx_envelope" json:"opening_tx_envelope,omitempty"`
+	LastFullUpdateTx              *wire.UpdateTx   `protobuf:"bytes,5,opt,name=last_full_update_tx" json:"last_full_update_tx,omitempty"`
+	LastFullUpdateTxEnvelope      *wire.Envelope   `protobuf:"bytes,6,opt,name=last_full_update_tx_envelope" json:"last_full_update_tx_envelope,omitempty"`
+	MyProposedUpdateTx            *wire.UpdateTx   `protobuf:"bytes,7,opt,name=my_proposed_update_tx" json:"my_proposed_update_tx,omitempty"`
+	MyProposedUpdateTxEnvelope    *wire.Envelope   `protobuf:"bytes,8,opt,name=my_proposed_update_tx_envelope" json:"my_proposed_update_tx_envelope,omitempty"`
+	TheirProposedUpdateTx         *wire.UpdateTx   `protobuf:"bytes,9,opt,name=their_proposed_update_tx" json:"their_proposed_update_tx,omitempty"`
+	TheirProposedUpdateTxEnvelope *wire.Envelope   `protobuf:"bytes,10,opt,name=their_proposed_update_tx_envelope" json:"their_proposed_update_tx_envelope,omitempty"`
+	FinalUpdateTx                 *wire.UpdateTx   `protobuf:"bytes,11,opt,name=final_update_tx" json:"final_update_tx,omitempty"`
+	FinalUpdateTxEnvelope         *wire.Envelope   `protobuf:"bytes,12,opt,name=final_update_tx_envelope" json:"final_update_tx_envelope,omitempty"`
+	Me                            uint32           `protobuf:"varint,13,opt,name=me" json:"me,omitempty"`
+	FollowOnTxs                   []*wire.Envelope `protobuf:"bytes,14,rep,name=follow_on_txs" json:"follow_on_txs,omitempty"`
+	JudgePubkey                   []byte           `protobuf:"bytes,15,opt,name=judge_pubkey,proto3" json:"judge_pubkey,omitempty"`
+	AccountPubkey                 []byte           `protobuf:"bytes,16,opt,name=account_pubkey,proto3" json:"account_pubkey,omitempty"`
+	CounterpartyPubkeys           [][]byte         `protobuf:"bytes,17,rep,name=counterparty_pubkeys,proto3" json:"counterparty_pubkeys,omitempty"`
+}
+
+func (m *Channel) Reset()                    { *m = Channel{} }
+func (m *Channel) String() string            { return proto.CompactTextString(m) }
+func (*Channel) ProtoMessage()               {}
+func (*Channel) Descriptor() ([]byte, []int) { return fileDescriptor0, []int{0} }
+
+func (m *Channel) GetOpeningTx() *wire.OpeningTx {
+	if m != nil {
+		return m.OpeningTx
+	}
+	return nil
+}
+
+func (m *Channel) GetOpeningTxEnvelope() *wire.Envelope {
+	if m != nil {
+		return m.OpeningTxEnvelope
+	}
+	return nil
+}
+
+func (m *Channel) GetLastFullUpdateTx() *wire.UpdateTx {
+	if m != nil {
+		return m.LastFullUpdateTx
+	}
+	return nil
+}
+
+func (m *Channel) GetLastFullUpdateTxEnvelope() *wire.Envelope {
+	if m != nil {
+		return m.LastFullUpdateTxEnvelope
+	}
+	return nil
+}
+
+func (m *Channel) GetMyProposedUpdateTx() *wire.UpdateTx {
+	if m != nil {
+		return m.MyProposedUpdateTx
+	}
+	return nil
+}
+
+func (m *Channel) GetMyProposedUpdateTxEnvelope() *wire.Envelope {
+	if m != nil {
+		return m.MyProposedUpdateTxEnvelope
+	}
+	return nil
+}
+
+func (m *Channel) GetTheirProposedUpdateTx() *wire.UpdateTx {
+	if m != nil {
+		return m.TheirProposedUpdateTx
+	}
+	return nil
+}
+
+func (m *Channel) GetTheirProposedUpdateTxEnvelope() *wire.Envelope {
+	if m != nil {
+		return m.TheirProposedUpdateTxEnvelope
+	}
+	return nil
+}
+
+func (m *Channel) GetFinalUpdateTx() *wire.UpdateTx {
+	if m != nil {
+		return m.FinalUpdateTx
+	}
+	return nil
+}
+
+func (m *Channel) GetFinalUpdateTxEnvelope() *wire.Envelope {
+	if m != nil {
+		return m.FinalUpdateTxEnvelope
+	}
+	return nil
+}
+
+func (m *Channel) GetFollowOnTxs() []*wire.Envelope {
+	if m != nil {
+		return m.FollowOnTxs
+	}
+	return nil
+}
+
+func init() {
+	proto.RegisterType((*Channel)(nil), "peer.schema.Channel")
+}
+
+var fileDescriptor0 = []byte{
+	// 448 bytes of a gzipped FileDescriptorProto
+	0x1f, 0x8b, 0x08, 0x00, 0x00, 0x00, 0x00, 0x00, 0x02, 0xff, 0x74, 0x93, 0x5f, 0x6b, 0xdb, 0x30,
+	0x14, 0xc5, 0x71, 0xb2, 0x26, 0xcd, 0x75, 0x9c, 0xb4, 0x4a, 0x03, 0xa2, 0xac, 0xc3, 0x1d, 0x0c,
+	0xfc, 0x94, 0xb2, 0x0e, 0xf6, 0xb6, 0xc1, 0x36, 0xb6, 0xb2, 0x97, 0xb5, 0x98, 0x0c, 0xc6, 0x5e,
+	0x84, 0x1b, 0xdf, 0x34, 0xde, 0x64, 0x49, 0xf8, 0xcf, 0xea, 0x7c, 0xb4, 0x7d, 0xbb, 0x11, 0xc9,
+	0xb1, 0xbd, 0x56, 0x7d, 0xb1, 0xa5, 0x73, 0xcf, 0x39, 0xfa, 0x81, 0x2d, 0xa0, 0x0a, 0x31, 0xbb,
+	0xc8, 0x57, 0x1b, 0x4c, 0xa3, 0xfa, 0xb5, 0x50, 0x99, 0x2c, 0x24, 0x71, 0x77, 0x93, 0x85, 0x91,
+	0x4e, 0xa7, 0xf7, 0x49, 0x86, 0x17, 0xbb, 0x87, 0x99, 0xbe, 0xfc, 0x3b, 0x84, 0xe1, 0xa7, 0x4d,
+	0x24, 0x04, 0x72, 0x72, 0x06, 0xb0, 0x32, 0x4b, 0x96, 0xc4, 0xd4, 0xf1, 0x9d, 0x60, 0x14, 0x8e,
+	0x6a, 0xe5, 0x6b, 0x4c, 0x4e, 0xe0, 0x40, 0x6d, 0xa2, 0x1c, 0x69, 0xcf, 0x77, 0x02, 0x2f, 0x34,
+	0x1b, 0xb2, 0x00, 0x90, 0x0a, 0x45, 0x22, 0xee, 0x58, 0x51, 0xd1, 0xbe, 0xef, 0x04, 0xee, 0xe5,
+	0x74, 0xa1, 0x4f, 0xb8, 0x36, 0xfa, 0xb2, 0x0a, 0x47, 0x72, 0xbf, 0x24, 0xef, 0x61, 0xd6, 0xfa,
+	0x19, 0x8a, 0x3f, 0xc8, 0xa5, 0x42, 0xfa, 0x4c, 0x07, 0x27, 0x26, 0xf8, 0xb9, 0x56, 0xc3, 0xe3,
+	0x26, 0xb7, 0x97, 0xc8, 0x3b, 0x98, 0xf1, 0x28, 0x2f, 0xd8, 0xba, 0xe4, 0x9c, 0x95, 0x2a, 0x8e,
+	0x0a, 0xdc, 0x1d, 0x7c, 0xd0, 0xcd, 0x7f, 0xd7, 0xf2, 0xb2, 0x0a, 0x8f, 0x76, 0xd6, 0x2f, 0x25,
+	0xe7, 0x7b, 0x85, 0x7c, 0x83, 0xe7, 0x96, 0x78, 0xcb, 0x31, 0xb0, 0x72, 0xd0, 0x87, 0x3d, 0x0d,
+	0xce, 0x07, 0x98, 0xa7, 0x5b, 0xa6, 0x32, 0xa9, 0x64, 0x8e, 0x71, 0x07, 0x68, 0x68, 0x05, 0x22,
+	0xe9, 0xf6, 0xa6, 0xf6, 0x36, 0x48, 0x21, 0xbc, 0xb0, 0x56, 0xb4, 0x50, 0x87, 0x56, 0xa8, 0xd3,
+	0xc7, 0x5d, 0x0d, 0xd6, 0x15, 0xd0, 0x62, 0x83, 0x49, 0x66, 0x23, 0x1b, 0x59, 0xc9, 0xe6, 0xda,
+	0xff, 0x08, 0xee, 0x07, 0x9c, 0x3f, 0x55, 0xd4, 0xf2, 0x81, 0x95, 0xef, 0xcc, 0xda, 0xd8, 0x20,
+	0xbe, 0x85, 0xe9, 0x3a, 0x11, 0x51, 0xf7, 0x23, 0xba, 0x56, 0x32, 0x4f, 0xdb, 0x1a, 0xa2, 0x2b,
+	0xa0, 0x0f, 0x72, 0x2d, 0xc8, 0xd8, 0x0a, 0x32, 0xff, 0xaf, 0xa0, 0x01, 0x98, 0x40, 0x2f, 0x45,
+	0xea, 0xe9, 0x9f, 0xb9, 0x97, 0x22, 0xb9, 0x04, 0x6f, 0x2d, 0x39, 0x97, 0xf7, 0x4c, 0x0a, 0x56,
+	0x54, 0x39, 0x9d, 0xf8, 0x7d, 0x4b, 0x9b, 0x6b, 0x4c, 0xd7, 0x62, 0x59, 0xe5, 0xe4, 0x1c, 0xc6,
+	0xbf, 0xca, 0xf8, 0x0e, 0x99, 0x2a, 0x6f, 0x7f, 0xe3, 0x96, 0x4e, 0x7d, 0x27, 0x18, 0x87, 0xae,
+	0xd6, 0x6e, 0xb4, 0x44, 0x5e, 0xc1, 0x24, 0x5a, 0xad, 0x64, 0x29, 0x8a, 0xbd, 0xe9, 0x48, 0x9b,
+	0xbc, 0x5a, 0xad, 0x6d, 0xaf, 0xe1, 0x44, 0x6f, 0x31, 0x53, 0x51, 0x56, 0x6c, 0x6b, 0x6f, 0x4e,
+	0x8f, 0xfd, 0x7e, 0x30, 0x0e, 0x67, 0xdd, 0x99, 0x49, 0xe4, 0x1f, 0x0f, 0x7f, 0x0e, 0xcc, 0xb5,
+	0xbe, 0x1d, 0xe8, 0xcb, 0xfc, 0xe6, 0xdf, 0x00, 0x0b, 0xa9, 0x61, 0x98, 0x06, 0x04, 0x00, 0x00,
+}
@@ -1,2 +1,3 @@
-protoc ./wire/wire.proto --go_out ./
- # && protoc $GOPATH/src/github.com/jtremback/upc-core/client/schema.proto --go_out $GOPATH/src -I $GOPATH/src && protoc $GOPATH/src/github.com/jtremback/upc-core/judge/schema/schema.proto --go_out $GOPATH/src -I $GOPATH/src
\ No newline at end of file
+protoc ./wire/wire.proto --go_out plugins=grpc:./
+protoc ./peer/schema/schema.proto --go_out Mwire/wire.proto=github.com/jtremback/usc/core/wire:./
+protoc ./judge/schema/schema.proto --go_out Mwire/wire.proto=github.com/jtremback/usc/core/wire:./
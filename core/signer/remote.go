@@ -0,0 +1,100 @@
+package signer
+
+import (
+	"encoding/json"
+	"errors"
+	"io"
+	"log"
+	"net"
+	"time"
+)
+
+type signRequest struct {
+	Pubkey  []byte
+	Payload []byte
+}
+
+type signResponse struct {
+	Signature []byte
+	Error     string
+}
+
+// Remote is a Signer that asks another process to sign, over the Unix socket
+// at Path. The other process runs Serve.
+type Remote struct {
+	Path string
+	// How long to wait for the other process. Zero means no timeout.
+	Timeout time.Duration
+}
+
+func (r *Remote) Sign(pubkey []byte, payload []byte) ([]byte, error) {
+	conn, err := net.DialTimeout("unix", r.Path, r.Timeout)
+	if err != nil {
+		return nil, err
+	}
+	defer conn.Close()
+
+	if r.Timeout > 0 {
+		conn.SetDeadline(time.Now().Add(r.Timeout))
+	}
+
+	err = json.NewEncoder(conn).Encode(&signRequest{Pubkey: pubkey, Payload: payload})
+	if err != nil {
+		return nil, err
+	}
+
+	resp := &signResponse{}
+	err = json.NewDecoder(conn).Decode(resp)
+	if err != nil {
+		return nil, err
+	}
+
+	if resp.Error != "" {
+		return nil, errors.New(resp.Error)
+	}
+
+	return resp.Signature, nil
+}
+
+// Serve answers the requests of Remote Signers connecting to l with s, until
+// l is closed.
+func Serve(l net.Listener, s Signer) error {
+	for {
+		conn, err := l.Accept()
+		if err != nil {
+			return err
+		}
+
+		go serveConn(conn, s)
+	}
+}
+
+func serveConn(conn net.Conn, s Signer) {
+	defer conn.Close()
+
+	dec := json.NewDecoder(conn)
+	enc := json.NewEncoder(conn)
+	for {
+		req := &signRequest{}
+		err := dec.Decode(req)
+		if err == io.EOF {
+			return
+		}
+		if err != nil {
+			log.Println("signer:", err)
+			return
+		}
+
+		resp := &signResponse{}
+		resp.Signature, err = s.Sign(req.Pubkey, req.Payload)
+		if err != nil {
+			resp.Error = err.Error()
+		}
+
+		err = enc.Encode(resp)
+		if err != nil {
+			log.Println("signer:", err)
+			return
+		}
+	}
+}
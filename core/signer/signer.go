@@ -0,0 +1,62 @@
+// Package signer signs payloads with ed25519 private keys that may be held
+// somewhere other than the peer or judge, such as a separate process.
+package signer
+
+import (
+	"encoding/hex"
+	"errors"
+	"sync"
+
+	"github.com/agl/ed25519"
+	"github.com/jtremback/usc/core/errs"
+)
+
+var ErrNoKey = errs.New(errs.NotFound, "signer does not have key")
+
+// Signer signs payloads with the private key of a public key.
+// keystore.Keystore is a Signer.
+type Signer interface {
+	Sign(pubkey []byte, payload []byte) ([]byte, error)
+}
+
+// Memory is a Signer that keeps private keys in memory.
+type Memory struct {
+	mu       sync.RWMutex
+	privkeys map[string][]byte
+}
+
+func NewMemory(privkeys ...[]byte) *Memory {
+	m := &Memory{privkeys: map[string][]byte{}}
+	for _, privkey := range privkeys {
+		m.Add(privkey)
+	}
+	return m
+}
+
+// Add adds an ed25519 private key. The public key is the last 32 bytes of it.
+func (m *Memory) Add(privkey []byte) error {
+	if len(privkey) != ed25519.PrivateKeySize {
+		return errors.New("private key is the wrong length")
+	}
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	m.privkeys[hex.EncodeToString(privkey[32:])] = append([]byte{}, privkey...)
+	return nil
+}
+
+func (m *Memory) Sign(pubkey []byte, payload []byte) ([]byte, error) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	privkey, ok := m.privkeys[hex.EncodeToString(pubkey)]
+	if !ok {
+		return nil, ErrNoKey
+	}
+
+	priv := [ed25519.PrivateKeySize]byte{}
+	copy(priv[:], privkey)
+
+	return ed25519.Sign(&priv, payload)[:], nil
+}
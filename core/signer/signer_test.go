@@ -0,0 +1,70 @@
+package signer
+
+import (
+	"crypto/rand"
+	"net"
+	"os"
+	"testing"
+	"time"
+
+	"github.com/agl/ed25519"
+)
+
+func verify(pubkey *[ed25519.PublicKeySize]byte, payload []byte, sig []byte) bool {
+	s := [ed25519.SignatureSize]byte{}
+	copy(s[:], sig)
+	return ed25519.Verify(pubkey, payload, &s)
+}
+
+func TestMemory(t *testing.T) {
+	pub, priv, err := ed25519.GenerateKey(rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	m := NewMemory(priv[:])
+
+	sig, err := m.Sign(pub[:], []byte{1, 2, 3})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !verify(pub, []byte{1, 2, 3}, sig) {
+		t.Fatal("signature not valid")
+	}
+
+	_, err = m.Sign([]byte{4, 5, 6}, []byte{1, 2, 3})
+	if err != ErrNoKey {
+		t.Fatal("unknown key should return ErrNoKey")
+	}
+}
+
+func TestRemote(t *testing.T) {
+	pub, priv, err := ed25519.GenerateKey(rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	os.Remove("/tmp/usc-signer-test.sock")
+	l, err := net.Listen("unix", "/tmp/usc-signer-test.sock")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer l.Close()
+
+	go Serve(l, NewMemory(priv[:]))
+
+	r := &Remote{Path: "/tmp/usc-signer-test.sock", Timeout: time.Second}
+
+	sig, err := r.Sign(pub[:], []byte{1, 2, 3})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !verify(pub, []byte{1, 2, 3}, sig) {
+		t.Fatal("signature not valid")
+	}
+
+	_, err = r.Sign([]byte{4, 5, 6}, []byte{1, 2, 3})
+	if err == nil || err.Error() != ErrNoKey.Error() {
+		t.Fatal("unknown key should return the signer's error", err)
+	}
+}
@@ -0,0 +1,183 @@
+// Package webhook POSTs signed JSON payloads about the lifecycle of channels to
+// URLs registered by a peer's accounts or a judge's operators.
+//
+// Each Delivery is saved in an outbox in the same transaction as the change it
+// describes, and is tried until it is delivered or MaxAttempts is reached, so
+// that no payload is lost to a restart or a receiver that is down. A payload
+// may be delivered more than once, and receivers can drop duplicates by its Id.
+//
+// The body is signed with the same key that the account or judge signs
+// Envelopes with, so the signed bytes are the body prefixed with SignedPrefix.
+// This keeps a webhook signature from ever being a valid signature of an
+// Envelope's Payload, or the other way around. Receivers check a signature
+// with Verify, or by checking the ed25519 signature of SignedPrefix followed by
+// the body.
+package webhook
+
+import (
+	"bytes"
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"net/url"
+	"time"
+
+	"github.com/agl/ed25519"
+	"github.com/jtremback/usc/core/errs"
+	"github.com/jtremback/usc/core/signer"
+)
+
+const (
+	// The base64url ed25519 signature of SignedPrefix followed by the body, by
+	// the key in PubkeyHeader
+	SignatureHeader = "Usc-Signature"
+	// The base64url pubkey of the account or judge that signed the body
+	PubkeyHeader = "Usc-Pubkey"
+	// What the body is prefixed with before it is signed
+	SignedPrefix = "usc-webhook\x00"
+)
+
+const (
+	// How many times a Delivery is tried before it is given up on
+	MaxAttempts = 20
+	// The wait after the first failed attempt, doubled after each one after
+	MinBackoff = 5 * time.Second
+	// The longest wait between attempts
+	MaxBackoff = time.Hour
+)
+
+// Payload is the body of a webhook, as JSON. Pubkey is the account or judge it
+// is for, and signs it.
+type Payload struct {
+	Id             uint64    `json:"id"`
+	Type           string    `json:"type"`
+	Pubkey         string    `json:"pubkey"`
+	ChannelId      string    `json:"channelId"`
+	SequenceNumber uint32    `json:"sequenceNumber,omitempty"`
+	Time           time.Time `json:"time"`
+}
+
+// Delivery is a Payload waiting in the outbox to be POSTed to URL. Id is its
+// position in the outbox, and is also the Id of the Payload.
+type Delivery struct {
+	Id          uint64
+	URL         string
+	Pubkey      []byte
+	Payload     *Payload
+	Attempts    int
+	NextAttempt time.Time
+	LastError   string
+}
+
+// CheckURLs checks that each of urls is an absolute http or https URL.
+func CheckURLs(urls []string) error {
+	for _, u := range urls {
+		parsed, err := url.Parse(u)
+		if err != nil || (parsed.Scheme != "http" && parsed.Scheme != "https") || parsed.Host == "" {
+			return errs.New(errs.Invalid, "webhook URL not valid: "+u)
+		}
+	}
+	return nil
+}
+
+// New makes a Delivery to each of urls of an event about a channel, signed by
+// pubkey.
+func New(urls []string, pubkey []byte, typ string, chID string, seq uint32, now time.Time) []*Delivery {
+	ds := []*Delivery{}
+	for _, u := range urls {
+		ds = append(ds, &Delivery{
+			URL:    u,
+			Pubkey: pubkey,
+			Payload: &Payload{
+				Type:           typ,
+				Pubkey:         base64.URLEncoding.EncodeToString(pubkey),
+				ChannelId:      chID,
+				SequenceNumber: seq,
+				Time:           now,
+			},
+			NextAttempt: now,
+		})
+	}
+	return ds
+}
+
+// Backoff returns how long to wait before trying again after the given number
+// of failed attempts.
+func Backoff(attempts int) time.Duration {
+	backoff := MinBackoff
+	for i := 1; i < attempts; i++ {
+		backoff *= 2
+		if backoff >= MaxBackoff {
+			return MaxBackoff
+		}
+	}
+	return backoff
+}
+
+// Failed records a failed attempt at d, and schedules the next one. It returns
+// false if d has been tried MaxAttempts times and should be given up on.
+func (d *Delivery) Failed(err error, now time.Time) bool {
+	d.Attempts++
+	d.LastError = err.Error()
+	d.NextAttempt = now.Add(Backoff(d.Attempts))
+	return d.Attempts < MaxAttempts
+}
+
+// signed returns the bytes that are signed for body.
+func signed(body []byte) []byte {
+	return append([]byte(SignedPrefix), body...)
+}
+
+// Post signs d's Payload with s and POSTs it to d.URL. Any response other than
+// a 2xx is an error.
+func Post(client *http.Client, s signer.Signer, d *Delivery) error {
+	d.Payload.Id = d.Id
+	body, err := json.Marshal(d.Payload)
+	if err != nil {
+		return err
+	}
+
+	sig, err := s.Sign(d.Pubkey, signed(body))
+	if err != nil {
+		return err
+	}
+
+	req, err := http.NewRequest("POST", d.URL, bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set(SignatureHeader, base64.URLEncoding.EncodeToString(sig))
+	req.Header.Set(PubkeyHeader, d.Payload.Pubkey)
+
+	resp, err := client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	io.Copy(ioutil.Discard, resp.Body)
+
+	if resp.StatusCode < 200 || resp.StatusCode > 299 {
+		return fmt.Errorf("webhook responded with %s", resp.Status)
+	}
+	return nil
+}
+
+// Verify checks that sig, from the SignatureHeader, is pubkey's signature of
+// body, prefixed with SignedPrefix. Receivers should also check that pubkey is
+// one they expect.
+func Verify(pubkey []byte, body []byte, sig []byte) bool {
+	if len(pubkey) != ed25519.PublicKeySize || len(sig) != ed25519.SignatureSize {
+		return false
+	}
+
+	pub := [ed25519.PublicKeySize]byte{}
+	copy(pub[:], pubkey)
+	s := [ed25519.SignatureSize]byte{}
+	copy(s[:], sig)
+
+	return ed25519.Verify(&pub, signed(body), &s)
+}
@@ -0,0 +1,132 @@
+package webhook
+
+import (
+	"crypto/rand"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/agl/ed25519"
+	"github.com/jtremback/usc/core/errs"
+	"github.com/jtremback/usc/core/signer"
+)
+
+func TestBackoff(t *testing.T) {
+	if Backoff(1) != MinBackoff {
+		t.Fatal("first backoff should be MinBackoff", Backoff(1))
+	}
+	if Backoff(3) != 4*MinBackoff {
+		t.Fatal("backoff should double", Backoff(3))
+	}
+	if Backoff(MaxAttempts) != MaxBackoff {
+		t.Fatal("backoff should be at most MaxBackoff", Backoff(MaxAttempts))
+	}
+
+	now := time.Now()
+	d := &Delivery{}
+	for i := 1; i < MaxAttempts; i++ {
+		if !d.Failed(errors.New("down"), now) {
+			t.Fatal("gave up after", i, "attempts")
+		}
+	}
+	if d.Failed(errors.New("down"), now) {
+		t.Fatal("should give up after MaxAttempts")
+	}
+	if d.LastError != "down" || !d.NextAttempt.Equal(now.Add(MaxBackoff)) {
+		t.Fatal("failed attempt not recorded", d)
+	}
+}
+
+func TestPost(t *testing.T) {
+	pub, priv, err := ed25519.GenerateKey(rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	got := make(chan *Payload, 1)
+	status := http.StatusOK
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, err := ioutil.ReadAll(r.Body)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		pubkey, err := base64.URLEncoding.DecodeString(r.Header.Get(PubkeyHeader))
+		if err != nil {
+			t.Fatal(err)
+		}
+		sig, err := base64.URLEncoding.DecodeString(r.Header.Get(SignatureHeader))
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !Verify(pubkey, body, sig) {
+			t.Fatal("signature not valid")
+		}
+
+		p := &Payload{}
+		err = json.Unmarshal(body, p)
+		if err != nil {
+			t.Fatal(err)
+		}
+		got <- p
+		w.WriteHeader(status)
+	}))
+	defer server.Close()
+
+	ds := New([]string{server.URL}, pub[:], "ChannelProposed", "channel1", 0, time.Now())
+	ds[0].Id = 7
+
+	err = Post(http.DefaultClient, signer.NewMemory(priv[:]), ds[0])
+	if err != nil {
+		t.Fatal(err)
+	}
+	p := <-got
+	if p.Id != 7 || p.Type != "ChannelProposed" || p.ChannelId != "channel1" {
+		t.Fatal("payload incorrect", p)
+	}
+
+	status = http.StatusInternalServerError
+	err = Post(http.DefaultClient, signer.NewMemory(priv[:]), ds[0])
+	if err == nil {
+		t.Fatal("error response should be an error")
+	}
+	<-got
+
+	err = Post(http.DefaultClient, signer.NewMemory(), ds[0])
+	if err != signer.ErrNoKey {
+		t.Fatal("should not post without the key", err)
+	}
+
+	if Verify(pub[:], []byte("other body"), make([]byte, ed25519.SignatureSize)) {
+		t.Fatal("bad signature verified")
+	}
+
+	// A signature of the body alone, as of an Envelope's Payload, is not a
+	// webhook signature.
+	body := []byte(`{"id":7}`)
+	if Verify(pub[:], body, ed25519.Sign(priv, body)[:]) {
+		t.Fatal("signature without the prefix verified")
+	}
+	if !Verify(pub[:], body, ed25519.Sign(priv, append([]byte(SignedPrefix), body...))[:]) {
+		t.Fatal("signature with the prefix not verified")
+	}
+}
+
+func TestCheckURLs(t *testing.T) {
+	err := CheckURLs([]string{"http://localhost:8080/hook", "https://example.com/usc"})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for _, u := range []string{"localhost:8080", "/hook", "ftp://example.com", "http://"} {
+		err = CheckURLs([]string{u})
+		if errs.CodeOf(err) != errs.Invalid {
+			t.Fatal("URL should not be valid", u, err)
+		}
+	}
+}
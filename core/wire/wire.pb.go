@@ -11,10 +11,18 @@ It is generated from these files:
 It has these top-level messages:
 	OpeningTx
 	UpdateTx
+	HashLock
 	FollowOnTx
 	ClosingTx
+	PreimageTx
+	CancelTx
+	ChannelRejectionTx
+	UpdateRejectionTx
 	Envelope
 	Parcel
+	ChannelRequest
+	ChannelJSON
+	Empty
 */
 package wire
 
@@ -22,6 +30,11 @@ import proto "github.com/golang/protobuf/proto"
 import fmt "fmt"
 import math "math"
 
+import (
+	context "golang.org/x/net/context"
+	grpc "google.golang.org/grpc"
+)
+
 // Reference imports to suppress errors if they are not otherwise used.
 var _ = proto.Marshal
 var _ = fmt.Errorf
@@ -44,10 +57,14 @@ func (*OpeningTx) ProtoMessage()               {}
 func (*OpeningTx) Descriptor() ([]byte, []int) { return fileDescriptor0, []int{0} }
 
 type UpdateTx struct {
-	ChannelId      string `protobuf:"bytes,1,opt,name=channel_id" json:"channel_id,omitempty"`
-	SequenceNumber uint32 `protobuf:"varint,2,opt,name=sequence_number" json:"sequence_number,omitempty"`
-	Fast           bool   `protobuf:"varint,3,opt,name=fast" json:"fast,omitempty"`
-	State          []byte `protobuf:"bytes,4,opt,name=state,proto3" json:"state,omitempty"`
+	ChannelId      string      `protobuf:"bytes,1,opt,name=channel_id" json:"channel_id,omitempty"`
+	SequenceNumber uint32      `protobuf:"varint,2,opt,name=sequence_number" json:"sequence_number,omitempty"`
+	Fast           bool        `protobuf:"varint,3,opt,name=fast" json:"fast,omitempty"`
+	State          []byte      `protobuf:"bytes,4,opt,name=state,proto3" json:"state,omitempty"`
+	HashLocks      []*HashLock `protobuf:"bytes,5,rep,name=hash_locks" json:"hash_locks,omitempty"`
+	// Unix time in nanoseconds after which the judge will not accept this
+	// UpdateTx. Zero means it never expires.
+	Expiry int64 `protobuf:"varint,6,opt,name=expiry" json:"expiry,omitempty"`
 }
 
 func (m *UpdateTx) Reset()                    { *m = UpdateTx{} }
@@ -55,6 +72,26 @@ func (m *UpdateTx) String() string            { return proto.CompactTextString(m
 func (*UpdateTx) ProtoMessage()               {}
 func (*UpdateTx) Descriptor() ([]byte, []int) { return fileDescriptor0, []int{1} }
 
+func (m *UpdateTx) GetHashLocks() []*HashLock {
+	if m != nil {
+		return m.HashLocks
+	}
+	return nil
+}
+
+// A HashLock makes part of an UpdateTx's state conditional on the preimage of
+// hash being revealed to the judge before expiry (unix time in nanoseconds).
+type HashLock struct {
+	Hash   []byte `protobuf:"bytes,1,opt,name=hash,proto3" json:"hash,omitempty"`
+	Expiry int64  `protobuf:"varint,2,opt,name=expiry" json:"expiry,omitempty"`
+	State  []byte `protobuf:"bytes,3,opt,name=state,proto3" json:"state,omitempty"`
+}
+
+func (m *HashLock) Reset()                    { *m = HashLock{} }
+func (m *HashLock) String() string            { return proto.CompactTextString(m) }
+func (*HashLock) ProtoMessage()               {}
+func (*HashLock) Descriptor() ([]byte, []int) { return fileDescriptor0, []int{2} }
+
 type FollowOnTx struct {
 	ChannelId string `protobuf:"bytes,1,opt,name=channel_id" json:"channel_id,omitempty"`
 	State     []byte `protobuf:"bytes,2,opt,name=state,proto3" json:"state,omitempty"`
@@ -63,7 +100,7 @@ type FollowOnTx struct {
 func (m *FollowOnTx) Reset()                    { *m = FollowOnTx{} }
 func (m *FollowOnTx) String() string            { return proto.CompactTextString(m) }
 func (*FollowOnTx) ProtoMessage()               {}
-func (*FollowOnTx) Descriptor() ([]byte, []int) { return fileDescriptor0, []int{2} }
+func (*FollowOnTx) Descriptor() ([]byte, []int) { return fileDescriptor0, []int{3} }
 
 type ClosingTx struct {
 	ChannelId string `protobuf:"bytes,2,opt,name=channel_id" json:"channel_id,omitempty"`
@@ -72,7 +109,45 @@ type ClosingTx struct {
 func (m *ClosingTx) Reset()                    { *m = ClosingTx{} }
 func (m *ClosingTx) String() string            { return proto.CompactTextString(m) }
 func (*ClosingTx) ProtoMessage()               {}
-func (*ClosingTx) Descriptor() ([]byte, []int) { return fileDescriptor0, []int{3} }
+func (*ClosingTx) Descriptor() ([]byte, []int) { return fileDescriptor0, []int{4} }
+
+type PreimageTx struct {
+	ChannelId string `protobuf:"bytes,7,opt,name=channel_id" json:"channel_id,omitempty"`
+	Preimage  []byte `protobuf:"bytes,8,opt,name=preimage,proto3" json:"preimage,omitempty"`
+}
+
+func (m *PreimageTx) Reset()                    { *m = PreimageTx{} }
+func (m *PreimageTx) String() string            { return proto.CompactTextString(m) }
+func (*PreimageTx) ProtoMessage()               {}
+func (*PreimageTx) Descriptor() ([]byte, []int) { return fileDescriptor0, []int{5} }
+
+type CancelTx struct {
+	ChannelId string `protobuf:"bytes,9,opt,name=channel_id" json:"channel_id,omitempty"`
+}
+
+func (m *CancelTx) Reset()                    { *m = CancelTx{} }
+func (m *CancelTx) String() string            { return proto.CompactTextString(m) }
+func (*CancelTx) ProtoMessage()               {}
+func (*CancelTx) Descriptor() ([]byte, []int) { return fileDescriptor0, []int{6} }
+
+type ChannelRejectionTx struct {
+	ChannelId string `protobuf:"bytes,10,opt,name=channel_id" json:"channel_id,omitempty"`
+}
+
+func (m *ChannelRejectionTx) Reset()                    { *m = ChannelRejectionTx{} }
+func (m *ChannelRejectionTx) String() string            { return proto.CompactTextString(m) }
+func (*ChannelRejectionTx) ProtoMessage()               {}
+func (*ChannelRejectionTx) Descriptor() ([]byte, []int) { return fileDescriptor0, []int{7} }
+
+type UpdateRejectionTx struct {
+	ChannelId      string `protobuf:"bytes,11,opt,name=channel_id" json:"channel_id,omitempty"`
+	SequenceNumber uint32 `protobuf:"varint,12,opt,name=sequence_number" json:"sequence_number,omitempty"`
+}
+
+func (m *UpdateRejectionTx) Reset()                    { *m = UpdateRejectionTx{} }
+func (m *UpdateRejectionTx) String() string            { return proto.CompactTextString(m) }
+func (*UpdateRejectionTx) ProtoMessage()               {}
+func (*UpdateRejectionTx) Descriptor() ([]byte, []int) { return fileDescriptor0, []int{8} }
 
 type Envelope struct {
 	Payload    []byte   `protobuf:"bytes,1,opt,name=payload,proto3" json:"payload,omitempty"`
@@ -82,7 +157,7 @@ type Envelope struct {
 func (m *Envelope) Reset()                    { *m = Envelope{} }
 func (m *Envelope) String() string            { return proto.CompactTextString(m) }
 func (*Envelope) ProtoMessage()               {}
-func (*Envelope) Descriptor() ([]byte, []int) { return fileDescriptor0, []int{4} }
+func (*Envelope) Descriptor() ([]byte, []int) { return fileDescriptor0, []int{9} }
 
 type Parcel struct {
 	Envelopes []*Envelope `protobuf:"bytes,1,rep,name=envelopes" json:"envelopes,omitempty"`
@@ -91,7 +166,7 @@ type Parcel struct {
 func (m *Parcel) Reset()                    { *m = Parcel{} }
 func (m *Parcel) String() string            { return proto.CompactTextString(m) }
 func (*Parcel) ProtoMessage()               {}
-func (*Parcel) Descriptor() ([]byte, []int) { return fileDescriptor0, []int{5} }
+func (*Parcel) Descriptor() ([]byte, []int) { return fileDescriptor0, []int{10} }
 
 func (m *Parcel) GetEnvelopes() []*Envelope {
 	if m != nil {
@@ -100,35 +175,589 @@ func (m *Parcel) GetEnvelopes() []*Envelope {
 	return nil
 }
 
+type ChannelRequest struct {
+	ChannelId string `protobuf:"bytes,1,opt,name=channel_id" json:"channel_id,omitempty"`
+}
+
+func (m *ChannelRequest) Reset()                    { *m = ChannelRequest{} }
+func (m *ChannelRequest) String() string            { return proto.CompactTextString(m) }
+func (*ChannelRequest) ProtoMessage()               {}
+func (*ChannelRequest) Descriptor() ([]byte, []int) { return fileDescriptor0, []int{11} }
+
+// A channel as JSON, as the judge's PeerHTTP returns it from /get_channel.
+type ChannelJSON struct {
+	Json []byte `protobuf:"bytes,1,opt,name=json,proto3" json:"json,omitempty"`
+}
+
+func (m *ChannelJSON) Reset()                    { *m = ChannelJSON{} }
+func (m *ChannelJSON) String() string            { return proto.CompactTextString(m) }
+func (*ChannelJSON) ProtoMessage()               {}
+func (*ChannelJSON) Descriptor() ([]byte, []int) { return fileDescriptor0, []int{12} }
+
+type Empty struct {
+}
+
+func (m *Empty) Reset()                    { *m = Empty{} }
+func (m *Empty) String() string            { return proto.CompactTextString(m) }
+func (*Empty) ProtoMessage()               {}
+func (*Empty) Descriptor() ([]byte, []int) { return fileDescriptor0, []int{13} }
+
 func init() {
 	proto.RegisterType((*OpeningTx)(nil), "wire.OpeningTx")
 	proto.RegisterType((*UpdateTx)(nil), "wire.UpdateTx")
+	proto.RegisterType((*HashLock)(nil), "wire.HashLock")
 	proto.RegisterType((*FollowOnTx)(nil), "wire.FollowOnTx")
 	proto.RegisterType((*ClosingTx)(nil), "wire.ClosingTx")
+	proto.RegisterType((*PreimageTx)(nil), "wire.PreimageTx")
+	proto.RegisterType((*CancelTx)(nil), "wire.CancelTx")
+	proto.RegisterType((*ChannelRejectionTx)(nil), "wire.ChannelRejectionTx")
+	proto.RegisterType((*UpdateRejectionTx)(nil), "wire.UpdateRejectionTx")
 	proto.RegisterType((*Envelope)(nil), "wire.Envelope")
 	proto.RegisterType((*Parcel)(nil), "wire.Parcel")
+	proto.RegisterType((*ChannelRequest)(nil), "wire.ChannelRequest")
+	proto.RegisterType((*ChannelJSON)(nil), "wire.ChannelJSON")
+	proto.RegisterType((*Empty)(nil), "wire.Empty")
+}
+
+// Reference imports to suppress errors if they are not otherwise used.
+var _ context.Context
+var _ grpc.ClientConn
+
+// This is a compile-time assertion to ensure that this generated file
+// is compatible with the grpc package it is being compiled against.
+const _ = grpc.SupportPackageIsVersion4
+
+// Client API for Counterparty service
+
+type CounterpartyClient interface {
+	AddChannel(ctx context.Context, in *Envelope, opts ...grpc.CallOption) (*Empty, error)
+	AddProposedUpdateTx(ctx context.Context, in *Envelope, opts ...grpc.CallOption) (*Empty, error)
+	AddFullUpdateTx(ctx context.Context, in *Envelope, opts ...grpc.CallOption) (*Empty, error)
+	AddChannelRejectionTx(ctx context.Context, in *Envelope, opts ...grpc.CallOption) (*Empty, error)
+	AddUpdateRejectionTx(ctx context.Context, in *Envelope, opts ...grpc.CallOption) (*Empty, error)
+}
+
+type counterpartyClient struct {
+	cc *grpc.ClientConn
+}
+
+func NewCounterpartyClient(cc *grpc.ClientConn) CounterpartyClient {
+	return &counterpartyClient{cc}
+}
+
+func (c *counterpartyClient) AddChannel(ctx context.Context, in *Envelope, opts ...grpc.CallOption) (*Empty, error) {
+	out := new(Empty)
+	err := grpc.Invoke(ctx, "/wire.Counterparty/AddChannel", in, out, c.cc, opts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *counterpartyClient) AddProposedUpdateTx(ctx context.Context, in *Envelope, opts ...grpc.CallOption) (*Empty, error) {
+	out := new(Empty)
+	err := grpc.Invoke(ctx, "/wire.Counterparty/AddProposedUpdateTx", in, out, c.cc, opts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *counterpartyClient) AddFullUpdateTx(ctx context.Context, in *Envelope, opts ...grpc.CallOption) (*Empty, error) {
+	out := new(Empty)
+	err := grpc.Invoke(ctx, "/wire.Counterparty/AddFullUpdateTx", in, out, c.cc, opts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *counterpartyClient) AddChannelRejectionTx(ctx context.Context, in *Envelope, opts ...grpc.CallOption) (*Empty, error) {
+	out := new(Empty)
+	err := grpc.Invoke(ctx, "/wire.Counterparty/AddChannelRejectionTx", in, out, c.cc, opts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *counterpartyClient) AddUpdateRejectionTx(ctx context.Context, in *Envelope, opts ...grpc.CallOption) (*Empty, error) {
+	out := new(Empty)
+	err := grpc.Invoke(ctx, "/wire.Counterparty/AddUpdateRejectionTx", in, out, c.cc, opts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+// Server API for Counterparty service
+
+type CounterpartyServer interface {
+	AddChannel(context.Context, *Envelope) (*Empty, error)
+	AddProposedUpdateTx(context.Context, *Envelope) (*Empty, error)
+	AddFullUpdateTx(context.Context, *Envelope) (*Empty, error)
+	AddChannelRejectionTx(context.Context, *Envelope) (*Empty, error)
+	AddUpdateRejectionTx(context.Context, *Envelope) (*Empty, error)
+}
+
+func RegisterCounterpartyServer(s *grpc.Server, srv CounterpartyServer) {
+	s.RegisterService(&_Counterparty_serviceDesc, srv)
+}
+
+func _Counterparty_AddChannel_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(Envelope)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(CounterpartyServer).AddChannel(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: "/wire.Counterparty/AddChannel",
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(CounterpartyServer).AddChannel(ctx, req.(*Envelope))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func _Counterparty_AddProposedUpdateTx_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(Envelope)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(CounterpartyServer).AddProposedUpdateTx(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: "/wire.Counterparty/AddProposedUpdateTx",
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(CounterpartyServer).AddProposedUpdateTx(ctx, req.(*Envelope))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func _Counterparty_AddFullUpdateTx_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(Envelope)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(CounterpartyServer).AddFullUpdateTx(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: "/wire.Counterparty/AddFullUpdateTx",
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(CounterpartyServer).AddFullUpdateTx(ctx, req.(*Envelope))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func _Counterparty_AddChannelRejectionTx_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(Envelope)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(CounterpartyServer).AddChannelRejectionTx(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: "/wire.Counterparty/AddChannelRejectionTx",
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(CounterpartyServer).AddChannelRejectionTx(ctx, req.(*Envelope))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func _Counterparty_AddUpdateRejectionTx_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(Envelope)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(CounterpartyServer).AddUpdateRejectionTx(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: "/wire.Counterparty/AddUpdateRejectionTx",
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(CounterpartyServer).AddUpdateRejectionTx(ctx, req.(*Envelope))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+var _Counterparty_serviceDesc = grpc.ServiceDesc{
+	ServiceName: "wire.Counterparty",
+	HandlerType: (*CounterpartyServer)(nil),
+	Methods: []grpc.MethodDesc{
+		{
+			MethodName: "AddChannel",
+			Handler:    _Counterparty_AddChannel_Handler,
+		},
+		{
+			MethodName: "AddProposedUpdateTx",
+			Handler:    _Counterparty_AddProposedUpdateTx_Handler,
+		},
+		{
+			MethodName: "AddFullUpdateTx",
+			Handler:    _Counterparty_AddFullUpdateTx_Handler,
+		},
+		{
+			MethodName: "AddChannelRejectionTx",
+			Handler:    _Counterparty_AddChannelRejectionTx_Handler,
+		},
+		{
+			MethodName: "AddUpdateRejectionTx",
+			Handler:    _Counterparty_AddUpdateRejectionTx_Handler,
+		},
+	},
+	Streams:  []grpc.StreamDesc{},
+	Metadata: "wire/wire.proto",
+}
+
+// Client API for Judge service
+
+type JudgeClient interface {
+	AddChannel(ctx context.Context, in *Envelope, opts ...grpc.CallOption) (*Empty, error)
+	AddFullUpdateTx(ctx context.Context, in *Envelope, opts ...grpc.CallOption) (*Empty, error)
+	AddClosingTx(ctx context.Context, in *Envelope, opts ...grpc.CallOption) (*Empty, error)
+	AddCancelTx(ctx context.Context, in *Envelope, opts ...grpc.CallOption) (*Empty, error)
+	AddPreimageTx(ctx context.Context, in *Envelope, opts ...grpc.CallOption) (*Empty, error)
+	AddFollowOnTx(ctx context.Context, in *Envelope, opts ...grpc.CallOption) (*Empty, error)
+	GetChannel(ctx context.Context, in *ChannelRequest, opts ...grpc.CallOption) (*ChannelJSON, error)
+	GetLastFullUpdateTx(ctx context.Context, in *ChannelRequest, opts ...grpc.CallOption) (*Envelope, error)
+}
+
+type judgeClient struct {
+	cc *grpc.ClientConn
+}
+
+func NewJudgeClient(cc *grpc.ClientConn) JudgeClient {
+	return &judgeClient{cc}
+}
+
+func (c *judgeClient) AddChannel(ctx context.Context, in *Envelope, opts ...grpc.CallOption) (*Empty, error) {
+	out := new(Empty)
+	err := grpc.Invoke(ctx, "/wire.Judge/AddChannel", in, out, c.cc, opts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *judgeClient) AddFullUpdateTx(ctx context.Context, in *Envelope, opts ...grpc.CallOption) (*Empty, error) {
+	out := new(Empty)
+	err := grpc.Invoke(ctx, "/wire.Judge/AddFullUpdateTx", in, out, c.cc, opts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *judgeClient) AddClosingTx(ctx context.Context, in *Envelope, opts ...grpc.CallOption) (*Empty, error) {
+	out := new(Empty)
+	err := grpc.Invoke(ctx, "/wire.Judge/AddClosingTx", in, out, c.cc, opts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *judgeClient) AddCancelTx(ctx context.Context, in *Envelope, opts ...grpc.CallOption) (*Empty, error) {
+	out := new(Empty)
+	err := grpc.Invoke(ctx, "/wire.Judge/AddCancelTx", in, out, c.cc, opts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *judgeClient) AddPreimageTx(ctx context.Context, in *Envelope, opts ...grpc.CallOption) (*Empty, error) {
+	out := new(Empty)
+	err := grpc.Invoke(ctx, "/wire.Judge/AddPreimageTx", in, out, c.cc, opts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *judgeClient) AddFollowOnTx(ctx context.Context, in *Envelope, opts ...grpc.CallOption) (*Empty, error) {
+	out := new(Empty)
+	err := grpc.Invoke(ctx, "/wire.Judge/AddFollowOnTx", in, out, c.cc, opts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *judgeClient) GetChannel(ctx context.Context, in *ChannelRequest, opts ...grpc.CallOption) (*ChannelJSON, error) {
+	out := new(ChannelJSON)
+	err := grpc.Invoke(ctx, "/wire.Judge/GetChannel", in, out, c.cc, opts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *judgeClient) GetLastFullUpdateTx(ctx context.Context, in *ChannelRequest, opts ...grpc.CallOption) (*Envelope, error) {
+	out := new(Envelope)
+	err := grpc.Invoke(ctx, "/wire.Judge/GetLastFullUpdateTx", in, out, c.cc, opts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+// Server API for Judge service
+
+type JudgeServer interface {
+	AddChannel(context.Context, *Envelope) (*Empty, error)
+	AddFullUpdateTx(context.Context, *Envelope) (*Empty, error)
+	AddClosingTx(context.Context, *Envelope) (*Empty, error)
+	AddCancelTx(context.Context, *Envelope) (*Empty, error)
+	AddPreimageTx(context.Context, *Envelope) (*Empty, error)
+	AddFollowOnTx(context.Context, *Envelope) (*Empty, error)
+	GetChannel(context.Context, *ChannelRequest) (*ChannelJSON, error)
+	GetLastFullUpdateTx(context.Context, *ChannelRequest) (*Envelope, error)
+}
+
+func RegisterJudgeServer(s *grpc.Server, srv JudgeServer) {
+	s.RegisterService(&_Judge_serviceDesc, srv)
+}
+
+func _Judge_AddChannel_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(Envelope)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(JudgeServer).AddChannel(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: "/wire.Judge/AddChannel",
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(JudgeServer).AddChannel(ctx, req.(*Envelope))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func _Judge_AddFullUpdateTx_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(Envelope)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(JudgeServer).AddFullUpdateTx(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: "/wire.Judge/AddFullUpdateTx",
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(JudgeServer).AddFullUpdateTx(ctx, req.(*Envelope))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func _Judge_AddClosingTx_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(Envelope)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(JudgeServer).AddClosingTx(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: "/wire.Judge/AddClosingTx",
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(JudgeServer).AddClosingTx(ctx, req.(*Envelope))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func _Judge_AddCancelTx_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(Envelope)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(JudgeServer).AddCancelTx(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: "/wire.Judge/AddCancelTx",
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(JudgeServer).AddCancelTx(ctx, req.(*Envelope))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func _Judge_AddPreimageTx_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(Envelope)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(JudgeServer).AddPreimageTx(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: "/wire.Judge/AddPreimageTx",
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(JudgeServer).AddPreimageTx(ctx, req.(*Envelope))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func _Judge_AddFollowOnTx_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(Envelope)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(JudgeServer).AddFollowOnTx(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: "/wire.Judge/AddFollowOnTx",
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(JudgeServer).AddFollowOnTx(ctx, req.(*Envelope))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func _Judge_GetChannel_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(ChannelRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(JudgeServer).GetChannel(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: "/wire.Judge/GetChannel",
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(JudgeServer).GetChannel(ctx, req.(*ChannelRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func _Judge_GetLastFullUpdateTx_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(ChannelRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(JudgeServer).GetLastFullUpdateTx(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: "/wire.Judge/GetLastFullUpdateTx",
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(JudgeServer).GetLastFullUpdateTx(ctx, req.(*ChannelRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+var _Judge_serviceDesc = grpc.ServiceDesc{
+	ServiceName: "wire.Judge",
+	HandlerType: (*JudgeServer)(nil),
+	Methods: []grpc.MethodDesc{
+		{
+			MethodName: "AddChannel",
+			Handler:    _Judge_AddChannel_Handler,
+		},
+		{
+			MethodName: "AddFullUpdateTx",
+			Handler:    _Judge_AddFullUpdateTx_Handler,
+		},
+		{
+			MethodName: "AddClosingTx",
+			Handler:    _Judge_AddClosingTx_Handler,
+		},
+		{
+			MethodName: "AddCancelTx",
+			Handler:    _Judge_AddCancelTx_Handler,
+		},
+		{
+			MethodName: "AddPreimageTx",
+			Handler:    _Judge_AddPreimageTx_Handler,
+		},
+		{
+			MethodName: "AddFollowOnTx",
+			Handler:    _Judge_AddFollowOnTx_Handler,
+		},
+		{
+			MethodName: "GetChannel",
+			Handler:    _Judge_GetChannel_Handler,
+		},
+		{
+			MethodName: "GetLastFullUpdateTx",
+			Handler:    _Judge_GetLastFullUpdateTx_Handler,
+		},
+	},
+	Streams:  []grpc.StreamDesc{},
+	Metadata: "wire/wire.proto",
 }
 
 var fileDescriptor0 = []byte{
-	// 311 bytes of a gzipped FileDescriptorProto
-	0x1f, 0x8b, 0x08, 0x00, 0x00, 0x09, 0x6e, 0x88, 0x02, 0xff, 0x84, 0x91, 0xcf, 0x4f, 0x3a, 0x31,
-	0x10, 0xc5, 0x03, 0xec, 0x97, 0x2f, 0x3b, 0x20, 0x24, 0x8d, 0x87, 0xbd, 0xa8, 0x64, 0x2f, 0xee,
-	0xc1, 0x40, 0xa2, 0x89, 0x77, 0xe3, 0x8f, 0xc4, 0x8b, 0x90, 0x46, 0xcf, 0xa4, 0xb0, 0x23, 0x34,
-	0xd6, 0xb6, 0xb6, 0x5d, 0x91, 0xe8, 0x1f, 0x6f, 0xb7, 0xb0, 0x42, 0xf4, 0xc0, 0x65, 0x33, 0xf3,
-	0x76, 0xfa, 0x3e, 0x2f, 0x33, 0xd0, 0x5b, 0x72, 0x83, 0xc3, 0xf2, 0x33, 0xd0, 0x46, 0x39, 0x45,
-	0xa2, 0xb2, 0x4e, 0x3f, 0x21, 0x1e, 0x69, 0x94, 0x5c, 0xce, 0x1f, 0x3f, 0xc8, 0x11, 0xc0, 0x6c,
-	0xc1, 0xa4, 0x44, 0x31, 0xe1, 0x79, 0x52, 0xeb, 0xd7, 0xb2, 0x98, 0xc6, 0x1b, 0xe5, 0x3e, 0x27,
-	0x09, 0xfc, 0xd7, 0xc5, 0xf4, 0x05, 0x57, 0x36, 0xa9, 0xf7, 0x1b, 0x59, 0x87, 0x56, 0x2d, 0x39,
-	0x84, 0x7f, 0xd6, 0x31, 0x87, 0x49, 0xc3, 0xbf, 0xe9, 0xd0, 0x75, 0x43, 0x4e, 0xa0, 0xbd, 0x50,
-	0x22, 0x9f, 0x68, 0x34, 0x5c, 0xe5, 0x49, 0xe4, 0xff, 0x45, 0x14, 0x4a, 0x69, 0x1c, 0x94, 0xf4,
-	0x0b, 0x5a, 0x4f, 0x3a, 0xf7, 0xa3, 0xfb, 0xd9, 0xa7, 0xd0, 0xb3, 0xf8, 0x56, 0xa0, 0x9c, 0xe1,
-	0x44, 0x16, 0xaf, 0x53, 0x34, 0x3e, 0x43, 0x2d, 0x3b, 0xa0, 0xdd, 0x4a, 0x7e, 0x08, 0x2a, 0x21,
-	0x10, 0x3d, 0x33, 0xeb, 0x42, 0x92, 0x16, 0x0d, 0xf5, 0x36, 0x5e, 0xb4, 0x13, 0x2f, 0xbd, 0x02,
-	0xb8, 0x53, 0x42, 0xa8, 0xe5, 0x48, 0xee, 0xe7, 0xff, 0x58, 0xd4, 0x77, 0x2d, 0x86, 0xd0, 0xbd,
-	0x66, 0x9e, 0x2d, 0x04, 0x73, 0x5c, 0xfd, 0xb5, 0xa9, 0xff, 0xb2, 0x49, 0x6f, 0xa0, 0x75, 0x2b,
-	0xdf, 0x51, 0x28, 0x8d, 0x61, 0x9d, 0x6c, 0x25, 0x14, 0x5b, 0xe3, 0xca, 0x75, 0xae, 0x5b, 0x72,
-	0x0c, 0x60, 0xf9, 0x5c, 0x32, 0x57, 0x18, 0xac, 0x76, 0xbd, 0xa3, 0xa4, 0x97, 0xd0, 0x1c, 0x33,
-	0xe3, 0xb1, 0xe4, 0x0c, 0x62, 0xdc, 0xf8, 0x59, 0xef, 0xd2, 0xc8, 0xda, 0xe7, 0xdd, 0x41, 0x38,
-	0x72, 0x85, 0xa1, 0xdb, 0x81, 0x69, 0x33, 0x5c, 0xfe, 0xe2, 0x3b, 0x00, 0x00, 0xff, 0xff, 0x97,
-	0xf8, 0xd7, 0x70, 0x0c, 0x02, 0x00, 0x00,
+	// 635 bytes of a gzipped FileDescriptorProto
+	0x1f, 0x8b, 0x08, 0x00, 0x00, 0x00, 0x00, 0x00, 0x02, 0xff, 0x94, 0x55, 0xcd, 0x4e, 0xdb, 0x40,
+	0x10, 0x96, 0xf3, 0x87, 0x3d, 0x09, 0x20, 0x16, 0x5a, 0x59, 0x48, 0x6d, 0x5d, 0x5f, 0x6a, 0x28,
+	0x05, 0x29, 0xb4, 0xbd, 0xf4, 0x14, 0xa5, 0x40, 0x8b, 0x10, 0x44, 0x6e, 0x7b, 0xea, 0x21, 0x5a,
+	0xbc, 0xd3, 0xc4, 0x60, 0xbc, 0xc6, 0xbb, 0x2e, 0x44, 0x7d, 0x81, 0x4a, 0x7d, 0xac, 0xbe, 0x58,
+	0xe5, 0x8d, 0x1d, 0x4c, 0x92, 0x9a, 0x70, 0x89, 0x66, 0x26, 0xdf, 0x37, 0x33, 0x3b, 0xf3, 0x4d,
+	0x02, 0xab, 0x37, 0x7e, 0x8c, 0x7b, 0xe9, 0xc7, 0x6e, 0x14, 0x73, 0xc9, 0x49, 0x2d, 0xb5, 0xed,
+	0x5f, 0x60, 0x9c, 0x45, 0x18, 0xfa, 0xe1, 0xe0, 0xeb, 0x2d, 0x79, 0x06, 0xe0, 0x0d, 0x69, 0x18,
+	0x62, 0xd0, 0xf7, 0x99, 0xa9, 0x59, 0x9a, 0x63, 0xb8, 0x46, 0x16, 0xf9, 0xcc, 0x88, 0x09, 0x4b,
+	0x51, 0x72, 0x7e, 0x89, 0x23, 0x61, 0x56, 0xac, 0xaa, 0xd3, 0x72, 0x73, 0x97, 0x6c, 0x40, 0x5d,
+	0x48, 0x2a, 0xd1, 0xac, 0x5a, 0x9a, 0xd3, 0x72, 0xc7, 0x0e, 0x79, 0x01, 0xcd, 0x21, 0x0f, 0x58,
+	0x3f, 0xc2, 0xd8, 0xe7, 0xcc, 0xac, 0x59, 0x9a, 0x53, 0x73, 0x21, 0x0d, 0xf5, 0x54, 0xc4, 0xfe,
+	0xab, 0x81, 0xfe, 0x2d, 0x62, 0x54, 0xe2, 0xc3, 0xc5, 0x5f, 0xc1, 0xaa, 0xc0, 0xeb, 0x04, 0x43,
+	0x0f, 0xfb, 0x61, 0x72, 0x75, 0x8e, 0xb1, 0x59, 0xb1, 0x34, 0x67, 0xd9, 0x5d, 0xc9, 0xc3, 0xa7,
+	0x2a, 0x4a, 0x08, 0xd4, 0x7e, 0x50, 0x21, 0x55, 0x2b, 0xba, 0xab, 0xec, 0xbb, 0xfe, 0x6a, 0xc5,
+	0xfe, 0xde, 0x00, 0x0c, 0xa9, 0x18, 0xf6, 0x03, 0xee, 0x5d, 0x0a, 0xb3, 0x6e, 0x55, 0x9d, 0x66,
+	0x7b, 0x65, 0x57, 0x8d, 0xe8, 0x13, 0x15, 0xc3, 0x13, 0xee, 0x5d, 0xba, 0xc6, 0x30, 0xb3, 0x04,
+	0x79, 0x0a, 0x0d, 0xbc, 0x8d, 0xfc, 0x78, 0x64, 0x36, 0x2c, 0xcd, 0xa9, 0xba, 0x99, 0x67, 0x9f,
+	0x80, 0x9e, 0xc3, 0xd3, 0xe2, 0x29, 0x41, 0xb5, 0xdf, 0x72, 0x95, 0x5d, 0xe0, 0x55, 0x8a, 0xbc,
+	0xf9, 0x43, 0xb3, 0x3b, 0x00, 0x87, 0x3c, 0x08, 0xf8, 0xcd, 0x59, 0xf8, 0xf0, 0x50, 0x26, 0x29,
+	0x2a, 0xc5, 0x14, 0xdb, 0x60, 0x74, 0x03, 0x2e, 0xe6, 0xed, 0xb4, 0x32, 0x95, 0xc1, 0x3e, 0x02,
+	0xe8, 0xc5, 0xe8, 0x5f, 0xd1, 0xc1, 0xec, 0x0e, 0x96, 0xa6, 0xcb, 0x6d, 0x82, 0x1e, 0x65, 0x60,
+	0x53, 0x57, 0x15, 0x27, 0xbe, 0xbd, 0x05, 0x7a, 0x97, 0x86, 0x1e, 0x06, 0x33, 0x69, 0x8c, 0xe9,
+	0x9a, 0xfb, 0x40, 0xba, 0x63, 0xc7, 0xc5, 0x0b, 0xf4, 0xa4, 0xcf, 0x67, 0x9f, 0x0a, 0xd3, 0xa4,
+	0xef, 0xb0, 0x36, 0x96, 0xca, 0xff, 0x39, 0xcd, 0x05, 0x34, 0xd3, 0x9a, 0xa7, 0x19, 0xfb, 0x23,
+	0xe8, 0x07, 0xe1, 0x4f, 0x0c, 0x78, 0x84, 0x4a, 0xe5, 0x74, 0x14, 0x70, 0xca, 0xb2, 0x2d, 0xe6,
+	0x2e, 0x79, 0x0e, 0x20, 0xfc, 0x41, 0x48, 0x65, 0x12, 0x63, 0x7e, 0x02, 0x85, 0x88, 0xfd, 0x1e,
+	0x1a, 0x3d, 0x1a, 0x7b, 0x18, 0x90, 0x1d, 0x30, 0x30, 0xcb, 0x27, 0x4c, 0xad, 0x28, 0xac, 0xbc,
+	0x8c, 0x7b, 0x07, 0xb0, 0xf7, 0x60, 0x65, 0x32, 0x8f, 0xeb, 0x04, 0x85, 0x7c, 0x60, 0xed, 0xf6,
+	0x4b, 0x68, 0x66, 0x84, 0xe3, 0x2f, 0x67, 0xa7, 0xa9, 0xe8, 0x2e, 0x04, 0x0f, 0x73, 0xd1, 0xa5,
+	0xb6, 0xbd, 0x04, 0xf5, 0x83, 0xab, 0x48, 0x8e, 0xda, 0xbf, 0x2b, 0xd0, 0xea, 0xf2, 0x24, 0x94,
+	0x18, 0x47, 0x34, 0x96, 0x23, 0xb2, 0x05, 0xd0, 0x61, 0x2c, 0xe3, 0x93, 0xa9, 0xb6, 0x36, 0x9b,
+	0x99, 0x9f, 0x72, 0x49, 0x1b, 0xd6, 0x3b, 0x8c, 0xf5, 0x62, 0x1e, 0x71, 0x81, 0x6c, 0x72, 0xa9,
+	0xa5, 0x9c, 0x5d, 0x58, 0xed, 0x30, 0x76, 0x98, 0x04, 0xc1, 0x62, 0xf8, 0xb7, 0xf0, 0xe4, 0xae,
+	0x9d, 0xe2, 0x6e, 0x4b, 0x59, 0xfb, 0xb0, 0xd1, 0x61, 0x6c, 0x56, 0x10, 0x65, 0xa4, 0xf6, 0x9f,
+	0x2a, 0xd4, 0x8f, 0x13, 0x36, 0xc0, 0xc7, 0xcc, 0xe0, 0xb1, 0xef, 0x79, 0x0d, 0xad, 0x34, 0xf5,
+	0xe4, 0xfe, 0x4a, 0xc1, 0xdb, 0xd0, 0x4c, 0xc1, 0xf9, 0xdd, 0x94, 0x62, 0x77, 0x60, 0x59, 0x2d,
+	0x63, 0x72, 0xac, 0x0b, 0xa0, 0x0b, 0xbf, 0x24, 0xa5, 0xe8, 0x77, 0x00, 0x47, 0x28, 0xf3, 0x79,
+	0x6c, 0x8c, 0xbf, 0xba, 0xaf, 0xc9, 0xcd, 0xb5, 0x7b, 0x51, 0x25, 0xbc, 0x0f, 0xb0, 0x7e, 0x84,
+	0xf2, 0x84, 0x0a, 0x79, 0x6f, 0x3e, 0xf3, 0xf9, 0x53, 0x0d, 0x9c, 0x37, 0xd4, 0xdf, 0xd0, 0xfe,
+	0xbf, 0x01, 0x00, 0x69, 0x87, 0xe2, 0x3b, 0x99, 0x06, 0x00, 0x00,
 }
@@ -0,0 +1,46 @@
+package wire
+
+import (
+	"bytes"
+	"testing"
+
+	"github.com/golang/protobuf/proto"
+)
+
+// A signature on one of the txs added after the original wire format must
+// never also be valid for another tx, so none of them may serialize to the
+// same bytes as any other signed tx with the same values.
+func TestSignedTxsDistinct(t *testing.T) {
+	baseline := []proto.Message{
+		&OpeningTx{ChannelId: "c"},
+		&UpdateTx{ChannelId: "c", SequenceNumber: 3},
+		&UpdateTx{ChannelId: "c", SequenceNumber: 3, State: []byte{1}},
+		&FollowOnTx{ChannelId: "c", State: []byte{1}},
+		&ClosingTx{ChannelId: "c"},
+	}
+	added := []proto.Message{
+		&PreimageTx{ChannelId: "c", Preimage: []byte{1}},
+		&CancelTx{ChannelId: "c"},
+		&ChannelRejectionTx{ChannelId: "c"},
+		&UpdateRejectionTx{ChannelId: "c", SequenceNumber: 3},
+	}
+
+	for i, a := range added {
+		ab, err := proto.Marshal(a)
+		if err != nil {
+			t.Fatal(err)
+		}
+		for j, b := range append(baseline, added...) {
+			if j == len(baseline)+i {
+				continue
+			}
+			bb, err := proto.Marshal(b)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if bytes.Equal(ab, bb) {
+				t.Fatalf("%T and %T serialize to the same bytes", a, b)
+			}
+		}
+	}
+}
@@ -2,12 +2,18 @@ package access
 
 import (
 	"bytes"
+	"encoding/binary"
 	"encoding/json"
 	"errors"
 	"fmt"
 
 	"github.com/boltdb/bolt"
+	"github.com/golang/protobuf/proto"
+	"github.com/jtremback/usc/core/errs"
 	core "github.com/jtremback/usc/core/judge"
+	"github.com/jtremback/usc/core/judge/schema"
+	"github.com/jtremback/usc/core/keystore"
+	"github.com/jtremback/usc/core/webhook"
 )
 
 // compound index types
@@ -22,6 +28,13 @@ var (
 	Channels []byte = []byte("Channels")
 	Judges   []byte = []byte("Judges")
 	Accounts []byte = []byte("Accounts")
+	Meta     []byte = []byte("Meta")
+	// Webhook URLs, keyed by judge pubkey
+	Webhooks []byte = []byte("Webhooks")
+	// The webhook outbox
+	Deliveries []byte = []byte("Deliveries")
+	// Evidence of conflicting UpdateTxs, keyed by Id
+	Equivocations []byte = []byte("Equivocations")
 )
 
 type NilError struct {
@@ -32,16 +45,29 @@ func (e *NilError) Error() string {
 	return fmt.Sprintf("%s", e.s)
 }
 
+// Code is errs.NotFound, so that callers of the HTTP APIs get a 404.
+func (e *NilError) Code() errs.Code {
+	return errs.NotFound
+}
+
 func MakeBuckets(db *bolt.DB) error {
 	err := db.Update(func(tx *bolt.Tx) error {
-		_, err := tx.CreateBucketIfNotExists(Indexes)
-		_, err = tx.CreateBucketIfNotExists(Channels)
-		_, err = tx.CreateBucketIfNotExists(Judges)
-		_, err = tx.CreateBucketIfNotExists(Accounts)
-		if err != nil {
-			return err
+		for _, name := range [][]byte{
+			Indexes,
+			Channels,
+			Judges,
+			Accounts,
+			Meta,
+			Webhooks,
+			Deliveries,
+			Equivocations,
+		} {
+			_, err := tx.CreateBucketIfNotExists(name)
+			if err != nil {
+				return err
+			}
 		}
-		return nil
+		return migrate(tx)
 	})
 	if err != nil {
 		return err
@@ -126,8 +152,32 @@ func PopulateAccount(tx *bolt.Tx, acct *core.Account) error {
 	return nil
 }
 
+func GetAccounts(tx *bolt.Tx) ([]*core.Account, error) {
+	accts := []*core.Account{}
+
+	err := tx.Bucket(Accounts).ForEach(func(k, v []byte) error {
+		acct := &core.Account{}
+		err := json.Unmarshal(v, acct)
+		if err != nil {
+			return err
+		}
+
+		err = PopulateAccount(tx, acct)
+		if err != nil {
+			return err
+		}
+
+		accts = append(accts, acct)
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	return accts, nil
+}
+
 func SetChannel(tx *bolt.Tx, ch *core.Channel) error {
-	b, err := json.Marshal(ch)
+	b, err := proto.Marshal(channelToRecord(ch))
 	if err != nil {
 		return err
 	}
@@ -147,14 +197,11 @@ func SetChannel(tx *bolt.Tx, ch *core.Channel) error {
 
 	// Accounts
 
-	err = SetAccount(tx, ch.Accounts[0])
-	if err != nil {
-		return err
-	}
-
-	err = SetAccount(tx, ch.Accounts[1])
-	if err != nil {
-		return err
+	for _, acct := range ch.Accounts {
+		err = SetAccount(tx, acct)
+		if err != nil {
+			return err
+		}
 	}
 
 	return nil
@@ -167,12 +214,13 @@ func GetChannel(tx *bolt.Tx, key string) (*core.Channel, error) {
 		return nil, &NilError{"channel not found"}
 	}
 
-	ch := &core.Channel{}
-	err := json.Unmarshal(b, ch)
+	rec := &schema.Channel{}
+	err := proto.Unmarshal(b, rec)
 	if err != nil {
 		return nil, err
 	}
 
+	ch := recordToChannel(rec)
 	err = PopulateChannel(tx, ch)
 	if err != nil {
 		return nil, err
@@ -181,14 +229,12 @@ func GetChannel(tx *bolt.Tx, key string) (*core.Channel, error) {
 }
 
 func PopulateChannel(tx *bolt.Tx, ch *core.Channel) error {
-	acct0, err := GetAccount(tx, ch.Accounts[0].Pubkey)
-	if err != nil {
-		return err
-	}
-
-	acct1, err := GetAccount(tx, ch.Accounts[1].Pubkey)
-	if err != nil {
-		return err
+	for i, acct := range ch.Accounts {
+		populated, err := GetAccount(tx, acct.Pubkey)
+		if err != nil {
+			return err
+		}
+		ch.Accounts[i] = populated
 	}
 
 	jd, err := GetJudge(tx, ch.Judge.Pubkey)
@@ -196,8 +242,6 @@ func PopulateChannel(tx *bolt.Tx, ch *core.Channel) error {
 		return err
 	}
 
-	ch.Accounts[0] = acct0
-	ch.Accounts[1] = acct1
 	ch.Judge = jd
 
 	return nil
@@ -208,12 +252,13 @@ func GetChannels(tx *bolt.Tx) ([]*core.Channel, error) {
 	chs := []*core.Channel{}
 
 	err = tx.Bucket(Channels).ForEach(func(k, v []byte) error {
-		ch := &core.Channel{}
-		err = json.Unmarshal(v, ch)
+		rec := &schema.Channel{}
+		err = proto.Unmarshal(v, rec)
 		if err != nil {
 			return err
 		}
 
+		ch := recordToChannel(rec)
 		err = PopulateChannel(tx, ch)
 		if err != nil {
 			return errors.New("error populating channel")
@@ -228,3 +273,180 @@ func GetChannels(tx *bolt.Tx) ([]*core.Channel, error) {
 	}
 	return chs, nil
 }
+
+func GetJudges(tx *bolt.Tx) ([]*core.Judge, error) {
+	jds := []*core.Judge{}
+
+	err := tx.Bucket(Judges).ForEach(func(k, v []byte) error {
+		jd := &core.Judge{}
+		err := json.Unmarshal(v, jd)
+		if err != nil {
+			return err
+		}
+
+		jds = append(jds, jd)
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	return jds, nil
+}
+
+func idKey(id uint64) []byte {
+	k := make([]byte, 8)
+	binary.BigEndian.PutUint64(k, id)
+	return k
+}
+
+// SetWebhooks sets the URLs that webhooks for the owner of pubkey are POSTed
+// to. Setting no URLs removes them all.
+func SetWebhooks(tx *bolt.Tx, pubkey []byte, urls []string) error {
+	if len(urls) == 0 {
+		return tx.Bucket(Webhooks).Delete(pubkey)
+	}
+
+	b, err := json.Marshal(urls)
+	if err != nil {
+		return err
+	}
+
+	return tx.Bucket(Webhooks).Put(pubkey, b)
+}
+
+// GetWebhooks returns the URLs that webhooks for the owner of pubkey are
+// POSTed to, if any.
+func GetWebhooks(tx *bolt.Tx, pubkey []byte) ([]string, error) {
+	urls := []string{}
+
+	b := tx.Bucket(Webhooks).Get(pubkey)
+	if len(b) == 0 {
+		return urls, nil
+	}
+
+	err := json.Unmarshal(b, &urls)
+	if err != nil {
+		return nil, err
+	}
+
+	return urls, nil
+}
+
+// AddDeliveries adds ds to the webhook outbox, and sets their Ids.
+func AddDeliveries(tx *bolt.Tx, ds []*webhook.Delivery) error {
+	b := tx.Bucket(Deliveries)
+
+	for _, d := range ds {
+		id, err := b.NextSequence()
+		if err != nil {
+			return err
+		}
+		d.Id = id
+
+		err = SetDelivery(tx, d)
+		if err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+func SetDelivery(tx *bolt.Tx, d *webhook.Delivery) error {
+	v, err := json.Marshal(d)
+	if err != nil {
+		return err
+	}
+
+	return tx.Bucket(Deliveries).Put(idKey(d.Id), v)
+}
+
+func DeleteDelivery(tx *bolt.Tx, id uint64) error {
+	return tx.Bucket(Deliveries).Delete(idKey(id))
+}
+
+// GetDeliveries returns every Delivery in the webhook outbox, oldest first.
+func GetDeliveries(tx *bolt.Tx) ([]*webhook.Delivery, error) {
+	ds := []*webhook.Delivery{}
+
+	err := tx.Bucket(Deliveries).ForEach(func(k, v []byte) error {
+		d := &webhook.Delivery{}
+		err := json.Unmarshal(v, d)
+		if err != nil {
+			return err
+		}
+		ds = append(ds, d)
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return ds, nil
+}
+
+var keystoreKey []byte = []byte("Keystore")
+
+func SetKeystore(tx *bolt.Tx, ks *keystore.Keystore) error {
+	b, err := json.Marshal(ks)
+	if err != nil {
+		return err
+	}
+
+	return tx.Bucket(Meta).Put(keystoreKey, b)
+}
+
+func GetKeystore(tx *bolt.Tx) (*keystore.Keystore, error) {
+	b := tx.Bucket(Meta).Get(keystoreKey)
+
+	if bytes.Compare(b, []byte{}) == 0 {
+		return nil, &NilError{"keystore not found"}
+	}
+
+	ks := &keystore.Keystore{}
+	err := json.Unmarshal(b, ks)
+	if err != nil {
+		return nil, err
+	}
+
+	return ks, nil
+}
+
+func AddEquivocation(tx *bolt.Tx, eq *core.Equivocation) error {
+	b := tx.Bucket(Equivocations)
+	id, err := b.NextSequence()
+	if err != nil {
+		return err
+	}
+	eq.Id = id
+
+	v, err := json.Marshal(eq)
+	if err != nil {
+		return err
+	}
+
+	return b.Put(idKey(eq.Id), v)
+}
+
+// GetEquivocations returns the Equivocations recorded about a Channel, oldest
+// first.
+func GetEquivocations(tx *bolt.Tx, channelID string) ([]*core.Equivocation, error) {
+	eqs := []*core.Equivocation{}
+
+	err := tx.Bucket(Equivocations).ForEach(func(k, v []byte) error {
+		eq := &core.Equivocation{}
+		err := json.Unmarshal(v, eq)
+		if err != nil {
+			return err
+		}
+		if eq.ChannelId == channelID {
+			eqs = append(eqs, eq)
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return eqs, nil
+}
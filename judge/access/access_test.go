@@ -130,10 +130,10 @@ var ch = &core.Channel{
 	OpeningTx:         &wire.OpeningTx{},
 	OpeningTxEnvelope: &wire.Envelope{},
 
-	LastFullUpdateTx:         &wire.UpdateTx{},
-	LastFullUpdateTxEnvelope: &wire.Envelope{},
+	FullUpdateTxs:         []*wire.UpdateTx{&wire.UpdateTx{}},
+	FullUpdateTxEnvelopes: []*wire.Envelope{&wire.Envelope{}},
 
-	FollowOnTxs: []*wire.Envelope{},
+	FollowOnTxs: []*wire.Envelope{&wire.Envelope{}},
 
 	Judge: &core.Judge{
 		Name:    "wrong",
@@ -0,0 +1,88 @@
+package access
+
+import (
+	"encoding/binary"
+	"encoding/json"
+	"errors"
+
+	"github.com/boltdb/bolt"
+	"github.com/golang/protobuf/proto"
+	core "github.com/jtremback/usc/core/judge"
+)
+
+// migrations are run in order on databases with an older schema version. The
+// schema version of a database is the number of migrations that have been
+// run on it.
+var migrations = []func(*bolt.Tx) error{
+	migrateJSONChannels,
+}
+
+var SchemaVersion = uint64(len(migrations))
+
+var version []byte = []byte("Version")
+
+func GetSchemaVersion(tx *bolt.Tx) uint64 {
+	b := tx.Bucket(Meta).Get(version)
+	if len(b) != 8 {
+		return 0
+	}
+	return binary.BigEndian.Uint64(b)
+}
+
+func setSchemaVersion(tx *bolt.Tx, v uint64) error {
+	b := make([]byte, 8)
+	binary.BigEndian.PutUint64(b, v)
+	return tx.Bucket(Meta).Put(version, b)
+}
+
+func migrate(tx *bolt.Tx) error {
+	v := GetSchemaVersion(tx)
+	if v > SchemaVersion {
+		return errors.New("database schema is newer than this version of usc")
+	}
+
+	for ; v < SchemaVersion; v++ {
+		err := migrations[v](tx)
+		if err != nil {
+			return err
+		}
+	}
+
+	return setSchemaVersion(tx, v)
+}
+
+func migrateJSONChannels(tx *bolt.Tx) error {
+	recs := map[string][]byte{}
+
+	err := tx.Bucket(Channels).ForEach(func(k, v []byte) error {
+		ch := &core.Channel{}
+		err := json.Unmarshal(v, ch)
+		if err != nil {
+			return err
+		}
+
+		if ch.Judge == nil {
+			return errors.New("channel " + string(k) + " is missing fields")
+		}
+
+		b, err := proto.Marshal(channelToRecord(ch))
+		if err != nil {
+			return err
+		}
+
+		recs[string(k)] = b
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+
+	for k, b := range recs {
+		err = tx.Bucket(Channels).Put([]byte(k), b)
+		if err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
@@ -0,0 +1,105 @@
+package access
+
+import (
+	"time"
+
+	core "github.com/jtremback/usc/core/judge"
+	"github.com/jtremback/usc/core/judge/schema"
+)
+
+// channelToRecord converts a Channel to the record it is stored as. The Judge
+// and Accounts are only stored by pubkey.
+func channelToRecord(ch *core.Channel) *schema.Channel {
+	rec := &schema.Channel{
+		ChannelId: ch.ChannelId,
+		Phase:     uint32(ch.Phase),
+
+		OpeningTx:         ch.OpeningTx,
+		OpeningTxEnvelope: ch.OpeningTxEnvelope,
+
+		FullUpdateTxs:         ch.FullUpdateTxs,
+		FullUpdateTxEnvelopes: ch.FullUpdateTxEnvelopes,
+
+		CloseTime:         unixNano(ch.CloseTime),
+		ClosingTxEnvelope: ch.ClosingTxEnvelope,
+		CancelTxEnvelope:  ch.CancelTxEnvelope,
+
+		FinalUpdateTx:         ch.FinalUpdateTx,
+		FinalUpdateTxEnvelope: ch.FinalUpdateTxEnvelope,
+		FinalHashLocks:        ch.FinalHashLocks,
+
+		JudgePubkey: ch.Judge.Pubkey,
+
+		FollowOnTxs: ch.FollowOnTxs,
+	}
+
+	for _, acct := range ch.Accounts {
+		rec.AccountPubkeys = append(rec.AccountPubkeys, acct.Pubkey)
+	}
+
+	for _, pre := range ch.Preimages {
+		rec.Preimages = append(rec.Preimages, &schema.Preimage{
+			Preimage:   pre.Preimage,
+			RevealTime: unixNano(pre.RevealTime),
+			Envelope:   pre.Envelope,
+		})
+	}
+
+	return rec
+}
+
+// recordToChannel converts a stored record back to a Channel. The Judge and
+// Accounts only have their pubkeys set, and are filled in by PopulateChannel.
+func recordToChannel(rec *schema.Channel) *core.Channel {
+	ch := &core.Channel{
+		ChannelId: rec.ChannelId,
+		Phase:     core.Phase(rec.Phase),
+
+		OpeningTx:         rec.OpeningTx,
+		OpeningTxEnvelope: rec.OpeningTxEnvelope,
+
+		FullUpdateTxs:         rec.FullUpdateTxs,
+		FullUpdateTxEnvelopes: rec.FullUpdateTxEnvelopes,
+
+		CloseTime:         fromUnixNano(rec.CloseTime),
+		ClosingTxEnvelope: rec.ClosingTxEnvelope,
+		CancelTxEnvelope:  rec.CancelTxEnvelope,
+
+		FinalUpdateTx:         rec.FinalUpdateTx,
+		FinalUpdateTxEnvelope: rec.FinalUpdateTxEnvelope,
+		FinalHashLocks:        rec.FinalHashLocks,
+
+		Judge: &core.Judge{Pubkey: rec.JudgePubkey},
+
+		FollowOnTxs: rec.FollowOnTxs,
+	}
+
+	for _, pubkey := range rec.AccountPubkeys {
+		ch.Accounts = append(ch.Accounts, &core.Account{Pubkey: pubkey})
+	}
+
+	for _, pre := range rec.Preimages {
+		ch.Preimages = append(ch.Preimages, &core.Preimage{
+			Preimage:   pre.Preimage,
+			RevealTime: fromUnixNano(pre.RevealTime),
+			Envelope:   pre.Envelope,
+		})
+	}
+
+	return ch
+}
+
+// unixNano and fromUnixNano store the zero time as 0.
+func unixNano(t time.Time) int64 {
+	if t.IsZero() {
+		return 0
+	}
+	return t.UnixNano()
+}
+
+func fromUnixNano(n int64) time.Time {
+	if n == 0 {
+		return time.Time{}
+	}
+	return time.Unix(0, n)
+}
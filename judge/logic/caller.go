@@ -1,13 +1,25 @@
 package logic
 
 import (
+	"time"
+
 	"github.com/boltdb/bolt"
+	"github.com/jtremback/usc/core/errs"
 	core "github.com/jtremback/usc/core/judge"
+	"github.com/jtremback/usc/core/keystore"
+	"github.com/jtremback/usc/core/signer"
 	"github.com/jtremback/usc/judge/access"
 )
 
 type CallerAPI struct {
 	DB *bolt.DB
+	// Keystore holds the private keys of the Judges. It must be unlocked for
+	// the judge to sign anything, unless Signer is set.
+	Keystore *keystore.Keystore
+	// If Signer is set, it signs for the Judges instead of the Keystore, so
+	// that their private keys can be kept out of the judge. See
+	// signer.Remote.
+	Signer signer.Signer
 }
 
 func (a *CallerAPI) NewJudge(
@@ -15,18 +27,13 @@ func (a *CallerAPI) NewJudge(
 ) (*core.Judge, error) {
 	var err error
 	jd := &core.Judge{}
-	a.DB.Update(func(tx *bolt.Tx) error {
+	err = a.DB.Update(func(tx *bolt.Tx) error {
 		jd, err = core.NewJudge(name)
 		if err != nil {
 			return err
 		}
 
-		err = access.SetJudge(tx, jd)
-		if err != nil {
-			return err
-		}
-
-		return nil
+		return a.addKey(tx, jd)
 	})
 	if err != nil {
 		return nil, err
@@ -63,19 +70,63 @@ func (a *CallerAPI) AddAccount(
 	})
 }
 
+func (a *CallerAPI) ViewJudges() ([]*core.Judge, error) {
+	var jds []*core.Judge
+	var err error
+	err = a.DB.View(func(tx *bolt.Tx) error {
+		jds, err = access.GetJudges(tx)
+		return err
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return jds, nil
+}
+
+func (a *CallerAPI) ViewAccounts() ([]*core.Account, error) {
+	var accts []*core.Account
+	var err error
+	err = a.DB.View(func(tx *bolt.Tx) error {
+		accts, err = access.GetAccounts(tx)
+		return err
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return accts, nil
+}
+
+func (a *CallerAPI) ViewAccount(pubkey []byte) (*core.Account, error) {
+	var acct *core.Account
+	var err error
+	err = a.DB.View(func(tx *bolt.Tx) error {
+		acct, err = access.GetAccount(tx, pubkey)
+		return err
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return acct, nil
+}
+
 func (a *CallerAPI) AcceptChannel(chID string) error {
 	var err error
 	return a.DB.Update(func(tx *bolt.Tx) error {
 		ch := &core.Channel{}
-		ch, err = access.GetChannel(tx, chID)
+		ch, err = getChannel(tx, a.judgeSigner(), chID)
 		if err != nil {
 			return err
 		}
 
-		ch.Judge.AppendSignature(ch.OpeningTxEnvelope)
-		ch.Phase = core.OPEN
+		err = ch.Confirm()
+		if err != nil {
+			return err
+		}
 
-		access.SetChannel(tx, ch)
+		err = access.SetChannel(tx, ch)
 		if err != nil {
 			return err
 		}
@@ -88,7 +139,7 @@ func (a *CallerAPI) ViewChannels() ([]*core.Channel, error) {
 	var chs []*core.Channel
 	var err error
 	err = a.DB.View(func(tx *bolt.Tx) error {
-		chs, err = access.GetChannels(tx)
+		chs, err = getChannels(tx, a.judgeSigner())
 
 		if err != nil {
 			return err
@@ -103,25 +154,90 @@ func (a *CallerAPI) ViewChannels() ([]*core.Channel, error) {
 	return chs, nil
 }
 
+func (a *CallerAPI) ViewChannel(chID string) (*core.Channel, error) {
+	var ch *core.Channel
+	var err error
+	err = a.DB.View(func(tx *bolt.Tx) error {
+		ch, err = getChannel(tx, a.judgeSigner(), chID)
+		return err
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return ch, nil
+}
+
+// ReviewChannels returns the channels which are waiting on the judge's
+// operators. These are channels in PENDING_OPEN, which must be accepted, and
+// OPEN channels whose hold period is over at now, which can be closed.
+func (a *CallerAPI) ReviewChannels(now time.Time) ([]*core.Channel, error) {
+	chs, err := a.ViewChannels()
+	if err != nil {
+		return nil, err
+	}
+
+	review := []*core.Channel{}
+	for _, ch := range chs {
+		if ch.Phase == core.PENDING_OPEN || (ch.Phase == core.OPEN && ch.HoldPeriodOver(now)) {
+			review = append(review, ch)
+		}
+	}
+
+	return review, nil
+}
+
 func (a *CallerAPI) CloseChannel(chID string, i int) error {
 	var err error
 	return a.DB.Update(func(tx *bolt.Tx) error {
 		ch := &core.Channel{}
-		ch, err = access.GetChannel(tx, chID)
+		ch, err = getChannel(tx, a.judgeSigner(), chID)
 		if err != nil {
 			return err
 		}
 
+		before := closingOf(ch)
+
 		err = ch.Close(i)
 		if err != nil {
 			return err
 		}
 
-		access.SetChannel(tx, ch)
+		err = access.SetChannel(tx, ch)
 		if err != nil {
 			return err
 		}
 
-		return nil
+		return addClosingWebhooks(tx, before, ch)
+	})
+}
+
+// CancelChannel closes a channel with the state in its OpeningTx. This is only
+// possible once the hold period is over, and if no UpdateTx was posted to
+// override the cancellation.
+func (a *CallerAPI) CancelChannel(chID string) error {
+	return a.DB.Update(func(tx *bolt.Tx) error {
+		ch, err := getChannel(tx, a.judgeSigner(), chID)
+		if err != nil {
+			return err
+		}
+
+		before := closingOf(ch)
+
+		if len(ch.FullUpdateTxs) > 0 {
+			return errs.New(errs.Conflict, "cancellation overridden by full update tx")
+		}
+
+		err = ch.Cancel()
+		if err != nil {
+			return err
+		}
+
+		err = access.SetChannel(tx, ch)
+		if err != nil {
+			return err
+		}
+
+		return addClosingWebhooks(tx, before, ch)
 	})
 }
@@ -0,0 +1,55 @@
+package logic
+
+import (
+	"time"
+
+	"github.com/boltdb/bolt"
+	core "github.com/jtremback/usc/core/judge"
+	"github.com/jtremback/usc/core/webhook"
+	"github.com/jtremback/usc/core/wire"
+	"github.com/jtremback/usc/judge/access"
+)
+
+// addEquivocation records that ev conflicts with held, an UpdateTx with the
+// same SequenceNumber that the judge already had, and queues an
+// EquivocationDetected webhook.
+func addEquivocation(tx *bolt.Tx, ch *core.Channel, utx *wire.UpdateTx, held *wire.Envelope, ev *wire.Envelope) error {
+	now := time.Now()
+	err := access.AddEquivocation(tx, &core.Equivocation{
+		ChannelId:      ch.ChannelId,
+		SequenceNumber: utx.SequenceNumber,
+		Held:           held,
+		Conflicting:    ev,
+		Time:           now,
+	})
+	if err != nil {
+		return err
+	}
+
+	urls, err := access.GetWebhooks(tx, ch.Judge.Pubkey)
+	if err != nil {
+		return err
+	}
+
+	return access.AddDeliveries(tx, webhook.New(urls, ch.Judge.Pubkey, string(core.EquivocationDetected), ch.ChannelId, utx.SequenceNumber, now))
+}
+
+// ViewEquivocations returns the evidence of the participants of a Channel
+// signing conflicting UpdateTxs.
+func (a *CallerAPI) ViewEquivocations(chID string) ([]*core.Equivocation, error) {
+	var eqs []*core.Equivocation
+	err := a.DB.View(func(tx *bolt.Tx) error {
+		_, err := access.GetChannel(tx, chID)
+		if err != nil {
+			return err
+		}
+
+		eqs, err = access.GetEquivocations(tx, chID)
+		return err
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return eqs, nil
+}
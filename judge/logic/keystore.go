@@ -0,0 +1,136 @@
+package logic
+
+import (
+	"errors"
+
+	"github.com/boltdb/bolt"
+	"github.com/jtremback/usc/core/errs"
+	core "github.com/jtremback/usc/core/judge"
+	"github.com/jtremback/usc/core/signer"
+	"github.com/jtremback/usc/judge/access"
+)
+
+// getChannel gets a Channel whose Judge signs with s.
+func getChannel(tx *bolt.Tx, s signer.Signer, chID string) (*core.Channel, error) {
+	ch, err := access.GetChannel(tx, chID)
+	if err != nil {
+		return nil, err
+	}
+
+	ch.Judge.Signer = s
+	return ch, nil
+}
+
+// getChannels gets every Channel, with Judges that sign with s.
+func getChannels(tx *bolt.Tx, s signer.Signer) ([]*core.Channel, error) {
+	chs, err := access.GetChannels(tx)
+	if err != nil {
+		return nil, err
+	}
+
+	for _, ch := range chs {
+		ch.Judge.Signer = s
+	}
+	return chs, nil
+}
+
+// judgeSigner returns the Signer that the Judges sign with.
+func (a *CallerAPI) judgeSigner() signer.Signer {
+	if a.Signer != nil {
+		return a.Signer
+	}
+	if a.Keystore != nil {
+		return a.Keystore
+	}
+	return nil
+}
+
+// addKey moves the Judge's Privkey into the Keystore and saves both. If the
+// CallerAPI has a Signer, the Judge must not have a Privkey.
+func (a *CallerAPI) addKey(tx *bolt.Tx, jd *core.Judge) error {
+	if a.Signer != nil {
+		if len(jd.Privkey) != 0 {
+			return errs.New(errs.Invalid, "private keys are held by the signer")
+		}
+		jd.Signer = a.Signer
+		return access.SetJudge(tx, jd)
+	}
+	if a.Keystore == nil {
+		return errors.New("no keystore")
+	}
+
+	err := a.Keystore.Add(jd.Pubkey, jd.Privkey)
+	if err != nil {
+		return err
+	}
+
+	err = access.SetKeystore(tx, a.Keystore)
+	if err != nil {
+		return err
+	}
+
+	jd.Privkey = nil
+	jd.Signer = a.Keystore
+	return access.SetJudge(tx, jd)
+}
+
+// Unlock unlocks the Keystore. The first time it is unlocked sets the
+// passphrase. Judges that were saved with a plaintext Privkey before there was
+// a Keystore have their keys moved into it.
+func (a *CallerAPI) Unlock(passphrase string) error {
+	if a.Keystore == nil {
+		return errors.New("no keystore")
+	}
+
+	return a.DB.Update(func(tx *bolt.Tx) error {
+		err := a.Keystore.Unlock(passphrase)
+		if err != nil {
+			return err
+		}
+
+		err = access.SetKeystore(tx, a.Keystore)
+		if err != nil {
+			return err
+		}
+
+		jds, err := access.GetJudges(tx)
+		if err != nil {
+			return err
+		}
+
+		for _, jd := range jds {
+			if len(jd.Privkey) == 0 {
+				continue
+			}
+			err = a.addKey(tx, jd)
+			if err != nil {
+				return err
+			}
+		}
+
+		return nil
+	})
+}
+
+// Lock locks the Keystore. Nothing can be signed until it is unlocked again.
+func (a *CallerAPI) Lock() {
+	if a.Keystore != nil {
+		a.Keystore.Lock()
+	}
+}
+
+// ChangePassphrase encrypts the Keystore with a new passphrase.
+func (a *CallerAPI) ChangePassphrase(old string, new string) error {
+	if a.Keystore == nil {
+		return errors.New("no keystore")
+	}
+
+	return a.DB.Update(func(tx *bolt.Tx) error {
+		err := a.Keystore.ChangePassphrase(old, new)
+		if err != nil {
+			return err
+		}
+
+		return access.SetKeystore(tx, a.Keystore)
+	})
+}
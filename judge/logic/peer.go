@@ -1,19 +1,29 @@
 package logic
 
 import (
+	"bytes"
 	"errors"
 
 	"github.com/boltdb/bolt"
 	"github.com/golang/protobuf/proto"
+	"github.com/jtremback/usc/core/errs"
 	core "github.com/jtremback/usc/core/judge"
+	"github.com/jtremback/usc/core/signer"
 	"github.com/jtremback/usc/core/wire"
 	"github.com/jtremback/usc/judge/access"
 )
 
 type PeerAPI struct {
 	DB *bolt.DB
+	// Signer signs for the judge. It is usually the CallerAPI's Keystore.
+	Signer signer.Signer
+	// Validator checks the state of OpeningTxs and UpdateTxs before they are
+	// added. If it is nil, all states are accepted.
+	Validator core.StateValidator
 }
 
+// AddChannel saves a Channel for the operators to accept. Sending the same
+// OpeningTx again does nothing.
 func (a *PeerAPI) AddChannel(ev *wire.Envelope) error {
 	var err error
 	err = a.DB.Update(func(tx *bolt.Tx) error {
@@ -21,41 +31,57 @@ func (a *PeerAPI) AddChannel(ev *wire.Envelope) error {
 		otx := &wire.OpeningTx{}
 		err = proto.Unmarshal(ev.Payload, otx)
 		if err != nil {
-			return err
+			return errs.New(errs.Invalid, "envelope payload not valid")
 		}
 
-		_, nilErr := access.GetChannel(tx, otx.ChannelId)
+		ch, nilErr := access.GetChannel(tx, otx.ChannelId)
 		if nilErr == nil {
-			return errors.New("channel already exists")
+			if bytes.Compare(ev.Payload, ch.OpeningTxEnvelope.Payload) == 0 {
+				return nil
+			}
+			return errs.New(errs.Conflict, "channel already exists")
 		}
 		_, ok := nilErr.(*access.NilError)
 		if !ok {
-			return err
+			return nilErr
 		}
 
-		acct0, err := access.GetAccount(tx, otx.Pubkeys[0])
-		if err != nil {
-			return err
+		if len(otx.Pubkeys) < 2 {
+			return errs.New(errs.Invalid, "not enough public keys")
+		}
+
+		accts := []*core.Account{}
+		for _, pubkey := range otx.Pubkeys {
+			acct, err := access.GetAccount(tx, pubkey)
+			if err != nil {
+				return err
+			}
+			accts = append(accts, acct)
 		}
 
-		acct1, err := access.GetAccount(tx, otx.Pubkeys[1])
+		judge, err := access.GetJudge(tx, accts[0].Judge.Pubkey)
 		if err != nil {
 			return err
 		}
 
-		judge, err := access.GetJudge(tx, acct0.Judge.Pubkey)
+		if a.Validator != nil {
+			err = a.Validator.ValidateOpeningTx(otx)
+			if err != nil {
+				return err
+			}
+		}
+
+		ch, err = judge.AddChannel(ev, otx, accts)
 		if err != nil {
 			return err
 		}
 
-		ch, err := judge.AddChannel(ev, otx, acct0, acct1)
-
-		access.SetChannel(tx, ch)
+		err = access.SetChannel(tx, ch)
 		if err != nil {
 			return err
 		}
 
-		return nil
+		return addWebhooks(tx, core.ChannelProposed, ch)
 	})
 	if err != nil {
 		return err
@@ -69,7 +95,7 @@ func (a *PeerAPI) GetChannel(chId string) (*core.Channel, error) {
 	var err error
 	ch := &core.Channel{}
 	err = a.DB.View(func(tx *bolt.Tx) error {
-		ch, err = access.GetChannel(tx, chId)
+		ch, err = getChannel(tx, a.Signer, chId)
 		if err != nil {
 			return err
 		}
@@ -85,35 +111,91 @@ func (a *PeerAPI) GetChannel(chId string) (*core.Channel, error) {
 	return ch, nil
 }
 
-func (a *PeerAPI) AddFullUpdateTx(ev *wire.Envelope) error {
+// GetLastFullUpdateTx gets the UpdateTx with the highest SequenceNumber that
+// the judge has accepted for a channel, signed by the judge.
+func (a *PeerAPI) GetLastFullUpdateTx(chId string) (*wire.Envelope, error) {
 	var err error
-	err = a.DB.Update(func(tx *bolt.Tx) error {
-		utx := &wire.UpdateTx{}
-		err = proto.Unmarshal(ev.Payload, utx)
+	var ev *wire.Envelope
+	err = a.DB.View(func(tx *bolt.Tx) error {
+		ch, err := getChannel(tx, a.Signer, chId)
 		if err != nil {
 			return err
 		}
 
-		ch, err := access.GetChannel(tx, utx.ChannelId)
+		ev, err = ch.LastFullUpdateTxEnvelope()
+		if err != nil {
+			return err
+		}
+
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return ev, nil
+}
+
+// AddFullUpdateTx adds an UpdateTx signed by every participant. Sending one the
+// judge already holds again does nothing. One with the SequenceNumber of an
+// UpdateTx the judge holds, but a different payload, is recorded as an
+// Equivocation, and ErrEquivocation is returned.
+func (a *PeerAPI) AddFullUpdateTx(ev *wire.Envelope) error {
+	equivocation := false
+	err := a.DB.Update(func(tx *bolt.Tx) error {
+		utx := &wire.UpdateTx{}
+		err := proto.Unmarshal(ev.Payload, utx)
+		if err != nil {
+			return errs.New(errs.Invalid, "envelope payload not valid")
+		}
+
+		ch, err := getChannel(tx, a.Signer, utx.ChannelId)
 		if err != nil {
 			return err
 		}
 
+		if ch.HasFullUpdateTx(ev) {
+			return nil
+		}
+
+		held := ch.ConflictingUpdateTx(ev, utx)
+		if held != nil {
+			equivocation = true
+			return addEquivocation(tx, ch, utx, held, ev)
+		}
+
+		before := closingOf(ch)
+
+		if a.Validator != nil {
+			err = a.Validator.ValidateUpdateTx(ch.OpeningTx, utx)
+			if err != nil {
+				return err
+			}
+		}
+
 		err = ch.AddFullUpdateTx(ev, utx)
 		if err != nil {
 			return err
 		}
 
-		access.SetChannel(tx, ch)
+		_, err = ch.CloseFast(a.Validator)
+		if err != nil {
+			return err
+		}
+
+		err = access.SetChannel(tx, ch)
 		if err != nil {
 			return errors.New("database error")
 		}
 
-		return nil
+		return addClosingWebhooks(tx, before, ch)
 	})
 	if err != nil {
 		return err
 	}
+	if equivocation {
+		return core.ErrEquivocation
+	}
 
 	return nil
 }
@@ -123,21 +205,86 @@ func (a *PeerAPI) AddClosingTx(ev *wire.Envelope) error {
 	return a.DB.Update(func(tx *bolt.Tx) error {
 		ctx := &wire.ClosingTx{}
 		err = proto.Unmarshal(ev.Payload, ctx)
+		if err != nil {
+			return errs.New(errs.Invalid, "envelope payload not valid")
+		}
+
+		ch, err := getChannel(tx, a.Signer, ctx.ChannelId)
+		if err != nil {
+			return err
+		}
+
+		before := closingOf(ch)
+
+		err = ch.AddClosingTx(ev)
+		if err != nil {
+			return err
+		}
+
+		_, err = ch.CloseFast(a.Validator)
+		if err != nil {
+			return err
+		}
+
+		err = access.SetChannel(tx, ch)
+		if err != nil {
+			return err
+		}
+
+		return addClosingWebhooks(tx, before, ch)
+	})
+}
+
+func (a *PeerAPI) AddCancelTx(ev *wire.Envelope) error {
+	return a.DB.Update(func(tx *bolt.Tx) error {
+		ctx := &wire.CancelTx{}
+		err := proto.Unmarshal(ev.Payload, ctx)
+		if err != nil {
+			return errs.New(errs.Invalid, "envelope payload not valid")
+		}
+
+		ch, err := getChannel(tx, a.Signer, ctx.ChannelId)
+		if err != nil {
+			return err
+		}
+
+		before := closingOf(ch)
+
+		err = ch.AddCancelTx(ev)
+		if err != nil {
+			return err
+		}
+
+		err = access.SetChannel(tx, ch)
 		if err != nil {
 			return err
 		}
 
-		ch, err := access.GetChannel(tx, ctx.ChannelId)
+		return addClosingWebhooks(tx, before, ch)
+	})
+}
+
+// AddPreimageTx records the time at which a Peer revealed the preimage of a
+// HashLock's hash.
+func (a *PeerAPI) AddPreimageTx(ev *wire.Envelope) error {
+	return a.DB.Update(func(tx *bolt.Tx) error {
+		ptx := &wire.PreimageTx{}
+		err := proto.Unmarshal(ev.Payload, ptx)
+		if err != nil {
+			return errs.New(errs.Invalid, "envelope payload not valid")
+		}
+
+		ch, err := getChannel(tx, a.Signer, ptx.ChannelId)
 		if err != nil {
 			return err
 		}
 
-		ch.AddClosingTx(ev)
+		err = ch.AddPreimageTx(ev, ptx)
 		if err != nil {
 			return err
 		}
 
-		access.SetChannel(tx, ch)
+		err = access.SetChannel(tx, ch)
 		if err != nil {
 			return err
 		}
@@ -152,20 +299,20 @@ func (a *PeerAPI) AddFollowOnTx(ev *wire.Envelope) error {
 		fol := &wire.FollowOnTx{}
 		err = proto.Unmarshal(ev.Payload, fol)
 		if err != nil {
-			return err
+			return errs.New(errs.Invalid, "envelope payload not valid")
 		}
 
-		ch, err := access.GetChannel(tx, fol.ChannelId)
+		ch, err := getChannel(tx, a.Signer, fol.ChannelId)
 		if err != nil {
 			return err
 		}
 
-		ch.AddFollowOnTx(ev)
+		err = ch.AddFollowOnTx(ev)
 		if err != nil {
 			return err
 		}
 
-		access.SetChannel(tx, ch)
+		err = access.SetChannel(tx, ch)
 		if err != nil {
 			return err
 		}
@@ -0,0 +1,88 @@
+package logic
+
+import (
+	"log"
+	"time"
+
+	"github.com/boltdb/bolt"
+	core "github.com/jtremback/usc/core/judge"
+	"github.com/jtremback/usc/core/signer"
+	"github.com/jtremback/usc/judge/access"
+)
+
+// Scheduler finalizes channels whose hold period is over, so that the judge's
+// operators do not have to close each channel by hand. Validator decides which
+// UpdateTx a channel is closed with, see core.Channel.Finalize.
+type Scheduler struct {
+	DB *bolt.DB
+	// Signer signs for the judge. It is usually the CallerAPI's Keystore.
+	Signer    signer.Signer
+	Validator core.StateValidator
+	// How often the scheduler looks for channels to finalize.
+	Interval time.Duration
+}
+
+// FinalizeChannels finalizes every OPEN channel whose hold period is over. It
+// returns the errors encountered, keyed by channel id.
+func (s *Scheduler) FinalizeChannels() map[string]error {
+	errs := map[string]error{}
+
+	err := s.DB.Update(func(tx *bolt.Tx) error {
+		chs, err := getChannels(tx, s.Signer)
+		if err != nil {
+			return err
+		}
+
+		for _, ch := range chs {
+			if ch.Phase != core.OPEN || !ch.HoldPeriodOver(time.Now()) {
+				continue
+			}
+
+			err = ch.Finalize(s.Validator)
+			if err != nil {
+				errs[ch.ChannelId] = err
+				continue
+			}
+
+			err = access.SetChannel(tx, ch)
+			if err != nil {
+				return err
+			}
+
+			err = addWebhooks(tx, core.ChannelClosed, ch)
+			if err != nil {
+				return err
+			}
+		}
+
+		return nil
+	})
+	if err != nil {
+		errs[""] = err
+	}
+
+	return errs
+}
+
+// Run calls FinalizeChannels every Interval until stop is closed.
+func (s *Scheduler) Run(stop <-chan struct{}) {
+	interval := s.Interval
+	if interval <= 0 {
+		interval = time.Second
+	}
+
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		for chId, err := range s.FinalizeChannels() {
+			log.Printf("scheduler: error finalizing channel %q: %v", chId, err)
+		}
+
+		select {
+		case <-stop:
+			return
+		case <-ticker.C:
+		}
+	}
+}
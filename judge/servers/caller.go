@@ -3,7 +3,11 @@ package servers
 import (
 	"encoding/json"
 	"net/http"
+	"strings"
+	"time"
 
+	"github.com/jtremback/usc/core/errs"
+	core "github.com/jtremback/usc/core/judge"
 	"github.com/jtremback/usc/judge/logic"
 )
 
@@ -12,71 +16,363 @@ type CallerHTTP struct {
 }
 
 func (a *CallerHTTP) MountRoutes(mux *http.ServeMux) {
+	mux.HandleFunc("/judges", a.judges)
+	mux.HandleFunc("/new_judge", a.newJudge)
+	mux.HandleFunc("/accounts", a.accounts)
+	mux.HandleFunc("/add_account", a.addAccount)
+	mux.HandleFunc("/channels", a.channels)
+	mux.HandleFunc("/channels_by_id/", a.channelsById)
+	mux.HandleFunc("/review_queue", a.reviewQueue)
+
 	mux.HandleFunc("/confirm_channel", a.confirmChannel)
 	mux.HandleFunc("/close_channel", a.closeChannel)
+	mux.HandleFunc("/cancel_channel", a.cancelChannel)
+
+	mux.HandleFunc("/unlock", a.unlock)
+	mux.HandleFunc("/lock", a.lock)
+	mux.HandleFunc("/change_passphrase", a.changePassphrase)
+
+	mux.HandleFunc("/set_webhooks", a.setWebhooks)
+	mux.HandleFunc("/webhooks/", a.webhooks)
+	mux.HandleFunc("/webhook_deliveries", a.webhookDeliveries)
+
+	mux.HandleFunc("/channel_equivocations/", a.channelEquivocations)
 }
 
-func (a *CallerHTTP) confirmChannel(w http.ResponseWriter, r *http.Request) {
+func (a *CallerHTTP) judges(w http.ResponseWriter, r *http.Request) {
+	jds, err := a.Logic.ViewJudges()
+	if err != nil {
+		errs.FailErr(w, err)
+		return
+	}
+
+	resp := []*Judge{}
+	for _, jd := range jds {
+		resp = append(resp, judgeToJSON(jd))
+	}
+	a.send(w, resp)
+}
+
+func (a *CallerHTTP) newJudge(w http.ResponseWriter, r *http.Request) {
 	if r.Body == nil {
-		a.fail(w, "no body", 500)
+		errs.Fail(w, "no body", errs.Invalid)
 		return
 	}
 
-	req := &struct {
-		ChannelId string
-	}{}
+	req := &NewJudgeRequest{}
 	err := json.NewDecoder(r.Body).Decode(req)
 	if err != nil {
-		a.fail(w, "body parsing error", 500)
+		errs.Fail(w, "body parsing error", errs.Invalid)
+		return
 	}
 
-	err = a.Logic.AcceptChannel(req.ChannelId)
+	jd, err := a.Logic.NewJudge(req.Name)
 	if err != nil {
-		a.fail(w, err.Error(), 500)
+		errs.FailErr(w, err)
+		return
+	}
+
+	a.send(w, judgeToJSON(jd))
+}
+
+func (a *CallerHTTP) accounts(w http.ResponseWriter, r *http.Request) {
+	accts, err := a.Logic.ViewAccounts()
+	if err != nil {
+		errs.FailErr(w, err)
+		return
+	}
+
+	resp := []*Account{}
+	for _, acct := range accts {
+		resp = append(resp, accountToJSON(acct))
 	}
+	a.send(w, resp)
+}
+
+func (a *CallerHTTP) addAccount(w http.ResponseWriter, r *http.Request) {
+	if r.Body == nil {
+		errs.Fail(w, "no body", errs.Invalid)
+		return
+	}
+
+	req := &AddAccountRequest{}
+	err := json.NewDecoder(r.Body).Decode(req)
+	if err != nil {
+		errs.Fail(w, "body parsing error", errs.Invalid)
+		return
+	}
+
+	jdPubkey, err := decodePubkey(req.JudgePubkey)
+	if err != nil {
+		errs.Fail(w, "judgePubkey is not base64url", errs.Invalid)
+		return
+	}
+
+	pubkey, err := decodePubkey(req.Pubkey)
+	if err != nil {
+		errs.Fail(w, "pubkey is not base64url", errs.Invalid)
+		return
+	}
+
+	err = a.Logic.AddAccount(req.Name, jdPubkey, pubkey, req.Address)
+	if err != nil {
+		errs.FailErr(w, err)
+		return
+	}
+
+	acct, err := a.Logic.ViewAccount(pubkey)
+	if err != nil {
+		errs.FailErr(w, err)
+		return
+	}
+
+	a.send(w, accountToJSON(acct))
+}
+
+// channels lists the channels, or only those in the phase given by the phase
+// query parameter.
+func (a *CallerHTTP) channels(w http.ResponseWriter, r *http.Request) {
+	var phase core.Phase
+	if name := r.URL.Query().Get("phase"); name != "" {
+		var ok bool
+		phase, ok = parsePhase(name)
+		if !ok {
+			errs.Fail(w, "unknown phase", errs.Invalid)
+			return
+		}
+	}
+
+	chs, err := a.Logic.ViewChannels()
+	if err != nil {
+		errs.FailErr(w, err)
+		return
+	}
+
+	now := time.Now()
+	resp := []*Channel{}
+	for _, ch := range chs {
+		if phase != 0 && ch.Phase != phase {
+			continue
+		}
+		resp = append(resp, channelToJSON(ch, now))
+	}
+	a.send(w, resp)
+}
+
+func (a *CallerHTTP) channelsById(w http.ResponseWriter, r *http.Request) {
+	a.sendChannel(w, strings.TrimPrefix(r.URL.Path, "/channels_by_id/"))
+}
+
+// reviewQueue lists the channels that are waiting on the operator, see
+// logic.CallerAPI.ReviewChannels.
+func (a *CallerHTTP) reviewQueue(w http.ResponseWriter, r *http.Request) {
+	now := time.Now()
+	chs, err := a.Logic.ReviewChannels(now)
+	if err != nil {
+		errs.FailErr(w, err)
+		return
+	}
+
+	resp := []*Channel{}
+	for _, ch := range chs {
+		resp = append(resp, channelToJSON(ch, now))
+	}
+	a.send(w, resp)
+}
+
+// channelRequest decodes a ChannelRequest and calls fn with its ChannelId. If
+// fn succeeds, the channel is sent back.
+func (a *CallerHTTP) channelRequest(w http.ResponseWriter, r *http.Request, fn func(string) error) {
+	if r.Body == nil {
+		errs.Fail(w, "no body", errs.Invalid)
+		return
+	}
+
+	req := &ChannelRequest{}
+	err := json.NewDecoder(r.Body).Decode(req)
+	if err != nil {
+		errs.Fail(w, "body parsing error", errs.Invalid)
+		return
+	}
+
+	err = fn(req.ChannelId)
+	if err != nil {
+		errs.FailErr(w, err)
+		return
+	}
+
+	a.sendChannel(w, req.ChannelId)
+}
+
+func (a *CallerHTTP) confirmChannel(w http.ResponseWriter, r *http.Request) {
+	a.channelRequest(w, r, a.Logic.AcceptChannel)
 }
 
 func (a *CallerHTTP) closeChannel(w http.ResponseWriter, r *http.Request) {
 	if r.Body == nil {
-		a.fail(w, "no body", 500)
+		errs.Fail(w, "no body", errs.Invalid)
 		return
 	}
 
-	req := &struct {
-		ChannelId     string
-		UpdateTxIndex int
-	}{}
+	req := &CloseChannelRequest{}
 	err := json.NewDecoder(r.Body).Decode(req)
 	if err != nil {
-		a.fail(w, "body parsing error", 500)
+		errs.Fail(w, "body parsing error", errs.Invalid)
+		return
 	}
 
 	err = a.Logic.CloseChannel(req.ChannelId, req.UpdateTxIndex)
 	if err != nil {
-		a.fail(w, err.Error(), 500)
+		errs.FailErr(w, err)
+		return
 	}
+
+	a.sendChannel(w, req.ChannelId)
 }
 
-func (a *CallerHTTP) fail(w http.ResponseWriter, msg string, status int) {
-	w.Header().Set("Content-Type", "application/json")
+func (a *CallerHTTP) cancelChannel(w http.ResponseWriter, r *http.Request) {
+	a.channelRequest(w, r, a.Logic.CancelChannel)
+}
 
-	data := struct {
-		Error string
-	}{Error: msg}
+func (a *CallerHTTP) unlock(w http.ResponseWriter, r *http.Request) {
+	if r.Body == nil {
+		errs.Fail(w, "no body", errs.Invalid)
+		return
+	}
 
-	resp, _ := json.Marshal(data)
-	w.WriteHeader(status)
-	w.Write(resp)
+	req := &UnlockRequest{}
+	err := json.NewDecoder(r.Body).Decode(req)
+	if err != nil {
+		errs.Fail(w, "body parsing error", errs.Invalid)
+		return
+	}
+
+	err = a.Logic.Unlock(req.Passphrase)
+	if err != nil {
+		errs.FailErr(w, err)
+		return
+	}
 }
 
-func (a *CallerHTTP) send(w http.ResponseWriter, data interface{}) {
-	w.Header().Set("Content-Type", "application/json")
+func (a *CallerHTTP) lock(w http.ResponseWriter, r *http.Request) {
+	a.Logic.Lock()
+}
+
+func (a *CallerHTTP) changePassphrase(w http.ResponseWriter, r *http.Request) {
+	if r.Body == nil {
+		errs.Fail(w, "no body", errs.Invalid)
+		return
+	}
+
+	req := &ChangePassphraseRequest{}
+	err := json.NewDecoder(r.Body).Decode(req)
+	if err != nil {
+		errs.Fail(w, "body parsing error", errs.Invalid)
+		return
+	}
+
+	err = a.Logic.ChangePassphrase(req.OldPassphrase, req.NewPassphrase)
+	if err != nil {
+		errs.FailErr(w, err)
+		return
+	}
+}
+
+func (a *CallerHTTP) setWebhooks(w http.ResponseWriter, r *http.Request) {
+	if r.Body == nil {
+		errs.Fail(w, "no body", errs.Invalid)
+		return
+	}
+
+	req := &Webhooks{}
+	err := json.NewDecoder(r.Body).Decode(req)
+	if err != nil {
+		errs.Fail(w, "body parsing error", errs.Invalid)
+		return
+	}
+
+	pubkey, err := decodePubkey(req.Pubkey)
+	if err != nil {
+		errs.Fail(w, "pubkey is not base64url", errs.Invalid)
+		return
+	}
+
+	err = a.Logic.SetWebhooks(pubkey, req.URLs)
+	if err != nil {
+		errs.FailErr(w, err)
+		return
+	}
+
+	a.sendWebhooks(w, pubkey)
+}
+
+func (a *CallerHTTP) webhooks(w http.ResponseWriter, r *http.Request) {
+	pubkey, err := decodePubkey(strings.TrimPrefix(r.URL.Path, "/webhooks/"))
+	if err != nil {
+		errs.Fail(w, "pubkey is not base64url", errs.Invalid)
+		return
+	}
+
+	a.sendWebhooks(w, pubkey)
+}
 
+func (a *CallerHTTP) sendWebhooks(w http.ResponseWriter, pubkey []byte) {
+	urls, err := a.Logic.ViewWebhooks(pubkey)
+	if err != nil {
+		errs.FailErr(w, err)
+		return
+	}
+
+	a.send(w, &Webhooks{Pubkey: encodePubkey(pubkey), URLs: urls})
+}
+
+func (a *CallerHTTP) webhookDeliveries(w http.ResponseWriter, r *http.Request) {
+	ds, err := a.Logic.ViewDeliveries()
+	if err != nil {
+		errs.FailErr(w, err)
+		return
+	}
+
+	resp := []*Delivery{}
+	for _, d := range ds {
+		resp = append(resp, deliveryToJSON(d))
+	}
+	a.send(w, resp)
+}
+
+// channelEquivocations sends the evidence of the participants of a channel
+// signing conflicting update txs.
+func (a *CallerHTTP) channelEquivocations(w http.ResponseWriter, r *http.Request) {
+	eqs, err := a.Logic.ViewEquivocations(strings.TrimPrefix(r.URL.Path, "/channel_equivocations/"))
+	if err != nil {
+		errs.FailErr(w, err)
+		return
+	}
+
+	resp := []*Equivocation{}
+	for _, eq := range eqs {
+		resp = append(resp, equivocationToJSON(eq))
+	}
+	a.send(w, resp)
+}
+
+func (a *CallerHTTP) sendChannel(w http.ResponseWriter, channelID string) {
+	ch, err := a.Logic.ViewChannel(channelID)
+	if err != nil {
+		errs.FailErr(w, err)
+		return
+	}
+
+	a.send(w, channelToJSON(ch, time.Now()))
+}
+
+func (a *CallerHTTP) send(w http.ResponseWriter, data interface{}) {
 	resp, err := json.Marshal(data)
 	if err != nil {
-		w.WriteHeader(http.StatusInternalServerError)
-		a.fail(w, "oops something evil has happened", 500)
+		errs.Fail(w, "oops something evil has happened", errs.Internal)
 		return
 	}
+
+	w.Header().Set("Content-Type", "application/json")
 	w.Write(resp)
 }
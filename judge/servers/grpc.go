@@ -0,0 +1,68 @@
+package servers
+
+import (
+	"encoding/json"
+
+	"github.com/jtremback/usc/core/errs"
+	"github.com/jtremback/usc/core/wire"
+	"github.com/jtremback/usc/judge/logic"
+	"golang.org/x/net/context"
+	"google.golang.org/grpc"
+)
+
+// PeerGRPC is the gRPC equivalent of PeerHTTP. It implements
+// wire.JudgeServer.
+type PeerGRPC struct {
+	Logic *logic.PeerAPI
+}
+
+func (a *PeerGRPC) Register(s *grpc.Server) {
+	wire.RegisterJudgeServer(s, a)
+}
+
+func (a *PeerGRPC) AddChannel(ctx context.Context, ev *wire.Envelope) (*wire.Empty, error) {
+	return &wire.Empty{}, errs.ToGRPC(a.Logic.AddChannel(ev))
+}
+
+func (a *PeerGRPC) AddFullUpdateTx(ctx context.Context, ev *wire.Envelope) (*wire.Empty, error) {
+	return &wire.Empty{}, errs.ToGRPC(a.Logic.AddFullUpdateTx(ev))
+}
+
+func (a *PeerGRPC) AddClosingTx(ctx context.Context, ev *wire.Envelope) (*wire.Empty, error) {
+	return &wire.Empty{}, errs.ToGRPC(a.Logic.AddClosingTx(ev))
+}
+
+func (a *PeerGRPC) AddCancelTx(ctx context.Context, ev *wire.Envelope) (*wire.Empty, error) {
+	return &wire.Empty{}, errs.ToGRPC(a.Logic.AddCancelTx(ev))
+}
+
+func (a *PeerGRPC) AddPreimageTx(ctx context.Context, ev *wire.Envelope) (*wire.Empty, error) {
+	return &wire.Empty{}, errs.ToGRPC(a.Logic.AddPreimageTx(ev))
+}
+
+func (a *PeerGRPC) AddFollowOnTx(ctx context.Context, ev *wire.Envelope) (*wire.Empty, error) {
+	return &wire.Empty{}, errs.ToGRPC(a.Logic.AddFollowOnTx(ev))
+}
+
+// GetChannel sends the channel as the same JSON as PeerHTTP's /get_channel.
+func (a *PeerGRPC) GetChannel(ctx context.Context, req *wire.ChannelRequest) (*wire.ChannelJSON, error) {
+	ch, err := a.Logic.GetChannel(req.ChannelId)
+	if err != nil {
+		return nil, errs.ToGRPC(err)
+	}
+
+	b, err := json.Marshal(ch)
+	if err != nil {
+		return nil, errs.ToGRPC(err)
+	}
+
+	return &wire.ChannelJSON{Json: b}, nil
+}
+
+func (a *PeerGRPC) GetLastFullUpdateTx(ctx context.Context, req *wire.ChannelRequest) (*wire.Envelope, error) {
+	ev, err := a.Logic.GetLastFullUpdateTx(req.ChannelId)
+	if err != nil {
+		return nil, errs.ToGRPC(err)
+	}
+	return ev, nil
+}
@@ -0,0 +1,316 @@
+package servers
+
+import (
+	"encoding/base64"
+	"time"
+
+	"github.com/golang/protobuf/proto"
+	core "github.com/jtremback/usc/core/judge"
+	"github.com/jtremback/usc/core/webhook"
+	"github.com/jtremback/usc/core/wire"
+)
+
+// These are the JSON representations of the judge caller API's requests and
+// responses. Pubkeys and hashes are base64url encoded, and states are strings.
+
+type Judge struct {
+	Name   string `json:"name"`
+	Pubkey string `json:"pubkey"`
+}
+
+type Account struct {
+	Name    string `json:"name"`
+	Pubkey  string `json:"pubkey"`
+	Address string `json:"address"`
+	Judge   *Judge `json:"judge"`
+}
+
+type OpeningTx struct {
+	ChannelId  string   `json:"channelId"`
+	Pubkeys    []string `json:"pubkeys"`
+	State      string   `json:"state"`
+	HoldPeriod uint64   `json:"holdPeriod"`
+}
+
+type HashLock struct {
+	Hash   string     `json:"hash"`
+	Expiry *time.Time `json:"expiry,omitempty"`
+	State  string     `json:"state"`
+}
+
+type UpdateTx struct {
+	ChannelId      string      `json:"channelId"`
+	SequenceNumber uint32      `json:"sequenceNumber"`
+	Fast           bool        `json:"fast"`
+	State          string      `json:"state"`
+	HashLocks      []*HashLock `json:"hashLocks,omitempty"`
+	Expiry         *time.Time  `json:"expiry,omitempty"`
+}
+
+type FollowOnTx struct {
+	ChannelId string `json:"channelId"`
+	State     string `json:"state"`
+}
+
+type Channel struct {
+	ChannelId string `json:"channelId"`
+	Phase     string `json:"phase"`
+
+	OpeningTx     *OpeningTx    `json:"openingTx"`
+	FullUpdateTxs []*UpdateTx   `json:"fullUpdateTxs"`
+	FinalUpdateTx *UpdateTx     `json:"finalUpdateTx,omitempty"`
+	FollowOnTxs   []*FollowOnTx `json:"followOnTxs"`
+
+	// When the channel started closing, if it has
+	CloseTime      *time.Time `json:"closeTime,omitempty"`
+	HoldPeriodOver bool       `json:"holdPeriodOver"`
+
+	Judge    *Judge     `json:"judge"`
+	Accounts []*Account `json:"accounts"`
+}
+
+// Webhooks are the URLs that the webhooks of the judge with Pubkey are POSTed
+// to. It is both the request and the response of /set_webhooks.
+type Webhooks struct {
+	Pubkey string   `json:"pubkey"`
+	URLs   []string `json:"urls"`
+}
+
+// Delivery is a webhook that has not been delivered yet.
+type Delivery struct {
+	Id          uint64           `json:"id"`
+	URL         string           `json:"url"`
+	Payload     *webhook.Payload `json:"payload"`
+	Attempts    int              `json:"attempts"`
+	NextAttempt time.Time        `json:"nextAttempt"`
+	LastError   string           `json:"lastError,omitempty"`
+}
+
+// Envelope is a signed payload, kept as evidence. The payload and the
+// signatures are base64url encoded.
+type Envelope struct {
+	Payload    string   `json:"payload"`
+	Signatures []string `json:"signatures"`
+}
+
+// Equivocation is evidence that the participants of a channel signed two
+// different update txs with the same sequence number. Held is the one the
+// judge had, and Conflicting is the one it was sent after it.
+type Equivocation struct {
+	Id                  uint64    `json:"id"`
+	SequenceNumber      uint32    `json:"sequenceNumber"`
+	Held                *UpdateTx `json:"held"`
+	Conflicting         *UpdateTx `json:"conflicting"`
+	HeldEnvelope        *Envelope `json:"heldEnvelope"`
+	ConflictingEnvelope *Envelope `json:"conflictingEnvelope"`
+	Time                time.Time `json:"time"`
+}
+
+type NewJudgeRequest struct {
+	Name string `json:"name"`
+}
+
+type AddAccountRequest struct {
+	Name        string `json:"name"`
+	JudgePubkey string `json:"judgePubkey"`
+	Pubkey      string `json:"pubkey"`
+	Address     string `json:"address"`
+}
+
+type ChannelRequest struct {
+	ChannelId string `json:"channelId"`
+}
+
+type CloseChannelRequest struct {
+	ChannelId string `json:"channelId"`
+	// The index in fullUpdateTxs of the UpdateTx to close the channel with
+	UpdateTxIndex int `json:"updateTxIndex"`
+}
+
+type UnlockRequest struct {
+	Passphrase string `json:"passphrase"`
+}
+
+type ChangePassphraseRequest struct {
+	OldPassphrase string `json:"oldPassphrase"`
+	NewPassphrase string `json:"newPassphrase"`
+}
+
+var phases = map[core.Phase]string{
+	core.PENDING_OPEN: "PENDING_OPEN",
+	core.OPEN:         "OPEN",
+	core.CLOSED:       "CLOSED",
+}
+
+// parsePhase returns the Phase with the given name.
+func parsePhase(name string) (core.Phase, bool) {
+	for phase, s := range phases {
+		if s == name {
+			return phase, true
+		}
+	}
+	return 0, false
+}
+
+func encodePubkey(b []byte) string {
+	return base64.URLEncoding.EncodeToString(b)
+}
+
+func decodePubkey(s string) ([]byte, error) {
+	return base64.URLEncoding.DecodeString(s)
+}
+
+func unixNanoTime(n int64) *time.Time {
+	if n == 0 {
+		return nil
+	}
+	t := time.Unix(0, n)
+	return &t
+}
+
+func judgeToJSON(jd *core.Judge) *Judge {
+	if jd == nil {
+		return nil
+	}
+	return &Judge{
+		Name:   jd.Name,
+		Pubkey: encodePubkey(jd.Pubkey),
+	}
+}
+
+func accountToJSON(acct *core.Account) *Account {
+	return &Account{
+		Name:    acct.Name,
+		Pubkey:  encodePubkey(acct.Pubkey),
+		Address: acct.Address,
+		Judge:   judgeToJSON(acct.Judge),
+	}
+}
+
+func openingTxToJSON(otx *wire.OpeningTx) *OpeningTx {
+	if otx == nil {
+		return nil
+	}
+	pubkeys := []string{}
+	for _, pubkey := range otx.Pubkeys {
+		pubkeys = append(pubkeys, encodePubkey(pubkey))
+	}
+	return &OpeningTx{
+		ChannelId:  otx.ChannelId,
+		Pubkeys:    pubkeys,
+		State:      string(otx.State),
+		HoldPeriod: otx.HoldPeriod,
+	}
+}
+
+func updateTxToJSON(utx *wire.UpdateTx) *UpdateTx {
+	if utx == nil {
+		return nil
+	}
+	j := &UpdateTx{
+		ChannelId:      utx.ChannelId,
+		SequenceNumber: utx.SequenceNumber,
+		Fast:           utx.Fast,
+		State:          string(utx.State),
+		Expiry:         unixNanoTime(utx.Expiry),
+	}
+	for _, lock := range utx.HashLocks {
+		j.HashLocks = append(j.HashLocks, &HashLock{
+			Hash:   encodePubkey(lock.Hash),
+			Expiry: unixNanoTime(lock.Expiry),
+			State:  string(lock.State),
+		})
+	}
+	return j
+}
+
+// channelToJSON converts a Channel to JSON. now is used to tell whether the
+// channel's hold period is over.
+func channelToJSON(ch *core.Channel, now time.Time) *Channel {
+	j := &Channel{
+		ChannelId: ch.ChannelId,
+		Phase:     phases[ch.Phase],
+
+		OpeningTx:     openingTxToJSON(ch.OpeningTx),
+		FullUpdateTxs: []*UpdateTx{},
+		FinalUpdateTx: updateTxToJSON(ch.FinalUpdateTx),
+		FollowOnTxs:   []*FollowOnTx{},
+
+		HoldPeriodOver: ch.HoldPeriodOver(now),
+
+		Judge:    judgeToJSON(ch.Judge),
+		Accounts: []*Account{},
+	}
+
+	if !ch.CloseTime.IsZero() {
+		closeTime := ch.CloseTime
+		j.CloseTime = &closeTime
+	}
+
+	for _, utx := range ch.FullUpdateTxs {
+		j.FullUpdateTxs = append(j.FullUpdateTxs, updateTxToJSON(utx))
+	}
+
+	for _, ev := range ch.FollowOnTxs {
+		ftx := &wire.FollowOnTx{}
+		err := proto.Unmarshal(ev.Payload, ftx)
+		if err != nil {
+			continue
+		}
+		j.FollowOnTxs = append(j.FollowOnTxs, &FollowOnTx{
+			ChannelId: ftx.ChannelId,
+			State:     string(ftx.State),
+		})
+	}
+
+	for _, acct := range ch.Accounts {
+		j.Accounts = append(j.Accounts, accountToJSON(acct))
+	}
+
+	return j
+}
+
+func deliveryToJSON(d *webhook.Delivery) *Delivery {
+	return &Delivery{
+		Id:          d.Id,
+		URL:         d.URL,
+		Payload:     d.Payload,
+		Attempts:    d.Attempts,
+		NextAttempt: d.NextAttempt,
+		LastError:   d.LastError,
+	}
+}
+
+func envelopeToJSON(ev *wire.Envelope) *Envelope {
+	j := &Envelope{
+		Payload:    base64.URLEncoding.EncodeToString(ev.Payload),
+		Signatures: []string{},
+	}
+	for _, sig := range ev.Signatures {
+		j.Signatures = append(j.Signatures, base64.URLEncoding.EncodeToString(sig))
+	}
+	return j
+}
+
+// envelopeUpdateTxToJSON decodes the UpdateTx in ev. It returns nil if ev does
+// not hold one.
+func envelopeUpdateTxToJSON(ev *wire.Envelope) *UpdateTx {
+	utx := &wire.UpdateTx{}
+	err := proto.Unmarshal(ev.Payload, utx)
+	if err != nil {
+		return nil
+	}
+	return updateTxToJSON(utx)
+}
+
+func equivocationToJSON(eq *core.Equivocation) *Equivocation {
+	return &Equivocation{
+		Id:                  eq.Id,
+		SequenceNumber:      eq.SequenceNumber,
+		Held:                envelopeUpdateTxToJSON(eq.Held),
+		Conflicting:         envelopeUpdateTxToJSON(eq.Conflicting),
+		HeldEnvelope:        envelopeToJSON(eq.Held),
+		ConflictingEnvelope: envelopeToJSON(eq.Conflicting),
+		Time:                eq.Time,
+	}
+}
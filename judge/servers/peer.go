@@ -6,127 +6,115 @@ import (
 	"net/http"
 
 	"github.com/golang/protobuf/proto"
+	"github.com/jtremback/usc/core/errs"
 	"github.com/jtremback/usc/core/wire"
 	"github.com/jtremback/usc/judge/logic"
 )
 
+// PeerHTTP serves the judge to peers. Envelopes are posted as protobuf, and
+// channel ids as the raw body. Its routes must match peer/clients.JudgeHTTP.
 type PeerHTTP struct {
 	Logic *logic.PeerAPI
 }
 
 func (a *PeerHTTP) MountRoutes(mux *http.ServeMux) {
-	mux.HandleFunc("/add_channel", a.addChannel)
-	mux.HandleFunc("/add_update_tx", a.addChannel)
-	mux.HandleFunc("/add_follow_on_data", a.addChannel)
+	mux.HandleFunc("/add_channel", a.envelopeHandler(a.Logic.AddChannel))
+	mux.HandleFunc("/add_full_update_tx", a.envelopeHandler(a.Logic.AddFullUpdateTx))
+	mux.HandleFunc("/add_closing_tx", a.envelopeHandler(a.Logic.AddClosingTx))
+	mux.HandleFunc("/add_cancel_tx", a.envelopeHandler(a.Logic.AddCancelTx))
+	mux.HandleFunc("/add_preimage_tx", a.envelopeHandler(a.Logic.AddPreimageTx))
+	mux.HandleFunc("/add_follow_on_tx", a.envelopeHandler(a.Logic.AddFollowOnTx))
+	mux.HandleFunc("/get_channel", a.getChannel)
+	mux.HandleFunc("/get_last_full_update_tx", a.getLastFullUpdateTx)
 }
 
-func (a *PeerHTTP) addChannel(w http.ResponseWriter, r *http.Request) {
-	if r.Body == nil {
-		a.fail(w, "no body", 500)
-		return
-	}
-
-	b, err := ioutil.ReadAll(r.Body)
-	if err != nil {
-		a.fail(w, "server error", 500)
-	}
-
-	ev := &wire.Envelope{}
-	proto.Unmarshal(b, ev)
-
-	err = a.Logic.AddChannel(ev)
-	if err != nil {
-		a.fail(w, "server error", 500)
+// envelopeHandler makes a handler which parses the envelope in the body of the
+// request and passes it to add.
+func (a *PeerHTTP) envelopeHandler(add func(*wire.Envelope) error) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if r.Body == nil {
+			errs.Fail(w, "no body", errs.Invalid)
+			return
+		}
+
+		b, err := ioutil.ReadAll(r.Body)
+		if err != nil {
+			errs.Fail(w, "server error", errs.Internal)
+			return
+		}
+
+		ev := &wire.Envelope{}
+		err = proto.Unmarshal(b, ev)
+		if err != nil {
+			errs.Fail(w, "envelope parsing error", errs.Invalid)
+			return
+		}
+
+		err = add(ev)
+		if err != nil {
+			errs.FailErr(w, err)
+			return
+		}
+		a.send(w, "ok")
 	}
-	a.send(w, "ok")
 }
 
 func (a *PeerHTTP) getChannel(w http.ResponseWriter, r *http.Request) {
 	if r.Body == nil {
-		a.fail(w, "no body", 500)
+		errs.Fail(w, "no body", errs.Invalid)
 		return
 	}
 
 	b, err := ioutil.ReadAll(r.Body)
 	if err != nil {
-		a.fail(w, "server error", 500)
+		errs.Fail(w, "server error", errs.Internal)
+		return
 	}
 
 	ch, err := a.Logic.GetChannel(string(b))
 	if err != nil {
-		a.fail(w, "server error", 500)
-	}
-
-	data, err := json.Marshal(ch)
-	if err != nil {
-		a.fail(w, "server error", 500)
+		errs.FailErr(w, err)
+		return
 	}
 
-	a.send(w, data)
+	a.send(w, ch)
 }
 
-func (a *PeerHTTP) addProposedUpdateTx(w http.ResponseWriter, r *http.Request) {
+func (a *PeerHTTP) getLastFullUpdateTx(w http.ResponseWriter, r *http.Request) {
 	if r.Body == nil {
-		a.fail(w, "no body", 500)
+		errs.Fail(w, "no body", errs.Invalid)
 		return
 	}
 
 	b, err := ioutil.ReadAll(r.Body)
 	if err != nil {
-		a.fail(w, "server error", 500)
-	}
-
-	ev := &wire.Envelope{}
-	proto.Unmarshal(b, ev)
-
-	err = a.Logic.AddProposedUpdateTx(ev)
-	if err != nil {
-		a.fail(w, "server error", 500)
-	}
-	a.send(w, "ok")
-}
-
-func (a *PeerHTTP) addFollowOnData(w http.ResponseWriter, r *http.Request) {
-	if r.Body == nil {
-		a.fail(w, "no body", 500)
+		errs.Fail(w, "server error", errs.Internal)
 		return
 	}
 
-	b, err := ioutil.ReadAll(r.Body)
+	ev, err := a.Logic.GetLastFullUpdateTx(string(b))
 	if err != nil {
-		a.fail(w, "server error", 500)
+		errs.FailErr(w, err)
+		return
 	}
 
-	ev := &wire.Envelope{}
-	proto.Unmarshal(b, ev)
-
-	err = a.Logic.AddFollowOnTx(ev)
+	data, err := proto.Marshal(ev)
 	if err != nil {
-		a.fail(w, "server error", 500)
+		errs.Fail(w, "server error", errs.Internal)
+		return
 	}
-	a.send(w, "ok")
-}
-
-func (a *PeerHTTP) fail(w http.ResponseWriter, msg string, status int) {
-	w.Header().Set("Content-Type", "application/json")
 
-	data := struct {
-		Error string
-	}{Error: msg}
-
-	resp, _ := json.Marshal(data)
-	w.WriteHeader(status)
-	w.Write(resp)
+	w.Header().Set("Content-Type", "application/octet-stream")
+	w.Write(data)
 }
 
 func (a *PeerHTTP) send(w http.ResponseWriter, data interface{}) {
-	w.Header().Set("Content-Type", "application/json")
-
 	resp, err := json.Marshal(data)
 	if err != nil {
-		w.WriteHeader(http.StatusInternalServerError)
-		a.fail(w, "oops something evil has happened", 500)
+		errs.Fail(w, "oops something evil has happened", errs.Internal)
 		return
 	}
+
+	w.Header().Set("Content-Type", "application/json")
 	w.Write(resp)
 }
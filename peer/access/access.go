@@ -2,12 +2,20 @@ package access
 
 import (
 	"bytes"
+	"crypto/sha256"
+	"encoding/binary"
 	"encoding/json"
 	"errors"
 	"fmt"
 
 	"github.com/boltdb/bolt"
+	"github.com/golang/protobuf/proto"
+	"github.com/jtremback/usc/core/errs"
+	"github.com/jtremback/usc/core/keystore"
 	core "github.com/jtremback/usc/core/peer"
+	"github.com/jtremback/usc/core/peer/schema"
+	"github.com/jtremback/usc/core/webhook"
+	"github.com/jtremback/usc/core/wire"
 )
 
 // compound index types
@@ -23,6 +31,19 @@ var (
 	Judges         []byte = []byte("Judges")
 	Accounts       []byte = []byte("Accounts")
 	Counterparties []byte = []byte("Counterparties")
+	Meta           []byte = []byte("Meta")
+	Events         []byte = []byte("Events")
+	// Webhook URLs, keyed by account pubkey
+	Webhooks []byte = []byte("Webhooks")
+	// The webhook outbox
+	Deliveries []byte = []byte("Deliveries")
+	// Messages waiting to be sent to Counterparties and Judges
+	Outbox []byte = []byte("Outbox")
+	// The sha256 hashes of the payloads of the Envelopes we have accepted, in
+	// a bucket for each Channel
+	Received []byte = []byte("Received")
+	// Evidence of Counterparties signing conflicting UpdateTxs
+	Equivocations []byte = []byte("Equivocations")
 )
 
 type NilError struct {
@@ -33,17 +54,33 @@ func (e *NilError) Error() string {
 	return fmt.Sprintf("%s", e.s)
 }
 
+// Code is errs.NotFound, so that callers of the HTTP APIs get a 404.
+func (e *NilError) Code() errs.Code {
+	return errs.NotFound
+}
+
 func MakeBuckets(db *bolt.DB) error {
 	err := db.Update(func(tx *bolt.Tx) error {
-		_, err := tx.CreateBucketIfNotExists(Indexes)
-		_, err = tx.CreateBucketIfNotExists(Channels)
-		_, err = tx.CreateBucketIfNotExists(Judges)
-		_, err = tx.CreateBucketIfNotExists(Accounts)
-		_, err = tx.CreateBucketIfNotExists(Counterparties)
-		if err != nil {
-			return err
+		for _, name := range [][]byte{
+			Indexes,
+			Channels,
+			Judges,
+			Accounts,
+			Counterparties,
+			Meta,
+			Events,
+			Webhooks,
+			Deliveries,
+			Outbox,
+			Received,
+			Equivocations,
+		} {
+			_, err := tx.CreateBucketIfNotExists(name)
+			if err != nil {
+				return err
+			}
 		}
-		return nil
+		return migrate(tx)
 	})
 	if err != nil {
 		return err
@@ -76,6 +113,25 @@ func GetJudge(tx *bolt.Tx, key []byte) (*core.Judge, error) {
 	return jd, nil
 }
 
+func GetJudges(tx *bolt.Tx) ([]*core.Judge, error) {
+	jds := []*core.Judge{}
+
+	err := tx.Bucket(Judges).ForEach(func(k, v []byte) error {
+		jd := &core.Judge{}
+		err := json.Unmarshal(v, jd)
+		if err != nil {
+			return err
+		}
+
+		jds = append(jds, jd)
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	return jds, nil
+}
+
 func SetAccount(tx *bolt.Tx, acct *core.Account) error {
 	b, err := json.Marshal(acct)
 	if err != nil {
@@ -182,8 +238,32 @@ func PopulateCounterparty(tx *bolt.Tx, cpt *core.Counterparty) error {
 	return nil
 }
 
+func GetCounterparties(tx *bolt.Tx) ([]*core.Counterparty, error) {
+	cpts := []*core.Counterparty{}
+
+	err := tx.Bucket(Counterparties).ForEach(func(k, v []byte) error {
+		cpt := &core.Counterparty{}
+		err := json.Unmarshal(v, cpt)
+		if err != nil {
+			return err
+		}
+
+		err = PopulateCounterparty(tx, cpt)
+		if err != nil {
+			return err
+		}
+
+		cpts = append(cpts, cpt)
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	return cpts, nil
+}
+
 func SetChannel(tx *bolt.Tx, ch *core.Channel) error {
-	b, err := json.Marshal(ch)
+	b, err := proto.Marshal(channelToRecord(ch))
 	if err != nil {
 		return err
 	}
@@ -209,9 +289,11 @@ func SetChannel(tx *bolt.Tx, ch *core.Channel) error {
 		return err
 	}
 
-	err = SetCounterparty(tx, ch.Counterparty)
-	if err != nil {
-		return err
+	for _, cpt := range ch.Counterparties {
+		err = SetCounterparty(tx, cpt)
+		if err != nil {
+			return err
+		}
 	}
 
 	return nil
@@ -224,12 +306,13 @@ func GetChannel(tx *bolt.Tx, key string) (*core.Channel, error) {
 		return nil, &NilError{"channel not found"}
 	}
 
-	ch := &core.Channel{}
-	err := json.Unmarshal(b, ch)
+	rec := &schema.Channel{}
+	err := proto.Unmarshal(b, rec)
 	if err != nil {
 		return nil, err
 	}
 
+	ch := recordToChannel(rec)
 	err = PopulateChannel(tx, ch)
 	if err != nil {
 		return nil, err
@@ -237,15 +320,28 @@ func GetChannel(tx *bolt.Tx, key string) (*core.Channel, error) {
 	return ch, nil
 }
 
+// DeleteChannel deletes a Channel along with the record of the Envelopes we
+// have accepted for it, so that a new Channel with the same ID starts afresh.
+func DeleteChannel(tx *bolt.Tx, key string) error {
+	err := tx.Bucket(Received).DeleteBucket([]byte(key))
+	if err != nil && err != bolt.ErrBucketNotFound {
+		return err
+	}
+	return tx.Bucket(Channels).Delete([]byte(key))
+}
+
 func PopulateChannel(tx *bolt.Tx, ch *core.Channel) error {
 	acct, err := GetAccount(tx, ch.Account.Pubkey)
 	if err != nil {
 		return err
 	}
 
-	cpt, err := GetCounterparty(tx, ch.Counterparty.Pubkey)
-	if err != nil {
-		return err
+	for i, cpt := range ch.Counterparties {
+		populated, err := GetCounterparty(tx, cpt.Pubkey)
+		if err != nil {
+			return err
+		}
+		ch.Counterparties[i] = populated
 	}
 
 	jd, err := GetJudge(tx, ch.Judge.Pubkey)
@@ -254,7 +350,6 @@ func PopulateChannel(tx *bolt.Tx, ch *core.Channel) error {
 	}
 
 	ch.Account = acct
-	ch.Counterparty = cpt
 	ch.Judge = jd
 
 	return nil
@@ -265,12 +360,13 @@ func GetChannels(tx *bolt.Tx) ([]*core.Channel, error) {
 	chs := []*core.Channel{}
 
 	err = tx.Bucket(Channels).ForEach(func(k, v []byte) error {
-		ch := &core.Channel{}
-		err = json.Unmarshal(v, ch)
+		rec := &schema.Channel{}
+		err = proto.Unmarshal(v, rec)
 		if err != nil {
 			return err
 		}
 
+		ch := recordToChannel(rec)
 		err = PopulateChannel(tx, ch)
 		if err != nil {
 			return errors.New("error populating channel")
@@ -285,3 +381,303 @@ func GetChannels(tx *bolt.Tx) ([]*core.Channel, error) {
 	}
 	return chs, nil
 }
+
+func GetAccounts(tx *bolt.Tx) ([]*core.Account, error) {
+	accts := []*core.Account{}
+
+	err := tx.Bucket(Accounts).ForEach(func(k, v []byte) error {
+		acct := &core.Account{}
+		err := json.Unmarshal(v, acct)
+		if err != nil {
+			return err
+		}
+
+		err = PopulateAccount(tx, acct)
+		if err != nil {
+			return err
+		}
+
+		accts = append(accts, acct)
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	return accts, nil
+}
+
+func cursorKey(cursor uint64) []byte {
+	k := make([]byte, 8)
+	binary.BigEndian.PutUint64(k, cursor)
+	return k
+}
+
+// AddEvent saves ev at the end of the list of Events, and sets its Cursor.
+func AddEvent(tx *bolt.Tx, ev *core.Event) error {
+	b := tx.Bucket(Events)
+
+	cursor, err := b.NextSequence()
+	if err != nil {
+		return err
+	}
+	ev.Cursor = cursor
+
+	v, err := json.Marshal(ev)
+	if err != nil {
+		return err
+	}
+
+	return b.Put(cursorKey(cursor), v)
+}
+
+// GetEvents returns up to limit Events with a Cursor after the given one, in
+// order.
+func GetEvents(tx *bolt.Tx, after uint64, limit int) ([]*core.Event, error) {
+	evs := []*core.Event{}
+
+	c := tx.Bucket(Events).Cursor()
+	for k, v := c.Seek(cursorKey(after + 1)); k != nil && len(evs) < limit; k, v = c.Next() {
+		ev := &core.Event{}
+		err := json.Unmarshal(v, ev)
+		if err != nil {
+			return nil, err
+		}
+		evs = append(evs, ev)
+	}
+
+	return evs, nil
+}
+
+// SetWebhooks sets the URLs that webhooks for the owner of pubkey are POSTed
+// to. Setting no URLs removes them all.
+func SetWebhooks(tx *bolt.Tx, pubkey []byte, urls []string) error {
+	if len(urls) == 0 {
+		return tx.Bucket(Webhooks).Delete(pubkey)
+	}
+
+	b, err := json.Marshal(urls)
+	if err != nil {
+		return err
+	}
+
+	return tx.Bucket(Webhooks).Put(pubkey, b)
+}
+
+// GetWebhooks returns the URLs that webhooks for the owner of pubkey are
+// POSTed to, if any.
+func GetWebhooks(tx *bolt.Tx, pubkey []byte) ([]string, error) {
+	urls := []string{}
+
+	b := tx.Bucket(Webhooks).Get(pubkey)
+	if len(b) == 0 {
+		return urls, nil
+	}
+
+	err := json.Unmarshal(b, &urls)
+	if err != nil {
+		return nil, err
+	}
+
+	return urls, nil
+}
+
+// AddDeliveries adds ds to the webhook outbox, and sets their Ids.
+func AddDeliveries(tx *bolt.Tx, ds []*webhook.Delivery) error {
+	b := tx.Bucket(Deliveries)
+
+	for _, d := range ds {
+		id, err := b.NextSequence()
+		if err != nil {
+			return err
+		}
+		d.Id = id
+
+		err = SetDelivery(tx, d)
+		if err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+func SetDelivery(tx *bolt.Tx, d *webhook.Delivery) error {
+	v, err := json.Marshal(d)
+	if err != nil {
+		return err
+	}
+
+	return tx.Bucket(Deliveries).Put(cursorKey(d.Id), v)
+}
+
+func DeleteDelivery(tx *bolt.Tx, id uint64) error {
+	return tx.Bucket(Deliveries).Delete(cursorKey(id))
+}
+
+// GetDeliveries returns every Delivery in the webhook outbox, oldest first.
+func GetDeliveries(tx *bolt.Tx) ([]*webhook.Delivery, error) {
+	ds := []*webhook.Delivery{}
+
+	err := tx.Bucket(Deliveries).ForEach(func(k, v []byte) error {
+		d := &webhook.Delivery{}
+		err := json.Unmarshal(v, d)
+		if err != nil {
+			return err
+		}
+		ds = append(ds, d)
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return ds, nil
+}
+
+// AddMessage adds m to the end of the Outbox, and sets its Id.
+func AddMessage(tx *bolt.Tx, m *core.Message) error {
+	id, err := tx.Bucket(Outbox).NextSequence()
+	if err != nil {
+		return err
+	}
+	m.Id = id
+
+	return SetMessage(tx, m)
+}
+
+func SetMessage(tx *bolt.Tx, m *core.Message) error {
+	v, err := json.Marshal(m)
+	if err != nil {
+		return err
+	}
+
+	return tx.Bucket(Outbox).Put(cursorKey(m.Id), v)
+}
+
+// GetMessage returns the Message with id, or nil if it is not in the Outbox.
+func GetMessage(tx *bolt.Tx, id uint64) (*core.Message, error) {
+	v := tx.Bucket(Outbox).Get(cursorKey(id))
+	if v == nil {
+		return nil, nil
+	}
+
+	m := &core.Message{}
+	err := json.Unmarshal(v, m)
+	if err != nil {
+		return nil, err
+	}
+	return m, nil
+}
+
+func DeleteMessage(tx *bolt.Tx, id uint64) error {
+	return tx.Bucket(Outbox).Delete(cursorKey(id))
+}
+
+// GetMessages returns every Message in the Outbox, in the order they were
+// added.
+func GetMessages(tx *bolt.Tx) ([]*core.Message, error) {
+	ms := []*core.Message{}
+
+	err := tx.Bucket(Outbox).ForEach(func(k, v []byte) error {
+		m := &core.Message{}
+		err := json.Unmarshal(v, m)
+		if err != nil {
+			return err
+		}
+		ms = append(ms, m)
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return ms, nil
+}
+
+// SetReceived records that we have accepted ev for a Channel, so that it can be
+// recognised if it is sent again. The record is deleted with the Channel.
+func SetReceived(tx *bolt.Tx, channelID string, ev *wire.Envelope) error {
+	b, err := tx.Bucket(Received).CreateBucketIfNotExists([]byte(channelID))
+	if err != nil {
+		return err
+	}
+	hash := sha256.Sum256(ev.Payload)
+	return b.Put(hash[:], []byte{})
+}
+
+// GetReceived returns true if we have already accepted an Envelope with the
+// same payload as ev for a Channel.
+func GetReceived(tx *bolt.Tx, channelID string, ev *wire.Envelope) bool {
+	b := tx.Bucket(Received).Bucket([]byte(channelID))
+	if b == nil {
+		return false
+	}
+	hash := sha256.Sum256(ev.Payload)
+	return b.Get(hash[:]) != nil
+}
+
+func AddEquivocation(tx *bolt.Tx, eq *core.Equivocation) error {
+	b := tx.Bucket(Equivocations)
+	id, err := b.NextSequence()
+	if err != nil {
+		return err
+	}
+	eq.Id = id
+
+	v, err := json.Marshal(eq)
+	if err != nil {
+		return err
+	}
+
+	return b.Put(cursorKey(eq.Id), v)
+}
+
+// GetEquivocations returns the Equivocations recorded about a Channel, in the
+// order they were found.
+func GetEquivocations(tx *bolt.Tx, channelID string) ([]*core.Equivocation, error) {
+	eqs := []*core.Equivocation{}
+
+	err := tx.Bucket(Equivocations).ForEach(func(k, v []byte) error {
+		eq := &core.Equivocation{}
+		err := json.Unmarshal(v, eq)
+		if err != nil {
+			return err
+		}
+		if eq.ChannelId == channelID {
+			eqs = append(eqs, eq)
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return eqs, nil
+}
+
+var keystoreKey []byte = []byte("Keystore")
+
+func SetKeystore(tx *bolt.Tx, ks *keystore.Keystore) error {
+	b, err := json.Marshal(ks)
+	if err != nil {
+		return err
+	}
+
+	return tx.Bucket(Meta).Put(keystoreKey, b)
+}
+
+func GetKeystore(tx *bolt.Tx) (*keystore.Keystore, error) {
+	b := tx.Bucket(Meta).Get(keystoreKey)
+
+	if bytes.Compare(b, []byte{}) == 0 {
+		return nil, &NilError{"keystore not found"}
+	}
+
+	ks := &keystore.Keystore{}
+	err := json.Unmarshal(b, ks)
+	if err != nil {
+		return nil, err
+	}
+
+	return ks, nil
+}
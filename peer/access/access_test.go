@@ -1,12 +1,15 @@
 package access
 
 import (
+	"encoding/json"
 	"os"
 	"reflect"
 	"testing"
+	"time"
 
 	"github.com/boltdb/bolt"
 	core "github.com/jtremback/usc/core/peer"
+	"github.com/jtremback/usc/core/webhook"
 	"github.com/jtremback/usc/core/wire"
 )
 
@@ -47,6 +50,15 @@ func TestJudge(t *testing.T) {
 		if !reflect.DeepEqual(jd, jd2) {
 			t.Fatal("Account incorrect")
 		}
+
+		jds, err := GetJudges(tx)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		if !reflect.DeepEqual(jds, []*core.Judge{jd}) {
+			t.Fatal("Judges incorrect")
+		}
 		return nil
 	})
 }
@@ -198,7 +210,7 @@ var ch = &core.Channel{
 	LastFullUpdateTxEnvelope: &wire.Envelope{},
 
 	Me:          0,
-	FollowOnTxs: []*wire.Envelope{},
+	FollowOnTxs: []*wire.Envelope{&wire.Envelope{}},
 
 	Judge: &core.Judge{
 		Name:    "wrong",
@@ -217,14 +229,16 @@ var ch = &core.Channel{
 		},
 	},
 
-	Counterparty: &core.Counterparty{
-		Name:    "wrong",
-		Pubkey:  []byte{40, 40, 40},
-		Address: "stoops.com:3004",
-		Judge: &core.Judge{
+	Counterparties: []*core.Counterparty{
+		&core.Counterparty{
 			Name:    "wrong",
 			Pubkey:  []byte{40, 40, 40},
 			Address: "stoops.com:3004",
+			Judge: &core.Judge{
+				Name:    "wrong",
+				Pubkey:  []byte{40, 40, 40},
+				Address: "stoops.com:3004",
+			},
 		},
 	},
 }
@@ -296,7 +310,7 @@ func TestChannel(t *testing.T) {
 
 	ch.Judge = jd
 	ch.Account = acct
-	ch.Counterparty = cpt
+	ch.Counterparties = []*core.Counterparty{cpt}
 
 	db.View(func(tx *bolt.Tx) error {
 		ch2, err := GetChannel(tx, ch.ChannelId)
@@ -350,3 +364,379 @@ func TestGetChannels(t *testing.T) {
 	})
 
 }
+
+func TestDeleteChannel(t *testing.T) {
+	db, err := bolt.Open("/tmp/test.db", 0600, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer db.Close()
+	defer os.Remove("/tmp/test.db")
+
+	err = MakeBuckets(db)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	db.Update(func(tx *bolt.Tx) error {
+		err := SetChannel(tx, ch)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		err = DeleteChannel(tx, ch.ChannelId)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		_, err = GetChannel(tx, ch.ChannelId)
+		err, ok := err.(*NilError)
+		if !ok {
+			t.Fatal("deleted channel should return NilError")
+		}
+
+		return nil
+	})
+}
+
+func TestMigrateJSONChannels(t *testing.T) {
+	db, err := bolt.Open("/tmp/test.db", 0600, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer db.Close()
+	defer os.Remove("/tmp/test.db")
+
+	jd := &core.Judge{
+		Name:    "joe",
+		Pubkey:  []byte{40, 40, 40},
+		Address: "stoops.com:3004",
+	}
+
+	acct := &core.Account{
+		Name:    "bob",
+		Pubkey:  []byte{50, 50, 50},
+		Privkey: []byte{50, 50, 50},
+		Judge:   jd,
+	}
+
+	cpt := &core.Counterparty{
+		Name:    "crunk",
+		Pubkey:  []byte{60, 60, 60},
+		Address: "stoops.com:3002",
+		Judge:   jd,
+	}
+
+	// A channel as it was stored before channels were protobuf records
+	legacy := &jsonChannel{
+		Channel: core.Channel{
+			ChannelId: "xyz23",
+			Phase:     2,
+			OpeningTx: &wire.OpeningTx{
+				ChannelId: "xyz23",
+				Pubkeys:   [][]byte{cpt.Pubkey, acct.Pubkey},
+			},
+			OpeningTxEnvelope: &wire.Envelope{},
+			Judge:             jd,
+			Account:           acct,
+		},
+		Counterparty: cpt,
+	}
+
+	b, err := json.Marshal(legacy)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	err = db.Update(func(tx *bolt.Tx) error {
+		for _, name := range [][]byte{Channels, Judges, Accounts, Counterparties} {
+			_, err := tx.CreateBucketIfNotExists(name)
+			if err != nil {
+				return err
+			}
+		}
+
+		err = SetJudge(tx, jd)
+		if err != nil {
+			return err
+		}
+		err = SetAccount(tx, acct)
+		if err != nil {
+			return err
+		}
+		err = SetCounterparty(tx, cpt)
+		if err != nil {
+			return err
+		}
+		return tx.Bucket(Channels).Put([]byte("xyz23"), b)
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	err = MakeBuckets(db)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	db.View(func(tx *bolt.Tx) error {
+		if GetSchemaVersion(tx) != SchemaVersion {
+			t.Fatal("schema version not set")
+		}
+
+		ch2, err := GetChannel(tx, "xyz23")
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		if ch2.Me != 1 {
+			t.Fatal("Me incorrect")
+		}
+
+		if !reflect.DeepEqual(ch2.Counterparties, []*core.Counterparty{cpt}) {
+			t.Fatal("Counterparties incorrect")
+		}
+
+		if !reflect.DeepEqual(ch2.Account, acct) {
+			t.Fatal("Account incorrect")
+		}
+		return nil
+	})
+}
+
+func TestEvents(t *testing.T) {
+	db, err := bolt.Open("/tmp/test.db", 0600, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer db.Close()
+	defer os.Remove("/tmp/test.db")
+
+	err = MakeBuckets(db)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	db.Update(func(tx *bolt.Tx) error {
+		for _, typ := range []core.EventType{core.ChannelProposed, core.ChannelOpened, core.UpdateProposed} {
+			err := AddEvent(tx, &core.Event{Type: typ, ChannelId: "shibby"})
+			if err != nil {
+				t.Fatal(err)
+			}
+		}
+		return nil
+	})
+
+	db.View(func(tx *bolt.Tx) error {
+		evs, err := GetEvents(tx, 0, 100)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if len(evs) != 3 || evs[0].Cursor != 1 || evs[2].Type != core.UpdateProposed {
+			t.Fatal("Events incorrect", evs)
+		}
+
+		evs, err = GetEvents(tx, 1, 1)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if len(evs) != 1 || evs[0].Cursor != 2 || evs[0].Type != core.ChannelOpened {
+			t.Fatal("Events after cursor incorrect", evs)
+		}
+
+		evs, err = GetEvents(tx, 3, 100)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if len(evs) != 0 {
+			t.Fatal("there should be no Events after the last one", evs)
+		}
+		return nil
+	})
+}
+
+func TestWebhooks(t *testing.T) {
+	db, err := bolt.Open("/tmp/test.db", 0600, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer db.Close()
+	defer os.Remove("/tmp/test.db")
+
+	err = MakeBuckets(db)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	db.Update(func(tx *bolt.Tx) error {
+		err := SetWebhooks(tx, []byte{40, 40, 40}, []string{"http://a", "http://b"})
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		urls, err := GetWebhooks(tx, []byte{40, 40, 40})
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !reflect.DeepEqual(urls, []string{"http://a", "http://b"}) {
+			t.Fatal("Webhooks incorrect", urls)
+		}
+
+		err = SetWebhooks(tx, []byte{40, 40, 40}, nil)
+		if err != nil {
+			t.Fatal(err)
+		}
+		urls, err = GetWebhooks(tx, []byte{40, 40, 40})
+		if err != nil {
+			t.Fatal(err)
+		}
+		if len(urls) != 0 {
+			t.Fatal("Webhooks should be removed", urls)
+		}
+
+		ds := webhook.New([]string{"http://a", "http://b"}, []byte{40, 40, 40}, "ChannelProposed", "shibby", 0, time.Now())
+		err = AddDeliveries(tx, ds)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if ds[0].Id != 1 || ds[1].Id != 2 {
+			t.Fatal("Delivery Ids incorrect", ds[0].Id, ds[1].Id)
+		}
+
+		ds[0].Attempts = 1
+		err = SetDelivery(tx, ds[0])
+		if err != nil {
+			t.Fatal(err)
+		}
+		err = DeleteDelivery(tx, ds[1].Id)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return nil
+	})
+
+	db.View(func(tx *bolt.Tx) error {
+		ds, err := GetDeliveries(tx)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if len(ds) != 1 || ds[0].Id != 1 || ds[0].Attempts != 1 || ds[0].Payload.ChannelId != "shibby" {
+			t.Fatal("Deliveries incorrect", ds)
+		}
+		return nil
+	})
+}
+
+func TestOutbox(t *testing.T) {
+	db, err := bolt.Open("/tmp/test.db", 0600, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer db.Close()
+	defer os.Remove("/tmp/test.db")
+
+	err = MakeBuckets(db)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	db.Update(func(tx *bolt.Tx) error {
+		for _, kind := range []core.MessageKind{core.AddChannel, core.AddProposedUpdateTx, core.AddFullUpdateTx} {
+			err := AddMessage(tx, &core.Message{
+				ChannelId: "shibby",
+				Kind:      kind,
+				Envelope:  &wire.Envelope{Payload: []byte{1, 2, 3}},
+				Address:   "2.com",
+			})
+			if err != nil {
+				t.Fatal(err)
+			}
+		}
+
+		err := DeleteMessage(tx, 1)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return nil
+	})
+
+	db.View(func(tx *bolt.Tx) error {
+		ms, err := GetMessages(tx)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if len(ms) != 2 || ms[0].Id != 2 || ms[0].Kind != core.AddProposedUpdateTx || ms[1].Kind != core.AddFullUpdateTx {
+			t.Fatal("Messages incorrect", ms)
+		}
+		if !reflect.DeepEqual(ms[0].Envelope.Payload, []byte{1, 2, 3}) {
+			t.Fatal("Message envelope incorrect", ms[0].Envelope)
+		}
+		return nil
+	})
+}
+
+func TestEquivocations(t *testing.T) {
+	db, err := bolt.Open("/tmp/test.db", 0600, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer db.Close()
+	defer os.Remove("/tmp/test.db")
+
+	err = MakeBuckets(db)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	db.Update(func(tx *bolt.Tx) error {
+		err := SetReceived(tx, "shibby", &wire.Envelope{Payload: []byte{1, 2, 3}})
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		for _, chID := range []string{"shibby", "other", "shibby"} {
+			err := AddEquivocation(tx, &core.Equivocation{
+				ChannelId:      chID,
+				SequenceNumber: 4,
+				Held:           &wire.Envelope{Payload: []byte{1, 2, 3}},
+				Conflicting:    &wire.Envelope{Payload: []byte{4, 5, 6}},
+			})
+			if err != nil {
+				t.Fatal(err)
+			}
+		}
+		return nil
+	})
+
+	db.View(func(tx *bolt.Tx) error {
+		if !GetReceived(tx, "shibby", &wire.Envelope{Payload: []byte{1, 2, 3}, Signatures: [][]byte{{7}}}) {
+			t.Fatal("envelope should have been received")
+		}
+		if GetReceived(tx, "shibby", &wire.Envelope{Payload: []byte{4, 5, 6}}) {
+			t.Fatal("envelope should not have been received")
+		}
+		if GetReceived(tx, "other", &wire.Envelope{Payload: []byte{1, 2, 3}}) {
+			t.Fatal("envelope should not have been received for another channel")
+		}
+
+		eqs, err := GetEquivocations(tx, "shibby")
+		if err != nil {
+			t.Fatal(err)
+		}
+		if len(eqs) != 2 || eqs[0].Id != 1 || eqs[1].Id != 3 || eqs[1].Conflicting.Payload[0] != 4 {
+			t.Fatal("Equivocations incorrect", eqs)
+		}
+		return nil
+	})
+
+	db.Update(func(tx *bolt.Tx) error {
+		err := DeleteChannel(tx, "shibby")
+		if err != nil {
+			t.Fatal(err)
+		}
+		if GetReceived(tx, "shibby", &wire.Envelope{Payload: []byte{1, 2, 3}}) {
+			t.Fatal("received envelopes should be deleted with the channel")
+		}
+		return nil
+	})
+}
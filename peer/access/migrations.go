@@ -0,0 +1,108 @@
+package access
+
+import (
+	"bytes"
+	"encoding/binary"
+	"encoding/json"
+	"errors"
+
+	"github.com/boltdb/bolt"
+	"github.com/golang/protobuf/proto"
+	core "github.com/jtremback/usc/core/peer"
+)
+
+// migrations are run in order on databases with an older schema version. The
+// schema version of a database is the number of migrations that have been
+// run on it.
+var migrations = []func(*bolt.Tx) error{
+	migrateJSONChannels,
+}
+
+var SchemaVersion = uint64(len(migrations))
+
+var version []byte = []byte("Version")
+
+func GetSchemaVersion(tx *bolt.Tx) uint64 {
+	b := tx.Bucket(Meta).Get(version)
+	if len(b) != 8 {
+		return 0
+	}
+	return binary.BigEndian.Uint64(b)
+}
+
+func setSchemaVersion(tx *bolt.Tx, v uint64) error {
+	b := make([]byte, 8)
+	binary.BigEndian.PutUint64(b, v)
+	return tx.Bucket(Meta).Put(version, b)
+}
+
+func migrate(tx *bolt.Tx) error {
+	v := GetSchemaVersion(tx)
+	if v > SchemaVersion {
+		return errors.New("database schema is newer than this version of usc")
+	}
+
+	for ; v < SchemaVersion; v++ {
+		err := migrations[v](tx)
+		if err != nil {
+			return err
+		}
+	}
+
+	return setSchemaVersion(tx, v)
+}
+
+// jsonChannel is a channel as it was stored before channels were stored as
+// protobuf records. Channels stored before N party channels have a single
+// Counterparty.
+type jsonChannel struct {
+	core.Channel
+	Counterparty *core.Counterparty
+}
+
+func migrateJSONChannels(tx *bolt.Tx) error {
+	recs := map[string][]byte{}
+
+	err := tx.Bucket(Channels).ForEach(func(k, v []byte) error {
+		jch := &jsonChannel{}
+		err := json.Unmarshal(v, jch)
+		if err != nil {
+			return err
+		}
+
+		ch := &jch.Channel
+		if jch.Counterparty != nil && len(ch.Counterparties) == 0 {
+			ch.Counterparties = []*core.Counterparty{jch.Counterparty}
+		}
+
+		if ch.Account == nil || ch.Judge == nil || ch.OpeningTx == nil {
+			return errors.New("channel " + string(k) + " is missing fields")
+		}
+
+		for i, pubkey := range ch.OpeningTx.Pubkeys {
+			if bytes.Equal(pubkey, ch.Account.Pubkey) {
+				ch.Me = uint32(i)
+			}
+		}
+
+		b, err := proto.Marshal(channelToRecord(ch))
+		if err != nil {
+			return err
+		}
+
+		recs[string(k)] = b
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+
+	for k, b := range recs {
+		err = tx.Bucket(Channels).Put([]byte(k), b)
+		if err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
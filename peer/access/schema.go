@@ -0,0 +1,79 @@
+package access
+
+import (
+	core "github.com/jtremback/usc/core/peer"
+	"github.com/jtremback/usc/core/peer/schema"
+)
+
+// channelToRecord converts a Channel to the record it is stored as. The Judge,
+// Account and Counterparties are only stored by pubkey.
+func channelToRecord(ch *core.Channel) *schema.Channel {
+	rec := &schema.Channel{
+		ChannelId: ch.ChannelId,
+		Phase:     uint32(ch.Phase),
+
+		OpeningTx:         ch.OpeningTx,
+		OpeningTxEnvelope: ch.OpeningTxEnvelope,
+
+		LastFullUpdateTx:         ch.LastFullUpdateTx,
+		LastFullUpdateTxEnvelope: ch.LastFullUpdateTxEnvelope,
+
+		MyProposedUpdateTx:         ch.MyProposedUpdateTx,
+		MyProposedUpdateTxEnvelope: ch.MyProposedUpdateTxEnvelope,
+
+		TheirProposedUpdateTx:         ch.TheirProposedUpdateTx,
+		TheirProposedUpdateTxEnvelope: ch.TheirProposedUpdateTxEnvelope,
+
+		FinalUpdateTx:         ch.FinalUpdateTx,
+		FinalUpdateTxEnvelope: ch.FinalUpdateTxEnvelope,
+
+		Me:          ch.Me,
+		FollowOnTxs: ch.FollowOnTxs,
+
+		JudgePubkey:   ch.Judge.Pubkey,
+		AccountPubkey: ch.Account.Pubkey,
+	}
+
+	for _, cpt := range ch.Counterparties {
+		rec.CounterpartyPubkeys = append(rec.CounterpartyPubkeys, cpt.Pubkey)
+	}
+
+	return rec
+}
+
+// recordToChannel converts a stored record back to a Channel. The Judge,
+// Account and Counterparties only have their pubkeys set, and are filled in by
+// PopulateChannel.
+func recordToChannel(rec *schema.Channel) *core.Channel {
+	ch := &core.Channel{
+		ChannelId: rec.ChannelId,
+		Phase:     core.Phase(rec.Phase),
+
+		OpeningTx:         rec.OpeningTx,
+		OpeningTxEnvelope: rec.OpeningTxEnvelope,
+
+		LastFullUpdateTx:         rec.LastFullUpdateTx,
+		LastFullUpdateTxEnvelope: rec.LastFullUpdateTxEnvelope,
+
+		MyProposedUpdateTx:         rec.MyProposedUpdateTx,
+		MyProposedUpdateTxEnvelope: rec.MyProposedUpdateTxEnvelope,
+
+		TheirProposedUpdateTx:         rec.TheirProposedUpdateTx,
+		TheirProposedUpdateTxEnvelope: rec.TheirProposedUpdateTxEnvelope,
+
+		FinalUpdateTx:         rec.FinalUpdateTx,
+		FinalUpdateTxEnvelope: rec.FinalUpdateTxEnvelope,
+
+		Me:          rec.Me,
+		FollowOnTxs: rec.FollowOnTxs,
+
+		Judge:   &core.Judge{Pubkey: rec.JudgePubkey},
+		Account: &core.Account{Pubkey: rec.AccountPubkey},
+	}
+
+	for _, pubkey := range rec.CounterpartyPubkeys {
+		ch.Counterparties = append(ch.Counterparties, &core.Counterparty{Pubkey: pubkey})
+	}
+
+	return ch
+}
@@ -0,0 +1,310 @@
+package clients
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/json"
+	"io/ioutil"
+	"net/http"
+	"strconv"
+	"strings"
+
+	"github.com/jtremback/usc/core/errs"
+	"github.com/jtremback/usc/peer/servers"
+)
+
+// CallerHTTP talks to the CallerHTTP server of a peer at Address, such as
+// "http://localhost:4456". Requests and responses are the types in
+// peer/servers, so that the two cannot drift apart.
+type CallerHTTP struct {
+	Address string
+}
+
+// do sends req as JSON to route, and decodes the response into resp. A nil req
+// is a GET, and a nil resp ignores the response.
+func (a *CallerHTTP) do(route string, req interface{}, resp interface{}) error {
+	var (
+		r   *http.Response
+		err error
+	)
+	if req == nil {
+		r, err = http.Get(a.Address + route)
+	} else {
+		b, marshalErr := json.Marshal(req)
+		if marshalErr != nil {
+			return marshalErr
+		}
+		r, err = http.Post(a.Address+route, "application/json", bytes.NewReader(b))
+	}
+	if err != nil {
+		return errs.New(errs.Upstream, "network error")
+	}
+	defer r.Body.Close()
+
+	body, err := ioutil.ReadAll(r.Body)
+	if err != nil {
+		return errs.New(errs.Upstream, "network error")
+	}
+
+	if r.StatusCode != 200 {
+		return errs.FromResponse(r.StatusCode, body, "peer error")
+	}
+
+	if resp == nil {
+		return nil
+	}
+	err = json.Unmarshal(body, resp)
+	if err != nil {
+		return errs.New(errs.Upstream, "error parsing response")
+	}
+	return nil
+}
+
+func (a *CallerHTTP) channelRequest(route string, chID string) (*servers.Channel, error) {
+	ch := &servers.Channel{}
+	err := a.do(route, &servers.ChannelRequest{ChannelId: chID}, ch)
+	if err != nil {
+		return nil, err
+	}
+	return ch, nil
+}
+
+func (a *CallerHTTP) Judges() ([]*servers.Judge, error) {
+	jds := []*servers.Judge{}
+	err := a.do("/judges", nil, &jds)
+	return jds, err
+}
+
+func (a *CallerHTTP) AddJudge(req *servers.AddJudgeRequest) (*servers.Judge, error) {
+	jd := &servers.Judge{}
+	err := a.do("/add_judge", req, jd)
+	if err != nil {
+		return nil, err
+	}
+	return jd, nil
+}
+
+func (a *CallerHTTP) Accounts() ([]*servers.Account, error) {
+	accts := []*servers.Account{}
+	err := a.do("/accounts", nil, &accts)
+	return accts, err
+}
+
+func (a *CallerHTTP) Account(pubkey string) (*servers.Account, error) {
+	acct := &servers.Account{}
+	err := a.do("/accounts_by_id/"+pubkey, nil, acct)
+	if err != nil {
+		return nil, err
+	}
+	return acct, nil
+}
+
+func (a *CallerHTTP) NewAccount(req *servers.NewAccountRequest) (*servers.Account, error) {
+	acct := &servers.Account{}
+	err := a.do("/new_account", req, acct)
+	if err != nil {
+		return nil, err
+	}
+	return acct, nil
+}
+
+func (a *CallerHTTP) Counterparties() ([]*servers.Counterparty, error) {
+	cpts := []*servers.Counterparty{}
+	err := a.do("/counterparties", nil, &cpts)
+	return cpts, err
+}
+
+func (a *CallerHTTP) Counterparty(pubkey string) (*servers.Counterparty, error) {
+	cpt := &servers.Counterparty{}
+	err := a.do("/counterparties/pubkey/"+pubkey, nil, cpt)
+	if err != nil {
+		return nil, err
+	}
+	return cpt, nil
+}
+
+func (a *CallerHTTP) AddCounterparty(req *servers.AddCounterpartyRequest) (*servers.Counterparty, error) {
+	cpt := &servers.Counterparty{}
+	err := a.do("/add_counterparty", req, cpt)
+	if err != nil {
+		return nil, err
+	}
+	return cpt, nil
+}
+
+func (a *CallerHTTP) Channels() ([]*servers.Channel, error) {
+	chs := []*servers.Channel{}
+	err := a.do("/channels", nil, &chs)
+	return chs, err
+}
+
+func (a *CallerHTTP) Channel(chID string) (*servers.Channel, error) {
+	ch := &servers.Channel{}
+	err := a.do("/channels_by_id/"+chID, nil, ch)
+	if err != nil {
+		return nil, err
+	}
+	return ch, nil
+}
+
+// ChannelMessages returns the messages about a channel which have not been
+// delivered yet.
+func (a *CallerHTTP) ChannelMessages(chID string) ([]*servers.Message, error) {
+	ms := []*servers.Message{}
+	err := a.do("/channel_messages/"+chID, nil, &ms)
+	return ms, err
+}
+
+// ChannelEquivocations returns the evidence of the counterparties of a channel
+// signing conflicting update txs.
+func (a *CallerHTTP) ChannelEquivocations(chID string) ([]*servers.Equivocation, error) {
+	eqs := []*servers.Equivocation{}
+	err := a.do("/channel_equivocations/"+chID, nil, &eqs)
+	return eqs, err
+}
+
+func (a *CallerHTTP) ProposeChannel(req *servers.ProposeChannelRequest) (*servers.Channel, error) {
+	ch := &servers.Channel{}
+	err := a.do("/propose_channel", req, ch)
+	if err != nil {
+		return nil, err
+	}
+	return ch, nil
+}
+
+func (a *CallerHTTP) AcceptChannel(chID string) (*servers.Channel, error) {
+	return a.channelRequest("/accept_channel", chID)
+}
+
+// RejectChannel rejects a channel. The channel is deleted, so nothing is
+// returned.
+func (a *CallerHTTP) RejectChannel(chID string) error {
+	return a.do("/reject_channel", &servers.ChannelRequest{ChannelId: chID}, nil)
+}
+
+func (a *CallerHTTP) CancelChannel(chID string) (*servers.Channel, error) {
+	return a.channelRequest("/cancel_channel", chID)
+}
+
+func (a *CallerHTTP) ProposeUpdateTx(req *servers.ProposeUpdateTxRequest) (*servers.Channel, error) {
+	ch := &servers.Channel{}
+	err := a.do("/propose_update_tx", req, ch)
+	if err != nil {
+		return nil, err
+	}
+	return ch, nil
+}
+
+func (a *CallerHTTP) AcceptUpdateTx(chID string) (*servers.Channel, error) {
+	return a.channelRequest("/accept_update_tx", chID)
+}
+
+func (a *CallerHTTP) RejectUpdateTx(chID string) (*servers.Channel, error) {
+	return a.channelRequest("/reject_update_tx", chID)
+}
+
+func (a *CallerHTTP) CloseChannel(chID string) (*servers.Channel, error) {
+	return a.channelRequest("/close_channel", chID)
+}
+
+func (a *CallerHTTP) CheckChannel(chID string) (*servers.Channel, error) {
+	return a.channelRequest("/check_channel", chID)
+}
+
+func (a *CallerHTTP) RevealPreimage(req *servers.RevealPreimageRequest) (*servers.Channel, error) {
+	ch := &servers.Channel{}
+	err := a.do("/reveal_preimage", req, ch)
+	if err != nil {
+		return nil, err
+	}
+	return ch, nil
+}
+
+func (a *CallerHTTP) RenewUpdateTx(req *servers.RenewUpdateTxRequest) (*servers.Channel, error) {
+	ch := &servers.Channel{}
+	err := a.do("/renew_update_tx", req, ch)
+	if err != nil {
+		return nil, err
+	}
+	return ch, nil
+}
+
+func (a *CallerHTTP) SetWebhooks(req *servers.Webhooks) (*servers.Webhooks, error) {
+	hooks := &servers.Webhooks{}
+	err := a.do("/set_webhooks", req, hooks)
+	if err != nil {
+		return nil, err
+	}
+	return hooks, nil
+}
+
+func (a *CallerHTTP) Webhooks(pubkey string) (*servers.Webhooks, error) {
+	hooks := &servers.Webhooks{}
+	err := a.do("/webhooks/"+pubkey, nil, hooks)
+	if err != nil {
+		return nil, err
+	}
+	return hooks, nil
+}
+
+func (a *CallerHTTP) WebhookDeliveries() ([]*servers.Delivery, error) {
+	ds := []*servers.Delivery{}
+	err := a.do("/webhook_deliveries", nil, &ds)
+	return ds, err
+}
+
+func (a *CallerHTTP) Unlock(passphrase string) error {
+	return a.do("/unlock", &servers.UnlockRequest{Passphrase: passphrase}, nil)
+}
+
+func (a *CallerHTTP) Lock() error {
+	return a.do("/lock", struct{}{}, nil)
+}
+
+func (a *CallerHTTP) ChangePassphrase(old string, new string) error {
+	return a.do("/change_passphrase", &servers.ChangePassphraseRequest{
+		OldPassphrase: old,
+		NewPassphrase: new,
+	}, nil)
+}
+
+// Events reads the peer's /events stream, starting after cursor, and calls fn
+// with each Event. It returns when the stream ends or fn returns an error.
+// Pass the Cursor of the last Event seen to pick up where it left off.
+func (a *CallerHTTP) Events(cursor uint64, fn func(*servers.Event) error) error {
+	r, err := http.Get(a.Address + "/events?cursor=" + strconv.FormatUint(cursor, 10))
+	if err != nil {
+		return errs.New(errs.Upstream, "network error")
+	}
+	defer r.Body.Close()
+
+	if r.StatusCode != 200 {
+		body, err := ioutil.ReadAll(r.Body)
+		if err != nil {
+			return errs.New(errs.Upstream, "network error")
+		}
+		return errs.FromResponse(r.StatusCode, body, "peer error")
+	}
+
+	scanner := bufio.NewScanner(r.Body)
+	for scanner.Scan() {
+		line := scanner.Text()
+		if !strings.HasPrefix(line, "data: ") {
+			continue
+		}
+
+		ev := &servers.Event{}
+		err := json.Unmarshal([]byte(strings.TrimPrefix(line, "data: ")), ev)
+		if err != nil {
+			return errs.New(errs.Upstream, "error parsing response")
+		}
+		err = fn(ev)
+		if err != nil {
+			return err
+		}
+	}
+	if scanner.Err() != nil {
+		return errs.New(errs.Upstream, "network error")
+	}
+	return nil
+}
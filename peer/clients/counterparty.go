@@ -2,26 +2,36 @@ package clients
 
 import (
 	"bytes"
-	"errors"
+	"io/ioutil"
 	"net/http"
 
 	"github.com/golang/protobuf/proto"
+	"github.com/jtremback/usc/core/errs"
 	"github.com/jtremback/usc/core/wire"
 )
 
-type CounterpartyHTTP struct{}
+// CounterpartyHTTP sends envelopes to the CounterpartyHTTP server of the peer
+// at the given address. Its routes must match peer/servers.CounterpartyHTTP.
+type CounterpartyHTTP struct {
+	// If Client is nil, requests time out after DefaultTimeout.
+	Client *http.Client
+}
 
 func (a *CounterpartyHTTP) sendEnvelope(ev *wire.Envelope, address string) error {
 	b, err := proto.Marshal(ev)
+	if err != nil {
+		return err
+	}
 
-	resp, err := http.Post(address, "application/octet-stream", bytes.NewReader(b))
+	resp, err := httpClient(a.Client).Post(address, "application/octet-stream", bytes.NewReader(b))
 	if err != nil {
-		return errors.New("network error")
+		return errs.New(errs.Upstream, "network error")
 	}
 	defer resp.Body.Close()
 
 	if resp.StatusCode != 200 {
-		return errors.New("counterparty error")
+		body, _ := ioutil.ReadAll(resp.Body)
+		return errs.FromResponse(resp.StatusCode, body, "counterparty error")
 	}
 
 	return nil
@@ -32,5 +42,17 @@ func (a *CounterpartyHTTP) AddChannel(ev *wire.Envelope, address string) error {
 }
 
 func (a *CounterpartyHTTP) AddProposedUpdateTx(ev *wire.Envelope, address string) error {
-	return a.sendEnvelope(ev, address+"/add_update_tx")
+	return a.sendEnvelope(ev, address+"/add_proposed_update_tx")
+}
+
+func (a *CounterpartyHTTP) AddFullUpdateTx(ev *wire.Envelope, address string) error {
+	return a.sendEnvelope(ev, address+"/add_full_update_tx")
+}
+
+func (a *CounterpartyHTTP) AddChannelRejectionTx(ev *wire.Envelope, address string) error {
+	return a.sendEnvelope(ev, address+"/add_channel_rejection_tx")
+}
+
+func (a *CounterpartyHTTP) AddUpdateRejectionTx(ev *wire.Envelope, address string) error {
+	return a.sendEnvelope(ev, address+"/add_update_rejection_tx")
 }
@@ -0,0 +1,240 @@
+package clients
+
+import (
+	"sync"
+	"time"
+
+	"github.com/jtremback/usc/core/errs"
+	"github.com/jtremback/usc/core/wire"
+	"golang.org/x/net/context"
+	"google.golang.org/grpc"
+)
+
+// conns keeps one grpc.ClientConn per address, since they are meant to be
+// reused and dialing is not free.
+type conns struct {
+	mut   sync.Mutex
+	conns map[string]*grpc.ClientConn
+	// How long a call may take. If it is zero, DefaultTimeout is used.
+	Timeout time.Duration
+}
+
+// callContext returns the context for a call, which is cancelled once the call
+// has taken longer than the Timeout.
+func (c *conns) callContext() (context.Context, context.CancelFunc) {
+	timeout := c.Timeout
+	if timeout <= 0 {
+		timeout = DefaultTimeout
+	}
+	return context.WithTimeout(context.Background(), timeout)
+}
+
+func (c *conns) get(address string) (*grpc.ClientConn, error) {
+	c.mut.Lock()
+	defer c.mut.Unlock()
+
+	if conn, ok := c.conns[address]; ok {
+		return conn, nil
+	}
+
+	conn, err := grpc.Dial(address, grpc.WithInsecure())
+	if err != nil {
+		return nil, errs.New(errs.Upstream, "network error")
+	}
+
+	if c.conns == nil {
+		c.conns = map[string]*grpc.ClientConn{}
+	}
+	c.conns[address] = conn
+	return conn, nil
+}
+
+// Close closes all the connections.
+func (c *conns) Close() error {
+	c.mut.Lock()
+	defer c.mut.Unlock()
+
+	for address, conn := range c.conns {
+		conn.Close()
+		delete(c.conns, address)
+	}
+	return nil
+}
+
+// CounterpartyGRPC talks to the CounterpartyGRPC server of the counterparty
+// at the given address, which is a host:port.
+type CounterpartyGRPC struct {
+	conns
+}
+
+func (a *CounterpartyGRPC) client(address string) (wire.CounterpartyClient, error) {
+	conn, err := a.get(address)
+	if err != nil {
+		return nil, err
+	}
+	return wire.NewCounterpartyClient(conn), nil
+}
+
+func (a *CounterpartyGRPC) send(
+	ev *wire.Envelope,
+	address string,
+	call func(wire.CounterpartyClient, context.Context, *wire.Envelope) error,
+) error {
+	client, err := a.client(address)
+	if err != nil {
+		return err
+	}
+
+	ctx, cancel := a.callContext()
+	defer cancel()
+
+	err = call(client, ctx, ev)
+	if err != nil {
+		return errs.FromGRPC(err, "counterparty error")
+	}
+	return nil
+}
+
+func (a *CounterpartyGRPC) AddChannel(ev *wire.Envelope, address string) error {
+	return a.send(ev, address, func(c wire.CounterpartyClient, ctx context.Context, ev *wire.Envelope) error {
+		_, err := c.AddChannel(ctx, ev)
+		return err
+	})
+}
+
+func (a *CounterpartyGRPC) AddProposedUpdateTx(ev *wire.Envelope, address string) error {
+	return a.send(ev, address, func(c wire.CounterpartyClient, ctx context.Context, ev *wire.Envelope) error {
+		_, err := c.AddProposedUpdateTx(ctx, ev)
+		return err
+	})
+}
+
+func (a *CounterpartyGRPC) AddFullUpdateTx(ev *wire.Envelope, address string) error {
+	return a.send(ev, address, func(c wire.CounterpartyClient, ctx context.Context, ev *wire.Envelope) error {
+		_, err := c.AddFullUpdateTx(ctx, ev)
+		return err
+	})
+}
+
+func (a *CounterpartyGRPC) AddChannelRejectionTx(ev *wire.Envelope, address string) error {
+	return a.send(ev, address, func(c wire.CounterpartyClient, ctx context.Context, ev *wire.Envelope) error {
+		_, err := c.AddChannelRejectionTx(ctx, ev)
+		return err
+	})
+}
+
+func (a *CounterpartyGRPC) AddUpdateRejectionTx(ev *wire.Envelope, address string) error {
+	return a.send(ev, address, func(c wire.CounterpartyClient, ctx context.Context, ev *wire.Envelope) error {
+		_, err := c.AddUpdateRejectionTx(ctx, ev)
+		return err
+	})
+}
+
+// JudgeGRPC talks to the PeerGRPC server of the judge at the given address,
+// which is a host:port.
+type JudgeGRPC struct {
+	conns
+}
+
+func (a *JudgeGRPC) client(address string) (wire.JudgeClient, error) {
+	conn, err := a.get(address)
+	if err != nil {
+		return nil, err
+	}
+	return wire.NewJudgeClient(conn), nil
+}
+
+func (a *JudgeGRPC) send(
+	ev *wire.Envelope,
+	address string,
+	call func(wire.JudgeClient, context.Context, *wire.Envelope) error,
+) error {
+	client, err := a.client(address)
+	if err != nil {
+		return err
+	}
+
+	ctx, cancel := a.callContext()
+	defer cancel()
+
+	err = call(client, ctx, ev)
+	if err != nil {
+		return errs.FromGRPC(err, "judge error")
+	}
+	return nil
+}
+
+func (a *JudgeGRPC) GetLastFullUpdateTx(chId string, address string) (*wire.Envelope, error) {
+	client, err := a.client(address)
+	if err != nil {
+		return nil, err
+	}
+
+	ctx, cancel := a.callContext()
+	defer cancel()
+
+	ev, err := client.GetLastFullUpdateTx(ctx, &wire.ChannelRequest{ChannelId: chId})
+	if err != nil {
+		return nil, errs.FromGRPC(err, "judge error")
+	}
+	return ev, nil
+}
+
+func (a *JudgeGRPC) AddChannel(ev *wire.Envelope, address string) error {
+	return a.send(ev, address, func(c wire.JudgeClient, ctx context.Context, ev *wire.Envelope) error {
+		_, err := c.AddChannel(ctx, ev)
+		return err
+	})
+}
+
+func (a *JudgeGRPC) AddClosingTx(ev *wire.Envelope, address string) error {
+	return a.send(ev, address, func(c wire.JudgeClient, ctx context.Context, ev *wire.Envelope) error {
+		_, err := c.AddClosingTx(ctx, ev)
+		return err
+	})
+}
+
+func (a *JudgeGRPC) AddFullUpdateTx(ev *wire.Envelope, address string) error {
+	return a.send(ev, address, func(c wire.JudgeClient, ctx context.Context, ev *wire.Envelope) error {
+		_, err := c.AddFullUpdateTx(ctx, ev)
+		return err
+	})
+}
+
+func (a *JudgeGRPC) AddCancelTx(ev *wire.Envelope, address string) error {
+	return a.send(ev, address, func(c wire.JudgeClient, ctx context.Context, ev *wire.Envelope) error {
+		_, err := c.AddCancelTx(ctx, ev)
+		return err
+	})
+}
+
+func (a *JudgeGRPC) AddPreimageTx(ev *wire.Envelope, address string) error {
+	return a.send(ev, address, func(c wire.JudgeClient, ctx context.Context, ev *wire.Envelope) error {
+		_, err := c.AddPreimageTx(ctx, ev)
+		return err
+	})
+}
+
+func (a *JudgeGRPC) AddFollowOnTx(ev *wire.Envelope, address string) error {
+	return a.send(ev, address, func(c wire.JudgeClient, ctx context.Context, ev *wire.Envelope) error {
+		_, err := c.AddFollowOnTx(ctx, ev)
+		return err
+	})
+}
+
+// GetChannel gets the judge's copy of a channel, as JSON.
+func (a *JudgeGRPC) GetChannel(chId string, address string) ([]byte, error) {
+	client, err := a.client(address)
+	if err != nil {
+		return nil, err
+	}
+
+	ctx, cancel := a.callContext()
+	defer cancel()
+
+	ch, err := client.GetChannel(ctx, &wire.ChannelRequest{ChannelId: chId})
+	if err != nil {
+		return nil, errs.FromGRPC(err, "judge error")
+	}
+	return ch.Json, nil
+}
@@ -2,74 +2,78 @@ package clients
 
 import (
 	"bytes"
-	"errors"
 	"io/ioutil"
 	"net/http"
 
 	"github.com/golang/protobuf/proto"
+	"github.com/jtremback/usc/core/errs"
 	"github.com/jtremback/usc/core/wire"
 )
 
-type JudgeHTTP struct{}
+// JudgeHTTP talks to the PeerHTTP server of the judge at the given address.
+// Its routes must match judge/servers.PeerHTTP.
+type JudgeHTTP struct {
+	// If Client is nil, requests time out after DefaultTimeout.
+	Client *http.Client
+}
+
+// judgeError makes an error from the response of a judge that did not accept
+// a request.
+func judgeError(resp *http.Response) error {
+	body, _ := ioutil.ReadAll(resp.Body)
+	return errs.FromResponse(resp.StatusCode, body, "judge error")
+}
 
 func (a *JudgeHTTP) sendEnvelope(ev *wire.Envelope, address string) error {
 	b, err := proto.Marshal(ev)
+	if err != nil {
+		return err
+	}
 
-	resp, err := http.Post(address, "application/octet-stream", bytes.NewReader(b))
+	resp, err := httpClient(a.Client).Post(address, "application/octet-stream", bytes.NewReader(b))
 	if err != nil {
-		return errors.New("network error")
+		return errs.New(errs.Upstream, "network error")
 	}
 	defer resp.Body.Close()
 
 	if resp.StatusCode != 200 {
-		return errors.New("counterparty error")
+		return judgeError(resp)
 	}
 
 	return nil
 }
 
-func (a *JudgeHTTP) getEnvelope(address string) (*wire.Envelope, error) {
-	resp, err := http.Post(address, "application/octet-stream", bytes.NewReader([]byte(address)))
+func (a *JudgeHTTP) getEnvelope(address string, key []byte) (*wire.Envelope, error) {
+	data, err := a.getData(address, key)
 	if err != nil {
-		return nil, errors.New("network error")
+		return nil, err
 	}
-	defer resp.Body.Close()
-
-	if resp.StatusCode != 200 {
-		return nil, errors.New("judge error")
-	}
-
-	data, err := ioutil.ReadAll(resp.Body)
 
 	ev := &wire.Envelope{}
 	err = proto.Unmarshal(data, ev)
 	if err != nil {
-		return nil, errors.New("error parsing envelope")
+		return nil, errs.New(errs.Upstream, "error parsing envelope")
 	}
 
 	return ev, nil
 }
 
 func (a *JudgeHTTP) getData(address string, key []byte) ([]byte, error) {
-	resp, err := http.Post(address, "application/octet-stream", bytes.NewReader([]byte(key)))
+	resp, err := httpClient(a.Client).Post(address, "application/octet-stream", bytes.NewReader([]byte(key)))
 	if err != nil {
-		return nil, errors.New("network error")
+		return nil, errs.New(errs.Upstream, "network error")
 	}
 	defer resp.Body.Close()
 
 	if resp.StatusCode != 200 {
-		return nil, errors.New("judge error")
+		return nil, judgeError(resp)
 	}
 
 	return ioutil.ReadAll(resp.Body)
 }
 
-func (a *JudgeHTTP) GetLastFullUpdateTx(address string) (*wire.Envelope, error) {
-	ev, err := a.getEnvelope(address + "/get_final_update_tx")
-	if err != nil {
-		return nil, errors.New("can't reach judge")
-	}
-	return ev, nil
+func (a *JudgeHTTP) GetLastFullUpdateTx(chId string, address string) (*wire.Envelope, error) {
+	return a.getEnvelope(address+"/get_last_full_update_tx", []byte(chId))
 }
 
 func (a *JudgeHTTP) AddChannel(ev *wire.Envelope, address string) error {
@@ -81,26 +85,22 @@ func (a *JudgeHTTP) AddClosingTx(ev *wire.Envelope, address string) error {
 }
 
 func (a *JudgeHTTP) AddFullUpdateTx(ev *wire.Envelope, address string) error {
-	return a.sendEnvelope(ev, address+"/add_update_tx")
+	return a.sendEnvelope(ev, address+"/add_full_update_tx")
+}
+
+func (a *JudgeHTTP) AddCancelTx(ev *wire.Envelope, address string) error {
+	return a.sendEnvelope(ev, address+"/add_cancel_tx")
+}
+
+func (a *JudgeHTTP) AddPreimageTx(ev *wire.Envelope, address string) error {
+	return a.sendEnvelope(ev, address+"/add_preimage_tx")
 }
 
 func (a *JudgeHTTP) AddFollowOnTx(ev *wire.Envelope, address string) error {
 	return a.sendEnvelope(ev, address+"/add_follow_on_tx")
 }
 
+// GetChannel gets the judge's copy of a channel, as JSON.
 func (a *JudgeHTTP) GetChannel(chId string, address string) ([]byte, error) {
-	data, err := a.getData(address+"/check_account", []byte(chId))
-	if err != nil {
-		return nil, errors.New("can't reach judge")
-	}
-
-	return data, nil
+	return a.getData(address+"/get_channel", []byte(chId))
 }
-
-// func (a *JudgeHTTP) CheckAccount(key []byte, address string) {
-// 	str := base64.URLEncoding.EncodeToString(key)
-// 	data, err := a.getData(address + "/check_account/" + str)
-// 	if err != nil {
-// 		return nil, errors.New("can't reach judge")
-// 	}
-// }
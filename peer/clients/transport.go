@@ -0,0 +1,41 @@
+package clients
+
+import (
+	"errors"
+	"net/http"
+	"time"
+
+	"github.com/jtremback/usc/peer/logic"
+)
+
+// DefaultTimeout is how long a request to a counterparty or judge may take
+// when the client is not given a timeout of its own. Requests are sent by the
+// outbox and the watcher, which must not be held up by one that never answers.
+const DefaultTimeout = 10 * time.Second
+
+// httpClient returns client, or one with DefaultTimeout if it is nil.
+func httpClient(client *http.Client) *http.Client {
+	if client == nil {
+		return &http.Client{Timeout: DefaultTimeout}
+	}
+	return client
+}
+
+// The transports that a peer can use to talk to counterparties and judges.
+// The addresses of Counterparties and Judges must suit the transport: a URL
+// such as "http://localhost:4456" for HTTP, or "localhost:4456" for gRPC.
+const (
+	HTTP = "http"
+	GRPC = "grpc"
+)
+
+// New makes the clients for the transport. An empty transport is HTTP.
+func New(transport string) (logic.CounterpartyClient, logic.JudgeClient, error) {
+	switch transport {
+	case HTTP, "":
+		return &CounterpartyHTTP{}, &JudgeHTTP{}, nil
+	case GRPC:
+		return &CounterpartyGRPC{}, &JudgeGRPC{}, nil
+	}
+	return nil, nil, errors.New("unknown transport " + transport)
+}
@@ -2,9 +2,16 @@ package logic
 
 import (
 	"encoding/json"
+	"errors"
+	"sync"
+	"time"
 
 	"github.com/boltdb/bolt"
+	"github.com/golang/protobuf/proto"
+	"github.com/jtremback/usc/core/errs"
+	"github.com/jtremback/usc/core/keystore"
 	core "github.com/jtremback/usc/core/peer"
+	"github.com/jtremback/usc/core/signer"
 	"github.com/jtremback/usc/core/wire"
 	"github.com/jtremback/usc/peer/access"
 )
@@ -13,14 +20,31 @@ type CallerAPI struct {
 	DB                 *bolt.DB
 	CounterpartyClient CounterpartyClient
 	JudgeClient        JudgeClient
+	// Keystore holds the private keys of the Accounts. It must be unlocked
+	// for the CallerAPI to sign anything, unless Signer is set.
+	Keystore *keystore.Keystore
+	// If Signer is set, it signs for the Accounts instead of the Keystore, so
+	// that their private keys can be kept out of the peer. See signer.Remote.
+	Signer signer.Signer
+	// If Events is set, it is notified of the Events that are saved.
+	Events *Events
+
+	// Held while the outbox is being read and written, but not while a
+	// Message is being sent. sending has the Channel and Address of each
+	// Message being sent, so that no other Message to the same place is sent
+	// at the same time.
+	outboxMut sync.Mutex
+	sending   map[string]bool
 }
 
 type JudgeClient interface {
-	GetLastFullUpdateTx(string) (*wire.Envelope, error)
+	GetLastFullUpdateTx(string, string) (*wire.Envelope, error)
 	AddChannel(*wire.Envelope, string) error
 	AddClosingTx(*wire.Envelope, string) error
 	AddFullUpdateTx(*wire.Envelope, string) error
 	AddFollowOnTx(*wire.Envelope, string) error
+	AddCancelTx(*wire.Envelope, string) error
+	AddPreimageTx(*wire.Envelope, string) error
 	GetChannel(string, string) ([]byte, error)
 }
 
@@ -28,6 +52,8 @@ type CounterpartyClient interface {
 	AddChannel(*wire.Envelope, string) error
 	AddProposedUpdateTx(*wire.Envelope, string) error
 	AddFullUpdateTx(*wire.Envelope, string) error
+	AddChannelRejectionTx(*wire.Envelope, string) error
+	AddUpdateRejectionTx(*wire.Envelope, string) error
 }
 
 func (a *CallerAPI) NewAccount(
@@ -46,12 +72,8 @@ func (a *CallerAPI) NewAccount(
 		if err != nil {
 			return err
 		}
-		err = access.SetAccount(tx, acct)
-		if err != nil {
-			return err
-		}
 
-		return nil
+		return a.addKey(tx, acct)
 	})
 	if err != nil {
 		return nil, err
@@ -79,15 +101,122 @@ func (a *CallerAPI) AddAccount(
 			Privkey: privkey,
 		}
 
-		err = access.SetAccount(tx, acct)
+		return a.addKey(tx, acct)
+	})
+}
+
+// accountSigner returns the Signer that the Accounts sign with.
+func (a *CallerAPI) accountSigner() signer.Signer {
+	if a.Signer != nil {
+		return a.Signer
+	}
+	if a.Keystore != nil {
+		return a.Keystore
+	}
+	return nil
+}
+
+// addKey moves the Account's Privkey into the Keystore and saves both. If the
+// CallerAPI has a Signer, the Account must not have a Privkey.
+func (a *CallerAPI) addKey(tx *bolt.Tx, acct *core.Account) error {
+	if a.Signer != nil {
+		if len(acct.Privkey) != 0 {
+			return errs.New(errs.Invalid, "private keys are held by the signer")
+		}
+		acct.Signer = a.Signer
+		return access.SetAccount(tx, acct)
+	}
+	if a.Keystore == nil {
+		return errors.New("no keystore")
+	}
+
+	err := a.Keystore.Add(acct.Pubkey, acct.Privkey)
+	if err != nil {
+		return err
+	}
+
+	err = access.SetKeystore(tx, a.Keystore)
+	if err != nil {
+		return err
+	}
+
+	acct.Privkey = nil
+	acct.Signer = a.Keystore
+	return access.SetAccount(tx, acct)
+}
+
+// Unlock unlocks the Keystore. The first time it is unlocked sets the
+// passphrase. Accounts that were saved with a plaintext Privkey before there
+// was a Keystore have their keys moved into it.
+func (a *CallerAPI) Unlock(passphrase string) error {
+	if a.Keystore == nil {
+		return errors.New("no keystore")
+	}
+
+	return a.DB.Update(func(tx *bolt.Tx) error {
+		err := a.Keystore.Unlock(passphrase)
+		if err != nil {
+			return err
+		}
+
+		err = access.SetKeystore(tx, a.Keystore)
+		if err != nil {
+			return err
+		}
+
+		accts, err := access.GetAccounts(tx)
 		if err != nil {
 			return err
 		}
 
+		for _, acct := range accts {
+			if len(acct.Privkey) == 0 {
+				continue
+			}
+			err = a.addKey(tx, acct)
+			if err != nil {
+				return err
+			}
+		}
+
 		return nil
 	})
 }
 
+// Lock locks the Keystore. Nothing can be signed until it is unlocked again.
+func (a *CallerAPI) Lock() {
+	if a.Keystore != nil {
+		a.Keystore.Lock()
+	}
+}
+
+// ChangePassphrase encrypts the Keystore with a new passphrase.
+func (a *CallerAPI) ChangePassphrase(old string, new string) error {
+	if a.Keystore == nil {
+		return errors.New("no keystore")
+	}
+
+	return a.DB.Update(func(tx *bolt.Tx) error {
+		err := a.Keystore.ChangePassphrase(old, new)
+		if err != nil {
+			return err
+		}
+
+		return access.SetKeystore(tx, a.Keystore)
+	})
+}
+
+// getChannel gets a Channel whose Account signs with the accountSigner.
+func (a *CallerAPI) getChannel(tx *bolt.Tx, channelID string) (*core.Channel, error) {
+	ch, err := access.GetChannel(tx, channelID)
+	if err != nil {
+		return nil, err
+	}
+
+	ch.Account.Signer = a.accountSigner()
+	return ch, nil
+}
+
 func (a *CallerAPI) AddCounterparty(
 	name string,
 	judge []byte,
@@ -137,6 +266,90 @@ func (a *CallerAPI) AddJudge(
 	})
 }
 
+func (a *CallerAPI) ViewJudges() ([]*core.Judge, error) {
+	var jds []*core.Judge
+	err := a.DB.View(func(tx *bolt.Tx) error {
+		var err error
+		jds, err = access.GetJudges(tx)
+		return err
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return jds, nil
+}
+
+func (a *CallerAPI) ViewAccounts() ([]*core.Account, error) {
+	var accts []*core.Account
+	err := a.DB.View(func(tx *bolt.Tx) error {
+		var err error
+		accts, err = access.GetAccounts(tx)
+		return err
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return accts, nil
+}
+
+func (a *CallerAPI) ViewAccount(pubkey []byte) (*core.Account, error) {
+	var acct *core.Account
+	err := a.DB.View(func(tx *bolt.Tx) error {
+		var err error
+		acct, err = access.GetAccount(tx, pubkey)
+		return err
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return acct, nil
+}
+
+func (a *CallerAPI) ViewCounterparties() ([]*core.Counterparty, error) {
+	var cpts []*core.Counterparty
+	err := a.DB.View(func(tx *bolt.Tx) error {
+		var err error
+		cpts, err = access.GetCounterparties(tx)
+		return err
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return cpts, nil
+}
+
+func (a *CallerAPI) ViewCounterparty(pubkey []byte) (*core.Counterparty, error) {
+	var cpt *core.Counterparty
+	err := a.DB.View(func(tx *bolt.Tx) error {
+		var err error
+		cpt, err = access.GetCounterparty(tx, pubkey)
+		return err
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return cpt, nil
+}
+
+func (a *CallerAPI) ViewChannel(channelID string) (*core.Channel, error) {
+	var ch *core.Channel
+	err := a.DB.View(func(tx *bolt.Tx) error {
+		var err error
+		ch, err = access.GetChannel(tx, channelID)
+		return err
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return ch, nil
+}
+
 func (a *CallerAPI) ViewChannels() ([]*core.Channel, error) {
 	var chs []*core.Channel
 	var err error
@@ -157,12 +370,12 @@ func (a *CallerAPI) ViewChannels() ([]*core.Channel, error) {
 }
 
 // ProposeChannel is called to propose a new channel. It creates and signs an
-// OpeningTx, sends it to the Counterparty and saves it in a new Channel.
+// OpeningTx, sends it to the Counterparties and saves it in a new Channel.
 func (a *CallerAPI) ProposeChannel(
 	channelId string,
 	state []byte,
 	myPubkey []byte,
-	theirPubkey []byte,
+	theirPubkeys [][]byte,
 	holdPeriod uint64,
 ) (*core.Channel, error) {
 	ch := &core.Channel{}
@@ -171,13 +384,18 @@ func (a *CallerAPI) ProposeChannel(
 		if err != nil {
 			return err
 		}
+		acct.Signer = a.accountSigner()
 
-		cpt, err := access.GetCounterparty(tx, theirPubkey)
-		if err != nil {
-			return err
+		cpts := []*core.Counterparty{}
+		for _, pubkey := range theirPubkeys {
+			cpt, err := access.GetCounterparty(tx, pubkey)
+			if err != nil {
+				return err
+			}
+			cpts = append(cpts, cpt)
 		}
 
-		otx, err := acct.NewOpeningTx(channelId, cpt, state, holdPeriod)
+		otx, err := acct.NewOpeningTx(channelId, cpts, state, holdPeriod)
 		if err != nil {
 			return err
 		}
@@ -187,14 +405,12 @@ func (a *CallerAPI) ProposeChannel(
 			return err
 		}
 
-		acct.AppendSignature(ev)
-
-		ch, err = core.NewChannel(ev, otx, acct, cpt)
+		ch, err = core.NewChannel(ev, otx, acct, cpts)
 		if err != nil {
 			return err
 		}
 
-		err = a.CounterpartyClient.AddChannel(ev, cpt.Address)
+		err = ch.SignOpeningTx()
 		if err != nil {
 			return err
 		}
@@ -204,64 +420,204 @@ func (a *CallerAPI) ProposeChannel(
 			return err
 		}
 
-		return nil
+		return queue(tx, ch, core.AddChannel, ev)
 	})
 	if err != nil {
 		return nil, err
 	}
 
+	a.sendQueued(channelId)
 	return ch, nil
 }
 
 // AcceptChannel is called on Channels which are in phase PENDING_OPEN. It signs
-// the Channel's OpeningTx and sends it to the Judge.
+// the Channel's OpeningTx. If every participant has now signed it, it is sent
+// to the Judge. Otherwise it is sent to the Counterparties, so that the last of
+// them to accept it has every signature.
 func (a *CallerAPI) AcceptChannel(channelID string) error {
 	var err error
-	return a.DB.Update(func(tx *bolt.Tx) error {
+	err = a.DB.Update(func(tx *bolt.Tx) error {
 		var ch *core.Channel
-		ch, err = access.GetChannel(tx, channelID)
+		ch, err = a.getChannel(tx, channelID)
 		if err != nil {
 			return err
 		}
 
-		ch.Account.AppendSignature(ch.OpeningTxEnvelope)
+		err = ch.SignOpeningTx()
+		if err != nil {
+			return err
+		}
 
 		err = access.SetChannel(tx, ch)
 		if err != nil {
 			return err
 		}
 
-		err = a.JudgeClient.AddChannel(ch.OpeningTxEnvelope, ch.Judge.Address)
+		if ch.FullySigned(ch.OpeningTxEnvelope) {
+			return queueJudge(tx, ch, core.JudgeAddChannel, ch.OpeningTxEnvelope)
+		}
+		return queue(tx, ch, core.AddChannel, ch.OpeningTxEnvelope)
+	})
+	if err != nil {
+		return err
+	}
+
+	a.sendQueued(channelID)
+	return nil
+}
+
+// RejectChannel is called on Channels which are in phase PENDING_OPEN. It sends
+// a ChannelRejectionTx to the Counterparty and deletes the Channel.
+func (a *CallerAPI) RejectChannel(channelID string) error {
+	err := a.DB.Update(func(tx *bolt.Tx) error {
+		ch, err := a.getChannel(tx, channelID)
+		if err != nil {
+			return err
+		}
+
+		rtx, err := ch.NewChannelRejectionTx()
 		if err != nil {
 			return err
 		}
 
-		return nil
+		ev, err := core.SerializeChannelRejectionTx(rtx)
+		if err != nil {
+			return err
+		}
+
+		err = ch.Account.AppendSignature(ev)
+		if err != nil {
+			return err
+		}
+
+		err = access.DeleteChannel(tx, ch.ChannelId)
+		if err != nil {
+			return err
+		}
+
+		return queue(tx, ch, core.AddChannelRejectionTx, ev)
 	})
+	if err != nil {
+		return err
+	}
+
+	a.sendQueued(channelID)
+	return nil
 }
 
-// This gets the channel from the judge and checks if it has changed, and does stuff if it has
+// judgePhase is the phase of a channel on the judge.
+type judgePhase int
+
+const (
+	judgePendingOpen judgePhase = 1
+	judgeOpen        judgePhase = 2
+	judgeClosed      judgePhase = 3
+)
+
+// judgeChannel is the judge's view of a channel, as returned by
+// JudgeClient.GetChannel.
+type judgeChannel struct {
+	ChannelId string
+	Phase     judgePhase
+
+	OpeningTx         *wire.OpeningTx
+	OpeningTxEnvelope *wire.Envelope
+
+	FullUpdateTxs         []*wire.UpdateTx
+	FullUpdateTxEnvelopes []*wire.Envelope
+
+	CloseTime time.Time
+
+	FinalUpdateTx         *wire.UpdateTx
+	FinalUpdateTxEnvelope *wire.Envelope
+}
+
+// CheckChannel gets the channel from the judge and updates our copy of it. If
+// the judge has closed the channel, our copy is closed as well. If the judge has
+// posted an UpdateTx, it is checked with checkFinalUpdateTx. If the judge has
+// started closing the channel without one, we send it our LastFullUpdateTx.
+// The judge is asked before the database is written to, so that a judge which
+// is slow to answer does not hold up everything else.
 func (a *CallerAPI) CheckChannel(chId string) error {
-	return a.DB.Update(func(tx *bolt.Tx) error {
-		ch, err := access.GetChannel(tx, chId)
+	var address string
+	err := a.DB.View(func(tx *bolt.Tx) error {
+		ch, err := a.getChannel(tx, chId)
 		if err != nil {
 			return err
 		}
+		address = ch.Judge.Address
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+
+	b, err := a.JudgeClient.GetChannel(chId, address)
+	if err != nil {
+		return err
+	}
 
-		b, err := a.JudgeClient.GetChannel(chId, ch.Judge.Address)
+	jch := &judgeChannel{}
+	err = json.Unmarshal(b, jch)
+	if err != nil {
+		return err
+	}
+
+	var final *wire.Envelope
+	if jch.Phase != judgeClosed && len(jch.FullUpdateTxs) > 0 {
+		final, err = a.JudgeClient.GetLastFullUpdateTx(chId, address)
 		if err != nil {
 			return err
 		}
+	}
 
-		jch := &core.Channel{}
-		json.Unmarshal(b, jch)
+	err = a.DB.Update(func(tx *bolt.Tx) error {
+		ch, err := a.getChannel(tx, chId)
+		if err != nil {
+			return err
+		}
+		before := ch.Phase
 
 		// This means that the judge has signed the channel
-		if ch.Phase == core.PENDING_OPEN && jch.Phase == core.OPEN {
-			ch.Open(jch.OpeningTxEnvelope, jch.OpeningTx)
+		if ch.Phase == core.PENDING_OPEN && jch.Phase == judgeOpen {
+			err = ch.Open(jch.OpeningTxEnvelope, jch.OpeningTx)
+			if err != nil {
+				return err
+			}
+		}
+
+		if jch.Phase == judgeClosed {
+			// This means that the judge has closed the channel, either after
+			// the hold period or straight away with a fast UpdateTx
+			if ch.Phase != core.CLOSED {
+				err = ch.Close(jch.FinalUpdateTxEnvelope, jch.FinalUpdateTx)
+				if err != nil {
+					return err
+				}
+			}
+		} else if final != nil {
+			err = a.checkFinalUpdateTx(tx, ch, final)
+			if err != nil {
+				return err
+			}
+		} else if !jch.CloseTime.IsZero() && ch.LastFullUpdateTx != nil {
+			// This means that the counterparty is trying to close the channel
+			// without our LastFullUpdateTx
+			queued, err := queuedJudge(tx, ch, core.JudgeAddFullUpdateTx, ch.LastFullUpdateTxEnvelope)
 			if err != nil {
 				return err
 			}
+			if !queued {
+				err = queueJudge(tx, ch, core.JudgeAddFullUpdateTx, ch.LastFullUpdateTxEnvelope)
+				if err != nil {
+					return err
+				}
+
+				err = addEvent(tx, a.Events, core.CheatDetected, ch, ch.LastFullUpdateTx.SequenceNumber)
+				if err != nil {
+					return err
+				}
+			}
 		}
 
 		err = access.SetChannel(tx, ch)
@@ -269,31 +625,63 @@ func (a *CallerAPI) CheckChannel(chId string) error {
 			return err
 		}
 
-		return nil
+		return addPhaseEvent(tx, a.Events, before, ch)
 	})
+	if err != nil {
+		return err
+	}
+
+	a.sendQueued(chId)
+	return nil
 }
 
-// NewUpdateTx is called on Channels which are in phase OPEN. It makes a new UpdateTx,
-// signs it, saves it as MyProposedUpdateTx, and sends it to the Counterparty.
-func (a *CallerAPI) NewUpdateTx(state []byte, channelID string, fast bool) error {
-	var err error
-	return a.DB.Update(func(tx *bolt.Tx) error {
-		ch := &core.Channel{}
-		ch, err = access.GetChannel(tx, channelID)
+// UpdateTxOptions describes an UpdateTx for ProposeUpdateTx to make.
+type UpdateTxOptions struct {
+	State []byte
+	Fast  bool
+	// The states which are only valid if their preimages are revealed to the
+	// Judge before they expire
+	HashLocks []*wire.HashLock
+	// If set, the Judge will not accept the UpdateTx after it
+	Expiry time.Time
+	// If set, the state of LastFullUpdateTx is proposed again with a later
+	// Expiry, and State, Fast and HashLocks are ignored
+	Renew bool
+}
+
+// ProposeUpdateTx is called on Channels which are in phase OPEN. It makes a new
+// UpdateTx as described by opts, signs it, saves it as MyProposedUpdateTx, and
+// sends it to the Counterparty.
+func (a *CallerAPI) ProposeUpdateTx(channelID string, opts *UpdateTxOptions) error {
+	if !opts.Expiry.IsZero() && !opts.Expiry.After(time.Now()) {
+		return errs.New(errs.Invalid, "expiry is in the past")
+	}
+
+	err := a.DB.Update(func(tx *bolt.Tx) error {
+		ch, err := a.getChannel(tx, channelID)
 		if err != nil {
 			return err
 		}
 
-		utx := ch.NewUpdateTx(state, fast)
+		var utx *wire.UpdateTx
+		if opts.Renew {
+			utx, err = ch.NewRenewalUpdateTx(opts.Expiry)
+		} else {
+			utx, err = ch.NewHashLockedUpdateTx(opts.State, opts.HashLocks, opts.Fast)
+			if err == nil && !opts.Expiry.IsZero() {
+				utx.Expiry = opts.Expiry.UnixNano()
+			}
+		}
+		if err != nil {
+			return err
+		}
 
 		ev, err := core.SerializeUpdateTx(utx)
 		if err != nil {
 			return err
 		}
 
-		ch.SignProposedUpdateTx(ev, utx)
-
-		err = a.CounterpartyClient.AddProposedUpdateTx(ev, ch.Counterparty.Address)
+		err = ch.SignProposedUpdateTx(ev, utx)
 		if err != nil {
 			return err
 		}
@@ -303,99 +691,316 @@ func (a *CallerAPI) NewUpdateTx(state []byte, channelID string, fast bool) error
 			return err
 		}
 
-		return nil
+		return queue(tx, ch, core.AddProposedUpdateTx, ev)
+	})
+	if err != nil {
+		return err
+	}
+
+	a.sendQueued(channelID)
+	return nil
+}
+
+// NewUpdateTx proposes an UpdateTx with a new state.
+func (a *CallerAPI) NewUpdateTx(state []byte, channelID string, fast bool) error {
+	return a.ProposeUpdateTx(channelID, &UpdateTxOptions{State: state, Fast: fast})
+}
+
+// NewHashLockedUpdateTx is like NewUpdateTx, but the state in each of the
+// hashLocks is only valid if its preimage is revealed to the Judge before it
+// expires.
+func (a *CallerAPI) NewHashLockedUpdateTx(state []byte, hashLocks []*wire.HashLock, channelID string, fast bool) error {
+	return a.ProposeUpdateTx(channelID, &UpdateTxOptions{State: state, Fast: fast, HashLocks: hashLocks})
+}
+
+// NewExpiringUpdateTx is like NewUpdateTx, but the Judge will not accept the
+// UpdateTx after expiry. Use RenewUpdateTx to extend it.
+func (a *CallerAPI) NewExpiringUpdateTx(state []byte, expiry time.Time, channelID string, fast bool) error {
+	return a.ProposeUpdateTx(channelID, &UpdateTxOptions{State: state, Fast: fast, Expiry: expiry})
+}
+
+// RenewUpdateTx proposes the state of the Channel's LastFullUpdateTx again at
+// the next sequence number, with a later expiry. Once the Counterparty cosigns
+// it, it replaces the LastFullUpdateTx which was about to expire.
+func (a *CallerAPI) RenewUpdateTx(channelID string, expiry time.Time) error {
+	return a.ProposeUpdateTx(channelID, &UpdateTxOptions{Expiry: expiry, Renew: true})
+}
+
+// RevealPreimage sends the preimage of a HashLock's hash to the Judge. It must
+// reach the Judge before the HashLock expires.
+func (a *CallerAPI) RevealPreimage(channelID string, preimage []byte) error {
+	err := a.DB.Update(func(tx *bolt.Tx) error {
+		ch, err := a.getChannel(tx, channelID)
+		if err != nil {
+			return err
+		}
+
+		ptx, err := ch.NewPreimageTx(preimage)
+		if err != nil {
+			return err
+		}
+
+		ev, err := core.SerializePreimageTx(ptx)
+		if err != nil {
+			return err
+		}
+
+		err = ch.Account.AppendSignature(ev)
+		if err != nil {
+			return err
+		}
+
+		return queueJudge(tx, ch, core.JudgeAddPreimageTx, ev)
 	})
+	if err != nil {
+		return err
+	}
+
+	a.sendQueued(channelID)
+	return nil
 }
 
-// CosignProposedUpdateTx cosigns the Channel's TheirProposedUpdateTx, saves it to
-// LastFullUpdateTx, and sends it to the Counterparty.
+// CosignProposedUpdateTx cosigns the Channel's TheirProposedUpdateTx. If every
+// participant has now signed it, it is saved to LastFullUpdateTx and sent to the
+// Counterparties as a full UpdateTx. Otherwise it is sent to them as a proposal
+// carrying our signature.
 func (a *CallerAPI) CosignProposedUpdateTx(channelID string) error {
-	return a.DB.Update(func(tx *bolt.Tx) error {
-		ch, err := access.GetChannel(tx, channelID)
+	err := a.DB.Update(func(tx *bolt.Tx) error {
+		ch, err := a.getChannel(tx, channelID)
 		if err != nil {
 			return err
 		}
 
-		ev := ch.CosignProposedUpdateTx()
+		before := seqsOf(ch)
+		ev, err := ch.CosignProposedUpdateTx()
+		if err != nil {
+			return err
+		}
 
 		err = access.SetChannel(tx, ch)
 		if err != nil {
 			return err
 		}
 
-		err = a.CounterpartyClient.AddFullUpdateTx(ev, ch.Counterparty.Address)
+		err = addUpdateEvent(tx, a.Events, before, ch)
 		if err != nil {
 			return err
 		}
 
-		return nil
+		if ch.FullySigned(ev) {
+			return queue(tx, ch, core.AddFullUpdateTx, ev)
+		}
+		return queue(tx, ch, core.AddProposedUpdateTx, ev)
+	})
+	if err != nil {
+		return err
+	}
+
+	a.sendQueued(channelID)
+	return nil
+}
+
+// RejectUpdateTx sends an UpdateRejectionTx to the Counterparty, to tell them that
+// we will never cosign TheirProposedUpdateTx, and clears TheirProposedUpdateTx.
+func (a *CallerAPI) RejectUpdateTx(channelID string) error {
+	err := a.DB.Update(func(tx *bolt.Tx) error {
+		ch, err := a.getChannel(tx, channelID)
+		if err != nil {
+			return err
+		}
+
+		rtx, err := ch.NewUpdateRejectionTx()
+		if err != nil {
+			return err
+		}
+
+		ev, err := core.SerializeUpdateRejectionTx(rtx)
+		if err != nil {
+			return err
+		}
+
+		err = ch.Account.AppendSignature(ev)
+		if err != nil {
+			return err
+		}
+		ch.RejectProposedUpdateTx()
+
+		err = access.SetChannel(tx, ch)
+		if err != nil {
+			return err
+		}
+
+		return queue(tx, ch, core.AddUpdateRejectionTx, ev)
 	})
+	if err != nil {
+		return err
+	}
+
+	a.sendQueued(channelID)
+	return nil
 }
 
+// CloseChannel sends our LastFullUpdateTx, if there is one, and a ClosingTx to
+// the Judge, which starts the hold period.
 func (a *CallerAPI) CloseChannel(channelID string) error {
-	return a.DB.View(func(tx *bolt.Tx) error {
-		ch, err := access.GetChannel(tx, channelID)
+	err := a.DB.Update(func(tx *bolt.Tx) error {
+		ch, err := a.getChannel(tx, channelID)
+		if err != nil {
+			return err
+		}
+
+		ev, err := core.SerializeClosingTx(ch.NewClosingTx())
+		if err != nil {
+			return err
+		}
+
+		err = ch.Account.AppendSignature(ev)
 		if err != nil {
 			return err
 		}
 
 		if ch.LastFullUpdateTx != nil {
-			err = a.JudgeClient.AddFullUpdateTx(ch.LastFullUpdateTxEnvelope, ch.Judge.Address)
+			err = queueJudge(tx, ch, core.JudgeAddFullUpdateTx, ch.LastFullUpdateTxEnvelope)
 			if err != nil {
 				return err
 			}
 		}
 
-		ev, err := core.SerializeClosingTx(ch.NewClosingTx())
-		ch.Account.AppendSignature(ev)
+		return queueJudge(tx, ch, core.JudgeAddClosingTx, ev)
+	})
+	if err != nil {
+		return err
+	}
 
-		err = a.JudgeClient.AddClosingTx(ev, ch.Judge.Address)
+	a.sendQueued(channelID)
+	return nil
+}
+
+// CancelChannel is called on Channels which are in phase OPEN and have no
+// LastFullUpdateTx. It sends a CancelTx to the Judge, instructing it to close
+// the Channel with the state in the OpeningTx once the hold period is over.
+func (a *CallerAPI) CancelChannel(channelID string) error {
+	err := a.DB.Update(func(tx *bolt.Tx) error {
+		ch, err := a.getChannel(tx, channelID)
 		if err != nil {
 			return err
 		}
 
+		ctx, err := ch.NewCancelTx()
+		if err != nil {
+			return err
+		}
+
+		ev, err := core.SerializeCancelTx(ctx)
+		if err != nil {
+			return err
+		}
+
+		err = ch.Account.AppendSignature(ev)
+		if err != nil {
+			return err
+		}
+		before := ch.Phase
+		ch.Phase = core.PENDING_CLOSED
+
+		err = access.SetChannel(tx, ch)
+		if err != nil {
+			return err
+		}
+
+		err = addPhaseEvent(tx, a.Events, before, ch)
+		if err != nil {
+			return err
+		}
+
+		return queueJudge(tx, ch, core.JudgeAddCancelTx, ev)
+	})
+	if err != nil {
+		return err
+	}
+
+	a.sendQueued(channelID)
+	return nil
+}
+
+// CheckFullUpdateTx checks with the Judge to see if the Counterparty has posted
+// an UpdateTx. If the UpdateTx from the Judge has a lower SequenceNumber than
+// LastFullUpdateTx, we send LastFullUpdateTx to the Judge. Otherwise, the
+// Channel is placed in PENDING_CLOSED.
+func (a *CallerAPI) CheckFullUpdateTx(channelID string) error {
+	var address string
+	err := a.DB.View(func(tx *bolt.Tx) error {
+		ch, err := a.getChannel(tx, channelID)
+		if err != nil {
+			return err
+		}
+		address = ch.Judge.Address
 		return nil
 	})
+	if err != nil {
+		return err
+	}
+
+	final, err := a.JudgeClient.GetLastFullUpdateTx(channelID, address)
+	if err != nil {
+		return err
+	}
+
+	err = a.DB.Update(func(tx *bolt.Tx) error {
+		ch, err := a.getChannel(tx, channelID)
+		if err != nil {
+			return err
+		}
+
+		before := ch.Phase
+		err = a.checkFinalUpdateTx(tx, ch, final)
+		if err != nil {
+			return err
+		}
+
+		err = access.SetChannel(tx, ch)
+		if err != nil {
+			return err
+		}
+
+		return addPhaseEvent(tx, a.Events, before, ch)
+	})
+	if err != nil {
+		return err
+	}
+
+	a.sendQueued(channelID)
+	return nil
 }
 
-// // CheckFullUpdateTx checks with the Judge to see if the Counterparty has posted
-// // an UpdateTx. If the UpdateTx from the Judge has a lower SequenceNumber than
-// // LastFullUpdateTx, we send LastFullUpdateTx to the Judge.
-// func (a *CallerAPI) CheckFullUpdateTx(channelID string) error {
-// 	return a.DB.Update(func(tx *bolt.Tx) error {
-// 		ch, err := access.GetChannel(tx, channelID)
-// 		if err != nil {
-// 			return err
-// 		}
-
-// 		ev, err := a.JudgeClient.GetLastFullUpdateTx(ch.Judge.Address)
-// 		if err != nil {
-// 			return err
-// 		}
-
-// 		utx := &wire.UpdateTx{}
-// 		err = proto.Unmarshal(ev.Payload, utx)
-// 		if err != nil {
-// 			return err
-// 		}
-
-// 		err = ch.AddFullUpdateTx(ev, utx)
-// 		if err != nil {
-// 			return err
-// 		}
-
-// 		if newerUpdateTx != nil {
-// 			err = a.JudgeClient.AddFullUpdateTx(newerUpdateTx, ch.Judge.Address)
-// 			if err != nil {
-// 				return err
-// 			}
-// 		}
-
-// 		err = access.SetChannel(tx, ch)
-// 		if err != nil {
-// 			return err
-// 		}
-
-// 		return nil
-// 	})
-// }
+// checkFinalUpdateTx checks ev, the last full UpdateTx from the Judge. If it is
+// older than our LastFullUpdateTx, ours is queued to be sent to the Judge once
+// tx is committed, and a CheatDetected Event is saved.
+func (a *CallerAPI) checkFinalUpdateTx(tx *bolt.Tx, ch *core.Channel, ev *wire.Envelope) error {
+	utx := &wire.UpdateTx{}
+	err := proto.Unmarshal(ev.Payload, utx)
+	if err != nil {
+		return err
+	}
+
+	newerEv, err := ch.CheckFinalUpdateTx(ev, utx)
+	if err != nil {
+		return err
+	}
+
+	if newerEv == nil {
+		return nil
+	}
+
+	queued, err := queuedJudge(tx, ch, core.JudgeAddFullUpdateTx, newerEv)
+	if err != nil || queued {
+		return err
+	}
+
+	err = queueJudge(tx, ch, core.JudgeAddFullUpdateTx, newerEv)
+	if err != nil {
+		return err
+	}
+
+	return addEvent(tx, a.Events, core.CheatDetected, ch, ch.LastFullUpdateTx.SequenceNumber)
+}
@@ -0,0 +1,99 @@
+package logic
+
+import (
+	"errors"
+	"os"
+	"testing"
+	"time"
+
+	"github.com/boltdb/bolt"
+	core "github.com/jtremback/usc/core/peer"
+	"github.com/jtremback/usc/core/wire"
+	"github.com/jtremback/usc/peer/access"
+)
+
+// channelCaller returns a CallerAPI with a PENDING_OPEN channel "xyz23" with a
+// hold period of an hour, which asks judge about it.
+func channelCaller(t *testing.T, judge JudgeClient) (*CallerAPI, func()) {
+	db, err := bolt.Open("/tmp/test_caller.db", 0600, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	err = access.MakeBuckets(db)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	jd := &core.Judge{Name: "joe", Pubkey: []byte{40, 40, 40}, Address: "stoops.com:3004"}
+	err = db.Update(func(tx *bolt.Tx) error {
+		return access.SetChannel(tx, &core.Channel{
+			ChannelId: "xyz23",
+			Phase:     core.PENDING_OPEN,
+			OpeningTx: &wire.OpeningTx{HoldPeriod: uint64(time.Hour)},
+			Judge:     jd,
+			Account:   &core.Account{Name: "bob", Pubkey: []byte{50, 50, 50}, Judge: jd},
+			Counterparties: []*core.Counterparty{
+				{Name: "crunk", Pubkey: []byte{60, 60, 60}, Address: "stoops.com:3002", Judge: jd},
+			},
+		})
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	return &CallerAPI{DB: db, JudgeClient: judge}, func() {
+		db.Close()
+		os.Remove("/tmp/test_caller.db")
+	}
+}
+
+// slowJudge blocks in GetChannel until release is closed, like a judge that
+// is slow to answer.
+type slowJudge struct {
+	JudgeClient
+	called  chan struct{}
+	release chan struct{}
+}
+
+func (j *slowJudge) GetChannel(chId string, address string) ([]byte, error) {
+	close(j.called)
+	<-j.release
+	return nil, errors.New("judge is down")
+}
+
+func TestCheckChannelSlowJudge(t *testing.T) {
+	judge := &slowJudge{
+		called:  make(chan struct{}),
+		release: make(chan struct{}),
+	}
+	a, teardown := channelCaller(t, judge)
+	defer teardown()
+
+	checked := make(chan error)
+	go func() {
+		checked <- a.CheckChannel("xyz23")
+	}()
+	<-judge.called
+
+	// The database can still be written to while the judge is being asked.
+	written := make(chan error)
+	go func() {
+		written <- a.DB.Update(func(tx *bolt.Tx) error {
+			return access.SetReceived(tx, "xyz23", &wire.Envelope{Payload: []byte{1}})
+		})
+	}()
+	select {
+	case err := <-written:
+		if err != nil {
+			t.Fatal(err)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("database was locked while the judge was being asked")
+	}
+
+	close(judge.release)
+	if <-checked == nil {
+		t.Fatal("checking the channel should return the judge's error")
+	}
+}
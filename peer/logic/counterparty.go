@@ -1,10 +1,12 @@
 package logic
 
 import (
+	"bytes"
 	"errors"
 
 	"github.com/boltdb/bolt"
 	"github.com/golang/protobuf/proto"
+	"github.com/jtremback/usc/core/errs"
 	core "github.com/jtremback/usc/core/peer"
 	"github.com/jtremback/usc/core/wire"
 	"github.com/jtremback/usc/peer/access"
@@ -12,81 +14,190 @@ import (
 
 type CounterpartyAPI struct {
 	DB *bolt.DB
+	// If Events is set, it is notified of the Events that are saved.
+	Events *Events
 }
 
+// AddChannel saves a Channel proposed by a Counterparty. If we already have the
+// Channel, the signatures that other Counterparties have made on its OpeningTx
+// are added to it instead. Sending the same OpeningTx again does nothing once
+// the Channel is open.
 func (a *CounterpartyAPI) AddChannel(ev *wire.Envelope) error {
 	var err error
 
 	otx := &wire.OpeningTx{}
 	err = proto.Unmarshal(ev.Payload, otx)
 	if err != nil {
-		return err
+		return errs.New(errs.Invalid, "envelope payload not valid")
 	}
 
-	acct := &core.Account{}
-	cpt := &core.Counterparty{}
 	err = a.DB.Update(func(tx *bolt.Tx) error {
-		_, nilErr := access.GetChannel(tx, otx.ChannelId)
+		ch, nilErr := access.GetChannel(tx, otx.ChannelId)
 		if nilErr == nil {
-			return errors.New("channel already exists")
+			if ch.Phase != core.PENDING_OPEN {
+				if bytes.Compare(ev.Payload, ch.OpeningTxEnvelope.Payload) == 0 {
+					return nil
+				}
+				return errs.New(errs.Conflict, "channel already exists")
+			}
+
+			err = ch.AddOpeningTxSignatures(ev)
+			if err != nil {
+				return err
+			}
+
+			return access.SetChannel(tx, ch)
 		}
 		_, ok := nilErr.(*access.NilError)
 		if !ok {
+			return nilErr
+		}
+		if len(otx.Pubkeys) < 2 {
+			return errs.New(errs.Invalid, "not enough public keys")
+		}
+
+		// Our account is one of the pubkeys, and all of the others must be
+		// our counterparties.
+		var acct *core.Account
+		cpts := []*core.Counterparty{}
+		for _, pubkey := range otx.Pubkeys {
+			if acct == nil {
+				found, err := access.GetAccount(tx, pubkey)
+				if err == nil {
+					acct = found
+					continue
+				}
+				if _, ok := err.(*access.NilError); !ok {
+					return err
+				}
+			}
+
+			cpt, err := access.GetCounterparty(tx, pubkey)
+			if err != nil {
+				return err
+			}
+			cpts = append(cpts, cpt)
+		}
+		if acct == nil {
+			return errs.New(errs.NotFound, "account not found")
+		}
+
+		err = acct.CheckOpeningTx(ev, otx, cpts)
+		if err != nil {
 			return err
 		}
 
-		cpt, err = access.GetCounterparty(tx, otx.Pubkeys[0])
+		ch, err = core.NewChannel(ev, otx, acct, cpts)
 		if err != nil {
 			return err
 		}
 
-		acct, err = access.GetAccount(tx, otx.Pubkeys[1])
+		err = access.SetChannel(tx, ch)
 		if err != nil {
 			return err
 		}
 
-		err = acct.CheckOpeningTx(ev, cpt)
+		return addEvent(tx, a.Events, core.ChannelProposed, ch, 0)
+	})
+	if err != nil {
+		return err
+	}
+
+	return nil
+}
+
+// AddProposedUpdateTx adds an UpdateTx proposed by a Counterparty. An UpdateTx
+// that we have already accepted is ignored, so that it can be sent again
+// safely. One with the SequenceNumber of an UpdateTx that the Counterparties
+// have already signed, but a different payload, is recorded as an
+// Equivocation, and ErrEquivocation is returned.
+func (a *CounterpartyAPI) AddProposedUpdateTx(ev *wire.Envelope) error {
+	return a.addUpdateTx(ev, (*core.Channel).AddProposedUpdateTx)
+}
+
+// AddFullUpdateTx adds an UpdateTx signed by every participant. It is safe to
+// send again, and is checked for Equivocations, like AddProposedUpdateTx.
+func (a *CounterpartyAPI) AddFullUpdateTx(ev *wire.Envelope) error {
+	return a.addUpdateTx(ev, (*core.Channel).AddFullUpdateTx)
+}
+
+func (a *CounterpartyAPI) addUpdateTx(ev *wire.Envelope, add func(*core.Channel, *wire.Envelope, *wire.UpdateTx) error) error {
+	equivocation := false
+	err := a.DB.Update(func(tx *bolt.Tx) error {
+		utx := &wire.UpdateTx{}
+		err := proto.Unmarshal(ev.Payload, utx)
+		if err != nil {
+			return errs.New(errs.Invalid, "envelope payload not valid")
+		}
+		ch, err := access.GetChannel(tx, utx.ChannelId)
 		if err != nil {
 			return err
 		}
+		before := seqsOf(ch)
+
+		// An UpdateTx that has been superseded by LastFullUpdateTx is too
+		// old to add, but if we accepted it before, this is a resend.
+		full := ch.LastFullUpdateTx
+		if full != nil && utx.SequenceNumber <= full.SequenceNumber && access.GetReceived(tx, ch.ChannelId, ev) {
+			return nil
+		}
 
-		ch, err := core.NewChannel(ev, otx, acct, cpt)
+		held := ch.ConflictingUpdateTx(ev, utx)
+		if held != nil {
+			equivocation = true
+			return addEquivocation(tx, a.Events, ch, utx, held, ev)
+		}
+
+		err = add(ch, ev, utx)
 		if err != nil {
 			return err
 		}
 
-		access.SetChannel(tx, ch)
+		err = access.SetChannel(tx, ch)
+		if err != nil {
+			return errors.New("database error")
+		}
+
+		err = access.SetReceived(tx, ch.ChannelId, ev)
 		if err != nil {
 			return err
 		}
 
-		return nil
+		return addUpdateEvent(tx, a.Events, before, ch)
 	})
 	if err != nil {
 		return err
 	}
+	if equivocation {
+		return core.ErrEquivocation
+	}
 
 	return nil
 }
 
-func (a *CounterpartyAPI) AddProposedUpdateTx(ev *wire.Envelope) error {
+// AddChannelRejectionTx deletes a Channel that the Counterparty has refused to
+// open. Sending it again does nothing, since the Channel is already gone.
+func (a *CounterpartyAPI) AddChannelRejectionTx(ev *wire.Envelope) error {
 	return a.DB.Update(func(tx *bolt.Tx) error {
-		utx := &wire.UpdateTx{}
-		err := proto.Unmarshal(ev.Payload, utx)
+		rtx := &wire.ChannelRejectionTx{}
+		err := proto.Unmarshal(ev.Payload, rtx)
 		if err != nil {
-			return err
+			return errs.New(errs.Invalid, "envelope payload not valid")
+		}
+		ch, err := access.GetChannel(tx, rtx.ChannelId)
+		if _, ok := err.(*access.NilError); ok {
+			return nil
 		}
-		ch, err := access.GetChannel(tx, utx.ChannelId)
 		if err != nil {
 			return err
 		}
 
-		err = ch.AddProposedUpdateTx(ev, utx)
+		err = ch.CheckChannelRejectionTx(ev, rtx)
 		if err != nil {
 			return err
 		}
 
-		access.SetChannel(tx, ch)
+		err = access.DeleteChannel(tx, ch.ChannelId)
 		if err != nil {
 			return errors.New("database error")
 		}
@@ -95,28 +206,37 @@ func (a *CounterpartyAPI) AddProposedUpdateTx(ev *wire.Envelope) error {
 	})
 }
 
-func (a *CounterpartyAPI) AddFullUpdateTx(ev *wire.Envelope) error {
+// AddUpdateRejectionTx clears MyProposedUpdateTx, which the Counterparty has
+// refused to cosign. Sending it again does nothing.
+func (a *CounterpartyAPI) AddUpdateRejectionTx(ev *wire.Envelope) error {
 	return a.DB.Update(func(tx *bolt.Tx) error {
-		utx := &wire.UpdateTx{}
-		err := proto.Unmarshal(ev.Payload, utx)
+		rtx := &wire.UpdateRejectionTx{}
+		err := proto.Unmarshal(ev.Payload, rtx)
 		if err != nil {
-			return err
+			return errs.New(errs.Invalid, "envelope payload not valid")
 		}
-		ch, err := access.GetChannel(tx, utx.ChannelId)
+		ch, err := access.GetChannel(tx, rtx.ChannelId)
 		if err != nil {
 			return err
 		}
 
-		err = ch.AddFullUpdateTx(ev, utx)
+		// After a rejection we may propose another UpdateTx with the same
+		// SequenceNumber, which the same UpdateRejectionTx rejects again.
+		mine := ch.MyProposedUpdateTx
+		if access.GetReceived(tx, ch.ChannelId, ev) && (mine == nil || mine.SequenceNumber != rtx.SequenceNumber) {
+			return nil
+		}
+
+		err = ch.AddUpdateRejectionTx(ev, rtx)
 		if err != nil {
 			return err
 		}
 
-		access.SetChannel(tx, ch)
+		err = access.SetChannel(tx, ch)
 		if err != nil {
 			return errors.New("database error")
 		}
 
-		return nil
+		return access.SetReceived(tx, ch.ChannelId, ev)
 	})
 }
@@ -0,0 +1,48 @@
+package logic
+
+import (
+	"time"
+
+	"github.com/boltdb/bolt"
+	core "github.com/jtremback/usc/core/peer"
+	"github.com/jtremback/usc/core/wire"
+	"github.com/jtremback/usc/peer/access"
+)
+
+// addEquivocation records that ev conflicts with held, an UpdateTx with the
+// same SequenceNumber that the Counterparties had already signed, and saves an
+// EquivocationDetected Event.
+func addEquivocation(tx *bolt.Tx, events *Events, ch *core.Channel, utx *wire.UpdateTx, held *wire.Envelope, ev *wire.Envelope) error {
+	err := access.AddEquivocation(tx, &core.Equivocation{
+		ChannelId:      ch.ChannelId,
+		SequenceNumber: utx.SequenceNumber,
+		Held:           held,
+		Conflicting:    ev,
+		Time:           time.Now(),
+	})
+	if err != nil {
+		return err
+	}
+
+	return addEvent(tx, events, core.EquivocationDetected, ch, utx.SequenceNumber)
+}
+
+// ViewEquivocations returns the evidence of the Counterparties of a Channel
+// signing conflicting UpdateTxs.
+func (a *CallerAPI) ViewEquivocations(channelID string) ([]*core.Equivocation, error) {
+	var eqs []*core.Equivocation
+	err := a.DB.View(func(tx *bolt.Tx) error {
+		_, err := access.GetChannel(tx, channelID)
+		if err != nil {
+			return err
+		}
+
+		eqs, err = access.GetEquivocations(tx, channelID)
+		return err
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return eqs, nil
+}
@@ -0,0 +1,132 @@
+package logic
+
+import (
+	"sync"
+	"time"
+
+	"github.com/boltdb/bolt"
+	core "github.com/jtremback/usc/core/peer"
+	"github.com/jtremback/usc/peer/access"
+)
+
+// Events wakes up whoever is waiting for new Events. The Events themselves are
+// saved in the database in the same transaction as the change they describe,
+// so none are lost, and they can be read again from any cursor with
+// CallerAPI.ViewEvents. The CallerAPI and CounterpartyAPI of a peer should
+// share one Events.
+type Events struct {
+	mut  sync.Mutex
+	wake chan struct{}
+}
+
+// Wait returns a channel which is closed once more Events have been saved.
+func (e *Events) Wait() <-chan struct{} {
+	e.mut.Lock()
+	defer e.mut.Unlock()
+
+	if e.wake == nil {
+		e.wake = make(chan struct{})
+	}
+	return e.wake
+}
+
+func (e *Events) notify() {
+	e.mut.Lock()
+	defer e.mut.Unlock()
+
+	if e.wake != nil {
+		close(e.wake)
+		e.wake = nil
+	}
+}
+
+// addEvent saves an Event about ch, and queues its webhooks. If events is not
+// nil, it is notified once tx is committed.
+func addEvent(tx *bolt.Tx, events *Events, typ core.EventType, ch *core.Channel, seq uint32) error {
+	ev := &core.Event{
+		Type:           typ,
+		ChannelId:      ch.ChannelId,
+		SequenceNumber: seq,
+		Time:           time.Now(),
+	}
+	err := access.AddEvent(tx, ev)
+	if err != nil {
+		return err
+	}
+
+	err = addWebhooks(tx, ev, ch)
+	if err != nil {
+		return err
+	}
+
+	if events != nil {
+		tx.OnCommit(events.notify)
+	}
+	return nil
+}
+
+// addPhaseEvent saves the Event for ch having moved from phase before to its
+// current phase, if it has moved.
+func addPhaseEvent(tx *bolt.Tx, events *Events, before core.Phase, ch *core.Channel) error {
+	if ch.Phase == before {
+		return nil
+	}
+
+	switch ch.Phase {
+	case core.OPEN:
+		return addEvent(tx, events, core.ChannelOpened, ch, 0)
+	case core.PENDING_CLOSED:
+		return addEvent(tx, events, core.ClosingStarted, ch, 0)
+	case core.CLOSED:
+		return addEvent(tx, events, core.ChannelClosed, ch, 0)
+	}
+	return nil
+}
+
+// updateSeqs are the SequenceNumbers of a Channel's LastFullUpdateTx and
+// TheirProposedUpdateTx, or 0 if it has none.
+type updateSeqs struct {
+	full     uint32
+	proposed uint32
+}
+
+func seqsOf(ch *core.Channel) updateSeqs {
+	seqs := updateSeqs{}
+	if ch.LastFullUpdateTx != nil {
+		seqs.full = ch.LastFullUpdateTx.SequenceNumber
+	}
+	if ch.TheirProposedUpdateTx != nil {
+		seqs.proposed = ch.TheirProposedUpdateTx.SequenceNumber
+	}
+	return seqs
+}
+
+// addUpdateEvent saves the Event for a new LastFullUpdateTx or
+// TheirProposedUpdateTx in ch since before, if there is one. Envelopes that we
+// already had do not make Events.
+func addUpdateEvent(tx *bolt.Tx, events *Events, before updateSeqs, ch *core.Channel) error {
+	after := seqsOf(ch)
+	if after.full > before.full {
+		return addEvent(tx, events, core.UpdateCosigned, ch, after.full)
+	}
+	if after.proposed != 0 && after.proposed != before.proposed {
+		return addEvent(tx, events, core.UpdateProposed, ch, after.proposed)
+	}
+	return nil
+}
+
+// ViewEvents returns up to limit Events after the given cursor. Use a cursor
+// of 0 to start from the first Event.
+func (a *CallerAPI) ViewEvents(after uint64, limit int) ([]*core.Event, error) {
+	var evs []*core.Event
+	err := a.DB.View(func(tx *bolt.Tx) error {
+		var err error
+		evs, err = access.GetEvents(tx, after, limit)
+		return err
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return evs, nil
+}
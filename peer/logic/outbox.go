@@ -0,0 +1,248 @@
+package logic
+
+import (
+	"bytes"
+	"fmt"
+	"log"
+	"time"
+
+	"github.com/boltdb/bolt"
+	core "github.com/jtremback/usc/core/peer"
+	"github.com/jtremback/usc/core/wire"
+	"github.com/jtremback/usc/peer/access"
+)
+
+// queue adds ev to the outbox, to be sent to every Counterparty in the
+// Channel with kind once tx is committed. See SendMessages.
+func queue(tx *bolt.Tx, ch *core.Channel, kind core.MessageKind, ev *wire.Envelope) error {
+	for _, cpt := range ch.Counterparties {
+		err := access.AddMessage(tx, &core.Message{
+			ChannelId:   ch.ChannelId,
+			Kind:        kind,
+			Envelope:    ev,
+			Address:     cpt.Address,
+			NextAttempt: time.Now(),
+		})
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// queueJudge adds ev to the outbox, to be sent to the Judge of the Channel
+// with kind once tx is committed.
+func queueJudge(tx *bolt.Tx, ch *core.Channel, kind core.MessageKind, ev *wire.Envelope) error {
+	return access.AddMessage(tx, &core.Message{
+		ChannelId:   ch.ChannelId,
+		Kind:        kind,
+		Envelope:    ev,
+		Address:     ch.Judge.Address,
+		NextAttempt: time.Now(),
+	})
+}
+
+// queuedJudge returns true if ev is already waiting in the outbox to be sent
+// to the Judge of the Channel with kind.
+func queuedJudge(tx *bolt.Tx, ch *core.Channel, kind core.MessageKind, ev *wire.Envelope) (bool, error) {
+	ms, err := access.GetMessages(tx)
+	if err != nil {
+		return false, err
+	}
+	for _, m := range ms {
+		if m.ChannelId == ch.ChannelId && m.Kind == kind && !m.Dead && bytes.Equal(m.Envelope.Payload, ev.Payload) {
+			return true, nil
+		}
+	}
+	return false, nil
+}
+
+func (a *CallerAPI) send(m *core.Message) error {
+	switch m.Kind {
+	case core.AddChannel:
+		return a.CounterpartyClient.AddChannel(m.Envelope, m.Address)
+	case core.AddProposedUpdateTx:
+		return a.CounterpartyClient.AddProposedUpdateTx(m.Envelope, m.Address)
+	case core.AddFullUpdateTx:
+		return a.CounterpartyClient.AddFullUpdateTx(m.Envelope, m.Address)
+	case core.AddChannelRejectionTx:
+		return a.CounterpartyClient.AddChannelRejectionTx(m.Envelope, m.Address)
+	case core.AddUpdateRejectionTx:
+		return a.CounterpartyClient.AddUpdateRejectionTx(m.Envelope, m.Address)
+	case core.JudgeAddChannel:
+		return a.JudgeClient.AddChannel(m.Envelope, m.Address)
+	case core.JudgeAddCancelTx:
+		return a.JudgeClient.AddCancelTx(m.Envelope, m.Address)
+	case core.JudgeAddFullUpdateTx:
+		return a.JudgeClient.AddFullUpdateTx(m.Envelope, m.Address)
+	case core.JudgeAddClosingTx:
+		return a.JudgeClient.AddClosingTx(m.Envelope, m.Address)
+	case core.JudgeAddPreimageTx:
+		return a.JudgeClient.AddPreimageTx(m.Envelope, m.Address)
+	}
+	return fmt.Errorf("unknown message kind %q", m.Kind)
+}
+
+// SendMessages tries to send every Message in the outbox which is due at time
+// now, or only those of one Channel if channelID is not empty. A Message that
+// fails is tried again after a backoff, and holds back the later Messages to
+// the same Address about the same Channel, so that they arrive in order. A
+// Message that is rejected, or fails too many times, is marked Dead and no
+// longer holds anything back, and is deleted once DeadMessageRetention is
+// over. It returns the errors encountered, keyed by Message Id.
+func (a *CallerAPI) SendMessages(now time.Time, channelID string) map[uint64]error {
+	a.outboxMut.Lock()
+	defer a.outboxMut.Unlock()
+	if a.sending == nil {
+		a.sending = map[string]bool{}
+	}
+
+	errs := map[uint64]error{}
+
+	var ms []*core.Message
+	err := a.DB.View(func(tx *bolt.Tx) error {
+		var err error
+		ms, err = access.GetMessages(tx)
+		return err
+	})
+	if err != nil {
+		errs[0] = err
+		return errs
+	}
+
+	held := map[string]bool{}
+	for _, m := range ms {
+		if channelID != "" && m.ChannelId != channelID {
+			continue
+		}
+
+		if m.Dead {
+			if !now.Before(m.NextAttempt) {
+				err := a.DB.Update(func(tx *bolt.Tx) error {
+					return access.DeleteMessage(tx, m.Id)
+				})
+				if err != nil {
+					errs[m.Id] = err
+				}
+			}
+			continue
+		}
+
+		to := m.ChannelId + " " + m.Address
+		if held[to] || a.sending[to] {
+			held[to] = true
+			continue
+		}
+		if now.Before(m.NextAttempt) {
+			held[to] = true
+			continue
+		}
+
+		// The Message may have been sent by another call since the outbox
+		// was read.
+		err := a.DB.View(func(tx *bolt.Tx) error {
+			var err error
+			m, err = access.GetMessage(tx, m.Id)
+			return err
+		})
+		if err != nil {
+			errs[0] = err
+			return errs
+		}
+		if m == nil {
+			continue
+		}
+
+		a.sending[to] = true
+		a.outboxMut.Unlock()
+		err = a.send(m)
+		a.outboxMut.Lock()
+		delete(a.sending, to)
+
+		if err != nil {
+			errs[m.Id] = err
+			m.Failed(err, now)
+			if m.Dead {
+				log.Printf("outbox: giving up on message %d to %s: %v", m.Id, m.Address, err)
+			} else {
+				held[to] = true
+			}
+		}
+
+		dbErr := a.DB.Update(func(tx *bolt.Tx) error {
+			if err == nil {
+				return access.DeleteMessage(tx, m.Id)
+			}
+			return access.SetMessage(tx, m)
+		})
+		if dbErr != nil {
+			errs[m.Id] = dbErr
+		}
+	}
+
+	return errs
+}
+
+// sendQueued tries to send the Messages just queued about a Channel. If they
+// cannot be sent now, they stay in the outbox for the Outbox to send, so the
+// error is not returned.
+func (a *CallerAPI) sendQueued(channelID string) {
+	for id, err := range a.SendMessages(time.Now(), channelID) {
+		log.Printf("outbox: error sending message %d: %v", id, err)
+	}
+}
+
+// ViewMessages returns the Messages about a Channel which have not been sent
+// yet, including the Dead ones. If there are none, everything has been
+// delivered.
+func (a *CallerAPI) ViewMessages(channelID string) ([]*core.Message, error) {
+	ms := []*core.Message{}
+	err := a.DB.View(func(tx *bolt.Tx) error {
+		all, err := access.GetMessages(tx)
+		if err != nil {
+			return err
+		}
+
+		for _, m := range all {
+			if m.ChannelId == channelID {
+				ms = append(ms, m)
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return ms, nil
+}
+
+// Outbox sends the Messages that could not be sent when they were queued.
+type Outbox struct {
+	Caller *CallerAPI
+	// How often the outbox is checked for Messages that are due.
+	Interval time.Duration
+}
+
+// Run calls SendMessages every Interval until stop is closed.
+func (o *Outbox) Run(stop <-chan struct{}) {
+	interval := o.Interval
+	if interval <= 0 {
+		interval = time.Second
+	}
+
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		for id, err := range o.Caller.SendMessages(time.Now(), "") {
+			log.Printf("outbox: error sending message %d: %v", id, err)
+		}
+
+		select {
+		case <-stop:
+			return
+		case <-ticker.C:
+		}
+	}
+}
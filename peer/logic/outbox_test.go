@@ -0,0 +1,219 @@
+package logic
+
+import (
+	"os"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/boltdb/bolt"
+	"github.com/jtremback/usc/core/errs"
+	core "github.com/jtremback/usc/core/peer"
+	"github.com/jtremback/usc/core/wire"
+	"github.com/jtremback/usc/peer/access"
+)
+
+// testClient is a CounterpartyClient which records the payloads it is sent,
+// and returns err. It refuses the payload reject. Sends to the address block
+// in blocking, after being signalled on blocked, until release is closed.
+type testClient struct {
+	mut      sync.Mutex
+	sent     []string
+	err      error
+	reject   string
+	blocking string
+	blocked  chan struct{}
+	release  chan struct{}
+}
+
+func (c *testClient) send(ev *wire.Envelope, address string) error {
+	if address == c.blocking {
+		c.blocked <- struct{}{}
+		<-c.release
+	}
+
+	c.mut.Lock()
+	defer c.mut.Unlock()
+	c.sent = append(c.sent, string(ev.Payload))
+	if string(ev.Payload) == c.reject {
+		return errs.New(errs.Invalid, "not an update tx")
+	}
+	return c.err
+}
+
+func (c *testClient) payloads() []string {
+	c.mut.Lock()
+	defer c.mut.Unlock()
+	return append([]string{}, c.sent...)
+}
+
+func (c *testClient) AddChannel(ev *wire.Envelope, address string) error {
+	return c.send(ev, address)
+}
+
+func (c *testClient) AddProposedUpdateTx(ev *wire.Envelope, address string) error {
+	return c.send(ev, address)
+}
+
+func (c *testClient) AddFullUpdateTx(ev *wire.Envelope, address string) error {
+	return c.send(ev, address)
+}
+
+func (c *testClient) AddChannelRejectionTx(ev *wire.Envelope, address string) error {
+	return c.send(ev, address)
+}
+
+func (c *testClient) AddUpdateRejectionTx(ev *wire.Envelope, address string) error {
+	return c.send(ev, address)
+}
+
+func outboxCaller(t *testing.T, client *testClient, ms ...*core.Message) (*CallerAPI, func()) {
+	db, err := bolt.Open("/tmp/test_outbox.db", 0600, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	err = access.MakeBuckets(db)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	err = db.Update(func(tx *bolt.Tx) error {
+		for _, m := range ms {
+			err := access.AddMessage(tx, m)
+			if err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	return &CallerAPI{DB: db, CounterpartyClient: client}, func() {
+		db.Close()
+		os.Remove("/tmp/test_outbox.db")
+	}
+}
+
+func message(chID string, address string, payload string) *core.Message {
+	return &core.Message{
+		ChannelId: chID,
+		Kind:      core.AddProposedUpdateTx,
+		Envelope:  &wire.Envelope{Payload: []byte(payload)},
+		Address:   address,
+	}
+}
+
+func viewMessages(t *testing.T, a *CallerAPI) []*core.Message {
+	var ms []*core.Message
+	err := a.DB.View(func(tx *bolt.Tx) error {
+		var err error
+		ms, err = access.GetMessages(tx)
+		return err
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	return ms
+}
+
+func TestSendMessagesWhileSending(t *testing.T) {
+	client := &testClient{
+		blocking: "slow",
+		blocked:  make(chan struct{}),
+		release:  make(chan struct{}),
+	}
+	a, teardown := outboxCaller(t, client,
+		message("channel1", "slow", "1"),
+		message("channel1", "slow", "2"),
+		message("channel2", "fast", "3"),
+	)
+	defer teardown()
+
+	done := make(chan map[uint64]error)
+	go func() {
+		done <- a.SendMessages(time.Now(), "")
+	}()
+	<-client.blocked
+
+	// The outbox is not locked while a Message is being sent, but the
+	// Messages to the same place wait for it.
+	failed := a.SendMessages(time.Now(), "")
+	if len(failed) != 0 {
+		t.Fatal(failed)
+	}
+	if sent := client.payloads(); len(sent) != 1 || sent[0] != "3" {
+		t.Fatal("only the message to another address should have been sent", sent)
+	}
+
+	close(client.release)
+	go func() {
+		<-client.blocked
+	}()
+	failed = <-done
+	if len(failed) != 0 {
+		t.Fatal(failed)
+	}
+
+	if sent := client.payloads(); len(sent) != 3 || sent[1] != "1" || sent[2] != "2" {
+		t.Fatal("every message should have been sent once, in order", sent)
+	}
+	if ms := viewMessages(t, a); len(ms) != 0 {
+		t.Fatal("outbox should be empty", ms)
+	}
+}
+
+func TestSendMessagesRejected(t *testing.T) {
+	client := &testClient{reject: "not an update tx"}
+	a, teardown := outboxCaller(t, client,
+		message("channel1", "a", "not an update tx"),
+		message("channel1", "a", "1"),
+	)
+	defer teardown()
+
+	failed := a.SendMessages(time.Now(), "")
+	if len(failed) != 1 {
+		t.Fatal("rejected message should have failed", failed)
+	}
+	if sent := client.payloads(); len(sent) != 2 || sent[1] != "1" {
+		t.Fatal("rejected message should not hold back the next one", sent)
+	}
+
+	ms := viewMessages(t, a)
+	if len(ms) != 1 || !ms[0].Dead || ms[0].Attempts != 1 {
+		t.Fatal("rejected message should be dead", ms)
+	}
+
+	failed = a.SendMessages(time.Now().Add(core.MaxMessageBackoff), "")
+	if len(failed) != 0 || len(client.payloads()) != 2 {
+		t.Fatal("dead message should not be sent again", failed)
+	}
+}
+
+func TestDeadMessagesDeleted(t *testing.T) {
+	client := &testClient{err: errs.New(errs.Invalid, "no")}
+	a, teardown := outboxCaller(t, client, message("channel1", "a", "1"))
+	defer teardown()
+
+	now := time.Now()
+	a.SendMessages(now, "")
+	ms := viewMessages(t, a)
+	if len(ms) != 1 || !ms[0].Dead {
+		t.Fatal("rejected message should be dead", ms)
+	}
+
+	a.SendMessages(now.Add(core.DeadMessageRetention-time.Second), "")
+	if len(viewMessages(t, a)) != 1 {
+		t.Fatal("dead message should be kept until the retention is over")
+	}
+
+	a.SendMessages(now.Add(core.DeadMessageRetention), "")
+	if ms := viewMessages(t, a); len(ms) != 0 {
+		t.Fatal("dead message should be deleted once the retention is over", ms)
+	}
+	if sent := client.payloads(); len(sent) != 1 {
+		t.Fatal("dead message should not be sent again", sent)
+	}
+}
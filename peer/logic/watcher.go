@@ -0,0 +1,139 @@
+package logic
+
+import (
+	"log"
+	"sync"
+	"time"
+
+	core "github.com/jtremback/usc/core/peer"
+)
+
+// Watcher is the usc daemon. It checks every channel with its judge at least
+// ChecksPerHoldPeriod times per hold period, so that if the counterparty tries
+// to close the channel with an old UpdateTx, we find out in time to send the
+// judge our LastFullUpdateTx.
+type Watcher struct {
+	Caller *CallerAPI
+
+	// How many times each channel is checked during one hold period.
+	ChecksPerHoldPeriod int64
+	// Bounds on the time between checks of a single channel.
+	MinInterval time.Duration
+	MaxInterval time.Duration
+	// How often the watcher wakes up to look for channels that are due.
+	Tick time.Duration
+
+	mut       sync.Mutex
+	nextCheck map[string]time.Time
+	failures  map[string]uint
+}
+
+// Interval returns the time between checks of a channel, derived from the
+// channel's hold period.
+func (w *Watcher) Interval(ch *core.Channel) time.Duration {
+	checks := w.ChecksPerHoldPeriod
+	if checks < 1 {
+		checks = 1
+	}
+
+	interval := time.Duration(int64(ch.OpeningTx.HoldPeriod) / checks)
+	if interval < w.MinInterval {
+		interval = w.MinInterval
+	}
+	if w.MaxInterval > 0 && interval > w.MaxInterval {
+		interval = w.MaxInterval
+	}
+
+	return interval
+}
+
+// backoff returns the time to wait before checking a channel again after it
+// has failed to be checked the given number of times in a row. It starts at
+// MinInterval and doubles with each failure, up to the channel's Interval.
+func (w *Watcher) backoff(ch *core.Channel, failures uint) time.Duration {
+	interval := w.Interval(ch)
+
+	backoff := w.MinInterval
+	if backoff <= 0 {
+		backoff = time.Second
+	}
+	for i := uint(1); i < failures && backoff < interval; i++ {
+		backoff *= 2
+	}
+	if backoff > interval {
+		backoff = interval
+	}
+
+	return backoff
+}
+
+// Check checks every channel which is due to be checked at time now. It
+// returns the errors encountered, keyed by channel id. Channels which could
+// not be checked are retried after a backoff.
+func (w *Watcher) Check(now time.Time) map[string]error {
+	w.mut.Lock()
+	defer w.mut.Unlock()
+
+	if w.nextCheck == nil {
+		w.nextCheck = map[string]time.Time{}
+	}
+	if w.failures == nil {
+		w.failures = map[string]uint{}
+	}
+
+	errs := map[string]error{}
+
+	chs, err := w.Caller.ViewChannels()
+	if err != nil {
+		errs[""] = err
+		return errs
+	}
+
+	for _, ch := range chs {
+		if ch.Phase == core.CLOSED {
+			delete(w.nextCheck, ch.ChannelId)
+			delete(w.failures, ch.ChannelId)
+			continue
+		}
+
+		if next, ok := w.nextCheck[ch.ChannelId]; ok && now.Before(next) {
+			continue
+		}
+
+		err = w.Caller.CheckChannel(ch.ChannelId)
+		if err != nil {
+			errs[ch.ChannelId] = err
+			w.failures[ch.ChannelId]++
+			w.nextCheck[ch.ChannelId] = now.Add(w.backoff(ch, w.failures[ch.ChannelId]))
+			continue
+		}
+
+		delete(w.failures, ch.ChannelId)
+		w.nextCheck[ch.ChannelId] = now.Add(w.Interval(ch))
+	}
+
+	return errs
+}
+
+// Run calls Check every Tick until stop is closed.
+func (w *Watcher) Run(stop <-chan struct{}) {
+	tick := w.Tick
+	if tick <= 0 {
+		tick = time.Second
+	}
+
+	ticker := time.NewTicker(tick)
+	defer ticker.Stop()
+
+	for {
+		for chId, err := range w.Check(time.Now()) {
+			log.Printf("watcher: error checking channel %q: %v", chId, err)
+		}
+
+		select {
+		case <-stop:
+			return
+		case <-ticker.C:
+		}
+	}
+}
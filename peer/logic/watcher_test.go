@@ -0,0 +1,58 @@
+package logic
+
+import (
+	"errors"
+	"testing"
+	"time"
+)
+
+// downJudge is a JudgeClient for a judge which can't be reached. It counts
+// the calls to GetChannel.
+type downJudge struct {
+	JudgeClient
+	calls int
+}
+
+func (j *downJudge) GetChannel(chId string, address string) ([]byte, error) {
+	j.calls++
+	return nil, errors.New("judge is down")
+}
+
+func TestWatcherBackoff(t *testing.T) {
+	judge := &downJudge{}
+	a, teardown := channelCaller(t, judge)
+	defer teardown()
+
+	w := &Watcher{
+		Caller:              a,
+		ChecksPerHoldPeriod: 4,
+		MinInterval:         time.Minute,
+	}
+
+	now := time.Now()
+	for i, tc := range []struct {
+		after time.Duration
+		calls int
+	}{
+		{0, 1},
+		{time.Second, 1},
+		{time.Minute, 2},
+		{time.Minute + time.Second, 2},
+		{3 * time.Minute, 3},
+		{6 * time.Minute, 3},
+		{7 * time.Minute, 4},
+		{14 * time.Minute, 4},
+		{15 * time.Minute, 5},
+		// The backoff stops growing at the channel's Interval
+		{29 * time.Minute, 5},
+		{30 * time.Minute, 6},
+	} {
+		errs := w.Check(now.Add(tc.after))
+		if judge.calls != tc.calls {
+			t.Fatal("check", i, "should have called the judge", tc.calls, "times, not", judge.calls)
+		}
+		if len(errs) != 0 && errs["xyz23"] == nil {
+			t.Fatal("check", i, "returned the wrong errors", errs)
+		}
+	}
+}
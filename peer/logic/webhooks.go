@@ -0,0 +1,163 @@
+package logic
+
+import (
+	"errors"
+	"log"
+	"net/http"
+	"time"
+
+	"github.com/boltdb/bolt"
+	core "github.com/jtremback/usc/core/peer"
+	"github.com/jtremback/usc/core/webhook"
+	"github.com/jtremback/usc/peer/access"
+)
+
+// addWebhooks queues a webhook about an Event for each URL of the Account of
+// ch, in the same transaction as the Event.
+func addWebhooks(tx *bolt.Tx, ev *core.Event, ch *core.Channel) error {
+	if ch.Account == nil {
+		return nil
+	}
+
+	urls, err := access.GetWebhooks(tx, ch.Account.Pubkey)
+	if err != nil {
+		return err
+	}
+
+	return access.AddDeliveries(tx, webhook.New(urls, ch.Account.Pubkey, string(ev.Type), ch.ChannelId, ev.SequenceNumber, ev.Time))
+}
+
+// SetWebhooks sets the URLs that the Events of an Account's Channels are
+// POSTed to, replacing any it had. No URLs removes them all.
+func (a *CallerAPI) SetWebhooks(pubkey []byte, urls []string) error {
+	err := webhook.CheckURLs(urls)
+	if err != nil {
+		return err
+	}
+
+	return a.DB.Update(func(tx *bolt.Tx) error {
+		_, err := access.GetAccount(tx, pubkey)
+		if err != nil {
+			return err
+		}
+
+		return access.SetWebhooks(tx, pubkey, urls)
+	})
+}
+
+func (a *CallerAPI) ViewWebhooks(pubkey []byte) ([]string, error) {
+	var urls []string
+	err := a.DB.View(func(tx *bolt.Tx) error {
+		_, err := access.GetAccount(tx, pubkey)
+		if err != nil {
+			return err
+		}
+
+		urls, err = access.GetWebhooks(tx, pubkey)
+		return err
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return urls, nil
+}
+
+// ViewDeliveries returns the webhooks that have not been delivered yet.
+func (a *CallerAPI) ViewDeliveries() ([]*webhook.Delivery, error) {
+	var ds []*webhook.Delivery
+	err := a.DB.View(func(tx *bolt.Tx) error {
+		var err error
+		ds, err = access.GetDeliveries(tx)
+		return err
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return ds, nil
+}
+
+// Webhooks POSTs the webhooks in the outbox, signed by their Accounts. A
+// webhook that fails is tried again later, with backoff, until it has been
+// tried webhook.MaxAttempts times.
+type Webhooks struct {
+	Caller *CallerAPI
+	// Client POSTs the webhooks. If it is nil, a client with a 10 second
+	// timeout is used.
+	Client *http.Client
+	// How often the outbox is checked for webhooks that are due.
+	Interval time.Duration
+}
+
+// Deliver tries every webhook which is due at time now. It returns the errors
+// encountered, keyed by Delivery Id.
+func (w *Webhooks) Deliver(now time.Time) map[uint64]error {
+	errs := map[uint64]error{}
+
+	ds, err := w.Caller.ViewDeliveries()
+	if err != nil {
+		errs[0] = err
+		return errs
+	}
+
+	client := w.Client
+	if client == nil {
+		client = &http.Client{Timeout: 10 * time.Second}
+	}
+
+	for _, d := range ds {
+		if now.Before(d.NextAttempt) {
+			continue
+		}
+
+		s := w.Caller.accountSigner()
+		if s == nil {
+			err = errors.New("no signer")
+		} else {
+			err = webhook.Post(client, s, d)
+		}
+		if err != nil {
+			errs[d.Id] = err
+		}
+
+		dbErr := w.Caller.DB.Update(func(tx *bolt.Tx) error {
+			if err == nil {
+				return access.DeleteDelivery(tx, d.Id)
+			}
+			if !d.Failed(err, now) {
+				log.Printf("webhooks: giving up on webhook %d to %s", d.Id, d.URL)
+				return access.DeleteDelivery(tx, d.Id)
+			}
+			return access.SetDelivery(tx, d)
+		})
+		if dbErr != nil {
+			errs[d.Id] = dbErr
+		}
+	}
+
+	return errs
+}
+
+// Run calls Deliver every Interval until stop is closed.
+func (w *Webhooks) Run(stop <-chan struct{}) {
+	interval := w.Interval
+	if interval <= 0 {
+		interval = time.Second
+	}
+
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		for id, err := range w.Deliver(time.Now()) {
+			log.Printf("webhooks: error delivering webhook %d: %v", id, err)
+		}
+
+		select {
+		case <-stop:
+			return
+		case <-ticker.C:
+		}
+	}
+}
@@ -1,9 +1,15 @@
 package servers
 
 import (
+	"encoding/base64"
 	"encoding/json"
+	"fmt"
 	"net/http"
+	"strconv"
+	"strings"
+	"time"
 
+	"github.com/jtremback/usc/core/errs"
 	"github.com/jtremback/usc/peer/logic"
 )
 
@@ -11,139 +17,667 @@ type CallerHTTP struct {
 	Logic *logic.CallerAPI
 }
 
+const (
+	// How many Events /events reads from the database at once
+	eventBatch = 100
+	// How often /events sends a comment when there are no Events
+	heartbeatInterval = 15 * time.Second
+)
+
 func (a *CallerHTTP) MountRoutes(mux *http.ServeMux) {
+	mux.HandleFunc("/judges", a.judges)
+	mux.HandleFunc("/add_judge", a.addJudge)
+	mux.HandleFunc("/accounts", a.accounts)
+	mux.HandleFunc("/accounts_by_id/", a.accountsById)
+	mux.HandleFunc("/new_account", a.newAccount)
+	mux.HandleFunc("/counterparties", a.counterparties)
+	mux.HandleFunc("/counterparties/pubkey/", a.counterpartiesByPubkey)
+	mux.HandleFunc("/add_counterparty", a.addCounterparty)
+	mux.HandleFunc("/channels", a.channels)
+	mux.HandleFunc("/channels_by_id/", a.channelsById)
+	mux.HandleFunc("/channel_messages/", a.channelMessages)
+	mux.HandleFunc("/channel_equivocations/", a.channelEquivocations)
+
 	mux.HandleFunc("/propose_channel", a.proposeChannel)
-	mux.HandleFunc("/confirm_channel", a.confirmChannel)
-	mux.HandleFunc("/send_update_tx", a.sendUpdateTx)
-	mux.HandleFunc("/confirm_update_tx", a.confirmUpdateTx)
+	mux.HandleFunc("/accept_channel", a.acceptChannel)
+	mux.HandleFunc("/reject_channel", a.rejectChannel)
+	mux.HandleFunc("/cancel_channel", a.cancelChannel)
+	mux.HandleFunc("/propose_update_tx", a.proposeUpdateTx)
+	mux.HandleFunc("/accept_update_tx", a.acceptUpdateTx)
+	mux.HandleFunc("/reject_update_tx", a.rejectUpdateTx)
+	mux.HandleFunc("/close_channel", a.closeChannel)
+	mux.HandleFunc("/check_channel", a.checkChannel)
+	mux.HandleFunc("/reveal_preimage", a.revealPreimage)
+	mux.HandleFunc("/renew_update_tx", a.renewUpdateTx)
+
+	mux.HandleFunc("/unlock", a.unlock)
+	mux.HandleFunc("/lock", a.lock)
+	mux.HandleFunc("/change_passphrase", a.changePassphrase)
+
+	mux.HandleFunc("/set_webhooks", a.setWebhooks)
+	mux.HandleFunc("/webhooks/", a.webhooks)
+	mux.HandleFunc("/webhook_deliveries", a.webhookDeliveries)
+
+	mux.HandleFunc("/events", a.events)
+}
+
+func (a *CallerHTTP) judges(w http.ResponseWriter, r *http.Request) {
+	jds, err := a.Logic.ViewJudges()
+	if err != nil {
+		errs.FailErr(w, err)
+		return
+	}
+
+	resp := []*Judge{}
+	for _, jd := range jds {
+		resp = append(resp, judgeToJSON(jd))
+	}
+	a.send(w, resp)
+}
+
+func (a *CallerHTTP) addJudge(w http.ResponseWriter, r *http.Request) {
+	if r.Body == nil {
+		errs.Fail(w, "no body", errs.Invalid)
+		return
+	}
+
+	req := &AddJudgeRequest{}
+	err := json.NewDecoder(r.Body).Decode(req)
+	if err != nil {
+		errs.Fail(w, "body parsing error", errs.Invalid)
+		return
+	}
+
+	pubkey, err := decodePubkey(req.Pubkey)
+	if err != nil {
+		errs.Fail(w, "pubkey is not base64url", errs.Invalid)
+		return
+	}
+
+	err = a.Logic.AddJudge(req.Name, pubkey, req.Address)
+	if err != nil {
+		errs.FailErr(w, err)
+		return
+	}
+
+	a.send(w, &Judge{
+		Name:    req.Name,
+		Pubkey:  req.Pubkey,
+		Address: req.Address,
+	})
+}
+
+func (a *CallerHTTP) accounts(w http.ResponseWriter, r *http.Request) {
+	accts, err := a.Logic.ViewAccounts()
+	if err != nil {
+		errs.FailErr(w, err)
+		return
+	}
+
+	resp := []*Account{}
+	for _, acct := range accts {
+		resp = append(resp, accountToJSON(acct))
+	}
+	a.send(w, resp)
+}
+
+func (a *CallerHTTP) accountsById(w http.ResponseWriter, r *http.Request) {
+	pubkey, err := decodePubkey(strings.TrimPrefix(r.URL.Path, "/accounts_by_id/"))
+	if err != nil {
+		errs.Fail(w, "pubkey is not base64url", errs.Invalid)
+		return
+	}
+
+	acct, err := a.Logic.ViewAccount(pubkey)
+	if err != nil {
+		errs.FailErr(w, err)
+		return
+	}
+
+	a.send(w, accountToJSON(acct))
+}
+
+func (a *CallerHTTP) newAccount(w http.ResponseWriter, r *http.Request) {
+	if r.Body == nil {
+		errs.Fail(w, "no body", errs.Invalid)
+		return
+	}
+
+	req := &NewAccountRequest{}
+	err := json.NewDecoder(r.Body).Decode(req)
+	if err != nil {
+		errs.Fail(w, "body parsing error", errs.Invalid)
+		return
+	}
+
+	judgePubkey, err := decodePubkey(req.JudgePubkey)
+	if err != nil {
+		errs.Fail(w, "judgePubkey is not base64url", errs.Invalid)
+		return
+	}
+
+	acct, err := a.Logic.NewAccount(req.Name, judgePubkey)
+	if err != nil {
+		errs.FailErr(w, err)
+		return
+	}
+
+	a.send(w, accountToJSON(acct))
+}
+
+func (a *CallerHTTP) counterparties(w http.ResponseWriter, r *http.Request) {
+	cpts, err := a.Logic.ViewCounterparties()
+	if err != nil {
+		errs.FailErr(w, err)
+		return
+	}
+
+	resp := []*Counterparty{}
+	for _, cpt := range cpts {
+		resp = append(resp, counterpartyToJSON(cpt))
+	}
+	a.send(w, resp)
+}
+
+func (a *CallerHTTP) counterpartiesByPubkey(w http.ResponseWriter, r *http.Request) {
+	pubkey, err := decodePubkey(strings.TrimPrefix(r.URL.Path, "/counterparties/pubkey/"))
+	if err != nil {
+		errs.Fail(w, "pubkey is not base64url", errs.Invalid)
+		return
+	}
+
+	cpt, err := a.Logic.ViewCounterparty(pubkey)
+	if err != nil {
+		errs.FailErr(w, err)
+		return
+	}
+
+	a.send(w, counterpartyToJSON(cpt))
+}
+
+func (a *CallerHTTP) addCounterparty(w http.ResponseWriter, r *http.Request) {
+	if r.Body == nil {
+		errs.Fail(w, "no body", errs.Invalid)
+		return
+	}
+
+	req := &AddCounterpartyRequest{}
+	err := json.NewDecoder(r.Body).Decode(req)
+	if err != nil {
+		errs.Fail(w, "body parsing error", errs.Invalid)
+		return
+	}
+
+	judgePubkey, err := decodePubkey(req.JudgePubkey)
+	if err != nil {
+		errs.Fail(w, "judgePubkey is not base64url", errs.Invalid)
+		return
+	}
+
+	pubkey, err := decodePubkey(req.Pubkey)
+	if err != nil {
+		errs.Fail(w, "pubkey is not base64url", errs.Invalid)
+		return
+	}
+
+	err = a.Logic.AddCounterparty(req.Name, judgePubkey, pubkey, req.Address)
+	if err != nil {
+		errs.FailErr(w, err)
+		return
+	}
+
+	cpt, err := a.Logic.ViewCounterparty(pubkey)
+	if err != nil {
+		errs.FailErr(w, err)
+		return
+	}
+
+	a.send(w, counterpartyToJSON(cpt))
+}
+
+func (a *CallerHTTP) channels(w http.ResponseWriter, r *http.Request) {
+	chs, err := a.Logic.ViewChannels()
+	if err != nil {
+		errs.FailErr(w, err)
+		return
+	}
+
+	resp := []*Channel{}
+	for _, ch := range chs {
+		resp = append(resp, channelToJSON(ch))
+	}
+	a.send(w, resp)
+}
+
+func (a *CallerHTTP) channelsById(w http.ResponseWriter, r *http.Request) {
+	a.sendChannel(w, strings.TrimPrefix(r.URL.Path, "/channels_by_id/"))
+}
+
+// channelMessages returns the messages about a channel which have not been
+// delivered yet, so an empty list means that everything has been delivered.
+func (a *CallerHTTP) channelMessages(w http.ResponseWriter, r *http.Request) {
+	ms, err := a.Logic.ViewMessages(strings.TrimPrefix(r.URL.Path, "/channel_messages/"))
+	if err != nil {
+		errs.FailErr(w, err)
+		return
+	}
+
+	resp := []*Message{}
+	for _, m := range ms {
+		resp = append(resp, messageToJSON(m))
+	}
+	a.send(w, resp)
+}
+
+// channelEquivocations sends the evidence of the counterparties of a channel
+// signing conflicting update txs.
+func (a *CallerHTTP) channelEquivocations(w http.ResponseWriter, r *http.Request) {
+	eqs, err := a.Logic.ViewEquivocations(strings.TrimPrefix(r.URL.Path, "/channel_equivocations/"))
+	if err != nil {
+		errs.FailErr(w, err)
+		return
+	}
+
+	resp := []*Equivocation{}
+	for _, eq := range eqs {
+		resp = append(resp, equivocationToJSON(eq))
+	}
+	a.send(w, resp)
 }
 
 func (a *CallerHTTP) proposeChannel(w http.ResponseWriter, r *http.Request) {
 	if r.Body == nil {
-		a.fail(w, "no body", 500)
+		errs.Fail(w, "no body", errs.Invalid)
 		return
 	}
 
-	req := &struct {
-		ChannelId          string
-		State              []byte
-		AccountPubkey      []byte
-		CounterpartyPubkey []byte
-		HoldPeriod         uint32
-	}{}
+	req := &ProposeChannelRequest{}
 	err := json.NewDecoder(r.Body).Decode(req)
 	if err != nil {
-		a.fail(w, "body parsing error", 500)
+		errs.Fail(w, "body parsing error", errs.Invalid)
+		return
 	}
 
-	_, err = a.Logic.ProposeChannel(req.ChannelId, req.State, req.AccountPubkey, req.CounterpartyPubkey, req.HoldPeriod)
+	acctPubkey, err := decodePubkey(req.AccountPubkey)
 	if err != nil {
-		a.fail(w, err.Error(), 500)
+		errs.Fail(w, "accountPubkey is not base64url", errs.Invalid)
+		return
+	}
+
+	encoded := req.CounterpartyPubkeys
+	if req.CounterpartyPubkey != "" {
+		encoded = append(encoded, req.CounterpartyPubkey)
+	}
+	cptPubkeys := [][]byte{}
+	for _, s := range encoded {
+		pubkey, err := decodePubkey(s)
+		if err != nil {
+			errs.Fail(w, "counterpartyPubkey is not base64url", errs.Invalid)
+			return
+		}
+		cptPubkeys = append(cptPubkeys, pubkey)
 	}
+
+	ch, err := a.Logic.ProposeChannel(req.ChannelId, []byte(req.State), acctPubkey, cptPubkeys, req.HoldPeriod)
+	if err != nil {
+		errs.FailErr(w, err)
+		return
+	}
+
+	a.send(w, channelToJSON(ch))
 }
 
-func (a *CallerHTTP) getChannel(w http.ResponseWriter, r *http.Request) {
+// channelRequest decodes a ChannelRequest and calls fn with its ChannelId. If
+// fn succeeds, the channel is sent back.
+func (a *CallerHTTP) channelRequest(w http.ResponseWriter, r *http.Request, fn func(string) error) {
 	if r.Body == nil {
-		a.fail(w, "no body", 500)
+		errs.Fail(w, "no body", errs.Invalid)
 		return
 	}
 
-	req := &struct {
-		ChannelId string
-	}{}
+	req := &ChannelRequest{}
 	err := json.NewDecoder(r.Body).Decode(req)
 	if err != nil {
-		a.fail(w, "body parsing error", 500)
+		errs.Fail(w, "body parsing error", errs.Invalid)
+		return
 	}
 
-	err = a.Logic.CheckChannel(req.ChannelId)
+	err = fn(req.ChannelId)
 	if err != nil {
-		a.fail(w, err.Error(), 500)
+		errs.FailErr(w, err)
+		return
 	}
+
+	a.sendChannel(w, req.ChannelId)
+}
+
+func (a *CallerHTTP) acceptChannel(w http.ResponseWriter, r *http.Request) {
+	a.channelRequest(w, r, a.Logic.AcceptChannel)
 }
 
-func (a *CallerHTTP) confirmChannel(w http.ResponseWriter, r *http.Request) {
+func (a *CallerHTTP) rejectChannel(w http.ResponseWriter, r *http.Request) {
 	if r.Body == nil {
-		a.fail(w, "no body", 500)
+		errs.Fail(w, "no body", errs.Invalid)
 		return
 	}
 
-	req := &struct {
-		ChannelId string
-	}{}
+	req := &ChannelRequest{}
 	err := json.NewDecoder(r.Body).Decode(req)
 	if err != nil {
-		a.fail(w, "body parsing error", 500)
+		errs.Fail(w, "body parsing error", errs.Invalid)
+		return
 	}
 
-	err = a.Logic.ConfirmChannel(req.ChannelId)
+	// The channel is deleted, so there is nothing to send back
+	err = a.Logic.RejectChannel(req.ChannelId)
 	if err != nil {
-		a.fail(w, err.Error(), 500)
+		errs.FailErr(w, err)
+		return
 	}
 }
 
-func (a *CallerHTTP) sendUpdateTx(w http.ResponseWriter, r *http.Request) {
+func (a *CallerHTTP) cancelChannel(w http.ResponseWriter, r *http.Request) {
+	a.channelRequest(w, r, a.Logic.CancelChannel)
+}
+
+func (a *CallerHTTP) proposeUpdateTx(w http.ResponseWriter, r *http.Request) {
+	if r.Body == nil {
+		errs.Fail(w, "no body", errs.Invalid)
+		return
+	}
+
+	req := &ProposeUpdateTxRequest{}
+	err := json.NewDecoder(r.Body).Decode(req)
+	if err != nil {
+		errs.Fail(w, "body parsing error", errs.Invalid)
+		return
+	}
+
+	opts := &logic.UpdateTxOptions{State: []byte(req.State), Fast: req.Fast}
+	if len(req.HashLocks) > 0 {
+		opts.HashLocks, err = hashLocksFromJSON(req.HashLocks)
+		if err != nil {
+			errs.Fail(w, "hash is not base64url", errs.Invalid)
+			return
+		}
+	}
+	if req.Expiry != nil {
+		opts.Expiry = *req.Expiry
+	}
+
+	err = a.Logic.ProposeUpdateTx(req.ChannelId, opts)
+	if err != nil {
+		errs.FailErr(w, err)
+		return
+	}
+
+	a.sendChannel(w, req.ChannelId)
+}
+
+func (a *CallerHTTP) acceptUpdateTx(w http.ResponseWriter, r *http.Request) {
+	a.channelRequest(w, r, a.Logic.CosignProposedUpdateTx)
+}
+
+func (a *CallerHTTP) rejectUpdateTx(w http.ResponseWriter, r *http.Request) {
+	a.channelRequest(w, r, a.Logic.RejectUpdateTx)
+}
+
+func (a *CallerHTTP) closeChannel(w http.ResponseWriter, r *http.Request) {
+	a.channelRequest(w, r, a.Logic.CloseChannel)
+}
+
+func (a *CallerHTTP) checkChannel(w http.ResponseWriter, r *http.Request) {
+	a.channelRequest(w, r, a.Logic.CheckChannel)
+}
+
+func (a *CallerHTTP) revealPreimage(w http.ResponseWriter, r *http.Request) {
 	if r.Body == nil {
-		a.fail(w, "no body", 500)
+		errs.Fail(w, "no body", errs.Invalid)
 		return
 	}
 
-	req := &struct {
-		State     []byte
-		ChannelId string
-		Fast      bool
-	}{}
+	req := &RevealPreimageRequest{}
 	err := json.NewDecoder(r.Body).Decode(req)
 	if err != nil {
-		a.fail(w, "body parsing error", 500)
+		errs.Fail(w, "body parsing error", errs.Invalid)
+		return
+	}
+
+	preimage, err := base64.URLEncoding.DecodeString(req.Preimage)
+	if err != nil {
+		errs.Fail(w, "preimage is not base64url", errs.Invalid)
+		return
 	}
 
-	err = a.Logic.NewUpdateTx(req.State, req.ChannelId, req.Fast)
+	err = a.Logic.RevealPreimage(req.ChannelId, preimage)
 	if err != nil {
-		a.fail(w, err.Error(), 500)
+		errs.FailErr(w, err)
+		return
 	}
+
+	a.sendChannel(w, req.ChannelId)
 }
 
-func (a *CallerHTTP) confirmUpdateTx(w http.ResponseWriter, r *http.Request) {
+func (a *CallerHTTP) renewUpdateTx(w http.ResponseWriter, r *http.Request) {
 	if r.Body == nil {
-		a.fail(w, "no body", 500)
+		errs.Fail(w, "no body", errs.Invalid)
 		return
 	}
 
-	req := &struct {
-		ChannelId string
-	}{}
+	req := &RenewUpdateTxRequest{}
 	err := json.NewDecoder(r.Body).Decode(req)
 	if err != nil {
-		a.fail(w, "body parsing error", 500)
+		errs.Fail(w, "body parsing error", errs.Invalid)
+		return
 	}
 
-	err = a.Logic.ConfirmUpdateTx(req.ChannelId)
+	err = a.Logic.RenewUpdateTx(req.ChannelId, req.Expiry)
 	if err != nil {
-		a.fail(w, err.Error(), 500)
+		errs.FailErr(w, err)
+		return
 	}
+
+	a.sendChannel(w, req.ChannelId)
 }
 
-func (a *CallerHTTP) fail(w http.ResponseWriter, msg string, status int) {
-	w.Header().Set("Content-Type", "application/json")
+func (a *CallerHTTP) unlock(w http.ResponseWriter, r *http.Request) {
+	if r.Body == nil {
+		errs.Fail(w, "no body", errs.Invalid)
+		return
+	}
 
-	data := struct {
-		Error string
-	}{Error: msg}
+	req := &UnlockRequest{}
+	err := json.NewDecoder(r.Body).Decode(req)
+	if err != nil {
+		errs.Fail(w, "body parsing error", errs.Invalid)
+		return
+	}
 
-	resp, _ := json.Marshal(data)
-	w.WriteHeader(status)
-	w.Write(resp)
+	err = a.Logic.Unlock(req.Passphrase)
+	if err != nil {
+		errs.FailErr(w, err)
+		return
+	}
 }
 
-func (a *CallerHTTP) send(w http.ResponseWriter, data interface{}) {
-	w.Header().Set("Content-Type", "application/json")
+func (a *CallerHTTP) lock(w http.ResponseWriter, r *http.Request) {
+	a.Logic.Lock()
+}
+
+func (a *CallerHTTP) changePassphrase(w http.ResponseWriter, r *http.Request) {
+	if r.Body == nil {
+		errs.Fail(w, "no body", errs.Invalid)
+		return
+	}
 
+	req := &ChangePassphraseRequest{}
+	err := json.NewDecoder(r.Body).Decode(req)
+	if err != nil {
+		errs.Fail(w, "body parsing error", errs.Invalid)
+		return
+	}
+
+	err = a.Logic.ChangePassphrase(req.OldPassphrase, req.NewPassphrase)
+	if err != nil {
+		errs.FailErr(w, err)
+		return
+	}
+}
+
+// events streams the peer's Events as server-sent events, starting after the
+// cursor in the Last-Event-ID header or the cursor query parameter, so that a
+// client which reconnects gets every Event it missed. The id of each event is
+// its cursor, and a comment is sent every heartbeat to keep the connection
+// open.
+func (a *CallerHTTP) events(w http.ResponseWriter, r *http.Request) {
+	cursor := r.Header.Get("Last-Event-ID")
+	if cursor == "" {
+		cursor = r.URL.Query().Get("cursor")
+	}
+	var after uint64
+	if cursor != "" {
+		var err error
+		after, err = strconv.ParseUint(cursor, 10, 64)
+		if err != nil {
+			errs.Fail(w, "cursor is not a number", errs.Invalid)
+			return
+		}
+	}
+
+	flusher, ok := w.(http.Flusher)
+	if !ok {
+		errs.Fail(w, "streaming not supported", errs.Internal)
+		return
+	}
+
+	w.Header().Set("Content-Type", "text/event-stream")
+	w.Header().Set("Cache-Control", "no-cache")
+	w.WriteHeader(http.StatusOK)
+	flusher.Flush()
+
+	heartbeat := time.NewTicker(heartbeatInterval)
+	defer heartbeat.Stop()
+
+	for {
+		// Wait must be called before the Events are read, or an Event
+		// saved in between would not wake us up.
+		var (
+			wake <-chan struct{}
+			poll <-chan time.Time
+		)
+		if a.Logic.Events != nil {
+			wake = a.Logic.Events.Wait()
+		} else {
+			poll = time.After(time.Second)
+		}
+
+		evs, err := a.Logic.ViewEvents(after, eventBatch)
+		if err != nil {
+			return
+		}
+		for _, ev := range evs {
+			data, err := json.Marshal(eventToJSON(ev))
+			if err != nil {
+				return
+			}
+			fmt.Fprintf(w, "id: %d\nevent: %s\ndata: %s\n\n", ev.Cursor, ev.Type, data)
+			after = ev.Cursor
+		}
+		flusher.Flush()
+		if len(evs) == eventBatch {
+			continue
+		}
+
+		select {
+		case <-r.Context().Done():
+			return
+		case <-heartbeat.C:
+			fmt.Fprint(w, ": heartbeat\n\n")
+		case <-wake:
+		case <-poll:
+		}
+	}
+}
+
+func (a *CallerHTTP) setWebhooks(w http.ResponseWriter, r *http.Request) {
+	if r.Body == nil {
+		errs.Fail(w, "no body", errs.Invalid)
+		return
+	}
+
+	req := &Webhooks{}
+	err := json.NewDecoder(r.Body).Decode(req)
+	if err != nil {
+		errs.Fail(w, "body parsing error", errs.Invalid)
+		return
+	}
+
+	pubkey, err := decodePubkey(req.Pubkey)
+	if err != nil {
+		errs.Fail(w, "pubkey is not base64url", errs.Invalid)
+		return
+	}
+
+	err = a.Logic.SetWebhooks(pubkey, req.URLs)
+	if err != nil {
+		errs.FailErr(w, err)
+		return
+	}
+
+	a.sendWebhooks(w, pubkey)
+}
+
+func (a *CallerHTTP) webhooks(w http.ResponseWriter, r *http.Request) {
+	pubkey, err := decodePubkey(strings.TrimPrefix(r.URL.Path, "/webhooks/"))
+	if err != nil {
+		errs.Fail(w, "pubkey is not base64url", errs.Invalid)
+		return
+	}
+
+	a.sendWebhooks(w, pubkey)
+}
+
+func (a *CallerHTTP) sendWebhooks(w http.ResponseWriter, pubkey []byte) {
+	urls, err := a.Logic.ViewWebhooks(pubkey)
+	if err != nil {
+		errs.FailErr(w, err)
+		return
+	}
+
+	a.send(w, &Webhooks{Pubkey: encodePubkey(pubkey), URLs: urls})
+}
+
+func (a *CallerHTTP) webhookDeliveries(w http.ResponseWriter, r *http.Request) {
+	ds, err := a.Logic.ViewDeliveries()
+	if err != nil {
+		errs.FailErr(w, err)
+		return
+	}
+
+	resp := []*Delivery{}
+	for _, d := range ds {
+		resp = append(resp, deliveryToJSON(d))
+	}
+	a.send(w, resp)
+}
+
+func (a *CallerHTTP) sendChannel(w http.ResponseWriter, channelID string) {
+	ch, err := a.Logic.ViewChannel(channelID)
+	if err != nil {
+		errs.FailErr(w, err)
+		return
+	}
+
+	a.send(w, channelToJSON(ch))
+}
+
+func (a *CallerHTTP) send(w http.ResponseWriter, data interface{}) {
 	resp, err := json.Marshal(data)
 	if err != nil {
-		w.WriteHeader(http.StatusInternalServerError)
-		a.fail(w, "oops something evil has happened", 500)
+		errs.Fail(w, "oops something evil has happened", errs.Internal)
 		return
 	}
+
+	w.Header().Set("Content-Type", "application/json")
 	w.Write(resp)
 }
@@ -6,6 +6,7 @@ import (
 	"net/http"
 
 	"github.com/golang/protobuf/proto"
+	"github.com/jtremback/usc/core/errs"
 	"github.com/jtremback/usc/core/wire"
 	"github.com/jtremback/usc/peer/logic"
 )
@@ -16,70 +17,154 @@ type CounterpartyHTTP struct {
 
 func (a *CounterpartyHTTP) MountRoutes(mux *http.ServeMux) {
 	mux.HandleFunc("/add_channel", a.addChannel)
+	mux.HandleFunc("/add_proposed_update_tx", a.addProposedUpdateTx)
+	mux.HandleFunc("/add_full_update_tx", a.addFullUpdateTx)
+	mux.HandleFunc("/add_channel_rejection_tx", a.addChannelRejectionTx)
+	mux.HandleFunc("/add_update_rejection_tx", a.addUpdateRejectionTx)
 }
 
 func (a *CounterpartyHTTP) addChannel(w http.ResponseWriter, r *http.Request) {
 	if r.Body == nil {
-		a.fail(w, "no body", 500)
+		errs.Fail(w, "no body", errs.Invalid)
 		return
 	}
 
 	b, err := ioutil.ReadAll(r.Body)
 	if err != nil {
-		a.fail(w, "server error", 500)
+		errs.Fail(w, "server error", errs.Internal)
+		return
 	}
 
 	ev := &wire.Envelope{}
-	proto.Unmarshal(b, ev)
+	err = proto.Unmarshal(b, ev)
+	if err != nil {
+		errs.Fail(w, "envelope parsing error", errs.Invalid)
+		return
+	}
 
 	err = a.Logic.AddChannel(ev)
 	if err != nil {
-		a.fail(w, "server error", 500)
+		errs.FailErr(w, err)
+		return
 	}
 	a.send(w, "ok")
 }
 
 func (a *CounterpartyHTTP) addProposedUpdateTx(w http.ResponseWriter, r *http.Request) {
 	if r.Body == nil {
-		a.fail(w, "no body", 500)
+		errs.Fail(w, "no body", errs.Invalid)
 		return
 	}
 
 	b, err := ioutil.ReadAll(r.Body)
 	if err != nil {
-		a.fail(w, "server error", 500)
+		errs.Fail(w, "server error", errs.Internal)
+		return
 	}
 
 	ev := &wire.Envelope{}
-	proto.Unmarshal(b, ev)
+	err = proto.Unmarshal(b, ev)
+	if err != nil {
+		errs.Fail(w, "envelope parsing error", errs.Invalid)
+		return
+	}
 
 	err = a.Logic.AddProposedUpdateTx(ev)
 	if err != nil {
-		a.fail(w, "server error", 500)
+		errs.FailErr(w, err)
+		return
 	}
 	a.send(w, "ok")
 }
 
-func (a *CounterpartyHTTP) fail(w http.ResponseWriter, msg string, status int) {
-	w.Header().Set("Content-Type", "application/json")
+func (a *CounterpartyHTTP) addFullUpdateTx(w http.ResponseWriter, r *http.Request) {
+	if r.Body == nil {
+		errs.Fail(w, "no body", errs.Invalid)
+		return
+	}
+
+	b, err := ioutil.ReadAll(r.Body)
+	if err != nil {
+		errs.Fail(w, "server error", errs.Internal)
+		return
+	}
 
-	data := struct {
-		Error string
-	}{Error: msg}
+	ev := &wire.Envelope{}
+	err = proto.Unmarshal(b, ev)
+	if err != nil {
+		errs.Fail(w, "envelope parsing error", errs.Invalid)
+		return
+	}
 
-	resp, _ := json.Marshal(data)
-	w.WriteHeader(status)
-	w.Write(resp)
+	err = a.Logic.AddFullUpdateTx(ev)
+	if err != nil {
+		errs.FailErr(w, err)
+		return
+	}
+	a.send(w, "ok")
 }
 
-func (a *CounterpartyHTTP) send(w http.ResponseWriter, data interface{}) {
-	w.Header().Set("Content-Type", "application/json")
+func (a *CounterpartyHTTP) addChannelRejectionTx(w http.ResponseWriter, r *http.Request) {
+	if r.Body == nil {
+		errs.Fail(w, "no body", errs.Invalid)
+		return
+	}
+
+	b, err := ioutil.ReadAll(r.Body)
+	if err != nil {
+		errs.Fail(w, "server error", errs.Internal)
+		return
+	}
+
+	ev := &wire.Envelope{}
+	err = proto.Unmarshal(b, ev)
+	if err != nil {
+		errs.Fail(w, "envelope parsing error", errs.Invalid)
+		return
+	}
+
+	err = a.Logic.AddChannelRejectionTx(ev)
+	if err != nil {
+		errs.FailErr(w, err)
+		return
+	}
+	a.send(w, "ok")
+}
+
+func (a *CounterpartyHTTP) addUpdateRejectionTx(w http.ResponseWriter, r *http.Request) {
+	if r.Body == nil {
+		errs.Fail(w, "no body", errs.Invalid)
+		return
+	}
+
+	b, err := ioutil.ReadAll(r.Body)
+	if err != nil {
+		errs.Fail(w, "server error", errs.Internal)
+		return
+	}
+
+	ev := &wire.Envelope{}
+	err = proto.Unmarshal(b, ev)
+	if err != nil {
+		errs.Fail(w, "envelope parsing error", errs.Invalid)
+		return
+	}
 
+	err = a.Logic.AddUpdateRejectionTx(ev)
+	if err != nil {
+		errs.FailErr(w, err)
+		return
+	}
+	a.send(w, "ok")
+}
+
+func (a *CounterpartyHTTP) send(w http.ResponseWriter, data interface{}) {
 	resp, err := json.Marshal(data)
 	if err != nil {
-		w.WriteHeader(http.StatusInternalServerError)
-		a.fail(w, "oops something evil has happened", 500)
+		errs.Fail(w, "oops something evil has happened", errs.Internal)
 		return
 	}
+
+	w.Header().Set("Content-Type", "application/json")
 	w.Write(resp)
 }
@@ -0,0 +1,39 @@
+package servers
+
+import (
+	"github.com/jtremback/usc/core/errs"
+	"github.com/jtremback/usc/core/wire"
+	"github.com/jtremback/usc/peer/logic"
+	"golang.org/x/net/context"
+	"google.golang.org/grpc"
+)
+
+// CounterpartyGRPC is the gRPC equivalent of CounterpartyHTTP. It implements
+// wire.CounterpartyServer.
+type CounterpartyGRPC struct {
+	Logic *logic.CounterpartyAPI
+}
+
+func (a *CounterpartyGRPC) Register(s *grpc.Server) {
+	wire.RegisterCounterpartyServer(s, a)
+}
+
+func (a *CounterpartyGRPC) AddChannel(ctx context.Context, ev *wire.Envelope) (*wire.Empty, error) {
+	return &wire.Empty{}, errs.ToGRPC(a.Logic.AddChannel(ev))
+}
+
+func (a *CounterpartyGRPC) AddProposedUpdateTx(ctx context.Context, ev *wire.Envelope) (*wire.Empty, error) {
+	return &wire.Empty{}, errs.ToGRPC(a.Logic.AddProposedUpdateTx(ev))
+}
+
+func (a *CounterpartyGRPC) AddFullUpdateTx(ctx context.Context, ev *wire.Envelope) (*wire.Empty, error) {
+	return &wire.Empty{}, errs.ToGRPC(a.Logic.AddFullUpdateTx(ev))
+}
+
+func (a *CounterpartyGRPC) AddChannelRejectionTx(ctx context.Context, ev *wire.Envelope) (*wire.Empty, error) {
+	return &wire.Empty{}, errs.ToGRPC(a.Logic.AddChannelRejectionTx(ev))
+}
+
+func (a *CounterpartyGRPC) AddUpdateRejectionTx(ctx context.Context, ev *wire.Envelope) (*wire.Empty, error) {
+	return &wire.Empty{}, errs.ToGRPC(a.Logic.AddUpdateRejectionTx(ev))
+}
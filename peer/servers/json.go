@@ -0,0 +1,409 @@
+package servers
+
+import (
+	"encoding/base64"
+	"time"
+
+	"github.com/golang/protobuf/proto"
+	core "github.com/jtremback/usc/core/peer"
+	"github.com/jtremback/usc/core/webhook"
+	"github.com/jtremback/usc/core/wire"
+)
+
+// These are the JSON representations of the caller API's requests and
+// responses. Pubkeys, hashes and preimages are base64url encoded, and states
+// are strings.
+
+type Judge struct {
+	Name    string `json:"name"`
+	Pubkey  string `json:"pubkey"`
+	Address string `json:"address"`
+}
+
+type Account struct {
+	Name   string `json:"name"`
+	Pubkey string `json:"pubkey"`
+	Judge  *Judge `json:"judge"`
+}
+
+type Counterparty struct {
+	Name    string `json:"name"`
+	Pubkey  string `json:"pubkey"`
+	Address string `json:"address"`
+	Judge   *Judge `json:"judge"`
+}
+
+type OpeningTx struct {
+	ChannelId  string   `json:"channelId"`
+	Pubkeys    []string `json:"pubkeys"`
+	State      string   `json:"state"`
+	HoldPeriod uint64   `json:"holdPeriod"`
+}
+
+type HashLock struct {
+	Hash   string     `json:"hash"`
+	Expiry *time.Time `json:"expiry,omitempty"`
+	State  string     `json:"state"`
+}
+
+type UpdateTx struct {
+	ChannelId      string      `json:"channelId"`
+	SequenceNumber uint32      `json:"sequenceNumber"`
+	Fast           bool        `json:"fast"`
+	State          string      `json:"state"`
+	HashLocks      []*HashLock `json:"hashLocks,omitempty"`
+	Expiry         *time.Time  `json:"expiry,omitempty"`
+}
+
+type FollowOnTx struct {
+	ChannelId string `json:"channelId"`
+	State     string `json:"state"`
+}
+
+type Channel struct {
+	ChannelId string `json:"channelId"`
+	Phase     string `json:"phase"`
+
+	OpeningTx             *OpeningTx    `json:"openingTx"`
+	LastFullUpdateTx      *UpdateTx     `json:"lastFullUpdateTx"`
+	MyProposedUpdateTx    *UpdateTx     `json:"myProposedUpdateTx"`
+	TheirProposedUpdateTx *UpdateTx     `json:"theirProposedUpdateTx"`
+	FinalUpdateTx         *UpdateTx     `json:"finalUpdateTx,omitempty"`
+	FollowOnTxs           []*FollowOnTx `json:"followOnTxs"`
+
+	Judge          *Judge          `json:"judge"`
+	Account        *Account        `json:"account"`
+	Counterparties []*Counterparty `json:"counterparties"`
+}
+
+type AddJudgeRequest struct {
+	Name    string `json:"name"`
+	Pubkey  string `json:"pubkey"`
+	Address string `json:"address"`
+}
+
+// NewAccountRequest makes an Account with a new key, which is kept in the
+// peer's keystore or signer.
+type NewAccountRequest struct {
+	Name        string `json:"name"`
+	JudgePubkey string `json:"judgePubkey"`
+}
+
+type AddCounterpartyRequest struct {
+	Name        string `json:"name"`
+	JudgePubkey string `json:"judgePubkey"`
+	Pubkey      string `json:"pubkey"`
+	Address     string `json:"address"`
+}
+
+// Event is sent by /events, as the data of a server-sent event.
+type Event struct {
+	Cursor         uint64    `json:"cursor"`
+	Type           string    `json:"type"`
+	ChannelId      string    `json:"channelId"`
+	SequenceNumber uint32    `json:"sequenceNumber,omitempty"`
+	Time           time.Time `json:"time"`
+}
+
+// Webhooks are the URLs that the webhooks of the account with Pubkey are POSTed
+// to. It is both the request and the response of /set_webhooks.
+type Webhooks struct {
+	Pubkey string   `json:"pubkey"`
+	URLs   []string `json:"urls"`
+}
+
+// Delivery is a webhook that has not been delivered yet.
+type Delivery struct {
+	Id          uint64           `json:"id"`
+	URL         string           `json:"url"`
+	Payload     *webhook.Payload `json:"payload"`
+	Attempts    int              `json:"attempts"`
+	NextAttempt time.Time        `json:"nextAttempt"`
+	LastError   string           `json:"lastError,omitempty"`
+}
+
+// Message is an envelope that has not been delivered to a counterparty or
+// judge yet. It is returned by /channel_messages. A dead message was rejected,
+// or failed too many times, and will not be sent again.
+type Message struct {
+	Id          uint64    `json:"id"`
+	Kind        string    `json:"kind"`
+	Address     string    `json:"address"`
+	Attempts    int       `json:"attempts"`
+	NextAttempt time.Time `json:"nextAttempt"`
+	LastError   string    `json:"lastError,omitempty"`
+	Dead        bool      `json:"dead,omitempty"`
+}
+
+// Envelope is a signed payload, kept as evidence. The payload and the
+// signatures are base64url encoded.
+type Envelope struct {
+	Payload    string   `json:"payload"`
+	Signatures []string `json:"signatures"`
+}
+
+// Equivocation is evidence that the counterparties of a channel signed two
+// different update txs with the same sequence number. Held is the one the peer
+// had, and Conflicting is the one it was sent after it.
+type Equivocation struct {
+	Id                  uint64    `json:"id"`
+	SequenceNumber      uint32    `json:"sequenceNumber"`
+	Held                *UpdateTx `json:"held"`
+	Conflicting         *UpdateTx `json:"conflicting"`
+	HeldEnvelope        *Envelope `json:"heldEnvelope"`
+	ConflictingEnvelope *Envelope `json:"conflictingEnvelope"`
+	Time                time.Time `json:"time"`
+}
+
+type ProposeChannelRequest struct {
+	ChannelId     string `json:"channelId"`
+	AccountPubkey string `json:"accountPubkey"`
+	// For a channel with one counterparty
+	CounterpartyPubkey string `json:"counterpartyPubkey,omitempty"`
+	// For a channel with several counterparties
+	CounterpartyPubkeys []string `json:"counterpartyPubkeys,omitempty"`
+	State               string   `json:"state"`
+	HoldPeriod          uint64   `json:"holdPeriod"`
+}
+
+type ChannelRequest struct {
+	ChannelId string `json:"channelId"`
+}
+
+type ProposeUpdateTxRequest struct {
+	ChannelId string      `json:"channelId"`
+	State     string      `json:"state"`
+	Fast      bool        `json:"fast"`
+	HashLocks []*HashLock `json:"hashLocks,omitempty"`
+	Expiry    *time.Time  `json:"expiry,omitempty"`
+}
+
+type RevealPreimageRequest struct {
+	ChannelId string `json:"channelId"`
+	Preimage  string `json:"preimage"`
+}
+
+type RenewUpdateTxRequest struct {
+	ChannelId string    `json:"channelId"`
+	Expiry    time.Time `json:"expiry"`
+}
+
+type UnlockRequest struct {
+	Passphrase string `json:"passphrase"`
+}
+
+type ChangePassphraseRequest struct {
+	OldPassphrase string `json:"oldPassphrase"`
+	NewPassphrase string `json:"newPassphrase"`
+}
+
+var phases = map[core.Phase]string{
+	core.PENDING_OPEN:   "PENDING_OPEN",
+	core.OPEN:           "OPEN",
+	core.PENDING_CLOSED: "PENDING_CLOSED",
+	core.CLOSED:         "CLOSED",
+}
+
+func encodePubkey(b []byte) string {
+	return base64.URLEncoding.EncodeToString(b)
+}
+
+func decodePubkey(s string) ([]byte, error) {
+	return base64.URLEncoding.DecodeString(s)
+}
+
+func unixNanoTime(n int64) *time.Time {
+	if n == 0 {
+		return nil
+	}
+	t := time.Unix(0, n)
+	return &t
+}
+
+func judgeToJSON(jd *core.Judge) *Judge {
+	if jd == nil {
+		return nil
+	}
+	return &Judge{
+		Name:    jd.Name,
+		Pubkey:  encodePubkey(jd.Pubkey),
+		Address: jd.Address,
+	}
+}
+
+func accountToJSON(acct *core.Account) *Account {
+	return &Account{
+		Name:   acct.Name,
+		Pubkey: encodePubkey(acct.Pubkey),
+		Judge:  judgeToJSON(acct.Judge),
+	}
+}
+
+func counterpartyToJSON(cpt *core.Counterparty) *Counterparty {
+	return &Counterparty{
+		Name:    cpt.Name,
+		Pubkey:  encodePubkey(cpt.Pubkey),
+		Address: cpt.Address,
+		Judge:   judgeToJSON(cpt.Judge),
+	}
+}
+
+func openingTxToJSON(otx *wire.OpeningTx) *OpeningTx {
+	if otx == nil {
+		return nil
+	}
+	pubkeys := []string{}
+	for _, pubkey := range otx.Pubkeys {
+		pubkeys = append(pubkeys, encodePubkey(pubkey))
+	}
+	return &OpeningTx{
+		ChannelId:  otx.ChannelId,
+		Pubkeys:    pubkeys,
+		State:      string(otx.State),
+		HoldPeriod: otx.HoldPeriod,
+	}
+}
+
+func updateTxToJSON(utx *wire.UpdateTx) *UpdateTx {
+	if utx == nil {
+		return nil
+	}
+	j := &UpdateTx{
+		ChannelId:      utx.ChannelId,
+		SequenceNumber: utx.SequenceNumber,
+		Fast:           utx.Fast,
+		State:          string(utx.State),
+		Expiry:         unixNanoTime(utx.Expiry),
+	}
+	for _, lock := range utx.HashLocks {
+		j.HashLocks = append(j.HashLocks, &HashLock{
+			Hash:   encodePubkey(lock.Hash),
+			Expiry: unixNanoTime(lock.Expiry),
+			State:  string(lock.State),
+		})
+	}
+	return j
+}
+
+func channelToJSON(ch *core.Channel) *Channel {
+	j := &Channel{
+		ChannelId: ch.ChannelId,
+		Phase:     phases[ch.Phase],
+
+		OpeningTx:             openingTxToJSON(ch.OpeningTx),
+		LastFullUpdateTx:      updateTxToJSON(ch.LastFullUpdateTx),
+		MyProposedUpdateTx:    updateTxToJSON(ch.MyProposedUpdateTx),
+		TheirProposedUpdateTx: updateTxToJSON(ch.TheirProposedUpdateTx),
+		FinalUpdateTx:         updateTxToJSON(ch.FinalUpdateTx),
+		FollowOnTxs:           []*FollowOnTx{},
+
+		Judge:          judgeToJSON(ch.Judge),
+		Account:        accountToJSON(ch.Account),
+		Counterparties: []*Counterparty{},
+	}
+
+	for _, ev := range ch.FollowOnTxs {
+		ftx := &wire.FollowOnTx{}
+		err := proto.Unmarshal(ev.Payload, ftx)
+		if err != nil {
+			continue
+		}
+		j.FollowOnTxs = append(j.FollowOnTxs, &FollowOnTx{
+			ChannelId: ftx.ChannelId,
+			State:     string(ftx.State),
+		})
+	}
+
+	for _, cpt := range ch.Counterparties {
+		j.Counterparties = append(j.Counterparties, counterpartyToJSON(cpt))
+	}
+
+	return j
+}
+
+func eventToJSON(ev *core.Event) *Event {
+	return &Event{
+		Cursor:         ev.Cursor,
+		Type:           string(ev.Type),
+		ChannelId:      ev.ChannelId,
+		SequenceNumber: ev.SequenceNumber,
+		Time:           ev.Time,
+	}
+}
+
+// hashLocksFromJSON decodes the HashLocks of a ProposeUpdateTxRequest.
+func hashLocksFromJSON(locks []*HashLock) ([]*wire.HashLock, error) {
+	hashLocks := []*wire.HashLock{}
+	for _, lock := range locks {
+		hash, err := base64.URLEncoding.DecodeString(lock.Hash)
+		if err != nil {
+			return nil, err
+		}
+		hashLock := &wire.HashLock{
+			Hash:  hash,
+			State: []byte(lock.State),
+		}
+		if lock.Expiry != nil {
+			hashLock.Expiry = lock.Expiry.UnixNano()
+		}
+		hashLocks = append(hashLocks, hashLock)
+	}
+	return hashLocks, nil
+}
+
+func deliveryToJSON(d *webhook.Delivery) *Delivery {
+	return &Delivery{
+		Id:          d.Id,
+		URL:         d.URL,
+		Payload:     d.Payload,
+		Attempts:    d.Attempts,
+		NextAttempt: d.NextAttempt,
+		LastError:   d.LastError,
+	}
+}
+
+func messageToJSON(m *core.Message) *Message {
+	return &Message{
+		Id:          m.Id,
+		Kind:        string(m.Kind),
+		Address:     m.Address,
+		Attempts:    m.Attempts,
+		NextAttempt: m.NextAttempt,
+		LastError:   m.LastError,
+		Dead:        m.Dead,
+	}
+}
+
+func envelopeToJSON(ev *wire.Envelope) *Envelope {
+	j := &Envelope{
+		Payload:    base64.URLEncoding.EncodeToString(ev.Payload),
+		Signatures: []string{},
+	}
+	for _, sig := range ev.Signatures {
+		j.Signatures = append(j.Signatures, base64.URLEncoding.EncodeToString(sig))
+	}
+	return j
+}
+
+// envelopeUpdateTxToJSON decodes the UpdateTx in ev. It returns nil if ev does
+// not hold one.
+func envelopeUpdateTxToJSON(ev *wire.Envelope) *UpdateTx {
+	utx := &wire.UpdateTx{}
+	err := proto.Unmarshal(ev.Payload, utx)
+	if err != nil {
+		return nil
+	}
+	return updateTxToJSON(utx)
+}
+
+func equivocationToJSON(eq *core.Equivocation) *Equivocation {
+	return &Equivocation{
+		Id:                  eq.Id,
+		SequenceNumber:      eq.SequenceNumber,
+		Held:                envelopeUpdateTxToJSON(eq.Held),
+		Conflicting:         envelopeUpdateTxToJSON(eq.Conflicting),
+		HeldEnvelope:        envelopeToJSON(eq.Held),
+		ConflictingEnvelope: envelopeToJSON(eq.Conflicting),
+		Time:                eq.Time,
+	}
+}
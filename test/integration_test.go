@@ -1,17 +1,42 @@
 package test
 
 import (
+	"bufio"
+	"bytes"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
 	"encoding/json"
+	"errors"
 	"fmt"
+	"io/ioutil"
+	"net"
+	"net/http"
+	"net/http/httptest"
 	"os"
+	"strings"
+	"sync"
 	"testing"
+	"time"
 
+	"github.com/agl/ed25519"
 	"github.com/boltdb/bolt"
+	"github.com/golang/protobuf/proto"
+	"github.com/jtremback/usc/core/errs"
+	judgeCore "github.com/jtremback/usc/core/judge"
+	"github.com/jtremback/usc/core/keystore"
+	peerCore "github.com/jtremback/usc/core/peer"
+	"github.com/jtremback/usc/core/signer"
+	"github.com/jtremback/usc/core/webhook"
 	"github.com/jtremback/usc/core/wire"
 	judgeAccess "github.com/jtremback/usc/judge/access"
 	judgeLogic "github.com/jtremback/usc/judge/logic"
+	judgeServers "github.com/jtremback/usc/judge/servers"
 	peerAccess "github.com/jtremback/usc/peer/access"
+	peerClients "github.com/jtremback/usc/peer/clients"
 	peerLogic "github.com/jtremback/usc/peer/logic"
+	peerServers "github.com/jtremback/usc/peer/servers"
+	"google.golang.org/grpc"
 )
 
 type Peer struct {
@@ -24,13 +49,14 @@ type Judge struct {
 	PeerAPI   *judgeLogic.PeerAPI
 }
 
+// CounterpartyClient sends envelopes to the peer with the given address.
 type CounterpartyClient struct {
-	Peer *Peer
-	T    *testing.T
+	Peers map[string]*Peer
+	T     *testing.T
 }
 
 func (client *CounterpartyClient) AddChannel(ev *wire.Envelope, address string) error {
-	err := client.Peer.CounterpartyAPI.AddChannel(ev)
+	err := client.Peers[address].CounterpartyAPI.AddChannel(ev)
 	if err != nil {
 		client.T.Fatal(err)
 	}
@@ -38,7 +64,7 @@ func (client *CounterpartyClient) AddChannel(ev *wire.Envelope, address string)
 }
 
 func (client *CounterpartyClient) AddProposedUpdateTx(ev *wire.Envelope, address string) error {
-	err := client.Peer.CounterpartyAPI.AddProposedUpdateTx(ev)
+	err := client.Peers[address].CounterpartyAPI.AddProposedUpdateTx(ev)
 	if err != nil {
 		client.T.Fatal(err)
 	}
@@ -46,7 +72,23 @@ func (client *CounterpartyClient) AddProposedUpdateTx(ev *wire.Envelope, address
 }
 
 func (client *CounterpartyClient) AddFullUpdateTx(ev *wire.Envelope, address string) error {
-	err := client.Peer.CounterpartyAPI.AddFullUpdateTx(ev)
+	err := client.Peers[address].CounterpartyAPI.AddFullUpdateTx(ev)
+	if err != nil {
+		client.T.Fatal(err)
+	}
+	return nil
+}
+
+func (client *CounterpartyClient) AddChannelRejectionTx(ev *wire.Envelope, address string) error {
+	err := client.Peers[address].CounterpartyAPI.AddChannelRejectionTx(ev)
+	if err != nil {
+		client.T.Fatal(err)
+	}
+	return nil
+}
+
+func (client *CounterpartyClient) AddUpdateRejectionTx(ev *wire.Envelope, address string) error {
+	err := client.Peers[address].CounterpartyAPI.AddUpdateRejectionTx(ev)
 	if err != nil {
 		client.T.Fatal(err)
 	}
@@ -58,9 +100,12 @@ type JudgeClient struct {
 	T     *testing.T
 }
 
-func (client *JudgeClient) GetLastFullUpdateTx(address string) (*wire.Envelope, error) {
-	fmt.Println("GetLastFullUpdateTx")
-	return nil, nil
+func (client *JudgeClient) GetLastFullUpdateTx(chId string, address string) (*wire.Envelope, error) {
+	ev, err := client.Judge.PeerAPI.GetLastFullUpdateTx(chId)
+	if err != nil {
+		client.T.Fatal(err)
+	}
+	return ev, nil
 }
 
 func (client *JudgeClient) AddFullUpdateTx(ev *wire.Envelope, address string) error {
@@ -87,6 +132,22 @@ func (client *JudgeClient) AddChannel(ev *wire.Envelope, address string) error {
 	return nil
 }
 
+func (client *JudgeClient) AddCancelTx(ev *wire.Envelope, address string) error {
+	err := client.Judge.PeerAPI.AddCancelTx(ev)
+	if err != nil {
+		client.T.Fatal(err)
+	}
+	return nil
+}
+
+func (client *JudgeClient) AddPreimageTx(ev *wire.Envelope, address string) error {
+	err := client.Judge.PeerAPI.AddPreimageTx(ev)
+	if err != nil {
+		client.T.Fatal(err)
+	}
+	return nil
+}
+
 func (client *JudgeClient) AddFollowOnTx(ev *wire.Envelope, address string) error {
 	fmt.Println("channel1")
 	return nil
@@ -106,7 +167,10 @@ func (client *JudgeClient) GetChannel(chId string, address string) ([]byte, erro
 	return b, nil
 }
 
-func TestIntegration(t *testing.T) {
+// setUp makes two peers and a judge, each with its own database, and gives
+// each peer an account on the judge. It returns the peers, the judge, the
+// pubkeys of the two accounts, and a function which closes the databases.
+func setUp(t *testing.T) (*Peer, *Peer, *Judge, []byte, []byte, func()) {
 	os.Remove("/tmp/p1.db")
 	os.Remove("/tmp/p2.db")
 	os.Remove("/tmp/j.db")
@@ -115,25 +179,23 @@ func TestIntegration(t *testing.T) {
 		t.Fatal(err)
 	}
 	peerAccess.MakeBuckets(p1DB)
-	defer p1DB.Close()
 
 	p2DB, err := bolt.Open("/tmp/p2.db", 0600, nil)
 	if err != nil {
 		t.Fatal(err)
 	}
 	peerAccess.MakeBuckets(p2DB)
-	defer p2DB.Close()
 
 	jDB, err := bolt.Open("/tmp/j.db", 0600, nil)
 	if err != nil {
 		t.Fatal(err)
 	}
 	judgeAccess.MakeBuckets(jDB)
-	defer jDB.Close()
 
 	p1 := &Peer{
 		CallerAPI: &peerLogic.CallerAPI{
-			DB: p1DB,
+			DB:       p1DB,
+			Keystore: keystore.New(),
 		},
 		CounterpartyAPI: &peerLogic.CounterpartyAPI{
 			DB: p1DB,
@@ -141,28 +203,48 @@ func TestIntegration(t *testing.T) {
 	}
 	p2 := &Peer{
 		CallerAPI: &peerLogic.CallerAPI{
-			DB: p2DB,
+			DB:       p2DB,
+			Keystore: keystore.New(),
 		},
 		CounterpartyAPI: &peerLogic.CounterpartyAPI{
 			DB: p2DB,
 		},
 	}
+	jKeystore := keystore.New()
 	j := &Judge{
 		CallerAPI: &judgeLogic.CallerAPI{
-			DB: jDB,
+			DB:       jDB,
+			Keystore: jKeystore,
 		},
 		PeerAPI: &judgeLogic.PeerAPI{
-			DB: jDB,
+			DB:     jDB,
+			Signer: jKeystore,
 		},
 	}
 
+	for _, unlock := range []func(string) error{
+		p1.CallerAPI.Unlock,
+		p2.CallerAPI.Unlock,
+		j.CallerAPI.Unlock,
+	} {
+		err = unlock("passphrase")
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+
 	p1.CallerAPI.JudgeClient = &JudgeClient{
 		Judge: j,
 		T:     t,
 	}
+	peers := map[string]*Peer{
+		"1.com": p1,
+		"2.com": p2,
+	}
+
 	p1.CallerAPI.CounterpartyClient = &CounterpartyClient{
-		Peer: p2,
-		T:    t,
+		Peers: peers,
+		T:     t,
 	}
 
 	p2.CallerAPI.JudgeClient = &JudgeClient{
@@ -170,8 +252,8 @@ func TestIntegration(t *testing.T) {
 		T:     t,
 	}
 	p2.CallerAPI.CounterpartyClient = &CounterpartyClient{
-		Peer: p1,
-		T:    t,
+		Peers: peers,
+		T:     t,
 	}
 
 	jd1, err := j.CallerAPI.NewJudge("jd1")
@@ -219,7 +301,20 @@ func TestIntegration(t *testing.T) {
 		t.Fatal(err)
 	}
 
-	ch, err := p1.CallerAPI.ProposeChannel("channel1", []byte{20}, acct1.Pubkey, acct2.Pubkey, 23)
+	teardown := func() {
+		p1DB.Close()
+		p2DB.Close()
+		jDB.Close()
+	}
+
+	return p1, p2, j, acct1.Pubkey, acct2.Pubkey, teardown
+}
+
+func TestIntegration(t *testing.T) {
+	p1, p2, j, acct1Pubkey, acct2Pubkey, teardown := setUp(t)
+	defer teardown()
+
+	ch, err := p1.CallerAPI.ProposeChannel("channel1", []byte{20}, acct1Pubkey, [][]byte{acct2Pubkey}, 23)
 	if err != nil {
 		t.Fatal(err)
 	}
@@ -289,3 +384,2435 @@ func TestIntegration(t *testing.T) {
 
 	fmt.Println(string(b))
 }
+
+// openChannel proposes a channel from p1 to p2, and has p2 and the judge
+// accept it.
+func openChannel(t *testing.T, p1 *Peer, p2 *Peer, j *Judge, acct1Pubkey []byte, acct2Pubkey []byte, chId string, holdPeriod time.Duration) {
+	_, err := p1.CallerAPI.ProposeChannel(chId, []byte{20}, acct1Pubkey, [][]byte{acct2Pubkey}, uint64(holdPeriod))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	err = p2.CallerAPI.AcceptChannel(chId)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	err = j.CallerAPI.AcceptChannel(chId)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	err = p1.CallerAPI.CheckChannel(chId)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	err = p2.CallerAPI.CheckChannel(chId)
+	if err != nil {
+		t.Fatal(err)
+	}
+}
+
+// getChannel gets a peer's copy of a channel.
+func getChannel(t *testing.T, p *Peer, chId string) *peerCore.Channel {
+	chs, err := p.CallerAPI.ViewChannels()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for _, ch := range chs {
+		if ch.ChannelId == chId {
+			ch.Account.Signer = p.CallerAPI.Keystore
+			return ch
+		}
+	}
+
+	t.Fatal("channel not found")
+	return nil
+}
+
+func TestWatcher(t *testing.T) {
+	p1, p2, j, acct1Pubkey, acct2Pubkey, teardown := setUp(t)
+	defer teardown()
+
+	openChannel(t, p1, p2, j, acct1Pubkey, acct2Pubkey, "channel1", 23)
+
+	err := p1.CallerAPI.NewUpdateTx([]byte{4, 30}, "channel1", false)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	err = p2.CallerAPI.CosignProposedUpdateTx("channel1")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	oldEv := getChannel(t, p1, "channel1").LastFullUpdateTxEnvelope
+
+	err = p1.CallerAPI.NewUpdateTx([]byte{4, 40}, "channel1", false)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	err = p2.CallerAPI.CosignProposedUpdateTx("channel1")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// --- p1 tries to close the channel with the old update tx ---
+
+	err = j.PeerAPI.AddFullUpdateTx(oldEv)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	ch1 := getChannel(t, p1, "channel1")
+	ctxEv, err := peerCore.SerializeClosingTx(ch1.NewClosingTx())
+	if err != nil {
+		t.Fatal(err)
+	}
+	ch1.Account.AppendSignature(ctxEv)
+
+	err = j.PeerAPI.AddClosingTx(ctxEv)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// --- p2's watcher notices and sends the newer update tx ---
+
+	w := &peerLogic.Watcher{
+		Caller:              p2.CallerAPI,
+		ChecksPerHoldPeriod: 4,
+		MinInterval:         time.Hour,
+	}
+
+	errs := w.Check(time.Now())
+	if len(errs) > 0 {
+		t.Fatal(errs)
+	}
+
+	jch, err := j.PeerAPI.GetChannel("channel1")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if jch.FullUpdateTxs[len(jch.FullUpdateTxs)-1].SequenceNumber != 2 {
+		t.Fatal("judge does not have the newest update tx")
+	}
+
+	ms, err := p2.CallerAPI.ViewMessages("channel1")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(ms) != 0 {
+		t.Fatal("newest update tx should have been sent through the outbox", ms)
+	}
+
+	// The judge already holds the old update tx, so sending it again
+	// succeeds, but does not make it the newest.
+	err = j.PeerAPI.AddFullUpdateTx(oldEv)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	jch, err = j.PeerAPI.GetChannel("channel1")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if jch.FullUpdateTxs[len(jch.FullUpdateTxs)-1].SequenceNumber != 2 {
+		t.Fatal("judge accepted an old update tx")
+	}
+}
+
+func TestCheckFullUpdateTx(t *testing.T) {
+	p1, p2, j, acct1Pubkey, acct2Pubkey, teardown := setUp(t)
+	defer teardown()
+
+	openChannel(t, p1, p2, j, acct1Pubkey, acct2Pubkey, "channel1", 23)
+
+	err := p1.CallerAPI.NewUpdateTx([]byte{4, 30}, "channel1", false)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	err = p2.CallerAPI.CosignProposedUpdateTx("channel1")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	err = p1.CallerAPI.CloseChannel("channel1")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	err = p2.CallerAPI.CheckFullUpdateTx("channel1")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if getChannel(t, p2, "channel1").Phase != peerCore.PENDING_CLOSED {
+		t.Fatal("channel should be PENDING_CLOSED")
+	}
+
+	err = p1.CallerAPI.CheckChannel("channel1")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if getChannel(t, p1, "channel1").Phase != peerCore.PENDING_CLOSED {
+		t.Fatal("channel should be PENDING_CLOSED")
+	}
+}
+
+func TestRejectChannel(t *testing.T) {
+	p1, p2, _, acct1Pubkey, acct2Pubkey, teardown := setUp(t)
+	defer teardown()
+
+	_, err := p1.CallerAPI.ProposeChannel("channel1", []byte{20}, acct1Pubkey, [][]byte{acct2Pubkey}, 23)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// The same channel can be proposed and rejected again once it has been
+	// deleted.
+	for i := 0; i < 2; i++ {
+		if i > 0 {
+			_, err = p1.CallerAPI.ProposeChannel("channel1", []byte{20}, acct1Pubkey, [][]byte{acct2Pubkey}, 23)
+			if err != nil {
+				t.Fatal(err)
+			}
+		}
+
+		err = p2.CallerAPI.RejectChannel("channel1")
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		for _, p := range []*Peer{p1, p2} {
+			chs, err := p.CallerAPI.ViewChannels()
+			if err != nil {
+				t.Fatal(err)
+			}
+			if len(chs) != 0 {
+				t.Fatal("rejected channel was not deleted")
+			}
+		}
+	}
+}
+
+func TestRejectUpdateTx(t *testing.T) {
+	p1, p2, j, acct1Pubkey, acct2Pubkey, teardown := setUp(t)
+	defer teardown()
+
+	openChannel(t, p1, p2, j, acct1Pubkey, acct2Pubkey, "channel1", 23)
+
+	err := p1.CallerAPI.NewUpdateTx([]byte{4, 30}, "channel1", false)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	err = p2.CallerAPI.RejectUpdateTx("channel1")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if getChannel(t, p1, "channel1").MyProposedUpdateTx != nil {
+		t.Fatal("MyProposedUpdateTx was not cleared")
+	}
+
+	if getChannel(t, p2, "channel1").TheirProposedUpdateTx != nil {
+		t.Fatal("TheirProposedUpdateTx was not cleared")
+	}
+
+	err = p2.CallerAPI.CosignProposedUpdateTx("channel1")
+	if err == nil {
+		t.Fatal("rejected update tx was cosigned")
+	}
+}
+
+func TestCancelChannel(t *testing.T) {
+	p1, p2, j, acct1Pubkey, acct2Pubkey, teardown := setUp(t)
+	defer teardown()
+
+	openChannel(t, p1, p2, j, acct1Pubkey, acct2Pubkey, "channel1", 23)
+
+	err := p1.CallerAPI.CancelChannel("channel1")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	err = j.CallerAPI.CancelChannel("channel1")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	jch, err := j.PeerAPI.GetChannel("channel1")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if jch.Phase != judgeCore.CLOSED {
+		t.Fatal("channel should be CLOSED")
+	}
+}
+
+func TestCancelChannelOverridden(t *testing.T) {
+	p1, p2, j, acct1Pubkey, acct2Pubkey, teardown := setUp(t)
+	defer teardown()
+
+	openChannel(t, p1, p2, j, acct1Pubkey, acct2Pubkey, "channel1", 23)
+
+	err := p1.CallerAPI.CancelChannel("channel1")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	err = p1.CallerAPI.NewUpdateTx([]byte{4, 30}, "channel1", false)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	err = p2.CallerAPI.CosignProposedUpdateTx("channel1")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	err = p2.CallerAPI.CloseChannel("channel1")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	err = j.CallerAPI.CancelChannel("channel1")
+	if err == nil {
+		t.Fatal("cancellation should be overridden")
+	}
+
+	err = j.CallerAPI.CloseChannel("channel1", 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+}
+
+// maxSeqValidator considers UpdateTxs valid up to a maximum sequence number
+// for each channel.
+type maxSeqValidator map[string]uint32
+
+func (v maxSeqValidator) ValidateOpeningTx(otx *wire.OpeningTx) error {
+	return nil
+}
+
+func (v maxSeqValidator) ValidateUpdateTx(otx *wire.OpeningTx, utx *wire.UpdateTx) error {
+	max, ok := v[utx.ChannelId]
+	if !ok || utx.SequenceNumber > max {
+		return errors.New("update tx not valid")
+	}
+	return nil
+}
+
+func (v maxSeqValidator) ValidateFollowOnTxs(otx *wire.OpeningTx, utx *wire.UpdateTx, ftxs []*wire.FollowOnTx) error {
+	return nil
+}
+
+func TestScheduler(t *testing.T) {
+	p1, p2, j, acct1Pubkey, acct2Pubkey, teardown := setUp(t)
+	defer teardown()
+
+	for _, chId := range []string{"channel1", "channel2"} {
+		openChannel(t, p1, p2, j, acct1Pubkey, acct2Pubkey, chId, 23)
+
+		err := p1.CallerAPI.NewUpdateTx([]byte{4, 30}, chId, false)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		err = p2.CallerAPI.CosignProposedUpdateTx(chId)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		err = j.PeerAPI.AddFullUpdateTx(getChannel(t, p1, chId).LastFullUpdateTxEnvelope)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		err = p1.CallerAPI.NewUpdateTx([]byte{4, 40}, chId, false)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		err = p2.CallerAPI.CosignProposedUpdateTx(chId)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		err = p1.CallerAPI.CloseChannel(chId)
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	// channel1 is only valid up to sequence number 1, channel2 is never valid
+	s := &judgeLogic.Scheduler{
+		DB:        j.PeerAPI.DB,
+		Signer:    j.PeerAPI.Signer,
+		Validator: maxSeqValidator{"channel1": 1},
+	}
+
+	errs := s.FinalizeChannels()
+	if len(errs) > 0 {
+		t.Fatal(errs)
+	}
+
+	jch, err := j.PeerAPI.GetChannel("channel1")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if jch.Phase != judgeCore.CLOSED || jch.FinalUpdateTx.SequenceNumber != 1 {
+		t.Fatal("channel1 should be closed with sequence number 1")
+	}
+
+	jch, err = j.PeerAPI.GetChannel("channel2")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if jch.Phase != judgeCore.CLOSED || jch.FinalUpdateTx != nil {
+		t.Fatal("channel2 should be cancelled")
+	}
+}
+
+func TestFastClose(t *testing.T) {
+	p1, p2, j, acct1Pubkey, acct2Pubkey, teardown := setUp(t)
+	defer teardown()
+
+	openChannel(t, p1, p2, j, acct1Pubkey, acct2Pubkey, "channel1", time.Hour)
+
+	err := p1.CallerAPI.NewUpdateTx([]byte{4, 30}, "channel1", true)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	err = p2.CallerAPI.CosignProposedUpdateTx("channel1")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	err = p1.CallerAPI.CloseChannel("channel1")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	jch, err := j.PeerAPI.GetChannel("channel1")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if jch.Phase != judgeCore.CLOSED {
+		t.Fatal("channel should be closed without waiting for the hold period")
+	}
+
+	err = p2.CallerAPI.CheckChannel("channel1")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	ch := getChannel(t, p2, "channel1")
+	if ch.Phase != peerCore.CLOSED || ch.FinalUpdateTx.SequenceNumber != 1 {
+		t.Fatal("channel should be CLOSED with sequence number 1")
+	}
+}
+
+func TestHashLock(t *testing.T) {
+	p1, p2, j, acct1Pubkey, acct2Pubkey, teardown := setUp(t)
+	defer teardown()
+
+	openChannel(t, p1, p2, j, acct1Pubkey, acct2Pubkey, "channel1", 23)
+
+	preimage1 := []byte("the first preimage")
+	preimage2 := []byte("the second preimage")
+	hash1 := sha256.Sum256(preimage1)
+	hash2 := sha256.Sum256(preimage2)
+
+	hashLocks := []*wire.HashLock{
+		&wire.HashLock{
+			Hash:   hash1[:],
+			Expiry: time.Now().Add(time.Hour).UnixNano(),
+			State:  []byte{1},
+		},
+		&wire.HashLock{
+			Hash:   hash2[:],
+			Expiry: time.Now().Add(-time.Hour).UnixNano(),
+			State:  []byte{2},
+		},
+	}
+
+	err := p1.CallerAPI.NewHashLockedUpdateTx([]byte{4, 30}, hashLocks, "channel1", false)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	err = p2.CallerAPI.CosignProposedUpdateTx("channel1")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	err = p1.CallerAPI.CloseChannel("channel1")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for i := 0; i < 2; i++ {
+		err = p2.CallerAPI.RevealPreimage("channel1", preimage1)
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	// The test JudgeClient fails on any error, so these go to the judge
+	// directly.
+	for _, preimage := range [][]byte{preimage2, []byte("not a preimage")} {
+		ch := getChannel(t, p2, "channel1")
+		ptx, err := ch.NewPreimageTx(preimage)
+		if err != nil {
+			t.Fatal(err)
+		}
+		ev, err := peerCore.SerializePreimageTx(ptx)
+		if err != nil {
+			t.Fatal(err)
+		}
+		err = ch.Account.AppendSignature(ev)
+		if err != nil {
+			t.Fatal(err)
+		}
+		err = j.PeerAPI.AddPreimageTx(ev)
+		if err == nil {
+			t.Fatal("judge should refuse a preimage that does not unlock a pending hash lock", string(preimage))
+		}
+	}
+
+	jch, err := j.PeerAPI.GetChannel("channel1")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(jch.Preimages) != 1 {
+		t.Fatal("judge should only keep the preimage of the pending hash lock", jch.Preimages)
+	}
+
+	v := &hashLockValidator{}
+	s := &judgeLogic.Scheduler{
+		DB:        j.PeerAPI.DB,
+		Signer:    j.PeerAPI.Signer,
+		Validator: v,
+	}
+
+	errs := s.FinalizeChannels()
+	if len(errs) > 0 {
+		t.Fatal(errs)
+	}
+
+	jch, err = j.PeerAPI.GetChannel("channel1")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if jch.Phase != judgeCore.CLOSED {
+		t.Fatal("channel1 should be closed")
+	}
+	if len(jch.FinalHashLocks) != 1 || jch.FinalHashLocks[0].State[0] != 1 {
+		t.Fatal("only the first hash lock should be unlocked", jch.FinalHashLocks)
+	}
+	if len(v.hashLocks) != 1 || v.hashLocks[0].State[0] != 1 {
+		t.Fatal("validator should be given only the unlocked hash locks", v.hashLocks)
+	}
+}
+
+// hashLockValidator considers every UpdateTx valid, and keeps the HashLocks of
+// the last one it was given.
+type hashLockValidator struct {
+	hashLocks []*wire.HashLock
+}
+
+func (v *hashLockValidator) ValidateOpeningTx(otx *wire.OpeningTx) error {
+	return nil
+}
+
+func (v *hashLockValidator) ValidateUpdateTx(otx *wire.OpeningTx, utx *wire.UpdateTx) error {
+	v.hashLocks = utx.HashLocks
+	return nil
+}
+
+func (v *hashLockValidator) ValidateFollowOnTxs(otx *wire.OpeningTx, utx *wire.UpdateTx, ftxs []*wire.FollowOnTx) error {
+	return nil
+}
+
+func TestExpiringUpdateTx(t *testing.T) {
+	p1, p2, j, acct1Pubkey, acct2Pubkey, teardown := setUp(t)
+	defer teardown()
+
+	openChannel(t, p1, p2, j, acct1Pubkey, acct2Pubkey, "channel1", 23)
+
+	err := p1.CallerAPI.NewExpiringUpdateTx([]byte{4, 30}, time.Now().Add(50*time.Millisecond), "channel1", false)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	err = p2.CallerAPI.CosignProposedUpdateTx("channel1")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	err = p1.CallerAPI.RenewUpdateTx("channel1", time.Now().Add(time.Hour))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	err = p2.CallerAPI.CosignProposedUpdateTx("channel1")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	ch := getChannel(t, p1, "channel1")
+	if ch.LastFullUpdateTx.SequenceNumber != 2 || ch.LastFullUpdateTx.State[1] != 30 {
+		t.Fatal("renewed update tx should have the same state at sequence number 2")
+	}
+
+	// An update tx which expired before reaching the counterparty or the judge
+	utx := &wire.UpdateTx{
+		ChannelId:      "channel1",
+		SequenceNumber: 3,
+		State:          []byte{4, 40},
+		Expiry:         time.Now().Add(-time.Second).UnixNano(),
+	}
+	ev, err := peerCore.SerializeUpdateTx(utx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	getChannel(t, p1, "channel1").SignProposedUpdateTx(ev, utx)
+
+	err = getChannel(t, p2, "channel1").AddProposedUpdateTx(ev, utx)
+	if err == nil || err.Error() != "update tx expired" {
+		t.Fatal("counterparty should refuse an expired update tx", err)
+	}
+
+	getChannel(t, p2, "channel1").SignProposedUpdateTx(ev, utx)
+
+	jch, err := j.PeerAPI.GetChannel("channel1")
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = jch.AddFullUpdateTx(ev, utx)
+	if err == nil || err.Error() != "update tx expired" {
+		t.Fatal("judge should refuse an expired update tx", err)
+	}
+}
+
+func TestThreePartyChannel(t *testing.T) {
+	p1, p2, j, acct1Pubkey, acct2Pubkey, teardown := setUp(t)
+	defer teardown()
+
+	// Add a third peer, the arbiter, with an account on the same judge
+	os.Remove("/tmp/p3.db")
+	p3DB, err := bolt.Open("/tmp/p3.db", 0600, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer p3DB.Close()
+	peerAccess.MakeBuckets(p3DB)
+
+	p3 := &Peer{
+		CallerAPI: &peerLogic.CallerAPI{
+			DB:                 p3DB,
+			CounterpartyClient: p1.CallerAPI.CounterpartyClient,
+			JudgeClient:        p1.CallerAPI.JudgeClient,
+			Keystore:           keystore.New(),
+		},
+		CounterpartyAPI: &peerLogic.CounterpartyAPI{
+			DB: p3DB,
+		},
+	}
+	p1.CallerAPI.CounterpartyClient.(*CounterpartyClient).Peers["3.com"] = p3
+
+	err = p3.CallerAPI.Unlock("passphrase")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var jd *peerCore.Judge
+	err = p1.CallerAPI.DB.View(func(tx *bolt.Tx) error {
+		acct, err := peerAccess.GetAccount(tx, acct1Pubkey)
+		jd = acct.Judge
+		return err
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	err = p3.CallerAPI.AddJudge(jd.Name, jd.Pubkey, jd.Address)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	acct3, err := p3.CallerAPI.NewAccount("acct3", jd.Pubkey)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for _, cpt := range []struct {
+		p       *Peer
+		name    string
+		pubkey  []byte
+		address string
+	}{
+		{p1, "acct3", acct3.Pubkey, "3.com"},
+		{p2, "acct3", acct3.Pubkey, "3.com"},
+		{p3, "acct1", acct1Pubkey, "1.com"},
+		{p3, "acct2", acct2Pubkey, "2.com"},
+	} {
+		err = cpt.p.CallerAPI.AddCounterparty(cpt.name, jd.Pubkey, cpt.pubkey, cpt.address)
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	err = j.CallerAPI.AddAccount("acct3", jd.Pubkey, acct3.Pubkey, "3.com")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// Open the channel, collecting every signature on the OpeningTx
+	_, err = p1.CallerAPI.ProposeChannel("channel1", []byte{20}, acct1Pubkey, [][]byte{acct2Pubkey, acct3.Pubkey}, 23)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	err = p2.CallerAPI.AcceptChannel("channel1")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	_, err = j.PeerAPI.GetChannel("channel1")
+	if err == nil {
+		t.Fatal("judge should not have the channel until everyone has signed")
+	}
+
+	err = p3.CallerAPI.AcceptChannel("channel1")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	err = j.CallerAPI.AcceptChannel("channel1")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for _, p := range []*Peer{p1, p2, p3} {
+		err = p.CallerAPI.CheckChannel("channel1")
+		if err != nil {
+			t.Fatal(err)
+		}
+		if getChannel(t, p, "channel1").Phase != peerCore.OPEN {
+			t.Fatal("channel should be open")
+		}
+	}
+
+	// Update the channel, collecting every signature on the UpdateTx
+	err = p1.CallerAPI.NewUpdateTx([]byte{4, 30}, "channel1", false)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	err = p2.CallerAPI.CosignProposedUpdateTx("channel1")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if getChannel(t, p1, "channel1").LastFullUpdateTx != nil {
+		t.Fatal("update tx should not be full until everyone has signed")
+	}
+
+	err = p3.CallerAPI.CosignProposedUpdateTx("channel1")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for _, p := range []*Peer{p1, p2, p3} {
+		ch := getChannel(t, p, "channel1")
+		if ch.LastFullUpdateTx == nil || ch.LastFullUpdateTx.SequenceNumber != 1 {
+			t.Fatal("every peer should have the full update tx")
+		}
+	}
+
+	// Proposals from two different Counterparties with the same sequence
+	// number are not equivocation, since neither has signed the other's.
+	for _, p := range []*Peer{p2, p3} {
+		ch := getChannel(t, p, "channel1")
+		utx := ch.NewUpdateTx([]byte{byte(ch.Me)}, false)
+		ev, err := peerCore.SerializeUpdateTx(utx)
+		if err != nil {
+			t.Fatal(err)
+		}
+		err = ch.SignProposedUpdateTx(ev, utx)
+		if err != nil {
+			t.Fatal(err)
+		}
+		err = p1.CounterpartyAPI.AddProposedUpdateTx(ev)
+		if errors.Is(err, peerCore.ErrEquivocation) {
+			t.Fatal("concurrent proposals should not be equivocation", err)
+		}
+	}
+
+	eqs, err := p1.CallerAPI.ViewEquivocations("channel1")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(eqs) != 0 {
+		t.Fatal("concurrent proposals should not be recorded as equivocation", eqs)
+	}
+
+	err = p3.CallerAPI.CloseChannel("channel1")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	s := &judgeLogic.Scheduler{
+		DB:     j.PeerAPI.DB,
+		Signer: j.PeerAPI.Signer,
+	}
+
+	errs := s.FinalizeChannels()
+	if len(errs) > 0 {
+		t.Fatal(errs)
+	}
+
+	for _, p := range []*Peer{p1, p2, p3} {
+		err = p.CallerAPI.CheckChannel("channel1")
+		if err != nil {
+			t.Fatal(err)
+		}
+		ch := getChannel(t, p, "channel1")
+		if ch.Phase != peerCore.CLOSED || ch.FinalUpdateTx.SequenceNumber != 1 {
+			t.Fatal("channel should be closed with sequence number 1")
+		}
+	}
+}
+
+func TestKeystore(t *testing.T) {
+	p1, p2, j, acct1Pubkey, acct2Pubkey, teardown := setUp(t)
+	defer teardown()
+
+	err := p1.CallerAPI.DB.View(func(tx *bolt.Tx) error {
+		acct, err := peerAccess.GetAccount(tx, acct1Pubkey)
+		if err != nil {
+			return err
+		}
+		if len(acct.Privkey) != 0 {
+			t.Fatal("private key should not be stored in plaintext")
+		}
+		return nil
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	ch, err := p1.CallerAPI.ProposeChannel("channel1", []byte{20}, acct1Pubkey, [][]byte{acct2Pubkey}, 23)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	err = p2.CallerAPI.AcceptChannel(ch.ChannelId)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	j.CallerAPI.Lock()
+
+	err = j.CallerAPI.AcceptChannel(ch.ChannelId)
+	if err != keystore.ErrLocked {
+		t.Fatal("locked judge should not sign", err)
+	}
+
+	err = j.CallerAPI.Unlock("wrong")
+	if err != keystore.ErrBadPassphrase {
+		t.Fatal("wrong passphrase should not unlock", err)
+	}
+
+	err = j.CallerAPI.Unlock("passphrase")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	err = j.CallerAPI.AcceptChannel(ch.ChannelId)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	err = p1.CallerAPI.CheckChannel(ch.ChannelId)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	err = p2.CallerAPI.CheckChannel(ch.ChannelId)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	err = p1.CallerAPI.ChangePassphrase("passphrase", "new passphrase")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	p1.CallerAPI.Lock()
+
+	err = p1.CallerAPI.NewUpdateTx([]byte{4, 4}, "channel1", false)
+	if err != keystore.ErrLocked {
+		t.Fatal("locked peer should not sign", err)
+	}
+
+	err = p1.CallerAPI.Unlock("passphrase")
+	if err != keystore.ErrBadPassphrase {
+		t.Fatal("old passphrase should not unlock", err)
+	}
+
+	err = p1.CallerAPI.Unlock("new passphrase")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	err = p1.CallerAPI.NewUpdateTx([]byte{4, 4}, "channel1", false)
+	if err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestRemoteSigner(t *testing.T) {
+	p1, p2, j, _, acct2Pubkey, teardown := setUp(t)
+	defer teardown()
+
+	// The private key is only held by the signer
+	pub, priv, err := ed25519.GenerateKey(rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	os.Remove("/tmp/usc-signer.sock")
+	l, err := net.Listen("unix", "/tmp/usc-signer.sock")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer l.Close()
+
+	go signer.Serve(l, signer.NewMemory(priv[:]))
+
+	p1.CallerAPI.Signer = &signer.Remote{Path: "/tmp/usc-signer.sock", Timeout: time.Second}
+
+	var jd *peerCore.Judge
+	err = p2.CallerAPI.DB.View(func(tx *bolt.Tx) error {
+		acct, err := peerAccess.GetAccount(tx, acct2Pubkey)
+		jd = acct.Judge
+		return err
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	_, err = p1.CallerAPI.NewAccount("acct4", jd.Pubkey)
+	if err == nil {
+		t.Fatal("peer with a signer should not make private keys")
+	}
+
+	err = p1.CallerAPI.AddAccount("acct4", jd.Pubkey, pub[:], nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	err = p2.CallerAPI.AddCounterparty("acct4", jd.Pubkey, pub[:], "1.com")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	err = j.CallerAPI.AddAccount("acct4", jd.Pubkey, pub[:], "1.com")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	ch, err := p1.CallerAPI.ProposeChannel("channel1", []byte{20}, pub[:], [][]byte{acct2Pubkey}, 23)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	err = p2.CallerAPI.AcceptChannel(ch.ChannelId)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	err = j.CallerAPI.AcceptChannel(ch.ChannelId)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	err = p1.CallerAPI.CheckChannel(ch.ChannelId)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	err = p2.CallerAPI.CheckChannel(ch.ChannelId)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	err = p1.CallerAPI.NewUpdateTx([]byte{4, 4}, "channel1", false)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	err = p2.CallerAPI.CosignProposedUpdateTx("channel1")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if getChannel(t, p1, "channel1").LastFullUpdateTx.SequenceNumber != 1 {
+		t.Fatal("update tx signed by the remote signer should be full")
+	}
+}
+
+// post sends req as JSON to the server and decodes the response into resp.
+func post(t *testing.T, server *httptest.Server, route string, req interface{}, resp interface{}) {
+	b, err := json.Marshal(req)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	res, err := http.Post(server.URL+route, "application/json", bytes.NewReader(b))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer res.Body.Close()
+
+	if res.StatusCode != 200 {
+		body, _ := ioutil.ReadAll(res.Body)
+		t.Fatal(route, res.StatusCode, string(body))
+	}
+
+	if resp != nil {
+		err = json.NewDecoder(res.Body).Decode(resp)
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+}
+
+func TestCallerHTTP(t *testing.T) {
+	p1, p2, j, acct1Pubkey, acct2Pubkey, teardown := setUp(t)
+	defer teardown()
+
+	servers := []*httptest.Server{}
+	for _, p := range []*Peer{p1, p2} {
+		mux := http.NewServeMux()
+		(&peerServers.CallerHTTP{Logic: p.CallerAPI}).MountRoutes(mux)
+		server := httptest.NewServer(mux)
+		defer server.Close()
+		servers = append(servers, server)
+	}
+
+	acct1 := base64.URLEncoding.EncodeToString(acct1Pubkey)
+	acct2 := base64.URLEncoding.EncodeToString(acct2Pubkey)
+
+	res, err := http.Get(servers[0].URL + "/accounts_by_id/" + acct1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	acct := &peerServers.Account{}
+	err = json.NewDecoder(res.Body).Decode(acct)
+	res.Body.Close()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if acct.Name != "acct1" || acct.Pubkey != acct1 || acct.Judge.Name != "jd1" {
+		t.Fatal("account incorrect", acct)
+	}
+
+	res, err = http.Get(servers[0].URL + "/counterparties/pubkey/" + acct1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	res.Body.Close()
+	if res.StatusCode != 404 {
+		t.Fatal("unknown counterparty should be 404", res.StatusCode)
+	}
+
+	ch := &peerServers.Channel{}
+	post(t, servers[0], "/propose_channel", &peerServers.ProposeChannelRequest{
+		ChannelId:          "channel1",
+		AccountPubkey:      acct1,
+		CounterpartyPubkey: acct2,
+		State:              `{"a":100}`,
+		HoldPeriod:         86400000,
+	}, ch)
+	if ch.Phase != "PENDING_OPEN" || ch.OpeningTx.State != `{"a":100}` || ch.Counterparties[0].Pubkey != acct2 {
+		t.Fatal("proposed channel incorrect", ch)
+	}
+
+	post(t, servers[1], "/accept_channel", &peerServers.ChannelRequest{ChannelId: "channel1"}, ch)
+	if ch.Phase != "PENDING_OPEN" {
+		t.Fatal("accepted channel incorrect", ch.Phase)
+	}
+
+	err = j.CallerAPI.AcceptChannel("channel1")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for _, server := range servers {
+		post(t, server, "/check_channel", &peerServers.ChannelRequest{ChannelId: "channel1"}, ch)
+		if ch.Phase != "OPEN" {
+			t.Fatal("checked channel should be OPEN", ch.Phase)
+		}
+	}
+
+	post(t, servers[0], "/propose_update_tx", &peerServers.ProposeUpdateTxRequest{
+		ChannelId: "channel1",
+		State:     `{"a":90}`,
+	}, ch)
+	if ch.MyProposedUpdateTx.State != `{"a":90}` {
+		t.Fatal("proposed update tx incorrect", ch.MyProposedUpdateTx)
+	}
+
+	post(t, servers[1], "/accept_update_tx", &peerServers.ChannelRequest{ChannelId: "channel1"}, ch)
+	if ch.LastFullUpdateTx.SequenceNumber != 1 {
+		t.Fatal("accepted update tx should be full", ch.LastFullUpdateTx)
+	}
+
+	chs := []*peerServers.Channel{}
+	res, err = http.Get(servers[0].URL + "/channels")
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = json.NewDecoder(res.Body).Decode(&chs)
+	res.Body.Close()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(chs) != 1 || chs[0].LastFullUpdateTx.State != `{"a":90}` {
+		t.Fatal("channels incorrect", chs)
+	}
+
+	post(t, servers[0], "/close_channel", &peerServers.ChannelRequest{ChannelId: "channel1"}, ch)
+	if ch.ChannelId != "channel1" {
+		t.Fatal("close_channel should return the channel", ch)
+	}
+}
+
+func TestCallerClient(t *testing.T) {
+	p1, _, _, acct1Pubkey, acct2Pubkey, teardown := setUp(t)
+	defer teardown()
+
+	mux := http.NewServeMux()
+	(&peerServers.CallerHTTP{Logic: p1.CallerAPI}).MountRoutes(mux)
+	server := httptest.NewServer(mux)
+	defer server.Close()
+
+	c := &peerClients.CallerHTTP{Address: server.URL}
+
+	jds, err := c.Judges()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(jds) != 1 || jds[0].Name != "jd1" {
+		t.Fatal("judges incorrect", jds)
+	}
+
+	pub, _, err := ed25519.GenerateKey(rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	cptPubkey := base64.URLEncoding.EncodeToString(pub[:])
+
+	cpt, err := c.AddCounterparty(&peerServers.AddCounterpartyRequest{
+		Name:        "acct3",
+		JudgePubkey: jds[0].Pubkey,
+		Pubkey:      cptPubkey,
+		Address:     "3.com",
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if cpt.Judge.Name != "jd1" || cpt.Address != "3.com" {
+		t.Fatal("added counterparty incorrect", cpt)
+	}
+
+	cpts, err := c.Counterparties()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(cpts) != 2 {
+		t.Fatal("counterparties incorrect", cpts)
+	}
+
+	acct, err := c.NewAccount(&peerServers.NewAccountRequest{
+		Name:        "acct4",
+		JudgePubkey: jds[0].Pubkey,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	acct, err = c.Account(acct.Pubkey)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if acct.Name != "acct4" || acct.Judge.Name != "jd1" {
+		t.Fatal("new account incorrect", acct)
+	}
+
+	hooks, err := c.SetWebhooks(&peerServers.Webhooks{
+		Pubkey: acct.Pubkey,
+		URLs:   []string{"https://example.com/usc"},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	hooks, err = c.Webhooks(acct.Pubkey)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if hooks.Pubkey != acct.Pubkey || fmt.Sprint(hooks.URLs) != "[https://example.com/usc]" {
+		t.Fatal("webhooks incorrect", hooks)
+	}
+	_, err = c.SetWebhooks(&peerServers.Webhooks{Pubkey: acct.Pubkey, URLs: []string{"example.com"}})
+	if errs.CodeOf(err) != errs.Upstream {
+		t.Fatal("bad webhook URL should be an error", err)
+	}
+
+	_, err = c.Counterparty(acct.Pubkey)
+	if errs.CodeOf(err) != errs.Upstream {
+		t.Fatal("unknown counterparty should be an error", err)
+	}
+
+	ch, err := c.ProposeChannel(&peerServers.ProposeChannelRequest{
+		ChannelId:          "channel1",
+		AccountPubkey:      base64.URLEncoding.EncodeToString(acct1Pubkey),
+		CounterpartyPubkey: base64.URLEncoding.EncodeToString(acct2Pubkey),
+		State:              `{"a":100}`,
+		HoldPeriod:         uint64(time.Hour),
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if ch.Phase != "PENDING_OPEN" {
+		t.Fatal("proposed channel incorrect", ch)
+	}
+
+	ms, err := c.ChannelMessages("channel1")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(ms) != 0 {
+		t.Fatal("proposed channel should have been delivered", ms)
+	}
+
+	chs, err := c.Channels()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(chs) != 1 || chs[0].ChannelId != "channel1" {
+		t.Fatal("channels incorrect", chs)
+	}
+
+	err = c.Lock()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	_, err = c.NewAccount(&peerServers.NewAccountRequest{
+		Name:        "acct5",
+		JudgePubkey: jds[0].Pubkey,
+	})
+	if err == nil {
+		t.Fatal("locked keystore should be an error")
+	}
+
+	err = c.Unlock("passphrase")
+	if err != nil {
+		t.Fatal(err)
+	}
+}
+
+// readEvents connects to the /events stream of server, and sends the events
+// it reads to evs until the connection is closed.
+func readEvents(t *testing.T, server *httptest.Server, lastEventID string, evs chan<- *peerServers.Event) func() {
+	req, err := http.NewRequest("GET", server.URL+"/events", nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if lastEventID != "" {
+		req.Header.Set("Last-Event-ID", lastEventID)
+	}
+
+	res, err := http.DefaultClient.Do(req)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if res.Header.Get("Content-Type") != "text/event-stream" {
+		t.Fatal("content type incorrect", res.Header.Get("Content-Type"))
+	}
+
+	go func() {
+		scanner := bufio.NewScanner(res.Body)
+		for scanner.Scan() {
+			line := scanner.Text()
+			if !strings.HasPrefix(line, "data: ") {
+				continue
+			}
+			ev := &peerServers.Event{}
+			err := json.Unmarshal([]byte(strings.TrimPrefix(line, "data: ")), ev)
+			if err != nil {
+				return
+			}
+			evs <- ev
+		}
+	}()
+
+	return func() { res.Body.Close() }
+}
+
+// expectEvents checks that the next events on evs have the given types.
+func expectEvents(t *testing.T, evs <-chan *peerServers.Event, types ...peerCore.EventType) []*peerServers.Event {
+	got := []*peerServers.Event{}
+	for _, typ := range types {
+		select {
+		case ev := <-evs:
+			if ev.Type != string(typ) || ev.ChannelId != "channel1" {
+				t.Fatal("expected", typ, "got", ev)
+			}
+			got = append(got, ev)
+		case <-time.After(5 * time.Second):
+			t.Fatal("timed out waiting for", typ)
+		}
+	}
+	return got
+}
+
+func TestEventStream(t *testing.T) {
+	p1, p2, j, acct1Pubkey, acct2Pubkey, teardown := setUp(t)
+	defer teardown()
+
+	events := &peerLogic.Events{}
+	p2.CallerAPI.Events = events
+	p2.CounterpartyAPI.Events = events
+
+	mux := http.NewServeMux()
+	(&peerServers.CallerHTTP{Logic: p2.CallerAPI}).MountRoutes(mux)
+	server := httptest.NewServer(mux)
+	defer server.Close()
+
+	evs := make(chan *peerServers.Event, 10)
+	stop := readEvents(t, server, "", evs)
+
+	openChannel(t, p1, p2, j, acct1Pubkey, acct2Pubkey, "channel1", time.Hour)
+	expectEvents(t, evs, peerCore.ChannelProposed, peerCore.ChannelOpened)
+
+	err := p1.CallerAPI.NewUpdateTx([]byte{4, 30}, "channel1", true)
+	if err != nil {
+		t.Fatal(err)
+	}
+	got := expectEvents(t, evs, peerCore.UpdateProposed)
+	if got[0].SequenceNumber != 1 {
+		t.Fatal("UpdateProposed should have sequence number 1", got[0])
+	}
+
+	err = p2.CallerAPI.CosignProposedUpdateTx("channel1")
+	if err != nil {
+		t.Fatal(err)
+	}
+	expectEvents(t, evs, peerCore.UpdateCosigned)
+
+	err = p1.CallerAPI.CloseChannel("channel1")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	err = p2.CallerAPI.CheckChannel("channel1")
+	if err != nil {
+		t.Fatal(err)
+	}
+	got = expectEvents(t, evs, peerCore.ChannelClosed)
+	if got[0].Cursor != 5 {
+		t.Fatal("cursor incorrect", got[0])
+	}
+	stop()
+
+	// Checking again changes nothing, so there is no new event.
+	err = p2.CallerAPI.CheckChannel("channel1")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// A client that reconnects gets the events after the last one it saw.
+	evs = make(chan *peerServers.Event, 10)
+	stop = readEvents(t, server, "3", evs)
+	defer stop()
+	got = expectEvents(t, evs, peerCore.UpdateCosigned, peerCore.ChannelClosed)
+	if got[0].Cursor != 4 {
+		t.Fatal("cursor incorrect", got[0])
+	}
+	select {
+	case ev := <-evs:
+		t.Fatal("unexpected event", ev)
+	case <-time.After(100 * time.Millisecond):
+	}
+
+	errDone := errors.New("done")
+	cursors := []uint64{}
+	err = (&peerClients.CallerHTTP{Address: server.URL}).Events(2, func(ev *peerServers.Event) error {
+		cursors = append(cursors, ev.Cursor)
+		if ev.Type == string(peerCore.ChannelClosed) {
+			return errDone
+		}
+		return nil
+	})
+	if err != errDone {
+		t.Fatal(err)
+	}
+	if fmt.Sprint(cursors) != "[3 4 5]" {
+		t.Fatal("cursors incorrect", cursors)
+	}
+}
+
+// webhookReceiver is a webhook URL that records the payloads POSTed to it, once
+// it has checked their signatures. It responds with status.
+type webhookReceiver struct {
+	t        *testing.T
+	mut      sync.Mutex
+	status   int
+	payloads []*webhook.Payload
+}
+
+func (rcv *webhookReceiver) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	rcv.mut.Lock()
+	defer rcv.mut.Unlock()
+
+	body, err := ioutil.ReadAll(r.Body)
+	if err != nil {
+		rcv.t.Error(err)
+		return
+	}
+	pubkey, err := base64.URLEncoding.DecodeString(r.Header.Get(webhook.PubkeyHeader))
+	if err != nil {
+		rcv.t.Error(err)
+		return
+	}
+	sig, err := base64.URLEncoding.DecodeString(r.Header.Get(webhook.SignatureHeader))
+	if err != nil {
+		rcv.t.Error(err)
+		return
+	}
+	if !webhook.Verify(pubkey, body, sig) {
+		rcv.t.Error("webhook signature not valid")
+		return
+	}
+
+	if rcv.status != http.StatusOK {
+		w.WriteHeader(rcv.status)
+		return
+	}
+
+	p := &webhook.Payload{}
+	err = json.Unmarshal(body, p)
+	if err != nil {
+		rcv.t.Error(err)
+		return
+	}
+	rcv.payloads = append(rcv.payloads, p)
+}
+
+// received returns the types of the payloads received since the last call.
+func (rcv *webhookReceiver) received() []string {
+	rcv.mut.Lock()
+	defer rcv.mut.Unlock()
+
+	types := []string{}
+	for _, p := range rcv.payloads {
+		types = append(types, p.Type)
+	}
+	rcv.payloads = nil
+	return types
+}
+
+func TestWebhooks(t *testing.T) {
+	p1, p2, j, acct1Pubkey, acct2Pubkey, teardown := setUp(t)
+	defer teardown()
+
+	jds, err := j.CallerAPI.ViewJudges()
+	if err != nil {
+		t.Fatal(err)
+	}
+	jdPubkey := jds[0].Pubkey
+
+	peerRcv := &webhookReceiver{t: t, status: http.StatusInternalServerError}
+	peerServer := httptest.NewServer(peerRcv)
+	defer peerServer.Close()
+	judgeRcv := &webhookReceiver{t: t, status: http.StatusOK}
+	judgeServer := httptest.NewServer(judgeRcv)
+	defer judgeServer.Close()
+
+	err = p2.CallerAPI.SetWebhooks(acct2Pubkey, []string{"not a url"})
+	if errs.CodeOf(err) != errs.Invalid {
+		t.Fatal("bad URL should be invalid", err)
+	}
+	err = p2.CallerAPI.SetWebhooks(acct1Pubkey, []string{peerServer.URL})
+	if errs.CodeOf(err) != errs.NotFound {
+		t.Fatal("webhooks of another peer's account should not be found", err)
+	}
+
+	err = p2.CallerAPI.SetWebhooks(acct2Pubkey, []string{peerServer.URL})
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = j.CallerAPI.SetWebhooks(jdPubkey, []string{judgeServer.URL})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	openChannel(t, p1, p2, j, acct1Pubkey, acct2Pubkey, "channel1", 23)
+
+	// The receiver is down, so the webhooks stay in the outbox, and are not
+	// tried again until their backoff is over.
+	peerHooks := &peerLogic.Webhooks{Caller: p2.CallerAPI}
+	now := time.Now()
+	if len(peerHooks.Deliver(now)) != 2 {
+		t.Fatal("both webhooks should fail")
+	}
+	ds, err := p2.CallerAPI.ViewDeliveries()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(ds) != 2 || ds[0].Attempts != 1 || ds[0].LastError == "" {
+		t.Fatal("failed webhooks should be in the outbox", ds)
+	}
+
+	peerRcv.status = http.StatusOK
+	if len(peerHooks.Deliver(now)) != 0 || len(peerRcv.received()) != 0 {
+		t.Fatal("webhooks should not be tried again before their backoff")
+	}
+
+	failed := peerHooks.Deliver(now.Add(webhook.MinBackoff))
+	if len(failed) != 0 {
+		t.Fatal(failed)
+	}
+	if fmt.Sprint(peerRcv.received()) != "[ChannelProposed ChannelOpened]" {
+		t.Fatal("peer webhooks incorrect")
+	}
+	ds, err = p2.CallerAPI.ViewDeliveries()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(ds) != 0 {
+		t.Fatal("delivered webhooks should leave the outbox", ds)
+	}
+
+	judgeHooks := &judgeLogic.Webhooks{DB: j.CallerAPI.DB, Signer: j.CallerAPI.Keystore}
+	judgeHooks.Deliver(time.Now())
+	if fmt.Sprint(judgeRcv.received()) != "[ChannelProposed]" {
+		t.Fatal("judge webhooks incorrect")
+	}
+
+	err = p1.CallerAPI.CloseChannel("channel1")
+	if err != nil {
+		t.Fatal(err)
+	}
+	scheduler := &judgeLogic.Scheduler{DB: j.CallerAPI.DB, Signer: j.CallerAPI.Keystore}
+	for chId, err := range scheduler.FinalizeChannels() {
+		t.Fatal(chId, err)
+	}
+
+	judgeHooks.Deliver(time.Now())
+	if fmt.Sprint(judgeRcv.received()) != "[HoldPeriodStarted ChannelClosed]" {
+		t.Fatal("judge webhooks incorrect")
+	}
+}
+
+// downCounterpartyClient fails every send while Down is set, as if the network
+// were down, and passes them on to Client otherwise.
+type downCounterpartyClient struct {
+	Client peerLogic.CounterpartyClient
+	Down   bool
+}
+
+var errNetworkDown = errors.New("network down")
+
+func (c *downCounterpartyClient) AddChannel(ev *wire.Envelope, address string) error {
+	if c.Down {
+		return errNetworkDown
+	}
+	return c.Client.AddChannel(ev, address)
+}
+
+func (c *downCounterpartyClient) AddProposedUpdateTx(ev *wire.Envelope, address string) error {
+	if c.Down {
+		return errNetworkDown
+	}
+	return c.Client.AddProposedUpdateTx(ev, address)
+}
+
+func (c *downCounterpartyClient) AddFullUpdateTx(ev *wire.Envelope, address string) error {
+	if c.Down {
+		return errNetworkDown
+	}
+	return c.Client.AddFullUpdateTx(ev, address)
+}
+
+func (c *downCounterpartyClient) AddChannelRejectionTx(ev *wire.Envelope, address string) error {
+	if c.Down {
+		return errNetworkDown
+	}
+	return c.Client.AddChannelRejectionTx(ev, address)
+}
+
+func (c *downCounterpartyClient) AddUpdateRejectionTx(ev *wire.Envelope, address string) error {
+	if c.Down {
+		return errNetworkDown
+	}
+	return c.Client.AddUpdateRejectionTx(ev, address)
+}
+
+func TestOutbox(t *testing.T) {
+	p1, p2, j, acct1Pubkey, acct2Pubkey, teardown := setUp(t)
+	defer teardown()
+
+	openChannel(t, p1, p2, j, acct1Pubkey, acct2Pubkey, "channel1", 23)
+
+	c1 := &downCounterpartyClient{Client: p1.CallerAPI.CounterpartyClient, Down: true}
+	p1.CallerAPI.CounterpartyClient = c1
+
+	// The updates are saved even though they cannot be sent, and the
+	// second waits behind the first.
+	err := p1.CallerAPI.NewUpdateTx([]byte{4, 30}, "channel1", false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = p1.CallerAPI.NewUpdateTx([]byte{4, 40}, "channel1", false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if getChannel(t, p1, "channel1").MyProposedUpdateTx.SequenceNumber != 2 {
+		t.Fatal("proposed update tx should be saved")
+	}
+	if getChannel(t, p2, "channel1").TheirProposedUpdateTx != nil {
+		t.Fatal("update tx should not have been sent")
+	}
+
+	ms, err := p1.CallerAPI.ViewMessages("channel1")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(ms) != 2 || ms[0].Kind != peerCore.AddProposedUpdateTx || ms[0].Attempts != 1 || ms[0].LastError != "network down" || ms[1].Attempts != 0 {
+		t.Fatal("messages incorrect", ms)
+	}
+
+	// Nothing is sent again before the backoff is over.
+	c1.Down = false
+	if len(p1.CallerAPI.SendMessages(time.Now(), "")) != 0 || getChannel(t, p2, "channel1").TheirProposedUpdateTx != nil {
+		t.Fatal("message should not be sent before its backoff")
+	}
+
+	outbox := &peerLogic.Outbox{Caller: p1.CallerAPI, Interval: time.Millisecond}
+	stop := make(chan struct{})
+	done := make(chan struct{})
+	go func() {
+		outbox.Run(stop)
+		close(done)
+	}()
+	deadline := time.Now().Add(5 * time.Second)
+	for {
+		ms, err = p1.CallerAPI.ViewMessages("channel1")
+		if err != nil {
+			t.Fatal(err)
+		}
+		if len(ms) == 0 {
+			break
+		}
+		if time.Now().After(deadline) {
+			t.Fatal("messages were not sent", ms)
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+	close(stop)
+	<-done
+
+	ch2 := getChannel(t, p2, "channel1")
+	if ch2.TheirProposedUpdateTx == nil || ch2.TheirProposedUpdateTx.SequenceNumber != 2 {
+		t.Fatal("update txs should have been sent in order", ch2.TheirProposedUpdateTx)
+	}
+
+	// Cosigning keeps the full update tx even if it cannot be sent.
+	c2 := &downCounterpartyClient{Client: p2.CallerAPI.CounterpartyClient, Down: true}
+	p2.CallerAPI.CounterpartyClient = c2
+
+	err = p2.CallerAPI.CosignProposedUpdateTx("channel1")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if getChannel(t, p2, "channel1").LastFullUpdateTx.SequenceNumber != 2 {
+		t.Fatal("cosigned update tx should be saved")
+	}
+	if getChannel(t, p1, "channel1").LastFullUpdateTx != nil {
+		t.Fatal("cosigned update tx should not have been sent")
+	}
+
+	c2.Down = false
+	failed := p2.CallerAPI.SendMessages(time.Now().Add(peerCore.MaxMessageBackoff), "channel1")
+	if len(failed) != 0 {
+		t.Fatal(failed)
+	}
+	if getChannel(t, p1, "channel1").LastFullUpdateTx.SequenceNumber != 2 {
+		t.Fatal("cosigned update tx should have been sent")
+	}
+}
+
+func TestOutboxRejected(t *testing.T) {
+	p1, p2, j, acct1Pubkey, acct2Pubkey, teardown := setUp(t)
+	defer teardown()
+
+	openChannel(t, p1, p2, j, acct1Pubkey, acct2Pubkey, "channel1", 23)
+
+	// p1 sends to p2 over HTTP, so that p2's refusal is a 4xx response.
+	mux := http.NewServeMux()
+	(&peerServers.CounterpartyHTTP{Logic: p2.CounterpartyAPI}).MountRoutes(mux)
+	server := httptest.NewServer(mux)
+	defer server.Close()
+
+	p1.CallerAPI.CounterpartyClient = &peerClients.CounterpartyHTTP{}
+	acct, err := p1.CallerAPI.ViewAccount(acct1Pubkey)
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = p1.CallerAPI.AddCounterparty("acct2", acct.Judge.Pubkey, acct2Pubkey, server.URL)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// A message the counterparty will never accept, queued ahead of an
+	// update.
+	err = p1.CallerAPI.DB.Update(func(tx *bolt.Tx) error {
+		return peerAccess.AddMessage(tx, &peerCore.Message{
+			ChannelId:   "channel1",
+			Kind:        peerCore.AddProposedUpdateTx,
+			Envelope:    &wire.Envelope{Payload: []byte("not an update tx")},
+			Address:     server.URL,
+			NextAttempt: time.Now(),
+		})
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	err = p1.CallerAPI.NewUpdateTx([]byte{4, 30}, "channel1", false)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	ch2 := getChannel(t, p2, "channel1")
+	if ch2.TheirProposedUpdateTx == nil || ch2.TheirProposedUpdateTx.SequenceNumber != 1 {
+		t.Fatal("rejected message should not hold back the update tx", ch2.TheirProposedUpdateTx)
+	}
+
+	ms, err := p1.CallerAPI.ViewMessages("channel1")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(ms) != 1 || !ms[0].Dead || ms[0].Attempts != 1 {
+		t.Fatal("rejected message should be dead", ms)
+	}
+}
+
+// signUpdateTx makes an UpdateTx with the given SequenceNumber and state,
+// signed by both peers.
+func signUpdateTx(t *testing.T, p1 *Peer, p2 *Peer, chId string, seq uint32, state []byte) *wire.Envelope {
+	ch1 := getChannel(t, p1, chId)
+	utx := ch1.NewUpdateTx(state, false)
+	utx.SequenceNumber = seq
+	ev, err := peerCore.SerializeUpdateTx(utx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = ch1.SignProposedUpdateTx(ev, utx)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	ch2 := getChannel(t, p2, chId)
+	ev.Signatures[ch2.Me], err = ch2.Account.Sign(ev.Payload)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return ev
+}
+
+func TestReplay(t *testing.T) {
+	p1, p2, j, acct1Pubkey, acct2Pubkey, teardown := setUp(t)
+	defer teardown()
+
+	openChannel(t, p1, p2, j, acct1Pubkey, acct2Pubkey, "channel1", 23)
+
+	otxEv := getChannel(t, p2, "channel1").OpeningTxEnvelope
+	err := p2.CounterpartyAPI.AddChannel(otxEv)
+	if err != nil {
+		t.Fatal("resending an opening tx should succeed", err)
+	}
+	err = j.PeerAPI.AddChannel(otxEv)
+	if err != nil {
+		t.Fatal("resending an opening tx to the judge should succeed", err)
+	}
+
+	err = p1.CallerAPI.NewUpdateTx([]byte{4, 30}, "channel1", false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	proposed := getChannel(t, p1, "channel1").MyProposedUpdateTxEnvelope
+	err = p2.CounterpartyAPI.AddProposedUpdateTx(proposed)
+	if err != nil {
+		t.Fatal("resending a proposed update tx should succeed", err)
+	}
+
+	err = p2.CallerAPI.CosignProposedUpdateTx("channel1")
+	if err != nil {
+		t.Fatal(err)
+	}
+	full := getChannel(t, p1, "channel1").LastFullUpdateTxEnvelope
+
+	err = p1.CallerAPI.NewUpdateTx([]byte{4, 40}, "channel1", false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = p2.CallerAPI.CosignProposedUpdateTx("channel1")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// Envelopes that have been superseded since they were accepted are
+	// still accepted again.
+	err = p2.CounterpartyAPI.AddProposedUpdateTx(proposed)
+	if err != nil {
+		t.Fatal("resending a superseded proposed update tx should succeed", err)
+	}
+	err = p1.CounterpartyAPI.AddFullUpdateTx(full)
+	if err != nil {
+		t.Fatal("resending a superseded full update tx should succeed", err)
+	}
+	for _, p := range []*Peer{p1, p2} {
+		if getChannel(t, p, "channel1").LastFullUpdateTx.SequenceNumber != 2 {
+			t.Fatal("resent update tx should not replace a newer one")
+		}
+	}
+
+	for i := 0; i < 2; i++ {
+		err = j.PeerAPI.AddFullUpdateTx(full)
+		if err != nil {
+			t.Fatal("resending a full update tx to the judge should succeed", err)
+		}
+	}
+
+	// A different update tx with a sequence number that has already been
+	// signed is evidence of equivocation.
+	conflict := signUpdateTx(t, p1, p2, "channel1", 2, []byte{9})
+	err = p1.CounterpartyAPI.AddFullUpdateTx(conflict)
+	if !errors.Is(err, peerCore.ErrEquivocation) {
+		t.Fatal("conflicting update tx should be ErrEquivocation", err)
+	}
+	if getChannel(t, p1, "channel1").LastFullUpdateTx.State[1] != 40 {
+		t.Fatal("conflicting update tx should not replace the one held")
+	}
+
+	eqs, err := p1.CallerAPI.ViewEquivocations("channel1")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(eqs) != 1 || eqs[0].SequenceNumber != 2 || !bytes.Equal(eqs[0].Conflicting.Payload, conflict.Payload) {
+		t.Fatal("equivocation not recorded", eqs)
+	}
+
+	evs, err := p1.CallerAPI.ViewEvents(0, 100)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if evs[len(evs)-1].Type != peerCore.EquivocationDetected {
+		t.Fatal("equivocation event not saved", evs[len(evs)-1])
+	}
+
+	conflict = signUpdateTx(t, p1, p2, "channel1", 1, []byte{9})
+	err = j.PeerAPI.AddFullUpdateTx(conflict)
+	if !errors.Is(err, judgeCore.ErrEquivocation) {
+		t.Fatal("conflicting update tx should be ErrEquivocation", err)
+	}
+
+	jeqs, err := j.CallerAPI.ViewEquivocations("channel1")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(jeqs) != 1 || jeqs[0].SequenceNumber != 1 || !bytes.Equal(jeqs[0].Held.Payload, full.Payload) {
+		t.Fatal("equivocation not recorded", jeqs)
+	}
+}
+
+func TestCounterpartyHTTP(t *testing.T) {
+	p1, p2, j, acct1Pubkey, acct2Pubkey, teardown := setUp(t)
+	defer teardown()
+
+	servers := []*httptest.Server{}
+	for _, p := range []*Peer{p1, p2} {
+		mux := http.NewServeMux()
+		(&peerServers.CounterpartyHTTP{Logic: p.CounterpartyAPI}).MountRoutes(mux)
+		server := httptest.NewServer(mux)
+		defer server.Close()
+		servers = append(servers, server)
+
+		p.CallerAPI.CounterpartyClient = &peerClients.CounterpartyHTTP{}
+	}
+
+	acct, err := p1.CallerAPI.ViewAccount(acct1Pubkey)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// Point each peer's counterparty at the other peer's server.
+	err = p1.CallerAPI.AddCounterparty("acct2", acct.Judge.Pubkey, acct2Pubkey, servers[1].URL)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	err = p2.CallerAPI.AddCounterparty("acct1", acct.Judge.Pubkey, acct1Pubkey, servers[0].URL)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	_, err = p1.CallerAPI.ProposeChannel("rejected", []byte{20}, acct1Pubkey, [][]byte{acct2Pubkey}, 23)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	err = p2.CallerAPI.RejectChannel("rejected")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	_, err = p1.CallerAPI.ViewChannel("rejected")
+	if _, ok := err.(*peerAccess.NilError); !ok {
+		t.Fatal("rejected channel was not deleted", err)
+	}
+
+	openChannel(t, p1, p2, j, acct1Pubkey, acct2Pubkey, "channel1", 23)
+
+	err = p1.CallerAPI.NewUpdateTx([]byte{4, 30}, "channel1", false)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	err = p2.CallerAPI.RejectUpdateTx("channel1")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if getChannel(t, p1, "channel1").MyProposedUpdateTx != nil {
+		t.Fatal("MyProposedUpdateTx was not cleared")
+	}
+
+	err = p1.CallerAPI.NewUpdateTx([]byte{4, 40}, "channel1", false)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	err = p2.CallerAPI.CosignProposedUpdateTx("channel1")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for _, p := range []*Peer{p1, p2} {
+		if !bytes.Equal(getChannel(t, p, "channel1").LastFullUpdateTx.State, []byte{4, 40}) {
+			t.Fatal("cosigned update tx was not sent back")
+		}
+	}
+
+	err = p2.CallerAPI.NewUpdateTx([]byte{4, 50}, "channel1", true)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	err = p1.CallerAPI.CosignProposedUpdateTx("channel1")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for _, p := range []*Peer{p1, p2} {
+		if !bytes.Equal(getChannel(t, p, "channel1").LastFullUpdateTx.State, []byte{4, 50}) {
+			t.Fatal("cosigned fast update tx was not sent back")
+		}
+	}
+
+	// A counterparty that rejects an envelope returns an error to the sender.
+	err = (&peerClients.CounterpartyHTTP{}).AddFullUpdateTx(&wire.Envelope{}, servers[1].URL)
+	if err == nil {
+		t.Fatal("invalid envelope should be rejected")
+	}
+}
+
+func TestJudgeHTTP(t *testing.T) {
+	p1, p2, j, acct1Pubkey, acct2Pubkey, teardown := setUp(t)
+	defer teardown()
+
+	mux := http.NewServeMux()
+	(&judgeServers.PeerHTTP{Logic: j.PeerAPI}).MountRoutes(mux)
+	server := httptest.NewServer(mux)
+	defer server.Close()
+
+	acct, err := p1.CallerAPI.ViewAccount(acct1Pubkey)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// Point both peers at the judge's server.
+	for _, p := range []*Peer{p1, p2} {
+		err = p.CallerAPI.AddJudge(acct.Judge.Name, acct.Judge.Pubkey, server.URL)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		p.CallerAPI.JudgeClient = &peerClients.JudgeHTTP{}
+	}
+
+	openChannel(t, p1, p2, j, acct1Pubkey, acct2Pubkey, "channel1", time.Hour)
+
+	for _, p := range []*Peer{p1, p2} {
+		if getChannel(t, p, "channel1").Phase != peerCore.OPEN {
+			t.Fatal("channel should be OPEN")
+		}
+	}
+
+	err = p1.CallerAPI.NewUpdateTx([]byte{4, 30}, "channel1", true)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	err = p2.CallerAPI.CosignProposedUpdateTx("channel1")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	ch := getChannel(t, p1, "channel1")
+	ev, err := peerCore.SerializeFollowOnTx(ch.NewFollowOnTx([]byte{9}))
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = ch.Account.AppendSignature(ev)
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = (&peerClients.JudgeHTTP{}).AddFollowOnTx(ev, server.URL)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	err = p1.CallerAPI.CloseChannel("channel1")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	ev, err = (&peerClients.JudgeHTTP{}).GetLastFullUpdateTx("channel1", server.URL)
+	if err != nil {
+		t.Fatal(err)
+	}
+	utx := &wire.UpdateTx{}
+	err = proto.Unmarshal(ev.Payload, utx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if utx.SequenceNumber != 1 {
+		t.Fatal("last full update tx should have sequence number 1")
+	}
+
+	jch, err := j.PeerAPI.GetChannel("channel1")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if jch.Phase != judgeCore.CLOSED || len(jch.FollowOnTxs) != 1 {
+		t.Fatal("channel should be closed with a follow on tx")
+	}
+
+	err = p2.CallerAPI.CheckChannel("channel1")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	ch = getChannel(t, p2, "channel1")
+	if ch.Phase != peerCore.CLOSED || ch.FinalUpdateTx.SequenceNumber != 1 {
+		t.Fatal("channel should be CLOSED with sequence number 1")
+	}
+
+	// The judge's error is returned to the peer.
+	err = (&peerClients.JudgeHTTP{}).AddChannel(&wire.Envelope{}, server.URL)
+	if err == nil {
+		t.Fatal("invalid envelope should be rejected")
+	}
+
+	_, err = (&peerClients.JudgeHTTP{}).GetChannel("nonexistent", server.URL)
+	if err == nil {
+		t.Fatal("nonexistent channel should be an error")
+	}
+}
+
+// grpcServer serves s on a free local port, and returns its address.
+func grpcServer(t *testing.T, s *grpc.Server) string {
+	lis, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	go s.Serve(lis)
+	return lis.Addr().String()
+}
+
+func TestGRPC(t *testing.T) {
+	p1, p2, j, acct1Pubkey, acct2Pubkey, teardown := setUp(t)
+	defer teardown()
+
+	judgeServer := grpc.NewServer()
+	(&judgeServers.PeerGRPC{Logic: j.PeerAPI}).Register(judgeServer)
+	judgeAddress := grpcServer(t, judgeServer)
+	defer judgeServer.Stop()
+
+	addresses := []string{}
+	for _, p := range []*Peer{p1, p2} {
+		s := grpc.NewServer()
+		(&peerServers.CounterpartyGRPC{Logic: p.CounterpartyAPI}).Register(s)
+		addresses = append(addresses, grpcServer(t, s))
+		defer s.Stop()
+
+		cptClient, judgeClient, err := peerClients.New(peerClients.GRPC)
+		if err != nil {
+			t.Fatal(err)
+		}
+		p.CallerAPI.CounterpartyClient = cptClient
+		p.CallerAPI.JudgeClient = judgeClient
+	}
+
+	acct, err := p1.CallerAPI.ViewAccount(acct1Pubkey)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for _, p := range []*Peer{p1, p2} {
+		err = p.CallerAPI.AddJudge(acct.Judge.Name, acct.Judge.Pubkey, judgeAddress)
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	err = p1.CallerAPI.AddCounterparty("acct2", acct.Judge.Pubkey, acct2Pubkey, addresses[1])
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	err = p2.CallerAPI.AddCounterparty("acct1", acct.Judge.Pubkey, acct1Pubkey, addresses[0])
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	openChannel(t, p1, p2, j, acct1Pubkey, acct2Pubkey, "channel1", time.Hour)
+
+	err = p1.CallerAPI.NewUpdateTx([]byte{4, 30}, "channel1", false)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	err = p2.CallerAPI.RejectUpdateTx("channel1")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if getChannel(t, p1, "channel1").MyProposedUpdateTx != nil {
+		t.Fatal("MyProposedUpdateTx was not cleared")
+	}
+
+	err = p1.CallerAPI.NewUpdateTx([]byte{4, 40}, "channel1", true)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	err = p2.CallerAPI.CosignProposedUpdateTx("channel1")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for _, p := range []*Peer{p1, p2} {
+		if !bytes.Equal(getChannel(t, p, "channel1").LastFullUpdateTx.State, []byte{4, 40}) {
+			t.Fatal("cosigned update tx was not sent back")
+		}
+	}
+
+	err = p1.CallerAPI.CloseChannel("channel1")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	jch, err := j.PeerAPI.GetChannel("channel1")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if jch.Phase != judgeCore.CLOSED {
+		t.Fatal("channel should be CLOSED")
+	}
+
+	err = p2.CallerAPI.CheckChannel("channel1")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	ch := getChannel(t, p2, "channel1")
+	if ch.Phase != peerCore.CLOSED || ch.FinalUpdateTx.SequenceNumber != 1 {
+		t.Fatal("channel should be CLOSED with sequence number 1")
+	}
+
+	// Errors on the other side are returned as Upstream errors.
+	err = p1.CallerAPI.JudgeClient.AddChannel(&wire.Envelope{}, judgeAddress)
+	if errs.CodeOf(err) != errs.Upstream {
+		t.Fatal("invalid envelope should be an upstream error", err)
+	}
+
+	_, err = p1.CallerAPI.JudgeClient.GetChannel("nonexistent", judgeAddress)
+	if errs.CodeOf(err) != errs.Upstream {
+		t.Fatal("nonexistent channel should be an upstream error", err)
+	}
+
+	err = p1.CallerAPI.CounterpartyClient.AddFullUpdateTx(&wire.Envelope{}, addresses[1])
+	if errs.CodeOf(err) != errs.Upstream {
+		t.Fatal("invalid envelope should be an upstream error", err)
+	}
+}
+
+func TestJudgeCallerHTTP(t *testing.T) {
+	p1, p2, j, acct1Pubkey, acct2Pubkey, teardown := setUp(t)
+	defer teardown()
+
+	mux := http.NewServeMux()
+	(&judgeServers.CallerHTTP{Logic: j.CallerAPI}).MountRoutes(mux)
+	server := httptest.NewServer(mux)
+	defer server.Close()
+
+	get := func(route string, resp interface{}) int {
+		res, err := http.Get(server.URL + route)
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer res.Body.Close()
+
+		if res.StatusCode == 200 {
+			err = json.NewDecoder(res.Body).Decode(resp)
+			if err != nil {
+				t.Fatal(err)
+			}
+		}
+		return res.StatusCode
+	}
+
+	jd := &judgeServers.Judge{}
+	post(t, server, "/new_judge", &judgeServers.NewJudgeRequest{Name: "jd2"}, jd)
+	if jd.Name != "jd2" {
+		t.Fatal("new judge incorrect", jd)
+	}
+
+	acct := &judgeServers.Account{}
+	post(t, server, "/add_account", &judgeServers.AddAccountRequest{
+		Name:        "acct3",
+		JudgePubkey: jd.Pubkey,
+		Pubkey:      base64.URLEncoding.EncodeToString([]byte{3}),
+		Address:     "3.com",
+	}, acct)
+	if acct.Name != "acct3" || acct.Judge.Pubkey != jd.Pubkey {
+		t.Fatal("added account incorrect", acct)
+	}
+
+	jds := []*judgeServers.Judge{}
+	get("/judges", &jds)
+	if len(jds) != 2 {
+		t.Fatal("there should be 2 judges", jds)
+	}
+
+	accts := []*judgeServers.Account{}
+	get("/accounts", &accts)
+	if len(accts) != 3 {
+		t.Fatal("there should be 3 accounts", accts)
+	}
+
+	_, err := p1.CallerAPI.ProposeChannel("channel1", []byte{20}, acct1Pubkey, [][]byte{acct2Pubkey}, 23)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	err = p2.CallerAPI.AcceptChannel("channel1")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	chs := []*judgeServers.Channel{}
+	get("/review_queue", &chs)
+	if len(chs) != 1 || chs[0].Phase != "PENDING_OPEN" {
+		t.Fatal("PENDING_OPEN channel should be in the review queue", chs)
+	}
+
+	ch := &judgeServers.Channel{}
+	post(t, server, "/confirm_channel", &judgeServers.ChannelRequest{ChannelId: "channel1"}, ch)
+	if ch.Phase != "OPEN" {
+		t.Fatal("confirmed channel should be OPEN", ch.Phase)
+	}
+
+	get("/review_queue", &chs)
+	if len(chs) != 0 {
+		t.Fatal("review queue should be empty", chs)
+	}
+
+	get("/channels?phase=PENDING_OPEN", &chs)
+	if len(chs) != 0 {
+		t.Fatal("there should be no PENDING_OPEN channels", chs)
+	}
+
+	get("/channels?phase=OPEN", &chs)
+	if len(chs) != 1 || len(chs[0].Accounts) != 2 {
+		t.Fatal("there should be 1 OPEN channel", chs)
+	}
+
+	if get("/channels?phase=OPENISH", &chs) != 400 {
+		t.Fatal("unknown phase should be 400")
+	}
+
+	if get("/channels_by_id/channel2", ch) != 404 {
+		t.Fatal("unknown channel should be 404")
+	}
+
+	for _, p := range []*Peer{p1, p2} {
+		err = p.CallerAPI.CheckChannel("channel1")
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	err = p1.CallerAPI.NewUpdateTx([]byte{4, 30}, "channel1", false)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	err = p2.CallerAPI.CosignProposedUpdateTx("channel1")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	err = p1.CallerAPI.CloseChannel("channel1")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	get("/review_queue", &chs)
+	if len(chs) != 1 || !chs[0].HoldPeriodOver || chs[0].CloseTime == nil {
+		t.Fatal("channel past its hold period should be in the review queue", chs)
+	}
+
+	post(t, server, "/close_channel", &judgeServers.CloseChannelRequest{ChannelId: "channel1"}, ch)
+	if ch.Phase != "CLOSED" || ch.FinalUpdateTx.SequenceNumber != 1 {
+		t.Fatal("channel should be CLOSED with sequence number 1", ch)
+	}
+}
+
+// postErr posts req as JSON to the server, and returns the status and the
+// error response.
+func postErr(t *testing.T, server *httptest.Server, route string, body string) (int, *errs.Response) {
+	res, err := http.Post(server.URL+route, "application/json", bytes.NewReader([]byte(body)))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer res.Body.Close()
+
+	resp := &errs.Response{}
+	err = json.NewDecoder(res.Body).Decode(resp)
+	if err != nil {
+		t.Fatal(route, err)
+	}
+	return res.StatusCode, resp
+}
+
+func TestHTTPErrors(t *testing.T) {
+	p1, p2, j, acct1Pubkey, acct2Pubkey, teardown := setUp(t)
+	defer teardown()
+
+	mux := http.NewServeMux()
+	(&peerServers.CallerHTTP{Logic: p2.CallerAPI}).MountRoutes(mux)
+	server := httptest.NewServer(mux)
+	defer server.Close()
+
+	_, err := p1.CallerAPI.ProposeChannel("channel1", []byte{20}, acct1Pubkey, [][]byte{acct2Pubkey}, 23)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	cases := []struct {
+		route  string
+		body   string
+		status int
+		code   errs.Code
+	}{
+		{"/accept_channel", `{"channelId": `, 400, errs.Invalid},
+		{"/accept_channel", `{"channelId": "channel2"}`, 404, errs.NotFound},
+		{"/propose_update_tx", `{"channelId": "channel1", "state": "a"}`, 409, errs.WrongPhase},
+		{"/reveal_preimage", `{"channelId": "channel1", "preimage": "!"}`, 400, errs.Invalid},
+		{"/unlock", `{"passphrase": "wrong"}`, 401, errs.BadPassphrase},
+	}
+	for _, c := range cases {
+		status, resp := postErr(t, server, c.route, c.body)
+		if status != c.status || resp.Code != c.code || resp.Error == "" {
+			t.Fatal(c.route, c.body, status, resp)
+		}
+	}
+
+	openChannel(t, p1, p2, j, acct1Pubkey, acct2Pubkey, "channel2", 23)
+
+	status, resp := postErr(t, server, "/accept_update_tx", `{"channelId": "channel2"}`)
+	if status != 404 || resp.Code != errs.NotFound {
+		t.Fatal("accepting a missing update tx should be not_found", status, resp)
+	}
+
+	status, resp = postErr(t, server, "/propose_update_tx", `{"channelId": "channel2", "state": "a", "expiry": "2001-01-01T00:00:00Z"}`)
+	if status != 400 || resp.Code != errs.Invalid {
+		t.Fatal("proposing an update tx which has already expired should be invalid", status, resp)
+	}
+
+	expiry := time.Now().Add(time.Hour).UTC()
+	post(t, server, "/propose_update_tx", &peerServers.ProposeUpdateTxRequest{
+		ChannelId: "channel2",
+		State:     "a",
+		HashLocks: []*peerServers.HashLock{{
+			Hash:  base64.URLEncoding.EncodeToString(make([]byte, 32)),
+			State: "b",
+		}},
+		Expiry: &expiry,
+	}, &peerServers.Channel{})
+	mine := getChannel(t, p2, "channel2").MyProposedUpdateTx
+	if len(mine.HashLocks) != 1 || mine.Expiry != expiry.UnixNano() {
+		t.Fatal("proposed update tx should have both hash locks and an expiry", mine)
+	}
+
+	p2.CallerAPI.Lock()
+	status, resp = postErr(t, server, "/propose_update_tx", `{"channelId": "channel2", "state": "a"}`)
+	if status != 503 || resp.Code != errs.Locked {
+		t.Fatal("proposing with a locked keystore should be locked", status, resp)
+	}
+
+	ch := getChannel(t, p1, "channel2")
+	utx := ch.NewUpdateTx([]byte{1}, false)
+	utx.SequenceNumber = 0
+	ev, err := peerCore.SerializeUpdateTx(utx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = ch.SignProposedUpdateTx(ev, utx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = p2.CounterpartyAPI.AddProposedUpdateTx(ev)
+	if !errors.Is(err, peerCore.ErrSeqTooLow) {
+		t.Fatal("update tx with an old sequence number should be ErrSeqTooLow", err)
+	}
+}